@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"codemap/render"
 	"codemap/scanner"
 	"codemap/watch"
 )
@@ -23,9 +25,18 @@ type hubInfo struct {
 	Imports   map[string][]string
 }
 
-// getHubInfo returns hub info from daemon state (fast) or fresh scan (slow)
+// getHubInfo returns hub info from the daemon (fast) or fresh scan (slow)
 func getHubInfo(root string) *hubInfo {
-	// Try daemon state first (instant)
+	// Ask the running daemon first (instant)
+	if g, err := watch.NewClient(root).Graph(); err == nil {
+		return &hubInfo{
+			Hubs:      g.Hubs,
+			Importers: g.Importers,
+			Imports:   g.Imports,
+		}
+	}
+
+	// Then its last state snapshot
 	if state := watch.ReadState(root); state != nil {
 		return &hubInfo{
 			Hubs:      state.Hubs,
@@ -35,7 +46,7 @@ func getHubInfo(root string) *hubInfo {
 	}
 
 	// Fall back to fresh scan (slower)
-	fg, err := scanner.BuildFileGraph(root)
+	fg, err := scanner.BuildFileGraph(context.Background(), root)
 	if err != nil {
 		return nil
 	}
@@ -47,8 +58,39 @@ func getHubInfo(root string) *hubInfo {
 	}
 }
 
-// RunHook executes the named hook with the given project root
+// currentSession returns the running daemon's session, from its query API
+// or else its saved session file
+func currentSession(root string) *watch.Session {
+	if s, err := watch.NewClient(root).Session(); err == nil {
+		return s
+	}
+	if sessions, err := watch.ListSessions(root); err == nil && len(sessions) > 0 && sessions[0].Active {
+		return &sessions[0]
+	}
+	return nil
+}
+
+// lastSession returns the most recent finished session with edits
+func lastSession(root string) *watch.Session {
+	sessions, err := watch.ListSessions(root)
+	if err != nil {
+		return nil
+	}
+	for i := range sessions {
+		if !sessions[i].Active && sessions[i].Events > 0 {
+			return &sessions[i]
+		}
+	}
+	return nil
+}
+
+// RunHook executes the named hook with the given project root. A root
+// inside a watched project (a subdirectory of it) is resolved to that
+// project.
 func RunHook(hookName, root string) error {
+	if watched, ok := watch.WatchedRoot(root); ok {
+		root = watched
+	}
 	switch hookName {
 	case "session-start":
 		return hookSessionStart(root)
@@ -70,7 +112,7 @@ func RunHook(hookName, root string) error {
 // hookSessionStart shows project structure, starts daemon, and shows hub warnings
 func hookSessionStart(root string) error {
 	// Check for previous session context before starting new daemon
-	lastSessionEvents := getLastSessionEvents(root)
+	previous := lastSession(root)
 
 	// Start the watch daemon in background (if not already running)
 	if !watch.IsRunning(root) {
@@ -80,13 +122,8 @@ func hookSessionStart(root string) error {
 	fmt.Println("📍 Project Context:")
 	fmt.Println()
 
-	// Run codemap to show full tree structure
-	exe, err := os.Executable()
-	if err == nil {
-		cmd := exec.Command(exe, root)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Run()
+	// Show full tree structure as plain text
+	if err := renderTree(os.Stdout, root, ""); err == nil {
 		fmt.Println()
 	}
 
@@ -108,8 +145,8 @@ func hookSessionStart(root string) error {
 	showDiffVsMain(root)
 
 	// Show last session context if resuming work
-	if len(lastSessionEvents) > 0 {
-		showLastSessionContext(lastSessionEvents)
+	if previous != nil {
+		showLastSessionContext(previous)
 	}
 
 	return nil
@@ -129,72 +166,80 @@ func showDiffVsMain(root string) {
 		return // No diff to show on main branch
 	}
 
-	// Run codemap --diff to show changes
-	exe, err := os.Executable()
-	if err != nil {
-		return
-	}
-
 	fmt.Println()
 	fmt.Printf("📝 Changes on branch '%s' vs main:\n", branch)
-	cmd := exec.Command(exe, "--diff", root)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Run()
+	if err := renderTree(os.Stdout, root, "main"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting git diff: %v\n", err)
+	}
 }
 
-// getLastSessionEvents reads events.log for previous session context
-func getLastSessionEvents(root string) []string {
-	eventsFile := filepath.Join(root, ".codemap", "events.log")
-	data, err := os.ReadFile(eventsFile)
+// renderTree writes the project tree without ANSI colors.
+// With a diffRef, only files changed vs that ref are shown, plus their impact.
+func renderTree(w io.Writer, root, diffRef string) error {
+	absRoot, err := filepath.Abs(root)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	lines := strings.Split(string(data), "\n")
-	if len(lines) == 0 {
-		return nil
+	var diffInfo *scanner.DiffInfo
+	if diffRef != "" {
+		diffInfo, err = scanner.GitDiffInfo(absRoot, diffRef)
+		if err != nil {
+			return err
+		}
+		if len(diffInfo.Changed) == 0 {
+			fmt.Fprintf(w, "No files changed vs %s\n", diffRef)
+			return nil
+		}
 	}
 
-	// Get last 20 non-empty lines
-	var recent []string
-	for i := len(lines) - 1; i >= 0 && len(recent) < 20; i-- {
-		if strings.TrimSpace(lines[i]) != "" {
-			recent = append([]string{lines[i]}, recent...)
-		}
+	files, err := scanner.ScanFiles(context.Background(), absRoot, scanner.NewGitIgnoreCache(absRoot), nil, nil)
+	if err != nil {
+		return err
 	}
-	return recent
-}
 
-// showLastSessionContext displays what was worked on in previous session
-func showLastSessionContext(events []string) {
-	// Extract unique files from events
-	files := make(map[string]string) // file -> last operation
-	for _, line := range events {
-		parts := strings.Split(line, "|")
-		if len(parts) >= 3 {
-			op := strings.TrimSpace(parts[1])
-			file := strings.TrimSpace(parts[2])
-			if file != "" && op != "" {
-				files[file] = op
-			}
-		}
+	project := scanner.Project{Root: absRoot, Mode: "tree", Files: files}
+	if diffInfo != nil {
+		project.Files = scanner.FilterToChangedWithInfo(files, diffInfo)
+		project.Impact = scanner.AnalyzeImpact(context.Background(), absRoot, project.Files)
+		project.DiffRef = diffRef
 	}
+	return render.Tree(project, render.Options{Writer: w})
+}
 
-	if len(files) == 0 {
+// showLastSessionContext displays what was worked on in previous session
+func showLastSessionContext(session *watch.Session) {
+	if len(session.Files) == 0 {
 		return
 	}
 
 	fmt.Println()
-	fmt.Println("🕐 Last session worked on:")
-	count := 0
-	for file, op := range files {
-		if count >= 5 {
-			fmt.Printf("   ... and %d more files\n", len(files)-5)
+	when := session.Start.Format("Jan 2 15:04")
+	if session.Branch != "" {
+		when += " on " + session.Branch
+	}
+	duration := "under a minute"
+	if d := session.Duration(); d >= time.Minute {
+		duration = d.Round(time.Minute).String()
+	}
+	fmt.Printf("🕐 Last session (%s, %s) worked on:\n", when, duration)
+	for i, f := range session.Files {
+		if i >= 5 {
+			fmt.Printf("   ... and %d more files\n", len(session.Files)-5)
 			break
 		}
-		fmt.Printf("   • %s (%s)\n", file, strings.ToLower(op))
-		count++
+		hub := ""
+		if f.IsHub {
+			hub = " ⚠️HUB"
+		}
+		moved := ""
+		if f.MovedFrom != "" {
+			moved = ", moved from " + f.MovedFrom
+		}
+		fmt.Printf("   • %s (%d edits, %+d lines%s)%s\n", f.Path, f.Edits, f.Delta, moved, hub)
+		if len(f.Symbols) > 0 {
+			fmt.Printf("     %s\n", watch.SummarizeSymbols(f.Symbols, 3))
+		}
 	}
 }
 
@@ -294,29 +339,18 @@ func hookPromptSubmit(root string) error {
 
 // showSessionProgress shows files edited so far in this session
 func showSessionProgress(root string) {
-	state := watch.ReadState(root)
-	if state == nil || len(state.RecentEvents) == 0 {
-		return
-	}
-
-	// Count unique files and hub edits
-	filesEdited := make(map[string]bool)
-	hubEdits := 0
-	for _, e := range state.RecentEvents {
-		filesEdited[e.Path] = true
-		if e.IsHub {
-			hubEdits++
-		}
-	}
-
-	if len(filesEdited) == 0 {
+	session := currentSession(root)
+	if session == nil || len(session.Files) == 0 {
 		return
 	}
 
 	fmt.Println()
-	fmt.Printf("📊 Session so far: %d files edited", len(filesEdited))
-	if hubEdits > 0 {
-		fmt.Printf(", %d hub edits", hubEdits)
+	fmt.Printf("📊 Session so far: %d files edited", len(session.Files))
+	if session.HubEdits > 0 {
+		fmt.Printf(", %d hub edits", session.HubEdits)
+	}
+	if session.Moves > 0 {
+		fmt.Printf(", %d moved", session.Moves)
 	}
 	fmt.Println()
 }
@@ -356,8 +390,12 @@ func hookPreCompact(root string) error {
 
 // hookSessionStop summarizes what changed in the session and stops the daemon
 func hookSessionStop(root string) error {
-	// Read state BEFORE stopping daemon (includes timeline)
-	state := watch.ReadState(root)
+	// Read the session BEFORE stopping daemon, with its full timeline
+	session := currentSession(root)
+	var events []watch.Event
+	if session != nil {
+		events, _ = watch.ReadEvents(root, session.Start)
+	}
 
 	// Stop the watch daemon
 	stopDaemon(root)
@@ -367,25 +405,11 @@ func hookSessionStop(root string) error {
 	fmt.Println("==================")
 
 	// Show timeline from daemon events (if available)
-	if state != nil && len(state.RecentEvents) > 0 {
+	if session != nil && session.Events > 0 {
 		fmt.Println()
 		fmt.Println("Edit Timeline:")
 
-		// Calculate stats
-		totalDelta := 0
-		fileEdits := make(map[string]int) // file -> edit count
-		hubEdits := 0
-
-		for _, e := range state.RecentEvents {
-			totalDelta += e.Delta
-			fileEdits[e.Path]++
-			if e.IsHub {
-				hubEdits++
-			}
-		}
-
 		// Show last 10 events
-		events := state.RecentEvents
 		start := 0
 		if len(events) > 10 {
 			start = len(events) - 10
@@ -405,23 +429,36 @@ func hookSessionStop(root string) error {
 				hubStr = " ⚠️HUB"
 			}
 
-			fmt.Printf("  %s %-6s %s%s%s\n",
+			symStr := ""
+			if len(e.Symbols) > 0 {
+				symStr = " - " + watch.SummarizeSymbols(e.Symbols, 3)
+			}
+
+			fmt.Printf("  %s %-6s %s%s%s%s\n",
 				e.Time.Format("15:04:05"),
 				e.Op,
-				e.Path,
+				e.DisplayPath(),
 				deltaStr,
 				hubStr,
+				symStr,
 			)
 		}
 
 		// Show stats
 		fmt.Println()
 		fmt.Printf("Stats: %d events, %d files touched, %+d lines",
-			len(state.RecentEvents), len(fileEdits), totalDelta)
-		if hubEdits > 0 {
-			fmt.Printf(", %d hub edits", hubEdits)
+			session.Events, len(session.Files), session.Delta)
+		if session.HubEdits > 0 {
+			fmt.Printf(", %d hub edits", session.HubEdits)
+		}
+		if session.Moves > 0 {
+			fmt.Printf(", %d moves", session.Moves)
+		}
+		if session.Commits > 0 {
+			fmt.Printf(", %d commits", session.Commits)
 		}
 		fmt.Println()
+		fmt.Printf("Saved as session %s (codemap sessions show %s)\n", session.ID, session.ID)
 	} else {
 		// Fallback to git diff if no daemon events
 		gitCmd := exec.Command("git", "diff", "--name-only")
@@ -506,18 +543,24 @@ func extractFilePathFromStdin() (string, error) {
 
 // checkFileImporters checks if a file is a hub and shows its importers
 func checkFileImporters(root, filePath string) error {
-	info := getHubInfo(root)
-	if info == nil {
-		return nil // silently skip if deps unavailable
-	}
-
-	// Handle absolute paths - convert to relative
+	// Handle absolute paths - convert to relative, to the watched project
+	// the file is in if it isn't under root
 	if filepath.IsAbs(filePath) {
+		if rel, err := filepath.Rel(root, filePath); err != nil || !filepath.IsLocal(rel) {
+			if watched, ok := watch.WatchedRoot(filepath.Dir(filePath)); ok {
+				root = watched
+			}
+		}
 		if rel, err := filepath.Rel(root, filePath); err == nil {
 			filePath = rel
 		}
 	}
 
+	info := getHubInfo(root)
+	if info == nil {
+		return nil // silently skip if deps unavailable
+	}
+
 	importers := info.Importers[filePath]
 	if len(importers) >= 3 {
 		fmt.Println()
@@ -0,0 +1,190 @@
+// Package config loads per-project codemap settings from .codemap/config.json
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileName is the project config file, relative to the project root
+const FileName = ".codemap/config.json"
+
+// ErrInvalid is wrapped by the errors for a config file that can't be used
+var ErrInvalid = errors.New("invalid")
+
+// Config holds project-level codemap settings
+type Config struct {
+	Rules Rules `json:"rules"`
+	Watch Watch `json:"watch,omitzero"`
+}
+
+// Watch adjusts which files the watch daemon tracks, on top of .gitignore
+// and the languages codemap knows. Patterns work like --exclude: an
+// extension (".vue"), a path component ("generated") or a glob ("*.pb.go").
+type Watch struct {
+	Include  []string  `json:"include,omitempty"`  // extra files to track, e.g. templates
+	Exclude  []string  `json:"exclude,omitempty"`  // files and directories to skip
+	Triggers []Trigger `json:"triggers,omitempty"` // actions run on matching events
+	// MaxConcurrent caps trigger commands running at once (default 2)
+	MaxConcurrent int     `json:"max_concurrent,omitempty"`
+	History       History `json:"history,omitzero"` // local history of tracked files
+}
+
+// History bounds the snapshots the watch daemon keeps in .codemap/history
+// each time a tracked file is written
+type History struct {
+	Disabled  bool     `json:"disabled,omitempty"`
+	MaxAge    Duration `json:"max_age,omitzero"`      // drops older snapshots (default 168h)
+	MaxSizeMB int64    `json:"max_size_mb,omitempty"` // caps the compressed snapshots (default 100)
+}
+
+// Trigger runs a command or appends to a notification file when the watch
+// daemon records a matching event. Conditions left empty match any event.
+// Matching events are collected for Debounce, then handed over as JSON
+// lines: on the command's stdin, or appended to the Notify file.
+type Trigger struct {
+	Name         string   `json:"name,omitempty"`
+	Path         string   `json:"path,omitempty"`          // glob like the rules' ("api/**", "go.mod")
+	Ops          []string `json:"ops,omitempty"`           // WRITE, CREATE, REMOVE, MOVE, COMMIT, ...
+	Hub          bool     `json:"hub,omitempty"`           // only hub files
+	MinImporters int      `json:"min_importers,omitempty"` // only files imported by at least this many
+	Command      string   `json:"command,omitempty"`       // shell command, run in the project root
+	Notify       string   `json:"notify,omitempty"`        // file to append to, relative to the project root
+	Debounce     Duration `json:"debounce,omitzero"`       // quiet time before firing (default 1s)
+	Timeout      Duration `json:"timeout,omitzero"`        // kills the command after this (default 5m)
+}
+
+// ID returns the trigger name, or its command or notify file
+func (t Trigger) ID() string {
+	switch {
+	case t.Name != "":
+		return t.Name
+	case t.Command != "":
+		return t.Command
+	}
+	return t.Notify
+}
+
+// Duration is a time.Duration written as a string like "2s" or "5m"
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"2s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Rules describes architecture boundaries between parts of the project.
+// Patterns in Deny and Allow are either layer names or path globs
+// ("render", "domain/**", "*.go"). A plain path matches itself and everything under it.
+type Rules struct {
+	Layers map[string][]string `json:"layers,omitempty"` // layer name -> path globs
+	Deny   []DepRule           `json:"deny,omitempty"`   // edges that must never exist
+	Allow  []DepRule           `json:"allow,omitempty"`  // whitelist: once a file matches an allow "from", only allowed targets are permitted
+}
+
+// DepRule describes a dependency edge between two path patterns or layers
+type DepRule struct {
+	Name   string `json:"name,omitempty"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ID returns the rule name, or a generated one like "render->mcp"
+func (r DepRule) ID() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.From + "->" + r.To
+}
+
+// Empty reports whether no dependency rules are configured
+func (r Rules) Empty() bool {
+	return len(r.Deny) == 0 && len(r.Allow) == 0
+}
+
+// Path returns the config file location for a project root
+func Path(root string) string {
+	return filepath.Join(root, filepath.FromSlash(FileName))
+}
+
+// Load reads the project config. A missing file yields an empty config.
+func Load(root string) (*Config, error) {
+	return LoadFile(Path(root))
+}
+
+// LoadFile reads a config from an explicit path. A missing file yields an empty config.
+func LoadFile(path string) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalid, path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalid, path, err)
+	}
+	return cfg, nil
+}
+
+// triggerOps are the event ops a trigger can match
+var triggerOps = map[string]bool{
+	"CREATE": true, "WRITE": true, "REMOVE": true, "RENAME": true, "MOVE": true,
+	"COMMIT": true, "CHECKOUT": true, "MERGE": true,
+}
+
+// validate checks that every rule has both ends set and every trigger
+// does something
+func (c *Config) validate() error {
+	for _, list := range [][]DepRule{c.Rules.Deny, c.Rules.Allow} {
+		for _, r := range list {
+			if r.From == "" || r.To == "" {
+				return fmt.Errorf("rule %q needs both \"from\" and \"to\"", r.ID())
+			}
+		}
+	}
+	for i, t := range c.Watch.Triggers {
+		if t.Command == "" && t.Notify == "" {
+			return fmt.Errorf("trigger %d needs a \"command\" or \"notify\" file", i+1)
+		}
+		for _, op := range t.Ops {
+			if !triggerOps[strings.ToUpper(op)] {
+				return fmt.Errorf("trigger %q: unknown op %q", t.ID(), op)
+			}
+		}
+		if t.Debounce < 0 || t.Timeout < 0 {
+			return fmt.Errorf("trigger %q: durations can't be negative", t.ID())
+		}
+	}
+	if c.Watch.MaxConcurrent < 0 {
+		return fmt.Errorf("watch max_concurrent can't be negative")
+	}
+	if c.Watch.History.MaxAge < 0 || c.Watch.History.MaxSizeMB < 0 {
+		return fmt.Errorf("watch history limits can't be negative")
+	}
+	return nil
+}
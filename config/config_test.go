@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".codemap"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(Path(root), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestLoadMissing(t *testing.T) {
+	cfg, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatalf("missing config should not error: %v", err)
+	}
+	if !cfg.Rules.Empty() {
+		t.Error("missing config should have no rules")
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	root := writeConfig(t, `{
+  "rules": {
+    "layers": {"domain": ["domain/**"]},
+    "deny": [{"from": "render", "to": "mcp", "reason": "library code"}],
+    "allow": [{"name": "pure-domain", "from": "domain", "to": "domain"}]
+  }
+}`)
+
+	cfg, err := Load(root)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Rules.Deny) != 1 || cfg.Rules.Deny[0].ID() != "render->mcp" {
+		t.Errorf("unexpected deny rules: %+v", cfg.Rules.Deny)
+	}
+	if len(cfg.Rules.Allow) != 1 || cfg.Rules.Allow[0].ID() != "pure-domain" {
+		t.Errorf("unexpected allow rules: %+v", cfg.Rules.Allow)
+	}
+	if got := cfg.Rules.Layers["domain"]; len(got) != 1 || got[0] != "domain/**" {
+		t.Errorf("unexpected layers: %+v", cfg.Rules.Layers)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"bad json", `{"rules": `, "invalid"},
+		{"missing to", `{"rules": {"deny": [{"from": "render"}]}}`, "needs both"},
+		{"trigger without action", `{"watch": {"triggers": [{"path": "go.mod"}]}}`, "needs a"},
+		{"trigger bad op", `{"watch": {"triggers": [{"ops": ["SAVE"], "command": "true"}]}}`, "unknown op"},
+		{"trigger bad duration", `{"watch": {"triggers": [{"command": "true", "debounce": "soon"}]}}`, "invalid"},
+		{"negative history size", `{"watch": {"history": {"max_size_mb": -1}}}`, "can't be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("expected ErrInvalid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadWatch(t *testing.T) {
+	root := writeConfig(t, `{"watch": {"include": [".vue"], "exclude": ["generated", "*.pb.go"]}}`)
+
+	cfg, err := Load(root)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Watch.Include) != 1 || cfg.Watch.Include[0] != ".vue" {
+		t.Errorf("unexpected include: %+v", cfg.Watch.Include)
+	}
+	if len(cfg.Watch.Exclude) != 2 || cfg.Watch.Exclude[1] != "*.pb.go" {
+		t.Errorf("unexpected exclude: %+v", cfg.Watch.Exclude)
+	}
+
+	root = writeConfig(t, `{"watch": {"history": {"max_age": "72h", "max_size_mb": 20}}}`)
+	cfg, err = Load(root)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if h := cfg.Watch.History; time.Duration(h.MaxAge) != 72*time.Hour || h.MaxSizeMB != 20 || h.Disabled {
+		t.Errorf("unexpected history: %+v", h)
+	}
+}
+
+func TestLoadTriggers(t *testing.T) {
+	root := writeConfig(t, `{"watch": {"max_concurrent": 1, "triggers": [
+  {"name": "contracts", "hub": true, "ops": ["write"], "command": "make contract-test", "debounce": "2s"},
+  {"path": "go.mod", "notify": ".codemap/deps.jsonl", "timeout": "30s"}
+]}}`)
+
+	cfg, err := Load(root)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	triggers := cfg.Watch.Triggers
+	if len(triggers) != 2 || cfg.Watch.MaxConcurrent != 1 {
+		t.Fatalf("unexpected watch config: %+v", cfg.Watch)
+	}
+	if triggers[0].ID() != "contracts" || !triggers[0].Hub || time.Duration(triggers[0].Debounce) != 2*time.Second {
+		t.Errorf("unexpected first trigger: %+v", triggers[0])
+	}
+	if triggers[1].ID() != ".codemap/deps.jsonl" || time.Duration(triggers[1].Timeout) != 30*time.Second {
+		t.Errorf("unexpected second trigger: %+v", triggers[1])
+	}
+}
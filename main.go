@@ -1,17 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"codemap/cmd"
+	"codemap/config"
 	"codemap/render"
 	"codemap/scanner"
 	"codemap/watch"
@@ -20,10 +26,19 @@ import (
 func main() {
 	// Handle "watch" subcommand before flag parsing
 	if len(os.Args) >= 2 && os.Args[1] == "watch" {
+		if len(os.Args) >= 3 && os.Args[2] == "log" {
+			os.Exit(runWatchLogSubcommand(os.Args[3:]))
+		}
+		if len(os.Args) >= 3 && os.Args[2] == "logs" {
+			os.Exit(runWatchLogsSubcommand(os.Args[3:]))
+		}
 		subCmd := "status"
 		if len(os.Args) >= 3 {
 			subCmd = os.Args[2]
 		}
+		if len(os.Args) >= 4 && os.Args[3] == "--all" {
+			os.Exit(runWatchAllSubcommand(subCmd))
+		}
 		root, _ := os.Getwd()
 		if len(os.Args) >= 4 {
 			root = os.Args[3]
@@ -32,6 +47,34 @@ func main() {
 		return
 	}
 
+	// Handle "daemon" (the multi-project supervisor) before flag parsing
+	if len(os.Args) >= 2 && os.Args[1] == "daemon" {
+		if len(os.Args) >= 3 {
+			os.Exit(runWatchAllSubcommand(os.Args[2]))
+		}
+		os.Exit(runSupervisor())
+	}
+
+	// Handle "sessions" subcommand before flag parsing
+	if len(os.Args) >= 2 && os.Args[1] == "sessions" {
+		os.Exit(runSessionsSubcommand(os.Args[2:]))
+	}
+
+	// Handle "history" subcommand before flag parsing
+	if len(os.Args) >= 2 && os.Args[1] == "history" {
+		os.Exit(runHistorySubcommand(os.Args[2:]))
+	}
+
+	// Handle "check" subcommand before flag parsing
+	if len(os.Args) >= 2 && os.Args[1] == "check" {
+		os.Exit(runCheckSubcommand(os.Args[2:]))
+	}
+
+	// Handle "report" subcommand before flag parsing
+	if len(os.Args) >= 2 && os.Args[1] == "report" {
+		os.Exit(runReportSubcommand(os.Args[2:]))
+	}
+
 	// Handle "hook" subcommand before flag parsing
 	if len(os.Args) >= 2 && os.Args[1] == "hook" {
 		if len(os.Args) < 3 {
@@ -66,6 +109,11 @@ func main() {
 	symbolsMode := flag.Bool("symbols", false, "Show code symbols with scopes and metadata")
 	showRefsMode := flag.Bool("refs", false, "Include symbol references (use with --symbols)")
 	symbolsJSONMode := flag.Bool("symbols-json", false, "Output symbols as JSON")
+	graphFormat := flag.String("format", "", "Export the dependency graph: dot, mermaid, graphml, d2, cytoscape")
+	granularity := flag.String("granularity", "file", "Graph export granularity: file, dir, package")
+	clusterMode := flag.Bool("cluster", false, "Group graph export nodes by top-level directory")
+	focusPath := flag.String("focus", "", "Graph export: only this file/dir/glob and its direct neighbors")
+	maxNodes := flag.Int("max-nodes", 0, "Graph export: keep the N most connected nodes (0 = unlimited)")
 	helpMode := flag.Bool("help", false, "Show help")
 	// Short flag aliases
 	flag.IntVar(depthLimit, "d", 0, "Limit tree depth (shorthand)")
@@ -90,6 +138,11 @@ func main() {
 		fmt.Println("  --symbols           Show code symbols with scopes and metadata")
 		fmt.Println("  --refs              Include symbol references (use with --symbols)")
 		fmt.Println("  --symbols-json      Output symbols as JSON")
+		fmt.Println("  --format <fmt>      Export dependency graph: dot, mermaid, graphml, d2, cytoscape")
+		fmt.Println("  --granularity <g>   Export nodes per file, dir or package (default: file)")
+		fmt.Println("  --cluster           Group exported nodes by top-level directory")
+		fmt.Println("  --focus <path>      Export only this file/dir and its direct neighbors")
+		fmt.Println("  --max-nodes <n>     Export at most n nodes (most connected first)")
 		fmt.Println()
 		fmt.Println("Examples:")
 		fmt.Println("  codemap .                       # Basic tree view")
@@ -102,6 +155,28 @@ func main() {
 		fmt.Println("  codemap --only swift .          # Just Swift files")
 		fmt.Println("  codemap --exclude .xcassets,Fonts,.png  # Hide assets")
 		fmt.Println("  codemap --importers scanner/types.go  # Check file impact")
+		fmt.Println("  codemap --format mermaid --granularity dir --cluster .  # Diagram for docs")
+		fmt.Println()
+		fmt.Println("Architecture rules (from .codemap/config.json):")
+		fmt.Println("  codemap check .                 # Fail on forbidden imports")
+		fmt.Println("  codemap check --format sarif .  # SARIF output for code scanning (also: junit, json)")
+		fmt.Println()
+		fmt.Println("Exit codes (check, report, history, sessions, watch log/logs):")
+		fmt.Println("  0 = success, 1 = check found violations, 2 = usage or runtime error")
+		fmt.Println()
+		fmt.Println("HTML report (single self-contained file):")
+		fmt.Println("  codemap report --html out.html .        # Tree, graph, hubs and symbols")
+		fmt.Println("  codemap report --html out.html --diff   # Highlight changes vs main")
+		fmt.Println()
+		fmt.Println("Live watching:")
+		fmt.Println("  codemap watch start .           # Background daemon (also: stop, restart, status)")
+		fmt.Println("  codemap watch start --all       # One daemon for all registered projects")
+		fmt.Println("  codemap watch log --since 1h    # Event history (--path 'src/*.go', --json)")
+		fmt.Println("  codemap watch logs -f           # Daemon output (--all for the supervisor's)")
+		fmt.Println("  codemap watch trust .           # Let the config's triggers run (also: untrust)")
+		fmt.Println("  codemap sessions list           # Past watch sessions")
+		fmt.Println("  codemap sessions show <id>      # Files, hub edits and timeline of one session")
+		fmt.Println("  codemap history main.go         # Local versions of a file (also: diff, restore)")
 		fmt.Println()
 		fmt.Println("Hooks (for Claude Code integration):")
 		fmt.Println("  codemap hook session-start      # Show project context")
@@ -162,6 +237,18 @@ func main() {
 		return
 	}
 
+	// Graph export mode - write the resolved file graph as a diagram
+	if *graphFormat != "" {
+		runGraphExport(absRoot, render.GraphOptions{
+			Options:     render.Options{Format: *graphFormat},
+			Granularity: *granularity,
+			Cluster:     *clusterMode,
+			Focus:       *focusPath,
+			MaxNodes:    *maxNodes,
+		})
+		return
+	}
+
 	// Symbols mode - show code symbols with scopes and metadata
 	if *symbolsMode {
 		runSymbolsMode(absRoot, root, *showRefsMode, *symbolsJSONMode)
@@ -200,7 +287,7 @@ func main() {
 	}
 
 	// Scan files
-	files, err := scanner.ScanFiles(root, gitCache, only, exclude)
+	files, err := scanner.ScanFiles(context.Background(), root, gitCache, only, exclude)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error walking tree: %v\n", err)
 		os.Exit(1)
@@ -211,7 +298,7 @@ func main() {
 	var activeDiffRef string
 	if diffInfo != nil {
 		files = scanner.FilterToChangedWithInfo(files, diffInfo)
-		impact = scanner.AnalyzeImpact(absRoot, files)
+		impact = scanner.AnalyzeImpact(context.Background(), absRoot, files)
 		activeDiffRef = *diffRef
 	}
 
@@ -228,17 +315,23 @@ func main() {
 	}
 
 	// Render or output JSON
+	opts := render.Options{Color: true}
 	if *jsonMode {
-		json.NewEncoder(os.Stdout).Encode(project)
-	} else if *skylineMode {
-		render.Skyline(project, *animateMode)
+		opts.Format = "json"
+	}
+	if *skylineMode && !*jsonMode {
+		err = render.Skyline(project, opts)
 	} else {
-		render.Tree(project)
+		err = render.Tree(project, opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 }
 
 func runDepsMode(absRoot, root string, jsonMode bool, diffRef string, changedFiles map[string]bool) {
-	analyses, err := scanner.ScanForDeps(root)
+	analyses, err := scanner.ScanForDeps(context.Background(), root)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		fmt.Fprintln(os.Stderr, "")
@@ -264,10 +357,33 @@ func runDepsMode(absRoot, root string, jsonMode bool, diffRef string, changedFil
 	}
 
 	// Render or output JSON
+	opts := render.Options{Color: true}
 	if jsonMode {
-		json.NewEncoder(os.Stdout).Encode(depsProject)
-	} else {
-		render.Depgraph(depsProject)
+		opts.Format = "json"
+	}
+	if err := render.Depgraph(depsProject, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runGraphExport(root string, opts render.GraphOptions) {
+	fg, err := scanner.BuildFileGraph(context.Background(), root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building file graph: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Accept absolute focus paths like --importers does
+	if filepath.IsAbs(opts.Focus) {
+		if rel, err := filepath.Rel(root, opts.Focus); err == nil {
+			opts.Focus = rel
+		}
+	}
+
+	if err := render.ExportGraph(fg, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 }
 
@@ -288,7 +404,7 @@ func runWatchMode(root string, verbose bool) {
 
 	fmt.Printf("Watching: %s\n", root)
 	fmt.Printf("Files tracked: %d\n", daemon.FileCount())
-	fmt.Println("Event log: .codemap/events.log")
+	fmt.Println("Event log: .codemap/events.jsonl")
 	fmt.Println()
 	fmt.Println("Press Ctrl+C to stop")
 	fmt.Println()
@@ -311,7 +427,7 @@ func runWatchMode(root string, verbose bool) {
 }
 
 func runImportersMode(root, file string) {
-	fg, err := scanner.BuildFileGraph(root)
+	fg, err := scanner.BuildFileGraph(context.Background(), root)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error building file graph: %v\n", err)
 		os.Exit(1)
@@ -374,23 +490,7 @@ func runWatchSubcommand(subCmd, root string) {
 			fmt.Println("Watch daemon already running")
 			return
 		}
-		// Fork a background daemon
-		exe, err := os.Executable()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-		cmd := exec.Command(exe, "watch", "daemon", absRoot)
-		cmd.Stdout = nil
-		cmd.Stderr = nil
-		cmd.Stdin = nil
-		// Detach from parent process group (Unix only)
-		setSysProcAttr(cmd)
-		if err := cmd.Start(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error starting daemon: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Printf("Watch daemon started (pid %d)\n", cmd.Process.Pid)
+		os.Exit(startWatch(absRoot))
 
 	case "daemon":
 		// Internal: run as the actual daemon process
@@ -407,14 +507,41 @@ func runWatchSubcommand(subCmd, root string) {
 		}
 		fmt.Println("Watch daemon stopped")
 
+	case "restart":
+		if watch.IsRunning(absRoot) {
+			if err := watch.Stop(absRoot); err != nil {
+				fmt.Fprintf(os.Stderr, "Error stopping daemon: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		os.Exit(startWatch(absRoot))
+
 	case "status":
 		if watch.IsRunning(absRoot) {
-			state := watch.ReadState(absRoot)
-			if state != nil {
+			if h, err := watch.NewClient(absRoot).Health(); err == nil {
+				fmt.Printf("Watch daemon running (pid %d)\n", h.PID)
+				fmt.Printf("  Files: %d\n", h.Files)
+				fmt.Printf("  Events: %d\n", h.Events)
+				fmt.Printf("  Started: %s\n", h.StartedAt.Format("15:04:05"))
+				if !h.LastEvent.IsZero() {
+					fmt.Printf("  Last event: %s\n", h.LastEvent.Format("15:04:05"))
+				}
+				if h.Supervised {
+					fmt.Println("  Supervised: yes (codemap watch status --all)")
+				}
+				printWatchMode(h.Mode, h.Polled)
+				if h.Triggers > 0 {
+					fmt.Printf("  Triggers: %d (output in .codemap/triggers.log)\n", h.Triggers)
+				}
+				if h.Untrusted > 0 {
+					fmt.Printf("  Untrusted trigger actions: %d (review .codemap/config.json, then codemap watch trust)\n", h.Untrusted)
+				}
+			} else if state := watch.ReadState(absRoot); state != nil {
 				fmt.Printf("Watch daemon running\n")
 				fmt.Printf("  Files: %d\n", state.FileCount)
 				fmt.Printf("  Hubs: %d\n", len(state.Hubs))
 				fmt.Printf("  Updated: %s\n", state.UpdatedAt.Format("15:04:05"))
+				printWatchMode(state.WatchMode, nil)
 			} else {
 				fmt.Println("Watch daemon running (no state)")
 			}
@@ -422,15 +549,778 @@ func runWatchSubcommand(subCmd, root string) {
 			fmt.Println("Watch daemon not running")
 		}
 
+	case "trust":
+		actions, err := watch.TrustTriggers(absRoot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(actions) == 0 {
+			fmt.Println("No triggers to trust in .codemap/config.json")
+			return
+		}
+		fmt.Println("Trusted these trigger actions until .codemap/config.json changes them:")
+		for _, a := range actions {
+			fmt.Printf("  %s\n", a)
+		}
+		if watch.IsRunning(absRoot) {
+			fmt.Println("Run codemap watch restart to start them")
+		}
+
+	case "untrust":
+		if err := watch.UntrustTriggers(absRoot); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Triggers no longer trusted")
+		if watch.IsRunning(absRoot) {
+			fmt.Println("Run codemap watch restart to stop them")
+		}
+
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown watch command: %s\n", subCmd)
-		fmt.Fprintln(os.Stderr, "Usage: codemap watch [start|stop|status]")
+		fmt.Fprintln(os.Stderr, "Usage: codemap watch [start|stop|restart|status|trust|untrust|log|logs]")
 		os.Exit(1)
 	}
 }
 
+// startWatch forks a background daemon for absRoot, or adds it to the
+// supervisor if one is running, and waits for it to take the project's lock
+func startWatch(absRoot string) int {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	supervised := watch.SupervisorPID() != 0
+	pid, err := watch.StartBackground(absRoot, exe)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting daemon: %v\n", err)
+		return 1
+	}
+	if supervised {
+		fmt.Printf("Watching with the supervisor (pid %d)\n", pid)
+		warnUntrusted(absRoot)
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = watch.WaitStarted(ctx, absRoot, pid)
+	switch {
+	case errors.Is(err, watch.ErrAlreadyRunning):
+		// Another start won the race
+		fmt.Println("Watch daemon already running")
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error starting daemon: %v\n", err)
+		return 1
+	default:
+		fmt.Printf("Watch daemon started (pid %d)\n", pid)
+	}
+	warnUntrusted(absRoot)
+	return 0
+}
+
+// warnUntrusted notes trigger actions that won't run until trusted
+func warnUntrusted(absRoot string) {
+	if actions, err := watch.UntrustedTriggers(absRoot); err == nil && len(actions) > 0 {
+		fmt.Printf("%d trigger action(s) in .codemap/config.json won't run until you review them and run codemap watch trust\n", len(actions))
+	}
+}
+
+// runWatchAllSubcommand starts, stops or reports on the supervisor, which
+// watches every registered project in one process
+func runWatchAllSubcommand(subCmd string) int {
+	switch subCmd {
+	case "start":
+		if pid := watch.SupervisorPID(); pid != 0 {
+			fmt.Printf("Supervisor already running (pid %d)\n", pid)
+			return 0
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		pid, err := watch.StartSupervisor(ctx, exe)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting supervisor: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Supervisor started (pid %d)\n", pid)
+		if projects, _ := watch.Projects(); len(projects) == 0 {
+			fmt.Println("No projects registered yet; add one with: codemap watch start <dir>")
+		}
+		return 0
+
+	case "stop":
+		pid := watch.SupervisorPID()
+		if pid == 0 {
+			fmt.Println("Supervisor not running")
+			return 0
+		}
+		if err := watch.StopSupervisor(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error stopping supervisor (pid %d): %v\n", pid, err)
+			return 1
+		}
+		fmt.Println("Supervisor stopped (projects stay registered for the next start --all)")
+		return 0
+
+	case "restart":
+		if watch.SupervisorPID() != 0 {
+			if err := watch.StopSupervisor(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error stopping supervisor: %v\n", err)
+				return 1
+			}
+		}
+		return runWatchAllSubcommand("start")
+
+	case "status":
+		pid := watch.SupervisorPID()
+		if pid == 0 {
+			fmt.Println("Supervisor not running")
+			if projects, err := watch.Projects(); err == nil && len(projects) > 0 {
+				fmt.Println("Registered projects (start with: codemap watch start --all):")
+				for _, root := range projects {
+					fmt.Printf("  %s\n", root)
+				}
+			}
+			return 0
+		}
+		projects, err := watch.NewSupervisorClient().Projects()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: supervisor (pid %d) not answering: %v\n", pid, err)
+			return 1
+		}
+		fmt.Printf("Supervisor running (pid %d), %d projects\n", pid, len(projects))
+		for _, p := range projects {
+			switch {
+			case p.Health != nil:
+				fmt.Printf("  %s  %s  %d files, %d events, %s\n", p.Root, p.Status, p.Health.Files, p.Health.Events, p.Health.Mode)
+			case p.Error != "":
+				fmt.Printf("  %s  %s: %s\n", p.Root, p.Status, p.Error)
+			default:
+				fmt.Printf("  %s  %s\n", p.Root, p.Status)
+			}
+		}
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command: %s --all\n", subCmd)
+	fmt.Fprintln(os.Stderr, "Usage: codemap watch [start|stop|restart|status] --all, or codemap daemon [status]")
+	return 2
+}
+
+// runSupervisor runs the supervisor in the foreground until SIGTERM or
+// SIGINT, e.g. under launchd or systemd
+func runSupervisor() int {
+	if pid := watch.SupervisorPID(); pid != 0 {
+		fmt.Fprintf(os.Stderr, "Supervisor already running (pid %d)\n", pid)
+		return 1
+	}
+	sup := watch.NewSupervisor(true)
+	if err := sup.Serve(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting supervisor: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s [supervisor] Started (pid %d)\n", time.Now().Format(logTimeFormat), os.Getpid())
+	if err := sup.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-sigChan
+
+	fmt.Printf("%s [supervisor] Stopping (%v)\n", time.Now().Format(logTimeFormat), sig)
+	sup.Stop()
+	return 0
+}
+
+// printWatchMode prints how the daemon notices changes, and which
+// directories it has to poll
+func printWatchMode(mode string, polled []watch.PolledDir) {
+	switch mode {
+	case "":
+		return
+	case watch.ModeNotify:
+		fmt.Printf("  Mode: %s\n", mode)
+		return
+	case watch.ModePolling:
+		fmt.Printf("  Mode: %s (fsnotify unavailable)\n", mode)
+	case watch.ModeMixed:
+		if len(polled) > 0 {
+			fmt.Printf("  Mode: %s (%d directories polled)\n", mode, len(polled))
+		} else {
+			fmt.Printf("  Mode: %s\n", mode)
+		}
+	}
+	const maxShown = 5
+	for i, dir := range polled {
+		if i == maxShown {
+			fmt.Printf("    ... and %d more\n", len(polled)-maxShown)
+			break
+		}
+		fmt.Printf("    %s: %s\n", dir.Path, dir.Reason)
+	}
+}
+
+// runWatchLogSubcommand prints the watch daemon's event history, including
+// rotated logs, optionally as JSON lines that can be replayed elsewhere
+func runWatchLogSubcommand(args []string) int {
+	fs := flag.NewFlagSet("watch log", flag.ContinueOnError)
+	since := fs.String("since", "", "Only events newer than this: a duration (1h, 30m) or an RFC 3339 time")
+	pathGlob := fs.String("path", "", "Only events for paths matching this glob (e.g. 'src/*.go', or '*.ts' for any directory)")
+	jsonOut := fs.Bool("json", false, "Print full events as JSON lines")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	root := fs.Arg(0)
+	if root == "" {
+		root = "."
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	var cutoff time.Time
+	if *since != "" {
+		if d, err := time.ParseDuration(*since); err == nil {
+			cutoff = time.Now().Add(-d)
+		} else if cutoff, err = time.Parse(time.RFC3339, *since); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --since %q (use e.g. 1h or 2006-01-02T15:04:05Z)\n", *since)
+			return 2
+		}
+	}
+	if *pathGlob != "" {
+		if _, err := filepath.Match(*pathGlob, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --path %q: %v\n", *pathGlob, err)
+			return 2
+		}
+	}
+
+	events, err := watch.ReadEvents(absRoot, cutoff)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading event log: %v\n", err)
+		return 2
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	shown := 0
+	for _, e := range events {
+		if *pathGlob != "" && !matchEventPath(*pathGlob, e.Path) && (e.OldPath == "" || !matchEventPath(*pathGlob, e.OldPath)) {
+			continue
+		}
+		shown++
+		if *jsonOut {
+			enc.Encode(e)
+			continue
+		}
+
+		delta := ""
+		if e.Delta != 0 {
+			delta = fmt.Sprintf("%+d", e.Delta)
+		}
+		var notes []string
+		if e.Dirty {
+			notes = append(notes, "dirty")
+		}
+		if e.IsHub {
+			notes = append(notes, fmt.Sprintf("HUB:%d importers", e.Importers))
+		}
+		if len(e.RelatedHot) > 0 {
+			notes = append(notes, "related: "+strings.Join(e.RelatedHot, ", "))
+		}
+		if len(e.Symbols) > 0 {
+			notes = append(notes, watch.SummarizeSymbols(e.Symbols, 0))
+		}
+		line := fmt.Sprintf("%s  %-6s  %-40s %6s  %s", e.Time.Local().Format("2006-01-02 15:04:05"), e.Op, e.DisplayPath(), delta, strings.Join(notes, "  "))
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+
+	if shown == 0 && !*jsonOut {
+		fmt.Println("No events logged")
+	}
+	return 0
+}
+
+// runWatchLogsSubcommand prints the end of a background daemon's output,
+// or the supervisor's, and optionally follows it
+func runWatchLogsSubcommand(args []string) int {
+	fs := flag.NewFlagSet("watch logs", flag.ContinueOnError)
+	lines := fs.Int("n", 50, "Number of lines to show")
+	follow := fs.Bool("f", false, "Keep printing new output")
+	all := fs.Bool("all", false, "Show the supervisor's output")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var path string
+	if *all {
+		p, err := watch.SupervisorLogPath()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		path = p
+	} else {
+		root := fs.Arg(0)
+		if root == "" {
+			root = "."
+		}
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		if watched, ok := watch.WatchedRoot(absRoot); ok {
+			absRoot = watched
+		}
+		if pid, _ := watch.ReadPID(absRoot); pid != 0 && pid == watch.SupervisorPID() {
+			// Supervised projects log to the supervisor
+			fmt.Fprintln(os.Stderr, "(watched by the supervisor; showing codemap watch logs --all)")
+			path, _ = watch.SupervisorLogPath()
+		} else {
+			path = watch.DaemonLogPath(absRoot)
+		}
+	}
+
+	offset, err := tailFile(os.Stdout, path, *lines)
+	if os.IsNotExist(err) && !*follow {
+		fmt.Println("No daemon output logged")
+		return 0
+	}
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if !*follow {
+		return 0
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sigChan:
+			return 0
+		case <-ticker.C:
+			offset = followFile(os.Stdout, path, offset)
+		}
+	}
+}
+
+// tailFile writes the last n lines of path to w, returning the offset to
+// follow it from
+func tailFile(w io.Writer, path string, n int) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		end := len(data)
+		if end > 0 && data[end-1] == '\n' {
+			end--
+		}
+		start := end
+		for i := 0; i < n && start >= 0; i++ {
+			start = bytes.LastIndexByte(data[:start], '\n')
+		}
+		w.Write(data[start+1:])
+	}
+	return int64(len(data)), nil
+}
+
+// followFile writes what was appended to path since offset, starting over
+// when the log was rotated or truncated, and returns the new offset
+func followFile(w io.Writer, path string, offset int64) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return offset
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if info.Size() == offset {
+		return offset
+	}
+	f.Seek(offset, io.SeekStart)
+	copied, _ := io.Copy(w, f)
+	return offset + copied
+}
+
+// matchEventPath matches a --path glob against an event path; globs without
+// a separator also match the base name, so '*.go' finds Go files anywhere
+func matchEventPath(glob, path string) bool {
+	if ok, _ := filepath.Match(glob, path); ok {
+		return true
+	}
+	if !strings.ContainsRune(glob, filepath.Separator) {
+		ok, _ := filepath.Match(glob, filepath.Base(path))
+		return ok
+	}
+	return false
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// runHistorySubcommand lists the versions the watch daemon kept of a file,
+// diffs one against the file or another version, or restores one
+func runHistorySubcommand(args []string) int {
+	const usage = "Usage: codemap history [--json] <file>, codemap history diff <file> <version> [<version>], or codemap history restore <file> <version>"
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	jsonOut := fs.Bool("json", false, "Output as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	action, rest := "list", fs.Args()
+	if len(rest) > 0 && (rest[0] == "diff" || rest[0] == "restore") {
+		action, rest = rest[0], rest[1:]
+	}
+	var versions []int
+	for _, arg := range rest[min(len(rest), 1):] {
+		n, err := strconv.Atoi(strings.TrimPrefix(arg, "v"))
+		if err != nil || n < 1 {
+			fmt.Fprintf(os.Stderr, "Error: invalid version %q\n", arg)
+			return 2
+		}
+		versions = append(versions, n)
+	}
+	minVersions, maxVersions := 0, 0
+	switch action {
+	case "diff":
+		minVersions, maxVersions = 1, 2
+	case "restore":
+		minVersions, maxVersions = 1, 1
+	}
+	if len(rest) == 0 || len(versions) < minVersions || len(versions) > maxVersions {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	absFile, err := filepath.Abs(rest[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	root, ok := watch.HistoryRoot(filepath.Dir(absFile))
+	if !ok {
+		fmt.Printf("No history for %s (the watch daemon keeps it: codemap watch start)\n", rest[0])
+		return 0
+	}
+	relPath, err := filepath.Rel(root, absFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	switch action {
+	case "diff":
+		return runHistoryDiff(root, relPath, versions)
+
+	case "restore":
+		restored, saved, err := watch.Restore(root, relPath, versions[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		fmt.Printf("Restored %s to v%d (%s)\n", relPath, restored.Version, restored.Time.Local().Format("2006-01-02 15:04:05"))
+		if saved.Version != 0 && saved.Hash != restored.Hash {
+			fmt.Printf("The content it replaced is v%d; undo with: codemap history restore %s %d\n", saved.Version, rest[0], saved.Version)
+		}
+		return 0
+	}
+
+	history, err := watch.ReadHistory(root, relPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading history: %v\n", err)
+		return 2
+	}
+	if *jsonOut {
+		if history == nil {
+			history = []watch.Version{}
+		}
+		printJSON(history)
+		return 0
+	}
+	if len(history) == 0 {
+		fmt.Printf("No history for %s\n", relPath)
+		return 0
+	}
+
+	current := ""
+	if data, err := os.ReadFile(absFile); err == nil {
+		current = watch.HashContent(data)
+	}
+	fmt.Printf("History of %s (newest first):\n", relPath)
+	for _, v := range history {
+		var notes []string
+		if v.Hash == current {
+			notes = append(notes, "current")
+		}
+		if v.OldPath != "" {
+			notes = append(notes, "moved from "+v.OldPath)
+		}
+		line := fmt.Sprintf("  v%-4d %s  %-7s %5d lines  %+5d  %s", v.Version, v.Time.Local().Format("2006-01-02 15:04:05"), v.Op, v.Lines, v.Delta, strings.Join(notes, ", "))
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	fmt.Printf("\nCompare with: codemap history diff %s <version>; restore with: codemap history restore %s <version>\n", rest[0], rest[0])
+	return 0
+}
+
+// runHistoryDiff prints how a version of a file differs from the file, or
+// from a second version
+func runHistoryDiff(root, relPath string, versions []int) int {
+	from, err := watch.FindVersion(root, relPath, versions[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	old, err := watch.HistoryContent(root, from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading v%d: %v\n", from.Version, err)
+		return 2
+	}
+
+	toName := filepath.ToSlash(relPath) + " (current)"
+	var content []byte
+	if len(versions) > 1 {
+		to, err := watch.FindVersion(root, relPath, versions[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		if content, err = watch.HistoryContent(root, to); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading v%d: %v\n", to.Version, err)
+			return 2
+		}
+		toName = fmt.Sprintf("%s (v%d)", filepath.ToSlash(relPath), to.Version)
+	} else if content, err = os.ReadFile(filepath.Join(root, relPath)); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	diff := watch.UnifiedDiff(old, content, fmt.Sprintf("%s (v%d)", filepath.ToSlash(relPath), from.Version), toName)
+	if diff == "" {
+		fmt.Println("No differences")
+		return 0
+	}
+	fmt.Print(diff)
+	return 0
+}
+
+// runSessionsSubcommand lists the watch daemon's sessions or shows one
+func runSessionsSubcommand(args []string) int {
+	fs := flag.NewFlagSet("sessions", flag.ContinueOnError)
+	jsonOut := fs.Bool("json", false, "Output as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	action := fs.Arg(0)
+	if action == "" {
+		action = "list"
+	}
+	rest := fs.Args()
+	if len(rest) > 0 {
+		rest = rest[1:]
+	}
+
+	var id, root string
+	switch action {
+	case "list":
+		if len(rest) > 0 {
+			root = rest[0]
+		}
+	case "show":
+		if len(rest) == 0 {
+			fmt.Fprintln(os.Stderr, "Usage: codemap sessions show <id|latest> [path]")
+			return 2
+		}
+		id = rest[0]
+		if len(rest) > 1 {
+			root = rest[1]
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown sessions command: %s\n", action)
+		fmt.Fprintln(os.Stderr, "Usage: codemap sessions [--json] [list|show <id>] [path]")
+		return 2
+	}
+	if root == "" {
+		root = "."
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	sessions, err := watch.ListSessions(absRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading sessions: %v\n", err)
+		return 2
+	}
+
+	// A running session's file lags behind; ask the daemon for the live one
+	if len(sessions) > 0 && sessions[0].Active {
+		if live, err := watch.NewClient(absRoot).Session(); err == nil && live.ID == sessions[0].ID {
+			sessions[0] = *live
+		}
+	}
+
+	if action == "list" {
+		if *jsonOut {
+			if sessions == nil {
+				sessions = []watch.Session{}
+			}
+			printJSON(sessions)
+			return 0
+		}
+		if len(sessions) == 0 {
+			fmt.Println("No sessions recorded (start one with: codemap watch start)")
+			return 0
+		}
+		fmt.Printf("%-15s  %-16s  %-9s  %-20s  %6s  %5s  %4s\n", "ID", "STARTED", "DURATION", "BRANCH", "EVENTS", "FILES", "HUBS")
+		for _, s := range sessions {
+			duration := s.Duration().Round(time.Second).String()
+			if s.Active {
+				duration = "running"
+			} else if s.End.IsZero() {
+				duration += "?" // daemon didn't stop cleanly
+			}
+			fmt.Printf("%-15s  %-16s  %-9s  %-20s  %6d  %5d  %4d\n",
+				s.ID, s.Start.Format("2006-01-02 15:04"), duration, s.Branch, s.Events, len(s.Files), s.HubEdits)
+		}
+		return 0
+	}
+
+	var session *watch.Session
+	for i := range sessions {
+		if sessions[i].ID == id || (id == "latest" && i == 0) {
+			session = &sessions[i]
+			break
+		}
+	}
+	if session == nil {
+		fmt.Fprintf(os.Stderr, "No session %q (see: codemap sessions list)\n", id)
+		return 2
+	}
+	// The timeline comes from the event log, which may have rotated past it
+	var timeline []watch.Event
+	if session.Events > 0 {
+		events, _ := watch.ReadEvents(absRoot, session.Start)
+		for _, e := range events {
+			if session.Active || !e.Time.After(session.LastEvent) {
+				timeline = append(timeline, e)
+			}
+		}
+	}
+
+	if *jsonOut {
+		printJSON(struct {
+			*watch.Session
+			Timeline []watch.Event `json:"timeline,omitempty"`
+		}{session, timeline})
+		return 0
+	}
+
+	fmt.Printf("Session %s\n", session.ID)
+	fmt.Printf("  Started:   %s\n", session.Start.Format("2006-01-02 15:04:05"))
+	switch {
+	case session.Active:
+		fmt.Printf("  Running:   %s so far\n", session.Duration().Round(time.Second))
+	case session.End.IsZero():
+		fmt.Println("  Ended:     unknown (daemon didn't stop cleanly)")
+	default:
+		fmt.Printf("  Ended:     %s (%s)\n", session.End.Format("2006-01-02 15:04:05"), session.Duration().Round(time.Second))
+	}
+	if session.Branch != "" {
+		fmt.Printf("  Branch:    %s\n", session.Branch)
+	}
+	fmt.Printf("  Events:    %d", session.Events)
+	if session.Events > 0 {
+		fmt.Printf(" (%s - %s)", session.FirstEvent.Format("15:04:05"), session.LastEvent.Format("15:04:05"))
+	}
+	fmt.Println()
+	fmt.Printf("  Lines:     %+d\n", session.Delta)
+	fmt.Printf("  Hub edits: %d\n", session.HubEdits)
+	if session.Moves > 0 {
+		fmt.Printf("  Moves:     %d\n", session.Moves)
+	}
+	if session.Commits > 0 || session.Checkouts > 0 {
+		fmt.Printf("  Git:       %d commits, %d checkouts\n", session.Commits, session.Checkouts)
+	}
+
+	if len(session.Files) > 0 {
+		fmt.Println()
+		fmt.Println("Files (most edited first):")
+		for _, f := range session.Files {
+			hub := ""
+			if f.IsHub {
+				hub = "  HUB"
+			}
+			moved := ""
+			if f.MovedFrom != "" {
+				moved = "  (from " + f.MovedFrom + ")"
+			}
+			fmt.Printf("  %4d  %+6d  %s%s%s\n", f.Edits, f.Delta, f.Path, moved, hub)
+			for _, c := range f.Symbols {
+				detail := ""
+				if c.Change == "signature" {
+					detail = fmt.Sprintf(": %s -> %s", c.OldSignature, c.Signature)
+				}
+				fmt.Printf("                %s%s\n", c, detail)
+			}
+		}
+	}
+
+	if len(timeline) > 0 {
+		fmt.Println()
+		fmt.Println("Timeline:")
+		start := 0
+		if len(timeline) > 20 {
+			start = len(timeline) - 20
+			fmt.Printf("  ... %d earlier events (codemap watch log --json for all)\n", start)
+		}
+		for _, e := range timeline[start:] {
+			delta := ""
+			if e.Delta != 0 {
+				delta = fmt.Sprintf(" %+d", e.Delta)
+			}
+			if len(e.Symbols) > 0 {
+				delta += " - " + watch.SummarizeSymbols(e.Symbols, 3)
+			}
+			fmt.Printf("  %s %-6s %s%s\n", e.Time.Format("15:04:05"), e.Op, e.DisplayPath(), delta)
+		}
+	}
+	return 0
+}
+
+// logTimeFormat timestamps the lifecycle lines in daemon logs
+const logTimeFormat = "2006-01-02 15:04:05"
+
+// runDaemon runs a project's background daemon until SIGTERM or SIGINT.
+// Its output goes to .codemap/watch.log (see codemap watch logs).
 func runDaemon(root string) {
-	daemon, err := watch.NewDaemon(root, false)
+	fmt.Printf("%s [watch] Starting (pid %d): %s\n", time.Now().Format(logTimeFormat), os.Getpid(), root)
+	daemon, err := watch.NewDaemon(root, true)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -441,16 +1331,25 @@ func runDaemon(root string) {
 		os.Exit(1)
 	}
 
+	// Serve queries before the PID file marks the daemon as running;
+	// without the socket, clients fall back to state.json
+	if err := daemon.Serve(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: query API unavailable: %v\n", err)
+	}
+
 	// Write PID file
-	watch.WritePID(root)
+	if err := watch.WritePID(root); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	fmt.Printf("%s [watch] Running: %d files\n", time.Now().Format(logTimeFormat), daemon.FileCount())
 
-	// Wait for stop signal (SIGTERM or state file removal)
+	// Wait for stop signal; Stop removes the PID file before releasing the lock
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
-	<-sigChan
+	sig := <-sigChan
 
+	fmt.Printf("%s [watch] Stopping (%v)\n", time.Now().Format(logTimeFormat), sig)
 	daemon.Stop()
-	watch.RemovePID(root)
 }
 
 func runSymbolsMode(absRoot, root string, showRefs bool, jsonOutput bool) {
@@ -468,15 +1367,144 @@ func runSymbolsMode(absRoot, root string, showRefs bool, jsonOutput bool) {
 		os.Exit(1)
 	}
 
-	analyses, err := sg.ScanSymbols(absRoot, showRefs)
+	analyses, err := sg.ScanSymbols(context.Background(), absRoot, showRefs)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error scanning: %v\n", err)
 		os.Exit(1)
 	}
 
-	options := render.RenderOptions{
+	options := render.SymbolOptions{
+		Options:        render.Options{Color: true},
 		ShowReferences: showRefs,
-		JSONOutput:     jsonOutput,
 	}
-	render.Symbols(analyses, options)
+	if jsonOutput {
+		options.Format = "json"
+	}
+	if err := render.Symbols(analyses, options); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runCheckSubcommand evaluates architecture rules and returns the process exit code:
+// 0 = clean, 1 = violations found, 2 = usage or analysis error
+func runCheckSubcommand(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	format := fs.String("format", "text", "Output format: text, json, junit or sarif")
+	configPath := fs.String("config", "", "Config file (default: <path>/.codemap/config.json)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	root := fs.Arg(0)
+	if root == "" {
+		root = "."
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	var cfg *config.Config
+	if *configPath != "" {
+		cfg, err = config.LoadFile(*configPath)
+	} else {
+		cfg, err = config.Load(absRoot)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 2
+	}
+	if cfg.Rules.Empty() {
+		fmt.Fprintf(os.Stderr, "No rules configured. Add a \"rules\" section to %s\n", config.FileName)
+		return 2
+	}
+
+	fg, err := scanner.BuildFileGraph(context.Background(), absRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building file graph: %v\n", err)
+		return 2
+	}
+
+	report := render.CheckReport{
+		Root:       absRoot,
+		Rules:      cfg.Rules,
+		Violations: scanner.CheckRules(fg, cfg.Rules),
+	}
+	if err := render.Check(report, render.Options{Color: true, Format: *format}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if len(report.Violations) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runReportSubcommand writes the interactive HTML report and returns the process exit code:
+// 0 = written, 2 = usage or runtime error (the same codes as check)
+func runReportSubcommand(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	out := fs.String("html", "codemap-report.html", "Output HTML file")
+	diffMode := fs.Bool("diff", false, "Only include files changed vs --ref")
+	diffRef := fs.String("ref", "main", "Branch/ref to compare against (use with --diff)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	root := fs.Arg(0)
+	if root == "" {
+		root = "."
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	files, err := scanner.ScanFiles(context.Background(), absRoot, scanner.NewGitIgnoreCache(absRoot), nil, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error walking tree: %v\n", err)
+		return 2
+	}
+
+	project := scanner.Project{Root: absRoot, Mode: "report", Files: files}
+	if *diffMode {
+		diffInfo, err := scanner.GitDiffInfo(absRoot, *diffRef)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting git diff: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Make sure '%s' is a valid branch/ref\n", *diffRef)
+			return 2
+		}
+		project.Files = scanner.FilterToChangedWithInfo(files, diffInfo)
+		project.Impact = scanner.AnalyzeImpact(context.Background(), absRoot, project.Files)
+		project.DiffRef = *diffRef
+	}
+
+	report := render.Report{Project: project}
+
+	// Graph and symbols need ast-grep; the report still works without them
+	if fg, err := scanner.BuildFileGraph(context.Background(), absRoot); err == nil {
+		report.Graph = fg
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: skipping dependency graph: %v\n", err)
+	}
+	if sg, err := scanner.NewAstGrepScanner(); err == nil {
+		if sg.Available() {
+			if analyses, err := sg.ScanSymbols(context.Background(), absRoot, false); err == nil {
+				report.Symbols = analyses
+			} else {
+				fmt.Fprintf(os.Stderr, "Warning: skipping symbols: %v\n", err)
+			}
+		}
+		sg.Close()
+	}
+
+	if err := render.WriteHTMLReport(*out, report); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		return 2
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", *out)
+	return 0
 }
@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"codemap/scanner"
+	"codemap/watch"
 )
 
 // TestMain runs before all tests
@@ -261,3 +262,187 @@ func TestCurrentDirectory(t *testing.T) {
 		t.Error("No arg and '.' should produce similar results")
 	}
 }
+
+func TestCheckWithoutRules(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	_, err := runCodemap("check", tmpDir)
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		t.Fatalf("check without rules should fail, got %v", err)
+	}
+	if exitErr.ExitCode() != 2 {
+		t.Errorf("expected exit code 2 for missing rules, got %d", exitErr.ExitCode())
+	}
+}
+
+func TestReportSubcommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n"), 0644)
+	out := filepath.Join(t.TempDir(), "report.html")
+
+	if _, err := runCodemap("report", "--html", out, tmpDir); err != nil {
+		t.Fatalf("report failed: %v", err)
+	}
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("report file not written: %v", err)
+	}
+	if !strings.Contains(string(content), "main.go") {
+		t.Error("report should include scanned files")
+	}
+
+	// Runtime errors exit 2, like check's
+	_, err = runCodemap("report", "--html", filepath.Join(tmpDir, "missing", "report.html"), tmpDir)
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Errorf("expected exit code 2 for an unwritable report, got %v", err)
+	}
+}
+
+func TestWatchLogSubcommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, ".codemap"), 0755)
+	log := `{"time":"2020-01-01T10:00:00Z","op":"WRITE","path":"src/old.go","delta":3}
+{"time":"2099-01-01T10:00:00Z","op":"WRITE","path":"src/main.go","delta":-2,"is_hub":true,"importers":4}
+{"time":"2099-01-01T10:01:00Z","op":"CREATE","path":"web/app.ts","delta":10}
+`
+	os.WriteFile(filepath.Join(tmpDir, ".codemap", "events.jsonl"), []byte(log), 0644)
+
+	output, err := runCodemap("watch", "log", "--since", "1h", tmpDir)
+	if err != nil {
+		t.Fatalf("watch log failed: %v", err)
+	}
+	if strings.Contains(output, "old.go") || !strings.Contains(output, "src/main.go") || !strings.Contains(output, "HUB:4 importers") {
+		t.Errorf("unexpected log output:\n%s", output)
+	}
+
+	output, err = runCodemap("watch", "log", "--path", "*.go", "--json", tmpDir)
+	if err != nil {
+		t.Fatalf("watch log --json failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 Go events, got %d:\n%s", len(lines), output)
+	}
+	var event map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil || event["path"] != "src/main.go" || event["is_hub"] != true {
+		t.Errorf("expected full JSON event for src/main.go, got %s (%v)", lines[1], err)
+	}
+}
+
+func TestWatchAllStatus(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEMAP_HOME", home)
+	os.WriteFile(filepath.Join(home, "projects.json"), []byte(`{"projects": ["/src/api", "/src/web"]}`), 0644)
+
+	for _, args := range [][]string{{"watch", "status", "--all"}, {"daemon", "status"}} {
+		output, err := runCodemap(args...)
+		if err != nil {
+			t.Fatalf("%v failed: %v", args, err)
+		}
+		if !strings.Contains(output, "Supervisor not running") || !strings.Contains(output, "/src/api") || !strings.Contains(output, "/src/web") {
+			t.Errorf("%v: unexpected output:\n%s", args, output)
+		}
+	}
+
+	if _, err := runCodemap("watch", "bogus", "--all"); err == nil {
+		t.Error("unknown --all command should fail")
+	}
+}
+
+func TestWatchLogs(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	output, err := runCodemap("watch", "logs", tmpDir)
+	if err != nil || !strings.Contains(output, "No daemon output logged") {
+		t.Fatalf("expected no output logged, got %q (%v)", output, err)
+	}
+
+	os.MkdirAll(filepath.Join(tmpDir, ".codemap"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, ".codemap", "watch.log"), []byte("one\ntwo\nthree\n"), 0644)
+	output, err = runCodemap("watch", "logs", "-n", "2", tmpDir)
+	if err != nil {
+		t.Fatalf("watch logs failed: %v", err)
+	}
+	if output != "two\nthree\n" {
+		t.Errorf("watch logs -n 2 = %q, want the last two lines", output)
+	}
+}
+
+func TestHistorySubcommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "main.go")
+
+	output, err := runCodemap("history", file)
+	if err != nil || !strings.Contains(output, "No history") {
+		t.Fatalf("expected no history, got %q (%v)", output, err)
+	}
+
+	os.WriteFile(file, []byte("package main\n"), 0644)
+	if _, err := watch.Snapshot(tmpDir, "main.go", "WRITE"); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	os.WriteFile(file, []byte("package main\n\nfunc broken(\n"), 0644)
+
+	output, err = runCodemap("history", file)
+	if err != nil || !strings.Contains(output, "v1") || !strings.Contains(output, "WRITE") {
+		t.Errorf("history: unexpected output %q (%v)", output, err)
+	}
+	output, err = runCodemap("history", "diff", file, "1")
+	if err != nil || !strings.Contains(output, "+func broken(") {
+		t.Errorf("history diff: unexpected output %q (%v)", output, err)
+	}
+	output, err = runCodemap("history", "restore", file, "v1")
+	if err != nil || !strings.Contains(output, "Restored main.go to v1") || !strings.Contains(output, "restore "+file+" 2") {
+		t.Errorf("history restore: unexpected output %q (%v)", output, err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "package main\n" {
+		t.Errorf("file not restored: %q", data)
+	}
+	if _, err := runCodemap("history", "restore", file); err == nil {
+		t.Error("restore without a version should fail")
+	}
+}
+
+func TestSessionsSubcommand(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	output, err := runCodemap("sessions", "list", tmpDir)
+	if err != nil || !strings.Contains(output, "No sessions recorded") {
+		t.Fatalf("expected no sessions, got %q (%v)", output, err)
+	}
+
+	dir := filepath.Join(tmpDir, ".codemap", "sessions")
+	os.MkdirAll(dir, 0755)
+	session := `{"id":"20260101-100000","start":"2026-01-01T10:00:00Z","end":"2026-01-01T10:45:00Z","branch":"feature-x",
+"events":3,"first_event":"2026-01-01T10:05:00Z","last_event":"2026-01-01T10:40:00Z","delta":12,"hub_edits":1,
+"files":[{"path":"src/main.go","edits":2,"delta":10,"is_hub":true,
+"symbols":[{"change":"signature","kind":"function","name":"run","signature":"(ctx context.Context)","old_signature":"()"}]},
+{"path":"src/util.go","edits":1,"delta":2}]}`
+	os.WriteFile(filepath.Join(dir, "20260101-100000.json"), []byte(session), 0644)
+
+	output, err = runCodemap("sessions", "list", tmpDir)
+	if err != nil {
+		t.Fatalf("sessions list failed: %v", err)
+	}
+	for _, want := range []string{"20260101-100000", "45m0s", "feature-x"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("list should contain %q, got:\n%s", want, output)
+		}
+	}
+
+	output, err = runCodemap("sessions", "show", "latest", tmpDir)
+	if err != nil {
+		t.Fatalf("sessions show failed: %v", err)
+	}
+	for _, want := range []string{"Session 20260101-100000", "Hub edits: 1", "src/main.go  HUB", "+12",
+		"changed signature of `run`: () -> (ctx context.Context)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("show should contain %q, got:\n%s", want, output)
+		}
+	}
+
+	if _, err := runCodemap("sessions", "show", "nope", tmpDir); err == nil {
+		t.Error("show of an unknown session should fail")
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"codemap/config"
+	"codemap/scanner"
+	"codemap/watch"
+)
+
+// maxCachedProjects bounds how many projects keep a warm model and a watcher
+// (or a subscription to their CLI daemon)
+const maxCachedProjects = 8
+
+// projects holds the in-memory model of every project a tool has looked at,
+// so repeated calls in a session don't rescan from scratch
+var projects = &projectCache{models: make(map[string]*projectModel)}
+
+type projectCache struct {
+	mu     sync.Mutex
+	models map[string]*projectModel
+}
+
+// get returns the model for a project directory, creating it (and its
+// watcher) on first use and evicting the least recently used one when full.
+// ctx bounds the initial scan; if it fails or is cancelled, the next call
+// retries.
+func (c *projectCache) get(ctx context.Context, path string) (*projectModel, error) {
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %w", err)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", root)
+	}
+
+	var evicted *projectModel
+	c.mu.Lock()
+	m, ok := c.models[root]
+	if ok {
+		m.lastUse = time.Now()
+	} else {
+		m, evicted = c.add(root)
+	}
+	c.mu.Unlock()
+
+	if evicted != nil {
+		evicted.close()
+	}
+
+	// The first caller starts the watcher; others wait for its initial scan
+	if err := m.ensureStarted(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// handOver switches root's model, if it runs a watcher of its own, to the
+// CLI daemon that now watches the project, so it isn't watched twice
+func (c *projectCache) handOver(ctx context.Context, root string) {
+	c.mu.Lock()
+	m := c.models[root]
+	c.mu.Unlock()
+	if m != nil {
+		m.handOver(ctx)
+	}
+}
+
+// add creates an unstarted model and removes the least recently used one
+// when full, returning it for the caller to close. Projects with resource
+// subscriptions are never evicted, since their watcher sends the updates.
+// Must be called with c.mu held.
+func (c *projectCache) add(root string) (m, evicted *projectModel) {
+	if len(c.models) >= maxCachedProjects {
+		for _, old := range c.models {
+			if subscriptions.active(old.root) {
+				continue
+			}
+			if evicted == nil || old.lastUse.Before(evicted.lastUse) {
+				evicted = old
+			}
+		}
+		if evicted != nil {
+			delete(c.models, evicted.root)
+		}
+	}
+
+	m = &projectModel{root: root, lastUse: time.Now()}
+	c.models[root] = m
+	return m, evicted
+}
+
+// projectModel is the cached view of one project. It is kept current by the
+// project's CLI daemon, if one is running, or else by an in-memory watcher of
+// its own; the file list, graph, dependency analyses and symbols are rebuilt
+// lazily after either reports a change.
+type projectModel struct {
+	root    string
+	daemon  atomic.Pointer[watch.Daemon] // our own watcher; nil when following the CLI daemon
+	watched atomic.Bool                  // false until started and once the CLI daemon stops; nothing is cached then
+	lastUse time.Time                    // guarded by projectCache.mu
+	gen     atomic.Uint64                // bumped on every watcher event
+
+	startMu sync.Mutex
+	started bool               // guarded by startMu
+	stream  *watch.EventStream // the CLI daemon's events; guarded by startMu
+
+	mu       sync.Mutex // serializes rebuilds
+	files    cached[[]scanner.FileInfo]
+	graph    cached[*scanner.FileGraph]
+	analyses cached[[]scanner.FileAnalysis]
+	symbols  cached[[]scanner.SymbolAnalysis]
+}
+
+// cached is a derived value and the model generation it was built from
+type cached[T any] struct {
+	value T
+	gen   uint64
+	ok    bool
+}
+
+// ensureStarted follows the project's CLI daemon, or runs an in-memory
+// watcher if there is none, once. If that fails, the error is returned (ctx's
+// own if it was cancelled) and the model is left to be started again. An
+// invalid config only stops the watcher: the model then rebuilds everything
+// on each call until the config is fixed.
+func (m *projectModel) ensureStarted(ctx context.Context) error {
+	m.startMu.Lock()
+	defer m.startMu.Unlock()
+	if m.started {
+		return nil
+	}
+	err := m.start(ctx)
+	if errors.Is(err, config.ErrInvalid) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.started = true
+	return nil
+}
+
+// start must be called with m.startMu held
+func (m *projectModel) start(ctx context.Context) error {
+	// A second watcher would scan the project again and use up inotify
+	// watches the CLI daemon needs
+	if watch.IsRunning(m.root) && m.follow(ctx) {
+		return nil
+	}
+
+	daemon, err := watch.NewDaemon(m.root, false)
+	if err != nil {
+		return err
+	}
+	daemon.SetInMemory(true)
+	daemon.OnEvent(func(watch.Event) {
+		m.changed()
+	})
+	if err := daemon.StartContext(ctx); err != nil {
+		daemon.Stop()
+		if errors.Is(err, context.Canceled) {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// The watcher already built the graph during its initial scan
+	if fg := daemon.FileGraph(); fg != nil {
+		m.graph = cached[*scanner.FileGraph]{value: fg, gen: m.gen.Load(), ok: true}
+	}
+	m.daemon.Store(daemon)
+	m.watched.Store(true)
+	return nil
+}
+
+// follow subscribes to the CLI daemon's events, reporting whether it could.
+// When the daemon stops, the model is left to be started again, with a
+// watcher of its own if no daemon has taken over. Must be called with
+// m.startMu held.
+func (m *projectModel) follow(ctx context.Context) bool {
+	stream, err := watch.NewClient(m.root).Subscribe(context.WithoutCancel(ctx))
+	if err != nil {
+		return false
+	}
+	m.stream = stream
+	m.watched.Store(true)
+
+	go func() {
+		for {
+			if _, err := stream.Next(); err != nil {
+				break
+			}
+			m.changed()
+		}
+		m.watched.Store(false)
+		m.changed()
+
+		m.startMu.Lock()
+		defer m.startMu.Unlock()
+		if m.stream == stream {
+			m.stream = nil
+			m.started = false
+		}
+	}()
+	return true
+}
+
+// handOver stops the model's own watcher and starts again, which follows
+// the CLI daemon if it is running. Nothing changes if the model already
+// follows it or was never started.
+func (m *projectModel) handOver(ctx context.Context) {
+	m.startMu.Lock()
+	defer m.startMu.Unlock()
+	daemon := m.daemon.Swap(nil)
+	if daemon == nil {
+		return
+	}
+	m.watched.Store(false)
+	daemon.Stop()
+	// Events between the two watchers are lost
+	m.changed()
+	m.started = m.start(ctx) == nil
+}
+
+// changed invalidates the cached values and tells subscribed clients
+func (m *projectModel) changed() {
+	m.gen.Add(1)
+	subscriptions.notify(m.root)
+}
+
+func (m *projectModel) close() {
+	// Wait for a start in progress so its watcher isn't leaked
+	m.startMu.Lock()
+	defer m.startMu.Unlock()
+	m.watched.Store(false)
+	if daemon := m.daemon.Swap(nil); daemon != nil {
+		daemon.Stop()
+	}
+	if m.stream != nil {
+		m.stream.Close()
+		m.stream = nil
+	}
+}
+
+// fresh reports whether c can be served without rebuilding
+func fresh[T any](m *projectModel, c cached[T]) bool {
+	return m.watched.Load() && c.ok && c.gen == m.gen.Load()
+}
+
+// Files returns the project's files, sorted by path
+func (m *projectModel) Files(ctx context.Context) ([]scanner.FileInfo, error) {
+	if daemon := m.daemon.Load(); daemon != nil {
+		return daemon.Files(), nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.loadFiles(ctx)
+}
+
+// loadFiles must be called with m.mu held
+func (m *projectModel) loadFiles(ctx context.Context) ([]scanner.FileInfo, error) {
+	if daemon := m.daemon.Load(); daemon != nil {
+		return daemon.Files(), nil
+	}
+	if fresh(m, m.files) {
+		return m.files.value, nil
+	}
+	gen := m.gen.Load()
+	files, err := scanner.ScanFiles(ctx, m.root, scanner.NewGitIgnoreCache(m.root), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	m.files = cached[[]scanner.FileInfo]{value: files, gen: gen, ok: true}
+	return files, nil
+}
+
+// Analyses returns the per-file imports and functions (needs ast-grep)
+func (m *projectModel) Analyses(ctx context.Context) ([]scanner.FileAnalysis, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.loadAnalyses(ctx)
+}
+
+// loadAnalyses must be called with m.mu held
+func (m *projectModel) loadAnalyses(ctx context.Context) ([]scanner.FileAnalysis, error) {
+	if fresh(m, m.analyses) {
+		return m.analyses.value, nil
+	}
+	gen := m.gen.Load()
+	analyses, err := scanner.ScanForDeps(ctx, m.root)
+	if err != nil {
+		return nil, err
+	}
+	m.analyses = cached[[]scanner.FileAnalysis]{value: analyses, gen: gen, ok: true}
+	return analyses, nil
+}
+
+// Graph returns the internal file-to-file dependency graph (needs ast-grep)
+func (m *projectModel) Graph(ctx context.Context) (*scanner.FileGraph, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if fresh(m, m.graph) {
+		return m.graph.value, nil
+	}
+	gen := m.gen.Load()
+	files, err := m.loadFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	analyses, err := m.loadAnalyses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fg, err := scanner.NewFileGraph(m.root, files, analyses)
+	if err != nil {
+		return nil, err
+	}
+	m.graph = cached[*scanner.FileGraph]{value: fg, gen: gen, ok: true}
+	return fg, nil
+}
+
+// Symbols returns the symbols of every file, sorted by path (needs ast-grep)
+func (m *projectModel) Symbols(ctx context.Context) ([]scanner.SymbolAnalysis, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if fresh(m, m.symbols) {
+		return m.symbols.value, nil
+	}
+	gen := m.gen.Load()
+	symbols, err := scanSymbols(ctx, m.root)
+	if err != nil {
+		return nil, err
+	}
+	m.symbols = cached[[]scanner.SymbolAnalysis]{value: symbols, gen: gen, ok: true}
+	return symbols, nil
+}
+
+// projectGraph returns the cached file graph of the project at path
+func projectGraph(ctx context.Context, path string) (*scanner.FileGraph, error) {
+	project, err := projects.get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return project.Graph(ctx)
+}
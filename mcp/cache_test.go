@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"codemap/watch"
+)
+
+// waitFor polls cond until it holds or a few seconds pass
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// startDaemon runs what codemap watch start would for root, in process, and
+// returns a func that stops it early
+func startDaemon(t *testing.T, root string) (stop func()) {
+	t.Helper()
+	daemon, err := watch.NewDaemon(root, false)
+	if err != nil {
+		t.Fatalf("NewDaemon failed: %v", err)
+	}
+	if err := daemon.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	stop = sync.OnceFunc(daemon.Stop)
+	t.Cleanup(stop)
+	if err := daemon.Serve(); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	if err := watch.WritePID(root); err != nil {
+		t.Fatalf("WritePID failed: %v", err)
+	}
+	return stop
+}
+
+// TestProjectFollowsDaemon tests that a project the CLI daemon watches is
+// kept current by its events instead of a second watcher
+func TestProjectFollowsDaemon(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stopDaemon := startDaemon(t, root)
+
+	cache := &projectCache{models: make(map[string]*projectModel)}
+	m, err := cache.get(context.Background(), root)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	defer m.close()
+	if m.daemon.Load() != nil || !m.watched.Load() {
+		t.Fatal("Expected the model to follow the running daemon, not start a watcher")
+	}
+
+	files, err := m.Files(context.Background())
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected 1 file, got %v (%v)", files, err)
+	}
+	gen := m.gen.Load()
+	if err := os.WriteFile(filepath.Join(root, "util.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the daemon's CREATE event", func() bool { return m.gen.Load() != gen })
+	if files, err := m.Files(context.Background()); err != nil || len(files) != 2 {
+		t.Errorf("Expected the new file after the event, got %v (%v)", files, err)
+	}
+
+	stopDaemon()
+	waitFor(t, "the stream to end", func() bool { return !m.watched.Load() })
+}
+
+// TestProjectHandsOverToDaemon tests that a model with a watcher of its own
+// switches to the CLI daemon once start_watch has started one
+func TestProjectHandsOverToDaemon(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := &projectCache{models: make(map[string]*projectModel)}
+	m, err := cache.get(context.Background(), root)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	defer m.close()
+	if m.daemon.Load() == nil {
+		t.Fatal("Expected an in-memory watcher with no daemon running")
+	}
+
+	startDaemon(t, root)
+	cache.handOver(context.Background(), root)
+	if m.daemon.Load() != nil || !m.watched.Load() || m.stream == nil {
+		t.Fatal("Expected the model to follow the daemon after the hand-over")
+	}
+
+	gen := m.gen.Load()
+	if err := os.WriteFile(filepath.Join(root, "util.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the daemon's CREATE event", func() bool { return m.gen.Load() != gen })
+	if files, err := m.Files(context.Background()); err != nil || len(files) != 2 {
+		t.Errorf("Expected the new file after the event, got %v (%v)", files, err)
+	}
+}
+
+// TestProjectStartErrors tests that a watcher that can't start fails the
+// call instead of leaving an unwatched model behind
+func TestProjectStartErrors(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".codemap"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".codemap", "config.json"), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// An invalid config stops the watcher, not the tools
+	cache := &projectCache{models: make(map[string]*projectModel)}
+	m, err := cache.get(context.Background(), root)
+	if err != nil {
+		t.Fatalf("invalid config should not fail the tools: %v", err)
+	}
+	if m.watched.Load() || m.daemon.Load() != nil {
+		t.Error("invalid config should leave the project unwatched")
+	}
+	if files, err := m.Files(context.Background()); err != nil || len(files) != 1 {
+		t.Errorf("Files = %v, %v; want main.go from an uncached scan", files, err)
+	}
+
+	// Once fixed, the next call starts the watcher
+	if err := os.WriteFile(filepath.Join(root, ".codemap", "config.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = cache.get(context.Background(), root); err != nil || m.daemon.Load() == nil {
+		t.Errorf("fixed config should start the watcher: %v", err)
+	}
+	m.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.get(ctx, t.TempDir()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// httpPath is where the streamable HTTP endpoint is mounted
+const httpPath = "/mcp"
+
+// httpSessionTimeout closes sessions of clients that went away without
+// ending them, so what is kept per session (roots, subscriptions) is freed
+const httpSessionTimeout = 30 * time.Minute
+
+// listenAddr binds to localhost when addr has no host (":8080"), so the
+// server is only reachable from other interfaces when asked for explicitly
+func listenAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid --http address %q (use :port or host:port): %w", addr, err)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// isLoopback reports whether a listen address only accepts local connections
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	return err == nil && isLoopbackHost(host)
+}
+
+// isLoopbackHost reports whether a host name or IP is this machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// localOnly guards a server without a token against DNS rebinding: a web
+// page can make the browser send it requests, but only under the page's own
+// Host and Origin. So when listening on loopback, Host must name the
+// loopback port served at addr, and a browser's Origin must be local too.
+func localOnly(addr string, next http.Handler) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+	checkHost := isLoopback(addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checkHost {
+			host, hostPort, err := net.SplitHostPort(r.Host)
+			if err != nil || hostPort != port || !isLoopbackHost(host) {
+				http.Error(w, "invalid Host header", http.StatusForbidden)
+				return
+			}
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || !isLoopbackHost(u.Hostname()) {
+				http.Error(w, "invalid Origin header", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newHTTPHandler serves one shared MCP server to every client session, so
+// watchers and subscriptions are shared across clients. A non-empty token is
+// required as "Authorization: Bearer <token>" on every request; without
+// one, only local requests to addr, where the server listens, are served.
+func newHTTPHandler(server *mcp.Server, addr, token string) http.Handler {
+	var handler http.Handler = mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+		return server
+	}, &mcp.StreamableHTTPOptions{SessionTimeout: httpSessionTimeout})
+
+	if token != "" {
+		verify := func(ctx context.Context, got string, req *http.Request) (*auth.TokenInfo, error) {
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				return nil, auth.ErrInvalidToken
+			}
+			return &auth.TokenInfo{Expiration: time.Now().Add(time.Hour)}, nil
+		}
+		handler = auth.RequireBearerToken(verify, nil)(handler)
+	} else {
+		handler = localOnly(addr, handler)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(httpPath, handler)
+	return mux
+}
+
+// serveHTTP runs the MCP server over streamable HTTP until ctx is cancelled
+func serveHTTP(ctx context.Context, server *mcp.Server, addr, token string) error {
+	addr, err := listenAddr(addr)
+	if err != nil {
+		return err
+	}
+	if !isLoopback(addr) && token == "" {
+		log.Printf("Warning: serving on %s without a token; anyone who can reach it can read your files (set --token)", addr)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: newHTTPHandler(server, ln.Addr().String(), token)}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("codemap MCP server listening on http://%s%s", ln.Addr(), httpPath)
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
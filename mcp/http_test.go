@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// initializeBody is the first request a client sends
+const initializeBody = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`
+
+func TestListenAddr(t *testing.T) {
+	tests := []struct {
+		addr, want string
+		loopback   bool
+	}{
+		{":8080", "127.0.0.1:8080", true},
+		{"localhost:8080", "localhost:8080", true},
+		{"[::1]:8080", "[::1]:8080", true},
+		{"0.0.0.0:8080", "0.0.0.0:8080", false},
+	}
+	for _, tt := range tests {
+		got, err := listenAddr(tt.addr)
+		if err != nil || got != tt.want {
+			t.Errorf("listenAddr(%q) = %q, %v; want %q", tt.addr, got, err, tt.want)
+		}
+		if isLoopback(got) != tt.loopback {
+			t.Errorf("isLoopback(%q) = %v, want %v", got, !tt.loopback, tt.loopback)
+		}
+	}
+	if _, err := listenAddr("8080"); err == nil {
+		t.Error("an address without a port separator should be rejected")
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	const addr = "127.0.0.1:8080"
+	tests := []struct {
+		name   string
+		addr   string
+		token  string
+		host   string
+		header map[string]string
+		want   int
+	}{
+		{name: "localhost default", host: addr, want: http.StatusOK},
+		{name: "localhost by name", host: "localhost:8080", want: http.StatusOK},
+		{name: "local origin", host: addr, header: map[string]string{"Origin": "http://localhost:3000"}, want: http.StatusOK},
+		{name: "rebound host", host: "evil.example:8080", want: http.StatusForbidden},
+		{name: "other port", host: "127.0.0.1:9090", want: http.StatusForbidden},
+		{name: "foreign origin", host: addr, header: map[string]string{"Origin": "http://evil.example"}, want: http.StatusForbidden},
+		{name: "explicit interface", addr: "0.0.0.0:8080", host: "192.0.2.1:8080", want: http.StatusOK},
+		{name: "missing token", token: "secret", host: addr, want: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", host: addr, header: map[string]string{"Authorization": "Bearer guess"}, want: http.StatusUnauthorized},
+		{name: "correct token", token: "secret", host: "192.0.2.1:8080", header: map[string]string{"Authorization": "Bearer secret", "Origin": "http://evil.example"}, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served := tt.addr
+			if served == "" {
+				served = addr
+			}
+			handler := newHTTPHandler(newServer(), served, tt.token)
+
+			req := httptest.NewRequest(http.MethodPost, httpPath, strings.NewReader(initializeBody))
+			req.Host = tt.host
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", "application/json, text/event-stream")
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
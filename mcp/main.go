@@ -2,16 +2,20 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"regexp"
+	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"codemap/render"
@@ -21,51 +25,202 @@ import (
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-// Global watcher registry - tracks active watchers per project
+// serverVersion is reported to clients and by the status tool
+const serverVersion = "2.1.0"
+
+// Projects whose watch daemon this server started or attached to. The
+// daemons are the CLI's (codemap watch start), so both share one event log.
 var (
-	watchers   = make(map[string]*watch.Daemon)
-	watchersMu sync.RWMutex
+	watchers   = make(map[string]bool)
+	watchersMu sync.Mutex
+
+	startWatchMu sync.Mutex // serializes start_watch and stop_watch so a project gets one daemon
 )
 
+// attachWatcher records that this server uses the daemon watching root
+func attachWatcher(root string) {
+	watchersMu.Lock()
+	watchers[root] = true
+	watchersMu.Unlock()
+}
+
+// watchStartTimeout bounds how long start_watch waits for a new daemon's
+// initial scan before reporting it as still starting
+const watchStartTimeout = 10 * time.Second
+
+// watchedProjects returns the attached projects whose daemon is still running
+func watchedProjects() []string {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+
+	var roots []string
+	for root := range watchers {
+		if watch.IsRunning(root) {
+			roots = append(roots, root)
+		} else {
+			delete(watchers, root)
+		}
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// codemapBinary finds the codemap CLI that runs watch daemons: $CODEMAP_BIN,
+// then a codemap binary next to this server, then one on PATH
+func codemapBinary() (string, error) {
+	if bin := os.Getenv("CODEMAP_BIN"); bin != "" {
+		return bin, nil
+	}
+	name := "codemap"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	if exe, err := os.Executable(); err == nil {
+		sibling := filepath.Join(filepath.Dir(exe), name)
+		if _, err := os.Stat(sibling); err == nil {
+			return sibling, nil
+		}
+	}
+	bin, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("codemap CLI not found; install it on PATH or set CODEMAP_BIN")
+	}
+	return bin, nil
+}
+
+// watchPath checks a watch tool's path argument and resolves it to the
+// watched project it is in, so a subdirectory finds its project's daemon,
+// standalone or supervised
+func watchPath(ctx context.Context, req *mcp.CallToolRequest, path string) (string, error) {
+	absPath, err := toolPath(ctx, req, path)
+	if err != nil {
+		return "", err
+	}
+	if root, ok := watch.WatchedRoot(absPath); ok && root != absPath {
+		if allowed, err := toolPath(ctx, req, root); err == nil {
+			return allowed, nil
+		}
+	}
+	return absPath, nil
+}
+
+// daemonFileCount is the number of files a running daemon tracks
+func daemonFileCount(root string) int {
+	if h, err := watch.NewClient(root).Health(); err == nil {
+		return h.Files
+	}
+	if state := watch.LoadState(root); state != nil {
+		return state.FileCount
+	}
+	return 0
+}
+
+// daemonEvents returns a running daemon's events, oldest first, from its
+// query API or else its event log
+func daemonEvents(root string) ([]watch.Event, error) {
+	if events, err := watch.NewClient(root).Events(time.Time{}, 0); err == nil {
+		return events, nil
+	}
+	return watch.ReadEvents(root, time.Time{})
+}
+
 // Input types for tools
 type PathInput struct {
+	FormatInput
+	PageInput
 	Path string `json:"path" jsonschema:"Path to the project directory to analyze"`
 }
 
 type DiffInput struct {
+	FormatInput
+	PageInput
 	Path string `json:"path" jsonschema:"Path to the project directory to analyze"`
 	Ref  string `json:"ref,omitempty" jsonschema:"Git branch/ref to compare against (default: main)"`
 }
 
 type FindInput struct {
+	FormatInput
+	PageInput
 	Path    string `json:"path" jsonschema:"Path to the project directory to search"`
 	Pattern string `json:"pattern" jsonschema:"Filename pattern to search for (case-insensitive substring match)"`
 }
 
 type ImportersInput struct {
+	FormatInput
+	PageInput
+	Path string `json:"path" jsonschema:"Path to the project directory"`
+	File string `json:"file" jsonschema:"Relative path to the file to check (e.g. src/utils.ts)"`
+}
+
+type FileContextInput struct {
+	FormatInput
+	PageInput
 	Path string `json:"path" jsonschema:"Path to the project directory"`
 	File string `json:"file" jsonschema:"Relative path to the file to check (e.g. src/utils.ts)"`
 }
 
 type ListProjectsInput struct {
+	FormatInput
+	PageInput
 	Path    string `json:"path" jsonschema:"Parent directory containing projects (e.g. /Users/name/Code or ~/Code)"`
 	Pattern string `json:"pattern,omitempty" jsonschema:"Optional filter to match project names (case-insensitive substring)"`
 }
 
 type WatchInput struct {
+	FormatInput
 	Path string `json:"path" jsonschema:"Path to the project directory to watch"`
 }
 
 type WatchActivityInput struct {
+	FormatInput
+	PageInput
 	Path    string `json:"path" jsonschema:"Path to the project directory"`
 	Minutes int    `json:"minutes,omitempty" jsonschema:"Look back this many minutes (default: 30)"`
 }
 
 func main() {
-	server := mcp.NewServer(&mcp.Implementation{
+	httpAddr := flag.String("http", "", "Serve streamable HTTP on this address (e.g. :8080, localhost only unless a host is given) instead of stdio")
+	token := flag.String("token", os.Getenv("CODEMAP_MCP_TOKEN"), "Bearer token HTTP clients must send (env: CODEMAP_MCP_TOKEN)")
+	var roots rootsFlag
+	flag.Var(&roots, "root", "Only allow access to this directory; repeatable (env: "+rootsEnv+", separated by \""+string(os.PathListSeparator)+"\")")
+	flag.Parse()
+
+	if len(roots) == 0 {
+		roots = filepath.SplitList(os.Getenv(rootsEnv))
+	}
+	if err := setAllowedRoots(roots); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	if *httpAddr != "" {
+		// One long-lived server shared by all HTTP clients
+		err = serveHTTP(ctx, newServer(), *httpAddr, *token)
+	} else {
+		// Run server on stdio
+		err = newServer().Run(ctx, &mcp.StdioTransport{})
+	}
+	if err != nil {
+		log.Printf("Server error: %v", err)
+	}
+}
+
+// newServer creates the MCP server with all codemap tools, resources and prompts registered
+func newServer() *mcp.Server {
+	var server *mcp.Server
+	server = mcp.NewServer(&mcp.Implementation{
 		Name:    "codemap",
-		Version: "2.0.0",
-	}, nil)
+		Version: serverVersion,
+	}, &mcp.ServerOptions{
+		SubscribeHandler: func(ctx context.Context, req *mcp.SubscribeRequest) error {
+			return subscribeResource(ctx, server, req)
+		},
+		UnsubscribeHandler:      unsubscribeResource,
+		RootsListChangedHandler: forgetRoots,
+	})
 
 	// Tool: get_structure - Get project tree view
 	mcp.AddTool(server, &mcp.Tool{
@@ -114,13 +269,13 @@ func main() {
 	// Tool: start_watch - Start watching a project
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "start_watch",
-		Description: "Start live file watching for a project. Tracks file changes in real-time with timestamps, line deltas, and git status. The watcher runs in background - use get_activity to see what's happening.",
+		Description: "Start live file watching for a project. Tracks file changes in real-time with timestamps, line deltas, and git status. The watcher is the same background daemon as \"codemap watch start\" and keeps running until stopped - use get_activity to see what's happening.",
 	}, handleStartWatch)
 
 	// Tool: stop_watch - Stop watching a project
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "stop_watch",
-		Description: "Stop the live file watcher for a project.",
+		Description: "Stop the live file watcher (background daemon) for a project.",
 	}, handleStopWatch)
 
 	// Tool: get_activity - Get recent coding activity
@@ -143,10 +298,30 @@ func main() {
 		Description: "Get complete dependency context for a specific file: what it imports, what imports it, whether it's a hub, and all connected files. Use this before editing a file to understand its role in the codebase.",
 	}, handleGetFileContext)
 
-	// Run server on stdio
-	if err := server.Run(context.Background(), &mcp.StdioTransport{}); err != nil {
-		log.Printf("Server error: %v", err)
-	}
+	// === SYMBOL TOOLS ===
+
+	// Tool: get_symbols - List symbol definitions
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_symbols",
+		Description: "List symbol definitions (functions, methods, classes, types, constants...) with file, line, scope and signature. Filter by file or directory, kind, and exported-only. Requires ast-grep.",
+	}, handleGetSymbols)
+
+	// Tool: find_symbol - Locate a symbol definition
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "find_symbol",
+		Description: "Find where a symbol is defined. Returns file:line locations with scope and signature, best match first. Use Type.member to search inside a class or struct, and fuzzy for partial names. Use this instead of grepping for definitions.",
+	}, handleFindSymbol)
+
+	// Tool: get_outline - Compact outline of one file
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_outline",
+		Description: "Get a compact outline of one file: its definitions in source order with line numbers, members indented under their class or struct. Use this to navigate a large file before reading it.",
+	}, handleGetOutline)
+
+	addResources(server)
+	addPrompts(server)
+
+	return server
 }
 
 func textResult(text string) *mcp.CallToolResult {
@@ -166,86 +341,165 @@ func errorResult(text string) *mcp.CallToolResult {
 	}
 }
 
-func handleGetStructure(ctx context.Context, req *mcp.CallToolRequest, input PathInput) (*mcp.CallToolResult, any, error) {
-	absRoot, err := filepath.Abs(input.Path)
+func handleGetStructure(ctx context.Context, req *mcp.CallToolRequest, input PathInput) (*mcp.CallToolResult, *StructureOutput, error) {
+	ctx = toolProgress(ctx, req)
+	path, err := toolPath(ctx, req, input.Path)
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	project, err := projects.get(ctx, path)
 	if err != nil {
 		return errorResult("Invalid path: " + err.Error()), nil, nil
 	}
+	absRoot := project.root
 
-	gitCache := scanner.NewGitIgnoreCache(input.Path)
-	files, err := scanner.ScanFiles(input.Path, gitCache, nil, nil)
+	files, err := project.Files(ctx)
 	if err != nil {
 		return errorResult("Scan error: " + err.Error()), nil, nil
 	}
 
-	project := scanner.Project{
-		Root:  absRoot,
-		Mode:  "tree",
-		Files: files,
+	out := &StructureOutput{
+		Root:      absRoot,
+		FileCount: len(files),
+	}
+	for _, f := range files {
+		out.TotalSize += f.Size
 	}
-
-	output := captureOutput(func() {
-		render.Tree(project)
-	})
 
 	// Add hub file summary
-	fg, err := scanner.BuildFileGraph(input.Path)
+	var hubSummary string
+	fg, err := project.Graph(ctx)
 	if err == nil {
-		hubs := fg.HubFiles()
-		if len(hubs) > 0 {
-			output += "\n⚠️  HUB FILES (high-impact, 3+ dependents):\n"
-			// Sort by importer count
-			sort.Slice(hubs, func(i, j int) bool {
-				return len(fg.Importers[hubs[i]]) > len(fg.Importers[hubs[j]])
-			})
-			for i, hub := range hubs {
+		out.Hubs = hubEntries(fg)
+		if len(out.Hubs) > 0 {
+			hubSummary = "\n⚠️  HUB FILES (high-impact, 3+ dependents):\n"
+			for i, hub := range out.Hubs {
 				if i >= 5 {
-					output += fmt.Sprintf("   ... and %d more hubs\n", len(hubs)-5)
+					hubSummary += fmt.Sprintf("   ... and %d more hubs\n", len(out.Hubs)-5)
 					break
 				}
-				output += fmt.Sprintf("   %s (%d importers)\n", hub, len(fg.Importers[hub]))
+				hubSummary += fmt.Sprintf("   %s (%d importers)\n", hub.Path, hub.Importers)
 			}
 		}
 	}
 
-	return textResult(output), nil, nil
+	output, out, page, err := paginate(files, input.PageInput, input.Format, func(files []scanner.FileInfo) (string, *StructureOutput, error) {
+		tree := scanner.Project{
+			Root:  absRoot,
+			Mode:  "tree",
+			Files: files,
+		}
+		var buf strings.Builder
+		if err := render.Tree(tree, render.Options{Writer: &buf}); err != nil {
+			return "", nil, fmt.Errorf("Render error: %w", err)
+		}
+		pageOut := *out
+		pageOut.Files = fileEntries(files)
+		return buf.String() + hubSummary, &pageOut, nil
+	})
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	out.Page = pageOf(page)
+
+	return toolResult(input.Format, output+page.summary("files")), out, nil
 }
 
-func handleGetDependencies(ctx context.Context, req *mcp.CallToolRequest, input PathInput) (*mcp.CallToolResult, any, error) {
-	absRoot, err := filepath.Abs(input.Path)
+func handleGetDependencies(ctx context.Context, req *mcp.CallToolRequest, input PathInput) (*mcp.CallToolResult, *DependenciesOutput, error) {
+	ctx = toolProgress(ctx, req)
+	path, err := toolPath(ctx, req, input.Path)
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	project, err := projects.get(ctx, path)
 	if err != nil {
 		return errorResult("Invalid path: " + err.Error()), nil, nil
 	}
+	absRoot := project.root
 
-	analyses, err := scanner.ScanForDeps(input.Path)
+	analyses, err := project.Analyses(ctx)
 	if err != nil {
 		return errorResult("Scan error: " + err.Error()), nil, nil
 	}
 
-	depsProject := scanner.DepsProject{
-		Root:         absRoot,
-		Mode:         "deps",
-		Files:        analyses,
-		ExternalDeps: scanner.ReadExternalDeps(absRoot),
-	}
+	// Cursors need a stable order; the cached slice is shared, so sort a copy
+	analyses = slices.Clone(analyses)
+	sort.Slice(analyses, func(i, j int) bool { return analyses[i].Path < analyses[j].Path })
+	externalDeps := scanner.ReadExternalDeps(absRoot)
+
+	out := &DependenciesOutput{Root: absRoot}
+	for lang, deps := range externalDeps {
+		if len(deps) == 0 {
+			continue
+		}
+		if out.ExternalDeps == nil {
+			out.ExternalDeps = make(map[string][]string)
+		}
+		out.ExternalDeps[lang] = deps
+	}
+	// Internal edges come from the same analyses
+	var edges []Edge
+	if fg, err := project.Graph(ctx); err == nil {
+		edges = graphEdges(fg)
+		out.Hubs = hubEntries(fg)
+	}
+
+	// Each page is rendered from its own files, so the text flow only shows
+	// imports between files on the page; edges and hubs cover the whole project
+	output, out, page, err := paginate(analyses, input.PageInput, input.Format, func(analyses []scanner.FileAnalysis) (string, *DependenciesOutput, error) {
+		depsProject := scanner.DepsProject{
+			Root:         absRoot,
+			Mode:         "deps",
+			Files:        analyses,
+			ExternalDeps: externalDeps,
+		}
+		var buf strings.Builder
+		if err := render.Depgraph(depsProject, render.Options{Writer: &buf}); err != nil {
+			return "", nil, fmt.Errorf("Render error: %w", err)
+		}
 
-	output := captureOutput(func() {
-		render.Depgraph(depsProject)
+		pageOut := *out
+		onPage := make(map[string]bool, len(analyses))
+		for _, a := range analyses {
+			onPage[a.Path] = true
+			pageOut.Files = append(pageOut.Files, DependencyFile{
+				Path:      a.Path,
+				Language:  a.Language,
+				Functions: a.Functions,
+				Imports:   a.Imports,
+			})
+		}
+		for _, e := range edges {
+			if onPage[e.From] {
+				pageOut.Edges = append(pageOut.Edges, e)
+			}
+		}
+		return buf.String(), &pageOut, nil
 	})
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	out.Page = pageOf(page)
 
-	return textResult(output), nil, nil
+	return toolResult(input.Format, output+page.summary("files")), out, nil
 }
 
-func handleGetDiff(ctx context.Context, req *mcp.CallToolRequest, input DiffInput) (*mcp.CallToolResult, any, error) {
+func handleGetDiff(ctx context.Context, req *mcp.CallToolRequest, input DiffInput) (*mcp.CallToolResult, *DiffOutput, error) {
+	ctx = toolProgress(ctx, req)
 	ref := input.Ref
 	if ref == "" {
 		ref = "main"
 	}
 
-	absRoot, err := filepath.Abs(input.Path)
+	path, err := toolPath(ctx, req, input.Path)
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	project, err := projects.get(ctx, path)
 	if err != nil {
 		return errorResult("Invalid path: " + err.Error()), nil, nil
 	}
+	absRoot := project.root
 
 	diffInfo, err := scanner.GitDiffInfo(absRoot, ref)
 	if err != nil {
@@ -253,80 +507,143 @@ func handleGetDiff(ctx context.Context, req *mcp.CallToolRequest, input DiffInpu
 	}
 
 	if len(diffInfo.Changed) == 0 {
-		return textResult("No files changed vs " + ref), nil, nil
+		return toolResult(input.Format, "No files changed vs "+ref), &DiffOutput{Root: absRoot, Ref: ref}, nil
 	}
 
-	gitCache := scanner.NewGitIgnoreCache(input.Path)
-	files, err := scanner.ScanFiles(input.Path, gitCache, nil, nil)
+	files, err := project.Files(ctx)
 	if err != nil {
 		return errorResult("Scan error: " + err.Error()), nil, nil
 	}
 
 	files = scanner.FilterToChangedWithInfo(files, diffInfo)
-	impact := scanner.AnalyzeImpact(absRoot, files)
+	impact := scanner.AnalyzeImpact(ctx, absRoot, files)
 
-	project := scanner.Project{
-		Root:    absRoot,
-		Mode:    "tree",
-		Files:   files,
-		DiffRef: ref,
-		Impact:  impact,
+	out := &DiffOutput{
+		Root: absRoot,
+		Ref:  ref,
+	}
+	for _, f := range files {
+		out.Added += f.Added
+		out.Removed += f.Removed
 	}
 
-	output := captureOutput(func() {
-		render.Tree(project)
+	output, out, page, err := paginate(files, input.PageInput, input.Format, func(files []scanner.FileInfo) (string, *DiffOutput, error) {
+		onPage := make(map[string]bool, len(files))
+		for _, f := range files {
+			onPage[f.Path] = true
+		}
+		var pageImpact []scanner.ImpactInfo
+		for _, imp := range impact {
+			if onPage[imp.File] {
+				pageImpact = append(pageImpact, imp)
+			}
+		}
+
+		tree := scanner.Project{
+			Root:    absRoot,
+			Mode:    "tree",
+			Files:   files,
+			DiffRef: ref,
+			Impact:  pageImpact,
+		}
+		var buf strings.Builder
+		if err := render.Tree(tree, render.Options{Writer: &buf}); err != nil {
+			return "", nil, fmt.Errorf("Render error: %w", err)
+		}
+
+		pageOut := *out
+		pageOut.Files = fileEntries(files)
+		for _, imp := range pageImpact {
+			pageOut.Impact = append(pageOut.Impact, ImpactEntry{File: imp.File, UsedBy: imp.UsedBy})
+		}
+		return buf.String(), &pageOut, nil
 	})
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	out.Page = pageOf(page)
 
-	return textResult(output), nil, nil
+	return toolResult(input.Format, output+page.summary("changed files")), out, nil
 }
 
-func handleFindFile(ctx context.Context, req *mcp.CallToolRequest, input FindInput) (*mcp.CallToolResult, any, error) {
-	gitCache := scanner.NewGitIgnoreCache(input.Path)
-	files, err := scanner.ScanFiles(input.Path, gitCache, nil, nil)
+func handleFindFile(ctx context.Context, req *mcp.CallToolRequest, input FindInput) (*mcp.CallToolResult, *FindOutput, error) {
+	ctx = toolProgress(ctx, req)
+	path, err := toolPath(ctx, req, input.Path)
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	project, err := projects.get(ctx, path)
+	if err != nil {
+		return errorResult("Invalid path: " + err.Error()), nil, nil
+	}
+	files, err := project.Files(ctx)
 	if err != nil {
 		return errorResult("Scan error: " + err.Error()), nil, nil
 	}
 
 	// Filter files matching pattern (case-insensitive)
-	var matches []string
+	var matched []scanner.FileInfo
 	pattern := strings.ToLower(input.Pattern)
 	for _, f := range files {
 		if strings.Contains(strings.ToLower(f.Path), pattern) {
-			matches = append(matches, f.Path)
+			matched = append(matched, f)
 		}
 	}
 
-	if len(matches) == 0 {
-		return textResult("No files found matching '" + input.Pattern + "'"), nil, nil
+	if len(matched) == 0 {
+		return toolResult(input.Format, "No files found matching '"+input.Pattern+"'"), &FindOutput{Pattern: input.Pattern}, nil
+	}
+
+	output, out, page, err := paginate(matched, input.PageInput, input.Format, func(files []scanner.FileInfo) (string, *FindOutput, error) {
+		var matches []string
+		for _, f := range files {
+			matches = append(matches, f.Path)
+		}
+		out := &FindOutput{Pattern: input.Pattern, Files: fileEntries(files)}
+		return fmt.Sprintf("Found %d files:\n%s", len(matched), strings.Join(matches, "\n")), out, nil
+	})
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
 	}
+	out.Page = pageOf(page)
 
-	return textResult(fmt.Sprintf("Found %d files:\n%s", len(matches), strings.Join(matches, "\n"))), nil, nil
+	return toolResult(input.Format, output+page.summary("files")), out, nil
 }
 
-// EmptyInput for tools that don't need parameters
-type EmptyInput struct{}
+// StatusInput for the status tool, which only takes the result format
+type StatusInput struct {
+	FormatInput
+}
 
-func handleStatus(ctx context.Context, req *mcp.CallToolRequest, input EmptyInput) (*mcp.CallToolResult, any, error) {
+func handleStatus(ctx context.Context, req *mcp.CallToolRequest, input StatusInput) (*mcp.CallToolResult, *StatusOutput, error) {
 	cwd, _ := os.Getwd()
 	home := os.Getenv("HOME")
 
 	// Check active watchers
-	watchersMu.RLock()
-	activeWatchers := len(watchers)
-	var watchedPaths []string
-	for path := range watchers {
-		watchedPaths = append(watchedPaths, path)
+	watchedPaths := watchedProjects()
+	activeWatchers := len(watchedPaths)
+
+	out := &StatusOutput{
+		Version:    serverVersion,
+		WorkingDir: cwd,
+		HomeDir:    home,
+		Watching:   watchedPaths,
+		Roots:      allowedRoots,
+	}
+
+	access := "enabled"
+	if len(allowedRoots) > 0 {
+		access = "limited to " + strings.Join(allowedRoots, ", ")
 	}
-	watchersMu.RUnlock()
 
 	watchStatus := "none"
 	if activeWatchers > 0 {
 		watchStatus = fmt.Sprintf("%d active: %s", activeWatchers, strings.Join(watchedPaths, ", "))
 	}
 
-	return textResult(fmt.Sprintf(`codemap MCP server v2.1.0
+	return toolResult(input.Format, fmt.Sprintf(`codemap MCP server v%s
 Status: connected
-Local filesystem access: enabled
+Local filesystem access: %s
 Working directory: %s
 Home directory: %s
 Active watchers: %s
@@ -342,20 +659,25 @@ Available tools:
 Live watch tools:
   start_watch      - Start watching a project for changes
   stop_watch       - Stop watching a project
-  get_activity     - See recent coding activity (hot files, edits, timeline)`, cwd, home, watchStatus)), nil, nil
-}
+  get_activity     - See recent coding activity (hot files, edits, timeline)
 
-func handleListProjects(ctx context.Context, req *mcp.CallToolRequest, input ListProjectsInput) (*mcp.CallToolResult, any, error) {
-	// Expand ~ to home directory
-	path := input.Path
-	if strings.HasPrefix(path, "~/") {
-		home := os.Getenv("HOME")
-		path = filepath.Join(home, path[2:])
-	}
+File graph tools:
+  get_hubs         - Files imported by 3+ others
+  get_file_context - A file's imports, importers and hub status
+
+Symbol tools (need ast-grep):
+  get_symbols      - List definitions, filtered by file, kind or exported
+  find_symbol      - Locate where a symbol is defined
+  get_outline      - Compact outline of one file
+
+All tools accept format: "json" for structured results.`, serverVersion, access, cwd, home, watchStatus)), out, nil
+}
 
-	absPath, err := filepath.Abs(path)
+func handleListProjects(ctx context.Context, req *mcp.CallToolRequest, input ListProjectsInput) (*mcp.CallToolResult, *ListProjectsOutput, error) {
+	ctx = toolProgress(ctx, req)
+	absPath, err := toolPath(ctx, req, input.Path)
 	if err != nil {
-		return errorResult("Invalid path: " + err.Error()), nil, nil
+		return errorResult(err.Error()), nil, nil
 	}
 
 	entries, err := os.ReadDir(absPath)
@@ -364,7 +686,7 @@ func handleListProjects(ctx context.Context, req *mcp.CallToolRequest, input Lis
 	}
 
 	pattern := strings.ToLower(input.Pattern)
-	var projects []string
+	var names []string
 
 	for _, entry := range entries {
 		if !entry.IsDir() {
@@ -381,19 +703,15 @@ func handleListProjects(ctx context.Context, req *mcp.CallToolRequest, input Lis
 		if pattern != "" && !strings.Contains(strings.ToLower(name), pattern) {
 			continue
 		}
-
-		// Get project stats
-		projectPath := filepath.Join(absPath, name)
-		stats := getProjectStats(projectPath)
-
-		projects = append(projects, fmt.Sprintf("%-30s %s", name+"/", stats))
+		names = append(names, name)
 	}
 
-	if len(projects) == 0 {
+	if len(names) == 0 {
+		out := &ListProjectsOutput{Root: absPath}
 		if pattern != "" {
-			return textResult(fmt.Sprintf("No projects matching '%s' in %s", input.Pattern, absPath)), nil, nil
+			return toolResult(input.Format, fmt.Sprintf("No projects matching '%s' in %s", input.Pattern, absPath)), out, nil
 		}
-		return textResult("No project directories found in " + absPath), nil, nil
+		return toolResult(input.Format, "No project directories found in "+absPath), out, nil
 	}
 
 	header := fmt.Sprintf("Projects in %s", absPath)
@@ -401,17 +719,42 @@ func handleListProjects(ctx context.Context, req *mcp.CallToolRequest, input Lis
 		header = fmt.Sprintf("Projects matching '%s' in %s", input.Pattern, absPath)
 	}
 
-	return textResult(fmt.Sprintf("%s:\n\n%s", header, strings.Join(projects, "\n"))), nil, nil
+	// Stats need a scan per project, so only projects on the page are scanned,
+	// each once even when the page is resized to fit a token budget
+	stats := make(map[string]ProjectEntry)
+	output, out, page, err := paginate(names, input.PageInput, input.Format, func(names []string) (string, *ListProjectsOutput, error) {
+		out := &ListProjectsOutput{Root: absPath}
+		var projects []string
+		for _, name := range names {
+			entry, ok := stats[name]
+			if !ok {
+				entry = getProjectStats(ctx, filepath.Join(absPath, name))
+				entry.Name = name
+				stats[name] = entry
+			}
+			out.Projects = append(out.Projects, entry)
+			projects = append(projects, fmt.Sprintf("%-30s %s", name+"/", entry.summary()))
+		}
+		return fmt.Sprintf("%s:\n\n%s", header, strings.Join(projects, "\n")), out, nil
+	})
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	out.Page = pageOf(page)
+
+	return toolResult(input.Format, output+page.summary("projects")), out, nil
 }
 
-// getProjectStats returns a brief summary of a project directory
+// getProjectStats returns file count, primary language and git status for a project directory
 // Uses the same scanner logic as the main codemap command (respects nested .gitignore files)
-func getProjectStats(path string) string {
+func getProjectStats(ctx context.Context, path string) ProjectEntry {
+	entry := ProjectEntry{Path: path, Files: -1}
 	gitCache := scanner.NewGitIgnoreCache(path)
-	files, err := scanner.ScanFiles(path, gitCache, nil, nil)
+	files, err := scanner.ScanFiles(ctx, path, gitCache, nil, nil)
 	if err != nil {
-		return "(error scanning)"
+		return entry
 	}
+	entry.Files = len(files)
 
 	// Count files by language
 	langCounts := make(map[string]int)
@@ -431,98 +774,109 @@ func getProjectStats(path string) string {
 			primaryLang = lang
 		}
 	}
+	entry.Language = primaryLang
 
 	// Check if it's a git repo
-	isGit := ""
 	if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
-		isGit = " [git]"
+		entry.Git = true
 	}
+	return entry
+}
 
-	if lang, ok := scanner.LangDisplay[primaryLang]; ok {
-		return fmt.Sprintf("(%d files, %s%s)", len(files), lang, isGit)
+// summary formats project stats for the text listing
+func (p ProjectEntry) summary() string {
+	if p.Files < 0 {
+		return "(error scanning)"
+	}
+	isGit := ""
+	if p.Git {
+		isGit = " [git]"
 	}
-	return fmt.Sprintf("(%d files%s)", len(files), isGit)
+	if lang, ok := scanner.LangDisplay[p.Language]; ok {
+		return fmt.Sprintf("(%d files, %s%s)", p.Files, lang, isGit)
+	}
+	return fmt.Sprintf("(%d files%s)", p.Files, isGit)
 }
 
-func handleGetImporters(ctx context.Context, req *mcp.CallToolRequest, input ImportersInput) (*mcp.CallToolResult, any, error) {
-	fg, err := scanner.BuildFileGraph(input.Path)
+func handleGetImporters(ctx context.Context, req *mcp.CallToolRequest, input ImportersInput) (*mcp.CallToolResult, *ImportersOutput, error) {
+	ctx = toolProgress(ctx, req)
+	path, err := toolPath(ctx, req, input.Path)
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	fg, err := projectGraph(ctx, path)
 	if err != nil {
 		return errorResult("Failed to build file graph: " + err.Error()), nil, nil
 	}
 
-	importers := fg.Importers[input.File]
+	importers := slices.Clone(fg.Importers[input.File])
+	sort.Strings(importers)
+	isHub := fg.IsHub(input.File)
 	if len(importers) == 0 {
-		return textResult("No files import '" + input.File + "'"), nil, nil
+		return toolResult(input.Format, "No files import '"+input.File+"'"), &ImportersOutput{File: input.File, IsHub: isHub}, nil
 	}
 
-	isHub := len(importers) >= 3
 	hubNote := ""
 	if isHub {
 		hubNote = " ⚠️ HUB FILE"
 	}
 
-	return textResult(fmt.Sprintf("%d files import '%s':%s\n%s", len(importers), input.File, hubNote, strings.Join(importers, "\n"))), nil, nil
-}
-
-// ANSI escape code pattern
-var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;]*m`)
-
-// stripANSI removes ANSI color codes from a string
-func stripANSI(s string) string {
-	return ansiRegex.ReplaceAllString(s, "")
-}
-
-// captureOutput captures stdout from a function and strips ANSI codes
-func captureOutput(f func()) string {
-	old := os.Stdout
-	r, w, _ := os.Pipe()
-	os.Stdout = w
-
-	f()
-
-	w.Close()
-	os.Stdout = old
+	output, out, page, err := paginate(importers, input.PageInput, input.Format, func(page []string) (string, *ImportersOutput, error) {
+		out := &ImportersOutput{File: input.File, IsHub: isHub, Importers: page}
+		return fmt.Sprintf("%d files import '%s':%s\n%s", len(importers), input.File, hubNote, strings.Join(page, "\n")), out, nil
+	})
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	out.Page = pageOf(page)
 
-	var buf bytes.Buffer
-	buf.ReadFrom(r)
-	return stripANSI(buf.String())
+	return toolResult(input.Format, output+page.summary("importers")), out, nil
 }
 
 // === WATCH HANDLERS ===
 
-func handleStartWatch(ctx context.Context, req *mcp.CallToolRequest, input WatchInput) (*mcp.CallToolResult, any, error) {
-	path := input.Path
-	if strings.HasPrefix(path, "~/") {
-		home := os.Getenv("HOME")
-		path = filepath.Join(home, path[2:])
-	}
-
-	absPath, err := filepath.Abs(path)
+func handleStartWatch(ctx context.Context, req *mcp.CallToolRequest, input WatchInput) (*mcp.CallToolResult, *WatchOutput, error) {
+	absPath, err := watchPath(ctx, req, input.Path)
 	if err != nil {
-		return errorResult("Invalid path: " + err.Error()), nil, nil
+		return errorResult(err.Error()), nil, nil
 	}
 
-	watchersMu.Lock()
-	defer watchersMu.Unlock()
+	startWatchMu.Lock()
+	defer startWatchMu.Unlock()
 
-	// Check if already watching
-	if _, exists := watchers[absPath]; exists {
-		return textResult(fmt.Sprintf("Already watching: %s\nUse get_activity to see recent changes.", absPath)), nil, nil
+	if watch.IsRunning(absPath) {
+		attachWatcher(absPath)
+		projects.handOver(ctx, absPath)
+		events, _ := daemonEvents(absPath)
+		out := &WatchOutput{Root: absPath, Watching: true, Files: daemonFileCount(absPath), Events: len(events)}
+		return toolResult(input.Format, fmt.Sprintf("Already watching: %s\nUse get_activity to see recent changes.", absPath)), out, nil
 	}
 
-	// Start new watcher
-	daemon, err := watch.NewDaemon(absPath, false)
+	exe, err := codemapBinary()
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	pid, err := watch.StartBackground(absPath, exe)
 	if err != nil {
-		return errorResult("Failed to create watcher: " + err.Error()), nil, nil
+		return errorResult(err.Error()), nil, nil
 	}
+	attachWatcher(absPath)
 
-	if err := daemon.Start(); err != nil {
-		return errorResult("Failed to start watcher: " + err.Error()), nil, nil
+	waitCtx, cancel := context.WithTimeout(ctx, watchStartTimeout)
+	defer cancel()
+	if !watch.WaitRunning(waitCtx, absPath) {
+		out := &WatchOutput{Root: absPath}
+		return toolResult(input.Format, fmt.Sprintf(`Watch daemon starting for: %s (pid %d)
+The initial scan is still running; use get_activity in a moment.`, absPath, pid)), out, nil
 	}
 
-	watchers[absPath] = daemon
+	// The tools no longer need a watcher of their own
+	projects.handOver(ctx, absPath)
 
-	return textResult(fmt.Sprintf(`Live watcher started for: %s
+	files := daemonFileCount(absPath)
+	out := &WatchOutput{Root: absPath, Watching: true, Files: files}
+
+	return toolResult(input.Format, fmt.Sprintf(`Live watcher started for: %s
 Tracking %d files
 
 The watcher is now running in background. I can now see:
@@ -531,64 +885,58 @@ The watcher is now running in background. I can now see:
 - Which files are "hot" (frequently edited)
 - What's uncommitted (dirty)
 
-Use get_activity to see what you've been working on.`, absPath, daemon.FileCount())), nil, nil
+It is the same daemon as "codemap watch start", and keeps running after this session.
+Use get_activity to see what you've been working on.`, absPath, files)), out, nil
 }
 
-func handleStopWatch(ctx context.Context, req *mcp.CallToolRequest, input WatchInput) (*mcp.CallToolResult, any, error) {
-	path := input.Path
-	if strings.HasPrefix(path, "~/") {
-		home := os.Getenv("HOME")
-		path = filepath.Join(home, path[2:])
-	}
-
-	absPath, err := filepath.Abs(path)
+func handleStopWatch(ctx context.Context, req *mcp.CallToolRequest, input WatchInput) (*mcp.CallToolResult, *WatchOutput, error) {
+	absPath, err := watchPath(ctx, req, input.Path)
 	if err != nil {
-		return errorResult("Invalid path: " + err.Error()), nil, nil
+		return errorResult(err.Error()), nil, nil
 	}
 
-	watchersMu.Lock()
-	defer watchersMu.Unlock()
+	startWatchMu.Lock()
+	defer startWatchMu.Unlock()
 
-	daemon, exists := watchers[absPath]
-	if !exists {
-		return textResult("No active watcher for: " + absPath), nil, nil
+	watchersMu.Lock()
+	delete(watchers, absPath)
+	watchersMu.Unlock()
+	if !watch.IsRunning(absPath) {
+		return toolResult(input.Format, "No active watcher for: "+absPath), &WatchOutput{Root: absPath}, nil
 	}
 
 	// Get final stats before stopping
-	events := daemon.GetEvents(0)
-	daemon.Stop()
-	delete(watchers, absPath)
+	events, _ := daemonEvents(absPath)
+	if err := watch.Stop(absPath); err != nil {
+		return errorResult(fmt.Sprintf("failed to stop watcher: %v", err)), nil, nil
+	}
 
-	return textResult(fmt.Sprintf("Watcher stopped for: %s\nTotal events captured: %d", absPath, len(events))), nil, nil
+	out := &WatchOutput{Root: absPath, Events: len(events)}
+	return toolResult(input.Format, fmt.Sprintf("Watcher stopped for: %s\nTotal events captured: %d", absPath, len(events))), out, nil
 }
 
-func handleGetActivity(ctx context.Context, req *mcp.CallToolRequest, input WatchActivityInput) (*mcp.CallToolResult, any, error) {
-	path := input.Path
-	if strings.HasPrefix(path, "~/") {
-		home := os.Getenv("HOME")
-		path = filepath.Join(home, path[2:])
-	}
-
-	absPath, err := filepath.Abs(path)
+func handleGetActivity(ctx context.Context, req *mcp.CallToolRequest, input WatchActivityInput) (*mcp.CallToolResult, *ActivityOutput, error) {
+	absPath, err := watchPath(ctx, req, input.Path)
 	if err != nil {
-		return errorResult("Invalid path: " + err.Error()), nil, nil
+		return errorResult(err.Error()), nil, nil
 	}
 
-	watchersMu.RLock()
-	daemon, exists := watchers[absPath]
-	watchersMu.RUnlock()
-
-	if !exists {
+	if !watch.IsRunning(absPath) {
 		return errorResult(fmt.Sprintf("No active watcher for: %s\nUse start_watch first.", absPath)), nil, nil
 	}
+	attachWatcher(absPath)
 
 	minutes := input.Minutes
 	if minutes <= 0 {
 		minutes = 30
 	}
 
-	events := daemon.GetEvents(0)
+	events, err := daemonEvents(absPath)
+	if err != nil {
+		return errorResult(fmt.Sprintf("failed to read events: %v", err)), nil, nil
+	}
 	cutoff := time.Now().Add(-time.Duration(minutes) * time.Minute)
+	filesTracked := daemonFileCount(absPath)
 
 	// Filter to recent events
 	var recent []watch.Event
@@ -598,31 +946,63 @@ func handleGetActivity(ctx context.Context, req *mcp.CallToolRequest, input Watc
 		}
 	}
 
+	out := &ActivityOutput{
+		Root:         absPath,
+		Minutes:      minutes,
+		FilesTracked: filesTracked,
+		TotalEvents:  len(events),
+		Events:       recent,
+	}
+
 	if len(recent) == 0 {
-		return textResult(fmt.Sprintf(`No activity in the last %d minutes.
+		return toolResult(input.Format, fmt.Sprintf(`No activity in the last %d minutes.
 
 Watcher is running for: %s
 Files tracked: %d
-Total events since start: %d
+Total events recorded: %d
 
 The user may be:
 - Reading code
 - Thinking/planning
 - Working in a different project
-- Taking a break`, minutes, absPath, daemon.FileCount(), len(events))), nil, nil
+- Taking a break`, minutes, absPath, filesTracked, len(events))), out, nil
 	}
 
 	// Aggregate by file
 	type fileStats struct {
-		edits    int
-		netDelta int
-		lastEdit time.Time
-		dirty    bool
+		edits     int
+		netDelta  int
+		lastEdit  time.Time
+		dirty     bool
+		movedFrom string
+		symbols   []watch.SymbolChange
 	}
 	byFile := make(map[string]*fileStats)
+	moves, commits, checkouts := 0, 0, 0
 
 	for _, e := range recent {
-		if e.Op == "WRITE" || e.Op == "CREATE" {
+		switch e.Op {
+		case "COMMIT", "MERGE":
+			commits++
+		case "CHECKOUT":
+			checkouts++
+		}
+		if e.Op == "MOVE" {
+			// Edits before the move count toward the new path
+			moves++
+			stats := byFile[e.OldPath]
+			if stats == nil {
+				stats = &fileStats{}
+			}
+			delete(byFile, e.OldPath)
+			if stats.movedFrom == "" {
+				stats.movedFrom = e.OldPath
+			}
+			if _, taken := byFile[e.Path]; !taken {
+				byFile[e.Path] = stats
+			}
+		}
+		if e.Op == "WRITE" || e.Op == "CREATE" || e.Op == "MOVE" {
 			stats, exists := byFile[e.Path]
 			if !exists {
 				stats = &fileStats{}
@@ -636,56 +1016,38 @@ The user may be:
 			if e.Dirty {
 				stats.dirty = true
 			}
+			stats.symbols = watch.MergeSymbolChanges(stats.symbols, e.Symbols)
 		}
 	}
 
 	// Sort files by edit count (hot files first)
 	type fileSummary struct {
-		path     string
-		edits    int
-		delta    int
-		lastEdit time.Time
-		dirty    bool
+		path      string
+		movedFrom string
+		edits     int
+		delta     int
+		lastEdit  time.Time
+		dirty     bool
+		symbols   []watch.SymbolChange
 	}
 	var summaries []fileSummary
 	for path, stats := range byFile {
 		summaries = append(summaries, fileSummary{
-			path:     path,
-			edits:    stats.edits,
-			delta:    stats.netDelta,
-			lastEdit: stats.lastEdit,
-			dirty:    stats.dirty,
+			path:      path,
+			movedFrom: stats.movedFrom,
+			edits:     stats.edits,
+			delta:     stats.netDelta,
+			lastEdit:  stats.lastEdit,
+			dirty:     stats.dirty,
+			symbols:   stats.symbols,
 		})
 	}
 	sort.Slice(summaries, func(i, j int) bool {
-		return summaries[i].edits > summaries[j].edits
-	})
-
-	// Build output
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("=== Activity: Last %d minutes ===\n", minutes))
-	sb.WriteString(fmt.Sprintf("Project: %s\n\n", absPath))
-
-	// Hot files
-	sb.WriteString("HOT FILES (by edit count):\n")
-	for i, s := range summaries {
-		if i >= 10 {
-			sb.WriteString(fmt.Sprintf("  ... and %d more files\n", len(summaries)-10))
-			break
-		}
-		deltaStr := ""
-		if s.delta > 0 {
-			deltaStr = fmt.Sprintf("+%d", s.delta)
-		} else if s.delta < 0 {
-			deltaStr = fmt.Sprintf("%d", s.delta)
+		if summaries[i].edits != summaries[j].edits {
+			return summaries[i].edits > summaries[j].edits
 		}
-		dirtyStr := ""
-		if s.dirty {
-			dirtyStr = " [uncommitted]"
-		}
-		sb.WriteString(fmt.Sprintf("  %-40s %2d edits  %6s lines%s\n",
-			s.path, s.edits, deltaStr, dirtyStr))
-	}
+		return summaries[i].path < summaries[j].path
+	})
 
 	// Session summary
 	totalEdits := 0
@@ -699,124 +1061,235 @@ The user may be:
 		}
 	}
 
-	sb.WriteString("\n")
-	sb.WriteString("SESSION SUMMARY:\n")
-	sb.WriteString(fmt.Sprintf("  Files touched:  %d\n", len(summaries)))
-	sb.WriteString(fmt.Sprintf("  Total edits:    %d\n", totalEdits))
-	deltaStr := ""
-	if totalDelta >= 0 {
-		deltaStr = fmt.Sprintf("+%d", totalDelta)
-	} else {
-		deltaStr = fmt.Sprintf("%d", totalDelta)
-	}
-	sb.WriteString(fmt.Sprintf("  Net line change: %s\n", deltaStr))
-	sb.WriteString(fmt.Sprintf("  Uncommitted:    %d files\n", dirtyCount))
+	// Without paging input the text keeps to the top 10 hot files
+	paging := input.PageInput != PageInput{}
+
+	output, out, page, err := paginate(summaries, input.PageInput, input.Format, func(summaries []fileSummary) (string, *ActivityOutput, error) {
+		pageOut := *out
+		for _, s := range summaries {
+			pageOut.Files = append(pageOut.Files, FileActivity{
+				Path:      s.path,
+				MovedFrom: s.movedFrom,
+				Edits:     s.edits,
+				Delta:     s.delta,
+				LastEdit:  s.lastEdit,
+				Dirty:     s.dirty,
+				Symbols:   s.symbols,
+			})
+		}
 
-	// Recent timeline (last 5 events)
-	sb.WriteString("\nRECENT TIMELINE:\n")
-	start := len(recent) - 5
-	if start < 0 {
-		start = 0
-	}
-	for _, e := range recent[start:] {
+		// Build output
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("=== Activity: Last %d minutes ===\n", minutes))
+		sb.WriteString(fmt.Sprintf("Project: %s\n\n", absPath))
+
+		// Hot files
+		sb.WriteString("HOT FILES (by edit count):\n")
+		for i, s := range summaries {
+			if i >= 10 && !paging {
+				sb.WriteString(fmt.Sprintf("  ... and %d more files\n", len(summaries)-10))
+				break
+			}
+			deltaStr := ""
+			if s.delta > 0 {
+				deltaStr = fmt.Sprintf("+%d", s.delta)
+			} else if s.delta < 0 {
+				deltaStr = fmt.Sprintf("%d", s.delta)
+			}
+			dirtyStr := ""
+			if s.dirty {
+				dirtyStr = " [uncommitted]"
+			}
+			movedStr := ""
+			if s.movedFrom != "" {
+				movedStr = " (moved from " + s.movedFrom + ")"
+			}
+			sb.WriteString(fmt.Sprintf("  %-40s %2d edits  %6s lines%s%s\n",
+				s.path, s.edits, deltaStr, dirtyStr, movedStr))
+			if len(s.symbols) > 0 {
+				sb.WriteString(fmt.Sprintf("    %s\n", watch.SummarizeSymbols(s.symbols, 5)))
+			}
+		}
+
+		sb.WriteString("\n")
+		sb.WriteString("SESSION SUMMARY:\n")
+		sb.WriteString(fmt.Sprintf("  Files touched:  %d\n", len(byFile)))
+		sb.WriteString(fmt.Sprintf("  Total edits:    %d\n", totalEdits))
 		deltaStr := ""
-		if e.Delta != 0 {
-			if e.Delta > 0 {
-				deltaStr = fmt.Sprintf(" (+%d)", e.Delta)
-			} else {
-				deltaStr = fmt.Sprintf(" (%d)", e.Delta)
+		if totalDelta >= 0 {
+			deltaStr = fmt.Sprintf("+%d", totalDelta)
+		} else {
+			deltaStr = fmt.Sprintf("%d", totalDelta)
+		}
+		sb.WriteString(fmt.Sprintf("  Net line change: %s\n", deltaStr))
+		sb.WriteString(fmt.Sprintf("  Uncommitted:    %d files\n", dirtyCount))
+		if moves > 0 {
+			sb.WriteString(fmt.Sprintf("  Moves:          %d\n", moves))
+		}
+		if commits > 0 || checkouts > 0 {
+			sb.WriteString(fmt.Sprintf("  Git:            %d commits, %d checkouts\n", commits, checkouts))
+		}
+
+		// Recent timeline (last 5 events)
+		sb.WriteString("\nRECENT TIMELINE:\n")
+		start := len(recent) - 5
+		if start < 0 {
+			start = 0
+		}
+		for _, e := range recent[start:] {
+			deltaStr := ""
+			if e.Delta != 0 {
+				if e.Delta > 0 {
+					deltaStr = fmt.Sprintf(" (+%d)", e.Delta)
+				} else {
+					deltaStr = fmt.Sprintf(" (%d)", e.Delta)
+				}
+			}
+			symStr := ""
+			if len(e.Symbols) > 0 {
+				symStr = " - " + watch.SummarizeSymbols(e.Symbols, 3)
 			}
+			sb.WriteString(fmt.Sprintf("  %s  %-6s  %s%s%s\n",
+				e.Time.Format("15:04:05"), e.Op, e.DisplayPath(), deltaStr, symStr))
 		}
-		sb.WriteString(fmt.Sprintf("  %s  %-6s  %s%s\n",
-			e.Time.Format("15:04:05"), e.Op, e.Path, deltaStr))
+		return sb.String(), &pageOut, nil
+	})
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
 	}
+	out.Page = pageOf(page)
 
-	return textResult(sb.String()), nil, nil
+	return toolResult(input.Format, output+page.summary("hot files")), out, nil
 }
 
 // === FILE GRAPH HANDLERS ===
 
-func handleGetHubs(ctx context.Context, req *mcp.CallToolRequest, input PathInput) (*mcp.CallToolResult, any, error) {
-	fg, err := scanner.BuildFileGraph(input.Path)
+func handleGetHubs(ctx context.Context, req *mcp.CallToolRequest, input PathInput) (*mcp.CallToolResult, *HubsOutput, error) {
+	ctx = toolProgress(ctx, req)
+	path, err := toolPath(ctx, req, input.Path)
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	fg, err := projectGraph(ctx, path)
 	if err != nil {
 		return errorResult("Failed to build file graph: " + err.Error()), nil, nil
 	}
 
-	hubs := fg.HubFiles()
+	hubs := hubEntries(fg)
 	if len(hubs) == 0 {
-		return textResult("No hub files found (no files with 3+ importers)."), nil, nil
+		return toolResult(input.Format, "No hub files found (no files with 3+ importers)."), &HubsOutput{Root: fg.Root}, nil
 	}
 
-	// Sort by importer count
-	sort.Slice(hubs, func(i, j int) bool {
-		return len(fg.Importers[hubs[i]]) > len(fg.Importers[hubs[j]])
-	})
+	output, out, page, err := paginate(hubs, input.PageInput, input.Format, func(page []HubEntry) (string, *HubsOutput, error) {
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("=== Hub Files (%d total) ===\n", len(hubs)))
+		sb.WriteString("These files are imported by 3+ other files. Changes here have wide impact.\n\n")
 
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("=== Hub Files (%d total) ===\n", len(hubs)))
-	sb.WriteString("These files are imported by 3+ other files. Changes here have wide impact.\n\n")
-
-	for _, hub := range hubs {
-		importers := fg.Importers[hub]
-		sb.WriteString(fmt.Sprintf("  %s (%d importers)\n", hub, len(importers)))
-		// Show first few importers
-		for i, imp := range importers {
-			if i >= 3 {
-				sb.WriteString(fmt.Sprintf("      ... and %d more\n", len(importers)-3))
-				break
+		for _, hub := range page {
+			sb.WriteString(fmt.Sprintf("  %s (%d importers)\n", hub.Path, hub.Importers))
+			// Show first few importers
+			for i, imp := range hub.ImportedBy {
+				if i >= 3 {
+					sb.WriteString(fmt.Sprintf("      ... and %d more\n", hub.Importers-3))
+					break
+				}
+				sb.WriteString(fmt.Sprintf("      <- %s\n", imp))
 			}
-			sb.WriteString(fmt.Sprintf("      <- %s\n", imp))
 		}
+		return sb.String(), &HubsOutput{Root: fg.Root, Hubs: page}, nil
+	})
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
 	}
+	out.Page = pageOf(page)
 
-	return textResult(sb.String()), nil, nil
+	return toolResult(input.Format, output+page.summary("hubs")), out, nil
 }
 
-func handleGetFileContext(ctx context.Context, req *mcp.CallToolRequest, input ImportersInput) (*mcp.CallToolResult, any, error) {
-	fg, err := scanner.BuildFileGraph(input.Path)
+func handleGetFileContext(ctx context.Context, req *mcp.CallToolRequest, input FileContextInput) (*mcp.CallToolResult, *FileContextOutput, error) {
+	ctx = toolProgress(ctx, req)
+	path, err := toolPath(ctx, req, input.Path)
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	fg, err := projectGraph(ctx, path)
 	if err != nil {
 		return errorResult("Failed to build file graph: " + err.Error()), nil, nil
 	}
 
-	file := input.File
-	imports := fg.Imports[file]
-	importers := fg.Importers[file]
-	isHub := fg.IsHub(file)
-	connected := fg.ConnectedFiles(file)
+	full := newFileContext(fg, input.File)
 
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("=== File Context: %s ===\n\n", file))
-
-	// Hub status
-	if isHub {
-		sb.WriteString(fmt.Sprintf("⚠️  HUB FILE - %d files depend on this\n", len(importers)))
-		sb.WriteString("    Changes here affect many parts of the codebase.\n\n")
+	// Pages run through the imports, then the importers
+	type contextEntry struct {
+		path     string
+		importer bool
+	}
+	entries := make([]contextEntry, 0, len(full.Imports)+len(full.Importers))
+	for _, imp := range full.Imports {
+		entries = append(entries, contextEntry{path: imp})
+	}
+	for _, imp := range full.Importers {
+		entries = append(entries, contextEntry{path: imp, importer: true})
 	}
 
-	// What this file imports
-	if len(imports) > 0 {
-		sb.WriteString(fmt.Sprintf("IMPORTS (%d files):\n", len(imports)))
-		for _, imp := range imports {
-			sb.WriteString(fmt.Sprintf("  -> %s\n", imp))
+	output, out, page, err := paginate(entries, input.PageInput, input.Format, func(entries []contextEntry) (string, *FileContextOutput, error) {
+		out := &FileContextOutput{File: full.File, IsHub: full.IsHub, Connected: full.Connected}
+		for _, e := range entries {
+			if e.importer {
+				out.Importers = append(out.Importers, e.path)
+			} else {
+				out.Imports = append(out.Imports, e.path)
+			}
 		}
-		sb.WriteString("\n")
-	} else {
-		sb.WriteString("IMPORTS: none (leaf file)\n\n")
-	}
+		if len(entries) < len(full.Imports)+len(full.Importers) {
+			// Only the connected files this page lists
+			out.Connected = nil
+			for _, f := range full.Connected {
+				if slices.Contains(out.Imports, f) || slices.Contains(out.Importers, f) {
+					out.Connected = append(out.Connected, f)
+				}
+			}
+		}
+
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("=== File Context: %s ===\n\n", out.File))
 
-	// What imports this file
-	if len(importers) > 0 {
-		sb.WriteString(fmt.Sprintf("IMPORTED BY (%d files):\n", len(importers)))
-		for _, imp := range importers {
-			sb.WriteString(fmt.Sprintf("  <- %s\n", imp))
+		// Hub status
+		if out.IsHub {
+			sb.WriteString(fmt.Sprintf("⚠️  HUB FILE - %d files depend on this\n", len(full.Importers)))
+			sb.WriteString("    Changes here affect many parts of the codebase.\n\n")
+		}
+
+		// What this file imports
+		if len(out.Imports) > 0 {
+			sb.WriteString(fmt.Sprintf("IMPORTS (%d files):\n", len(full.Imports)))
+			for _, imp := range out.Imports {
+				sb.WriteString(fmt.Sprintf("  -> %s\n", imp))
+			}
+			sb.WriteString("\n")
+		} else if len(full.Imports) == 0 {
+			sb.WriteString("IMPORTS: none (leaf file)\n\n")
+		}
+
+		// What imports this file
+		if len(out.Importers) > 0 {
+			sb.WriteString(fmt.Sprintf("IMPORTED BY (%d files):\n", len(full.Importers)))
+			for _, imp := range out.Importers {
+				sb.WriteString(fmt.Sprintf("  <- %s\n", imp))
+			}
+			sb.WriteString("\n")
+		} else if len(full.Importers) == 0 {
+			sb.WriteString("IMPORTED BY: none (entry point or unused)\n\n")
 		}
-		sb.WriteString("\n")
-	} else {
-		sb.WriteString("IMPORTED BY: none (entry point or unused)\n\n")
-	}
 
-	// Connected files summary
-	sb.WriteString(fmt.Sprintf("CONNECTED: %d files in dependency graph\n", len(connected)))
+		// Connected files summary
+		sb.WriteString(fmt.Sprintf("CONNECTED: %d files in dependency graph\n", len(full.Connected)))
+		return sb.String(), out, nil
+	})
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	out.Page = pageOf(page)
 
-	return textResult(sb.String()), nil, nil
+	return toolResult(input.Format, output+page.summary("imports and importers")), out, nil
 }
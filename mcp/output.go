@@ -0,0 +1,282 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"codemap/scanner"
+	"codemap/watch"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// FormatInput is embedded in every tool input to choose the result format
+type FormatInput struct {
+	Format string `json:"format,omitempty" jsonschema:"Result format: text (default, human-readable summary) or json (structured data only)"`
+}
+
+// Output types for tools. Every tool returns one of these as structured
+// content; slices are omitempty so empty results still match the schema.
+
+// FileEntry is a file in a structured result
+type FileEntry struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Language string `json:"language,omitempty"`
+	IsNew    bool   `json:"is_new,omitempty"`
+	Added    int    `json:"added,omitempty" jsonschema:"Lines added vs the diff ref"`
+	Removed  int    `json:"removed,omitempty" jsonschema:"Lines removed vs the diff ref"`
+}
+
+// HubEntry is a file imported by 3+ other files
+type HubEntry struct {
+	Path       string   `json:"path"`
+	Importers  int      `json:"importers" jsonschema:"Number of files importing this one (hub score)"`
+	ImportedBy []string `json:"imported_by,omitempty"`
+}
+
+// Edge is an internal import from one file to another
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type StructureOutput struct {
+	Root      string      `json:"root"`
+	FileCount int         `json:"file_count"`
+	TotalSize int64       `json:"total_size"`
+	Files     []FileEntry `json:"files,omitempty"`
+	Hubs      []HubEntry  `json:"hubs,omitempty"`
+	Page      *PageInfo   `json:"page,omitempty" jsonschema:"Present when only part of the list was returned"`
+}
+
+type DependencyFile struct {
+	Path      string   `json:"path"`
+	Language  string   `json:"language"`
+	Functions []string `json:"functions,omitempty"`
+	Imports   []string `json:"imports,omitempty" jsonschema:"Raw import strings as written in the source"`
+}
+
+type DependenciesOutput struct {
+	Root         string              `json:"root"`
+	Files        []DependencyFile    `json:"files,omitempty"`
+	Edges        []Edge              `json:"edges,omitempty" jsonschema:"Imports resolved to files inside the project"`
+	ExternalDeps map[string][]string `json:"external_deps,omitempty" jsonschema:"Declared dependencies by language (go.mod, package.json, ...)"`
+	Hubs         []HubEntry          `json:"hubs,omitempty"`
+	Page         *PageInfo           `json:"page,omitempty" jsonschema:"Present when only part of the list was returned"`
+}
+
+type ImpactEntry struct {
+	File   string `json:"file"`
+	UsedBy int    `json:"used_by" jsonschema:"Number of other files that import this changed file"`
+}
+
+type DiffOutput struct {
+	Root    string        `json:"root"`
+	Ref     string        `json:"ref"`
+	Added   int           `json:"added"`
+	Removed int           `json:"removed"`
+	Files   []FileEntry   `json:"files,omitempty"`
+	Impact  []ImpactEntry `json:"impact,omitempty"`
+	Page    *PageInfo     `json:"page,omitempty" jsonschema:"Present when only part of the list was returned"`
+}
+
+type FindOutput struct {
+	Pattern string      `json:"pattern"`
+	Files   []FileEntry `json:"files,omitempty"`
+	Page    *PageInfo   `json:"page,omitempty" jsonschema:"Present when only part of the list was returned"`
+}
+
+type ImportersOutput struct {
+	File      string    `json:"file"`
+	IsHub     bool      `json:"is_hub"`
+	Importers []string  `json:"importers,omitempty"`
+	Page      *PageInfo `json:"page,omitempty" jsonschema:"Present when only part of the list was returned"`
+}
+
+type StatusOutput struct {
+	Version    string   `json:"version"`
+	WorkingDir string   `json:"working_dir"`
+	HomeDir    string   `json:"home_dir"`
+	Watching   []string `json:"watching,omitempty" jsonschema:"Projects with an active watcher"`
+	Roots      []string `json:"allowed_roots,omitempty" jsonschema:"Directories tools may access; empty means unrestricted"`
+}
+
+type ProjectEntry struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Files    int    `json:"files"`
+	Language string `json:"language,omitempty" jsonschema:"Primary language by file count"`
+	Git      bool   `json:"git"`
+}
+
+type ListProjectsOutput struct {
+	Root     string         `json:"root"`
+	Projects []ProjectEntry `json:"projects,omitempty"`
+	Page     *PageInfo      `json:"page,omitempty" jsonschema:"Present when only part of the list was returned"`
+}
+
+type WatchOutput struct {
+	Root     string `json:"root"`
+	Watching bool   `json:"watching"`
+	Files    int    `json:"files,omitempty" jsonschema:"Files tracked by the watcher"`
+	Events   int    `json:"events,omitempty" jsonschema:"Events captured since the watcher started"`
+}
+
+type FileActivity struct {
+	Path      string               `json:"path"`
+	MovedFrom string               `json:"moved_from,omitempty" jsonschema:"Where the file was before it moved in this window"`
+	Edits     int                  `json:"edits"`
+	Delta     int                  `json:"delta" jsonschema:"Net line change"`
+	LastEdit  time.Time            `json:"last_edit"`
+	Dirty     bool                 `json:"dirty,omitempty" jsonschema:"Has uncommitted changes"`
+	Symbols   []watch.SymbolChange `json:"symbols,omitempty" jsonschema:"Net changes to its functions and types"`
+}
+
+type ActivityOutput struct {
+	Root         string         `json:"root"`
+	Minutes      int            `json:"minutes"`
+	FilesTracked int            `json:"files_tracked"`
+	TotalEvents  int            `json:"total_events"`
+	Files        []FileActivity `json:"files,omitempty" jsonschema:"Edited files, most edited first"`
+	Events       []watch.Event  `json:"events,omitempty" jsonschema:"Events in the time window, oldest first"`
+	Page         *PageInfo      `json:"page,omitempty" jsonschema:"Present when only part of the list was returned"`
+}
+
+type HubsOutput struct {
+	Root string     `json:"root"`
+	Hubs []HubEntry `json:"hubs,omitempty"`
+	Page *PageInfo  `json:"page,omitempty" jsonschema:"Present when only part of the list was returned"`
+}
+
+type FileContextOutput struct {
+	File      string    `json:"file"`
+	IsHub     bool      `json:"is_hub"`
+	Imports   []string  `json:"imports,omitempty"`
+	Importers []string  `json:"importers,omitempty"`
+	Connected []string  `json:"connected,omitempty" jsonschema:"All files reachable through imports in either direction"`
+	Page      *PageInfo `json:"page,omitempty" jsonschema:"Present when only part of the imports and importers was returned"`
+}
+
+// SymbolEntry is a symbol definition with its location
+type SymbolEntry struct {
+	File      string   `json:"file"`
+	Name      string   `json:"name"`
+	Kind      string   `json:"kind"`
+	Line      int      `json:"line" jsonschema:"1-based line of the definition"`
+	Column    int      `json:"column" jsonschema:"1-based column of the definition"`
+	Scope     string   `json:"scope,omitempty" jsonschema:"Enclosing scope, e.g. class:App or struct:Server (omitted for top level)"`
+	Parent    string   `json:"parent,omitempty"`
+	Signature string   `json:"signature,omitempty"`
+	Modifiers []string `json:"modifiers,omitempty"`
+	Exported  bool     `json:"exported"`
+}
+
+type SymbolsOutput struct {
+	Root    string        `json:"root"`
+	Symbols []SymbolEntry `json:"symbols,omitempty"`
+	Page    *PageInfo     `json:"page,omitempty" jsonschema:"Present when only part of the list was returned"`
+}
+
+type FindSymbolOutput struct {
+	Name    string        `json:"name"`
+	Fuzzy   bool          `json:"fuzzy"`
+	Matches []SymbolEntry `json:"matches,omitempty" jsonschema:"Definitions, best match first"`
+	Page    *PageInfo     `json:"page,omitempty" jsonschema:"Present when only part of the list was returned"`
+}
+
+// OutlineEntry is one line of a file outline; Depth is 1 for class/struct members
+type OutlineEntry struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Line      int    `json:"line" jsonschema:"1-based line of the definition"`
+	Depth     int    `json:"depth"`
+	Signature string `json:"signature,omitempty"`
+	Exported  bool   `json:"exported"`
+}
+
+type OutlineOutput struct {
+	File     string         `json:"file"`
+	Language string         `json:"language,omitempty"`
+	Entries  []OutlineEntry `json:"entries,omitempty" jsonschema:"Definitions in source order"`
+	Page     *PageInfo      `json:"page,omitempty" jsonschema:"Present when only part of the list was returned"`
+}
+
+// newFileContext collects the graph neighborhood of one file
+func newFileContext(fg *scanner.FileGraph, file string) *FileContextOutput {
+	out := &FileContextOutput{
+		File:      file,
+		IsHub:     fg.IsHub(file),
+		Imports:   slices.Clone(fg.Imports[file]),
+		Importers: slices.Clone(fg.Importers[file]),
+		Connected: fg.ConnectedFiles(file),
+	}
+	sort.Strings(out.Imports)
+	sort.Strings(out.Importers)
+	sort.Strings(out.Connected)
+	return out
+}
+
+// toolResult attaches the text summary to a structured result. For format=json
+// Content is left empty and the SDK fills it with the serialized output.
+func toolResult(format, text string) *mcp.CallToolResult {
+	switch format {
+	case "", "text":
+		return textResult(text)
+	case "json":
+		return &mcp.CallToolResult{}
+	default:
+		return errorResult("Unknown format '" + format + "' (use text or json)")
+	}
+}
+
+// fileEntries converts scanned files to structured entries
+func fileEntries(files []scanner.FileInfo) []FileEntry {
+	var entries []FileEntry
+	for _, f := range files {
+		entries = append(entries, FileEntry{
+			Path:     f.Path,
+			Size:     f.Size,
+			Language: scanner.DetectLanguage(f.Path),
+			IsNew:    f.IsNew,
+			Added:    f.Added,
+			Removed:  f.Removed,
+		})
+	}
+	return entries
+}
+
+// hubEntries lists hub files, most imported first
+func hubEntries(fg *scanner.FileGraph) []HubEntry {
+	var hubs []HubEntry
+	for _, hub := range fg.HubFiles() {
+		importers := append([]string(nil), fg.Importers[hub]...)
+		sort.Strings(importers)
+		hubs = append(hubs, HubEntry{Path: hub, Importers: len(importers), ImportedBy: importers})
+	}
+	sort.Slice(hubs, func(i, j int) bool {
+		if hubs[i].Importers != hubs[j].Importers {
+			return hubs[i].Importers > hubs[j].Importers
+		}
+		return hubs[i].Path < hubs[j].Path
+	})
+	return hubs
+}
+
+// graphEdges flattens the file graph into sorted edges
+func graphEdges(fg *scanner.FileGraph) []Edge {
+	var edges []Edge
+	for from, targets := range fg.Imports {
+		for _, to := range targets {
+			edges = append(edges, Edge{From: from, To: to})
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
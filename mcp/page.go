@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// PageInput is embedded in the inputs of tools that return lists, so agents
+// on large repos can fetch results progressively instead of all at once
+type PageInput struct {
+	Limit     int    `json:"limit,omitempty" jsonschema:"Return at most this many items (default: all)"`
+	Cursor    string `json:"cursor,omitempty" jsonschema:"Continue after a previous page: pass its next_cursor"`
+	MaxTokens int    `json:"max_tokens,omitempty" jsonschema:"Approximate token budget for the result; fewer items are returned to fit"`
+}
+
+// PageInfo describes which part of a list a result holds
+type PageInfo struct {
+	Total       int    `json:"total" jsonschema:"Items in the full list"`
+	Offset      int    `json:"offset" jsonschema:"Index of the first returned item"`
+	Returned    int    `json:"returned"`
+	NextCursor  string `json:"next_cursor,omitempty" jsonschema:"Cursor for the next page; omitted on the last page"`
+	TruncatedBy string `json:"truncated_by,omitempty" jsonschema:"What ended the page early: limit or max_tokens"`
+}
+
+// bytesPerToken is a rough average for code and English text
+const bytesPerToken = 4
+
+// pageOverhead reserves budget for the page summary and PageInfo, which are
+// added after the page is sized
+const pageOverhead = 64
+
+// estimateTokens approximates how many tokens a result costs an agent
+func estimateTokens(n int) int {
+	return (n + bytesPerToken - 1) / bytesPerToken
+}
+
+// paginate selects the page of items that in asks for and builds its result
+// with build. Items must already be in a deterministic order, since cursors
+// are offsets into the list. With a token budget the page is shrunk (by
+// binary search over build) until the result fits, but never below one item
+// so every call makes progress.
+func paginate[T, Out any](items []T, in PageInput, format string, build func(page []T) (string, Out, error)) (string, Out, *PageInfo, error) {
+	var zero Out
+	offset := 0
+	if in.Cursor != "" {
+		n, err := strconv.Atoi(in.Cursor)
+		if err != nil || n < 0 || n > len(items) {
+			return "", zero, nil, fmt.Errorf("invalid cursor %q (pass the next_cursor of a previous call)", in.Cursor)
+		}
+		offset = n
+	}
+	if in.Limit < 0 || in.MaxTokens < 0 {
+		return "", zero, nil, fmt.Errorf("limit and max_tokens must not be negative")
+	}
+
+	info := &PageInfo{Total: len(items), Offset: offset}
+	rest := items[offset:]
+	if in.Limit > 0 && in.Limit < len(rest) {
+		rest = rest[:in.Limit]
+		info.TruncatedBy = "limit"
+	}
+
+	text, out, err := build(rest)
+	if err != nil {
+		return "", zero, nil, err
+	}
+	budget := in.MaxTokens - pageOverhead
+	if in.MaxTokens > 0 && len(rest) > 1 && resultTokens(format, text, out) > budget {
+		// Largest page that fits; page 1 is kept even if it doesn't
+		n := sort.Search(len(rest)-1, func(i int) bool {
+			t, o, err := build(rest[:i+2])
+			return err != nil || resultTokens(format, t, o) > budget
+		}) + 1
+		rest = rest[:n]
+		if text, out, err = build(rest); err != nil {
+			return "", zero, nil, err
+		}
+		info.TruncatedBy = "max_tokens"
+	}
+
+	info.Returned = len(rest)
+	if next := offset + len(rest); next < len(items) {
+		info.NextCursor = strconv.Itoa(next)
+	} else {
+		info.TruncatedBy = ""
+	}
+	return text, out, info, nil
+}
+
+// resultTokens estimates the size of a tool result: the JSON for format=json,
+// otherwise the text summary plus the structured content sent alongside it
+func resultTokens(format, text string, out any) int {
+	data, _ := json.Marshal(out)
+	if format == "json" {
+		return estimateTokens(len(data))
+	}
+	return estimateTokens(len(text) + len(data))
+}
+
+// paged reports whether a result is only part of its list and should say so
+func (p *PageInfo) paged() bool {
+	return p != nil && (p.Offset > 0 || p.Returned < p.Total)
+}
+
+// summary tells the agent what a page left out and how to get the rest
+func (p *PageInfo) summary(noun string) string {
+	if !p.paged() {
+		return ""
+	}
+	s := fmt.Sprintf("\n--- Showing %s %d-%d of %d", noun, p.Offset+1, p.Offset+p.Returned, p.Total)
+	switch p.TruncatedBy {
+	case "max_tokens":
+		s += " (token budget reached)"
+	case "limit":
+		s += " (limit reached)"
+	}
+	if p.NextCursor != "" {
+		s += fmt.Sprintf("; %d more, pass cursor \"%s\" to continue", p.Total-p.Offset-p.Returned, p.NextCursor)
+	}
+	return s + " ---\n"
+}
+
+// pageOf keeps PageInfo out of results that weren't paginated
+func pageOf(p *PageInfo) *PageInfo {
+	if p.paged() {
+		return p
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildNumbers renders a page of numbers as one line each
+func buildNumbers(page []int) (string, []int, error) {
+	var sb strings.Builder
+	for _, n := range page {
+		fmt.Fprintf(&sb, "item %04d\n", n)
+	}
+	return sb.String(), page, nil
+}
+
+func numbers(n int) []int {
+	items := make([]int, n)
+	for i := range items {
+		items[i] = i
+	}
+	return items
+}
+
+func TestPaginate(t *testing.T) {
+	items := numbers(10)
+	tests := []struct {
+		name      string
+		in        PageInput
+		offset    int
+		returned  int
+		next      string
+		truncated string
+	}{
+		{"everything", PageInput{}, 0, 10, "", ""},
+		{"limit", PageInput{Limit: 3}, 0, 3, "3", "limit"},
+		{"cursor", PageInput{Cursor: "3", Limit: 3}, 3, 3, "6", "limit"},
+		{"final page", PageInput{Cursor: "8", Limit: 3}, 8, 2, "", ""},
+		{"limit ending exactly at the end", PageInput{Cursor: "7", Limit: 3}, 7, 3, "", ""},
+		{"cursor at the end", PageInput{Cursor: "10"}, 10, 0, "", ""},
+		{"limit over the total", PageInput{Limit: 50}, 0, 10, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, out, info, err := paginate(items, tt.in, "text", buildNumbers)
+			if err != nil {
+				t.Fatalf("paginate failed: %v", err)
+			}
+			if info.Total != 10 || info.Offset != tt.offset || info.Returned != tt.returned ||
+				info.NextCursor != tt.next || info.TruncatedBy != tt.truncated {
+				t.Errorf("Unexpected page info: %+v", info)
+			}
+			if len(out) != tt.returned || (len(out) > 0 && out[0] != tt.offset) {
+				t.Errorf("Expected %d items from %d, got %v", tt.returned, tt.offset, out)
+			}
+		})
+	}
+}
+
+func TestPaginateInvalidInput(t *testing.T) {
+	items := numbers(5)
+	for _, in := range []PageInput{
+		{Cursor: "abc"},
+		{Cursor: "-1"},
+		{Cursor: "6"},
+		{Cursor: "1.5"},
+		{Limit: -1},
+		{MaxTokens: -10},
+	} {
+		if _, _, _, err := paginate(items, in, "text", buildNumbers); err == nil {
+			t.Errorf("Expected an error for %+v", in)
+		}
+	}
+}
+
+func TestPaginateTokenBudget(t *testing.T) {
+	items := numbers(100)
+	for _, format := range []string{"text", "json"} {
+		for _, maxTokens := range []int{pageOverhead + 10, pageOverhead + 30, pageOverhead + 60} {
+			in := PageInput{MaxTokens: maxTokens}
+			text, out, info, err := paginate(items, in, format, buildNumbers)
+			if err != nil {
+				t.Fatalf("paginate failed: %v", err)
+			}
+			budget := maxTokens - pageOverhead
+			n := info.Returned
+			if n < 1 || n >= len(items) || info.TruncatedBy != "max_tokens" || info.NextCursor != fmt.Sprint(n) {
+				t.Fatalf("%s, max_tokens %d: unexpected page info %+v", format, maxTokens, info)
+			}
+			// The page fits, and one more item would not have
+			if got := resultTokens(format, text, out); got > budget {
+				t.Errorf("%s, max_tokens %d: page of %d costs %d tokens, over the budget of %d", format, maxTokens, n, got, budget)
+			}
+			moreText, more, _ := buildNumbers(items[:n+1])
+			if got := resultTokens(format, moreText, more); got <= budget {
+				t.Errorf("%s, max_tokens %d: a page of %d (%d tokens) would also fit", format, maxTokens, n+1, got)
+			}
+		}
+	}
+
+	// The next page picks up where the budget stopped the first
+	_, first, info, _ := paginate(items, PageInput{MaxTokens: pageOverhead + 20}, "text", buildNumbers)
+	_, second, _, err := paginate(items, PageInput{MaxTokens: pageOverhead + 20, Cursor: info.NextCursor}, "text", buildNumbers)
+	if err != nil || len(second) == 0 || second[0] != first[len(first)-1]+1 {
+		t.Errorf("Expected the second page to follow %v, got %v (%v)", first, second, err)
+	}
+}
+
+func TestPaginateKeepsOneItem(t *testing.T) {
+	// A budget too small for anything still returns one item, so paging
+	// always makes progress
+	_, out, info, err := paginate(numbers(5), PageInput{MaxTokens: 1}, "text", buildNumbers)
+	if err != nil || len(out) != 1 || info.NextCursor != "1" || info.TruncatedBy != "max_tokens" {
+		t.Errorf("Expected one item, got %v %+v (%v)", out, info, err)
+	}
+
+	// ...and the last item ends the list even if it is over the budget
+	_, out, info, err = paginate(numbers(5), PageInput{MaxTokens: 1, Cursor: "4"}, "text", buildNumbers)
+	if err != nil || len(out) != 1 || info.NextCursor != "" || info.TruncatedBy != "" {
+		t.Errorf("Expected the last item without a cursor, got %v %+v (%v)", out, info, err)
+	}
+}
+
+func TestPageSummary(t *testing.T) {
+	if s := (&PageInfo{Total: 3, Returned: 3}).summary("files"); s != "" {
+		t.Errorf("A complete list needs no summary, got %q", s)
+	}
+	s := (&PageInfo{Total: 10, Offset: 3, Returned: 3, NextCursor: "6", TruncatedBy: "limit"}).summary("files")
+	for _, want := range []string{"files 4-6 of 10", "limit reached", "4 more", `cursor "6"`} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Summary %q is missing %q", s, want)
+		}
+	}
+	if pageOf(&PageInfo{Total: 3, Returned: 3}) != nil {
+		t.Error("pageOf should drop a page holding the whole list")
+	}
+}
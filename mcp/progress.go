@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"codemap/scanner"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// progressInterval throttles progress notifications so large scans don't
+// flood the client
+const progressInterval = 200 * time.Millisecond
+
+// withProgress returns a context whose scans send notifications/progress to
+// the client, if the request carried a progress token
+func withProgress(ctx context.Context, ss *mcp.ServerSession, token any) context.Context {
+	if ss == nil || token == nil {
+		return ctx
+	}
+
+	var (
+		mu       sync.Mutex
+		progress float64 // one step per file walked or analyzed, so it only grows
+		last     time.Time
+	)
+	return scanner.WithProgress(ctx, func(stage string, files int) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress++
+		if time.Since(last) < progressInterval {
+			return
+		}
+		last = time.Now()
+
+		verb := "Walked"
+		if stage == scanner.StageAnalyze {
+			verb = "Analyzed"
+		}
+		ss.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+			ProgressToken: token,
+			Progress:      progress,
+			Message:       fmt.Sprintf("%s %d files", verb, files),
+		})
+	})
+}
+
+// toolProgress is withProgress for a tool call; req may be nil for internal calls
+func toolProgress(ctx context.Context, req *mcp.CallToolRequest) context.Context {
+	if req == nil {
+		return ctx
+	}
+	return withProgress(ctx, req.Session, req.Params.GetProgressToken())
+}
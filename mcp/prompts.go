@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// addPrompts registers prompt templates that bundle codemap output with instructions
+func addPrompts(server *mcp.Server) {
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "review_diff",
+		Title:       "Review this diff with impact",
+		Description: "Review the changes against a git ref, using the changed files, their importers and hub files to focus on what might break.",
+		Arguments: []*mcp.PromptArgument{
+			{Name: "path", Description: "Path to the project directory", Required: true},
+			{Name: "ref", Description: "Git branch/ref to compare against (default: main)"},
+		},
+	}, handleReviewDiffPrompt)
+
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "onboard",
+		Title:       "Onboard me to this repo",
+		Description: "Explain a project's layout, key dependencies and critical hub files to someone new to it.",
+		Arguments: []*mcp.PromptArgument{
+			{Name: "path", Description: "Path to the project directory", Required: true},
+		},
+	}, handleOnboardPrompt)
+}
+
+func handleReviewDiffPrompt(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	ctx = withProgress(ctx, req.Session, req.Params.GetProgressToken())
+	path, err := checkPath(ctx, req.Session, req.Params.Arguments["path"])
+	if err != nil {
+		return nil, err
+	}
+	ref := req.Params.Arguments["ref"]
+	if ref == "" {
+		ref = "main"
+	}
+
+	diff, err := toolText(handleGetDiff(ctx, nil, DiffInput{Path: path, Ref: ref}))
+	if err != nil {
+		return nil, err
+	}
+	hubs, err := toolText(handleGetHubs(ctx, nil, PathInput{Path: path}))
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Review the changes in %s against %s.\n\n", path, ref)
+	sb.WriteString("Focus on correctness and on what the changes could break. Files imported by many others ")
+	sb.WriteString("(see \"used by\" counts and hub files) deserve the closest look: check that their callers ")
+	sb.WriteString("still work. Read the changed files before commenting, and finish with a short list of risks.\n\n")
+	fmt.Fprintf(&sb, "## Changed files vs %s\n\n%s\n\n## Hub files\n\n%s\n", ref, diff, hubs)
+
+	return promptResult("Review changes vs "+ref+" with impact analysis", sb.String()), nil
+}
+
+func handleOnboardPrompt(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	ctx = withProgress(ctx, req.Session, req.Params.GetProgressToken())
+	path, err := checkPath(ctx, req.Session, req.Params.Arguments["path"])
+	if err != nil {
+		return nil, err
+	}
+
+	structure, err := toolText(handleGetStructure(ctx, nil, PathInput{Path: path}))
+	if err != nil {
+		return nil, err
+	}
+	deps, err := toolText(handleGetDependencies(ctx, nil, PathInput{Path: path}))
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "I'm new to the project in %s. Using the codemap output below, onboard me:\n\n", path)
+	sb.WriteString("1. What the project does and how it is organized\n")
+	sb.WriteString("2. The entry points and main modules, and how they connect\n")
+	sb.WriteString("3. The hub files I should understand first, and why\n")
+	sb.WriteString("4. Key external dependencies\n")
+	sb.WriteString("5. Where to start reading, in order\n\n")
+	fmt.Fprintf(&sb, "## Structure\n\n%s\n\n## Dependencies\n\n%s\n", structure, deps)
+
+	return promptResult("Onboarding overview of "+path, sb.String()), nil
+}
+
+// toolText extracts the text summary of a tool handler's result
+func toolText[Out any](res *mcp.CallToolResult, _ Out, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, c := range res.Content {
+		if text, ok := c.(*mcp.TextContent); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	if res.IsError {
+		return "", fmt.Errorf("%s", strings.Join(parts, "\n"))
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// promptResult wraps text as a single user message
+func promptResult(description, text string) *mcp.GetPromptResult {
+	return &mcp.GetPromptResult{
+		Description: description,
+		Messages: []*mcp.PromptMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: text}},
+		},
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// fakeAstGrep puts an ast-grep that finds nothing first on PATH
+func fakeAstGrep(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script as a fake ast-grep")
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = --version ]; then echo 'ast-grep 0.39.0'; else echo '[]'; fi\n"
+	if err := os.WriteFile(filepath.Join(bin, "ast-grep"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// promptText returns the single message of a prompt
+func promptText(t *testing.T, res *mcp.GetPromptResult) string {
+	t.Helper()
+	if len(res.Messages) != 1 {
+		t.Fatalf("expected one message, got %d", len(res.Messages))
+	}
+	text, ok := res.Messages[0].Content.(*mcp.TextContent)
+	if !ok {
+		t.Fatalf("expected text content, got %T", res.Messages[0].Content)
+	}
+	return text.Text
+}
+
+func TestPrompts(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	fakeAstGrep(t)
+	root := tempTree(t)
+	forgetProject(t, root)
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "-q", "-b", "main")
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := connectServer(t, nil, root)
+	ctx := context.Background()
+
+	res, err := cs.GetPrompt(ctx, &mcp.GetPromptParams{Name: "onboard", Arguments: map[string]string{"path": root}})
+	if err != nil {
+		t.Fatalf("onboard failed: %v", err)
+	}
+	if text := promptText(t, res); !strings.Contains(text, "## Structure") || !strings.Contains(text, "main.go") {
+		t.Errorf("onboard should include the project structure:\n%s", text)
+	}
+
+	res, err = cs.GetPrompt(ctx, &mcp.GetPromptParams{Name: "review_diff", Arguments: map[string]string{"path": root}})
+	if err != nil {
+		t.Fatalf("review_diff failed: %v", err)
+	}
+	if text := promptText(t, res); !strings.Contains(text, "against main") || !strings.Contains(text, "main.go") {
+		t.Errorf("review_diff should list the changed file against main:\n%s", text)
+	}
+
+	if _, err := cs.GetPrompt(ctx, &mcp.GetPromptParams{Name: "onboard", Arguments: map[string]string{"path": filepath.Dir(root)}}); err == nil {
+		t.Error("a path outside the client's roots should be refused")
+	}
+}
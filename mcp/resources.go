@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"codemap/render"
+	"codemap/scanner"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Resources are addressed as codemap://{project}/<view>. {project} is the
+// base name of the server's working directory or of a watched project, or a
+// percent-encoded absolute path (codemap://%2Fcode%2Fapp/tree).
+const resourceScheme = "codemap://"
+
+// subscriptions tracks the resource URIs each client session subscribed
+// to, so watcher events can be turned into resource update notifications
+var subscriptions = &subscriptionRegistry{bySession: make(map[*mcp.ServerSession]*sessionSubscriptions)}
+
+type subscriptionRegistry struct {
+	mu        sync.Mutex
+	bySession map[*mcp.ServerSession]*sessionSubscriptions
+}
+
+// sessionSubscriptions are one session's subscribed URIs
+type sessionSubscriptions struct {
+	server *mcp.Server       // sends the session's notifications
+	uris   map[string]string // uri -> project root
+}
+
+func (r *subscriptionRegistry) add(server *mcp.Server, ss *mcp.ServerSession, root, uri string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subs := r.bySession[ss]
+	if subs == nil {
+		subs = &sessionSubscriptions{server: server, uris: make(map[string]string)}
+		r.bySession[ss] = subs
+	}
+	subs.uris[uri] = root
+}
+
+func (r *subscriptionRegistry) remove(ss *mcp.ServerSession, uri string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subs := r.bySession[ss]
+	if subs == nil {
+		return
+	}
+	delete(subs.uris, uri)
+	if len(subs.uris) == 0 {
+		delete(r.bySession, ss)
+	}
+}
+
+// dropSession forgets the subscriptions of a session that ended
+func (r *subscriptionRegistry) dropSession(ss *mcp.ServerSession) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.bySession, ss)
+}
+
+// active reports whether any resource of root is subscribed
+func (r *subscriptionRegistry) active(root string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, subs := range r.bySession {
+		for _, subRoot := range subs.uris {
+			if subRoot == root {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// notify sends an update notification for every subscribed URI of root
+func (r *subscriptionRegistry) notify(root string) {
+	type update struct {
+		server *mcp.Server
+		uri    string
+	}
+	updates := make(map[update]bool)
+
+	r.mu.Lock()
+	for _, subs := range r.bySession {
+		for uri, subRoot := range subs.uris {
+			if subRoot == root {
+				updates[update{subs.server, uri}] = true
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	// The server sends each URI's update to every session subscribed to it
+	for u := range updates {
+		u.server.ResourceUpdated(context.Background(), &mcp.ResourceUpdatedNotificationParams{URI: u.uri})
+	}
+}
+
+// resourceRef is a parsed codemap:// URI
+type resourceRef struct {
+	Root string // absolute project root
+	View string // tree, hubs, file or symbols
+	Path string // file or directory for the file and symbols views
+}
+
+// parseResourceURI splits a codemap:// URI and resolves its project, which
+// must be inside the allowed roots
+func parseResourceURI(ctx context.Context, ss *mcp.ServerSession, uri string) (resourceRef, error) {
+	rest, ok := strings.CutPrefix(uri, resourceScheme)
+	if !ok {
+		return resourceRef{}, fmt.Errorf("not a codemap resource: %s", uri)
+	}
+	project, view, _ := strings.Cut(rest, "/")
+	project, err := url.PathUnescape(project)
+	if err != nil {
+		return resourceRef{}, fmt.Errorf("invalid project in %s: %w", uri, err)
+	}
+	root, err := resolveProject(project)
+	if err != nil {
+		return resourceRef{}, err
+	}
+	if root, err = checkPath(ctx, ss, root); err != nil {
+		return resourceRef{}, err
+	}
+
+	ref := resourceRef{Root: root}
+	switch {
+	case view == "tree" || view == "hubs":
+		ref.View = view
+	case strings.HasPrefix(view, "file/") && strings.HasSuffix(view, "/context"):
+		ref.View = "file"
+		ref.Path = strings.TrimSuffix(strings.TrimPrefix(view, "file/"), "/context")
+	case view == "symbols" || strings.HasPrefix(view, "symbols/"):
+		ref.View = "symbols"
+		ref.Path = strings.Trim(strings.TrimPrefix(view, "symbols"), "/")
+	default:
+		return resourceRef{}, fmt.Errorf("unknown codemap view in %s", uri)
+	}
+	if ref.Path != "" {
+		if ref.Path, err = url.PathUnescape(ref.Path); err != nil {
+			return resourceRef{}, fmt.Errorf("invalid path in %s: %w", uri, err)
+		}
+		ref.Path = filepath.ToSlash(filepath.Clean(ref.Path))
+		if ref.Path == ".." || strings.HasPrefix(ref.Path, "../") || filepath.IsAbs(ref.Path) {
+			return resourceRef{}, fmt.Errorf("path escapes the project in %s", uri)
+		}
+	}
+	if ref.View == "file" && ref.Path == "" {
+		return resourceRef{}, fmt.Errorf("missing file in %s", uri)
+	}
+	return ref, nil
+}
+
+// knownProjects lists the working directory and all watched project roots
+func knownProjects() []string {
+	var roots []string
+	if cwd, err := os.Getwd(); err == nil {
+		roots = append(roots, cwd)
+	}
+	return append(roots, watchedProjects()...)
+}
+
+// resolveProject maps the {project} part of a resource URI to a directory
+func resolveProject(project string) (string, error) {
+	if filepath.IsAbs(project) {
+		root := filepath.Clean(project)
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return "", fmt.Errorf("project directory not found: %s", root)
+		}
+		return root, nil
+	}
+	for _, root := range knownProjects() {
+		if filepath.Base(root) == project {
+			return root, nil
+		}
+	}
+	return "", fmt.Errorf("unknown project %q (use the working directory name, a watched project, or an encoded absolute path)", project)
+}
+
+// projectURI builds the resource URI prefix for a project name
+func projectURI(name string) string {
+	return resourceScheme + url.PathEscape(name)
+}
+
+// addResources registers the codemap resource templates, plus concrete
+// tree and hubs resources for the server's working directory
+func addResources(server *mcp.Server) {
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "tree",
+		Title:       "Project tree",
+		URITemplate: resourceScheme + "{project}/tree",
+		Description: "Project structure as a tree with file sizes and languages.",
+		MIMEType:    "text/plain",
+	}, readResource)
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "hubs",
+		Title:       "Hub files",
+		URITemplate: resourceScheme + "{project}/hubs",
+		Description: "Files imported by 3+ other files, with their importers (JSON).",
+		MIMEType:    "application/json",
+	}, readResource)
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "file-context",
+		Title:       "File context",
+		URITemplate: resourceScheme + "{project}/file/{+path}/context",
+		Description: "Imports, importers, hub status and connected files for one file (JSON).",
+		MIMEType:    "application/json",
+	}, readResource)
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "symbols",
+		Title:       "Symbols",
+		URITemplate: resourceScheme + "{project}/symbols/{+path}",
+		Description: "Code symbols for a file or directory (JSON, requires ast-grep).",
+		MIMEType:    "application/json",
+	}, readResource)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	prefix := projectURI(filepath.Base(cwd))
+	if _, err := url.Parse(prefix); err != nil {
+		return // name can't be used as a URI host; templates still work
+	}
+	server.AddResource(&mcp.Resource{
+		Name:        "tree",
+		Title:       "Project tree: " + filepath.Base(cwd),
+		URI:         prefix + "/tree",
+		Description: "Structure of the working directory project.",
+		MIMEType:    "text/plain",
+	}, readResource)
+	server.AddResource(&mcp.Resource{
+		Name:        "hubs",
+		Title:       "Hub files: " + filepath.Base(cwd),
+		URI:         prefix + "/hubs",
+		Description: "Hub files of the working directory project (JSON).",
+		MIMEType:    "application/json",
+	}, readResource)
+}
+
+// readResource renders a codemap:// resource
+func readResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	ctx = withProgress(ctx, req.Session, req.Params.GetProgressToken())
+	uri := req.Params.URI
+	ref, err := parseResourceURI(ctx, req.Session, uri)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+
+	project, err := projects.get(ctx, ref.Root)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+
+	var text string
+	switch ref.View {
+	case "tree":
+		files, err := project.Files(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		var buf strings.Builder
+		tree := scanner.Project{Root: ref.Root, Mode: "tree", Files: files}
+		if err := render.Tree(tree, render.Options{Writer: &buf}); err != nil {
+			return nil, fmt.Errorf("render error: %w", err)
+		}
+		text = buf.String()
+
+	case "hubs":
+		fg, err := project.Graph(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build file graph: %w", err)
+		}
+		text, err = resourceJSON(&HubsOutput{Root: fg.Root, Hubs: hubEntries(fg)})
+		if err != nil {
+			return nil, err
+		}
+
+	case "file":
+		if _, err := os.Stat(filepath.Join(ref.Root, ref.Path)); err != nil {
+			return nil, mcp.ResourceNotFoundError(uri)
+		}
+		fg, err := project.Graph(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build file graph: %w", err)
+		}
+		text, err = resourceJSON(newFileContext(fg, ref.Path))
+		if err != nil {
+			return nil, err
+		}
+
+	case "symbols":
+		analyses, err := projectSymbols(ctx, ref.Root, ref.Path)
+		if err != nil {
+			return nil, err
+		}
+		text, err = resourceJSON(analyses)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{{URI: uri, Text: text}},
+	}, nil
+}
+
+// resourceJSON encodes a resource body as indented JSON
+func resourceJSON(v any) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// subscribeResource loads the resource's project into the cache, whose
+// watcher reports changes with notifications/resources/updated
+func subscribeResource(ctx context.Context, server *mcp.Server, req *mcp.SubscribeRequest) error {
+	uri := req.Params.URI
+	ref, err := parseResourceURI(ctx, req.Session, uri)
+	if err != nil {
+		return mcp.ResourceNotFoundError(uri)
+	}
+	// Subscribe first so the model can't be evicted while it loads
+	subscriptions.add(server, req.Session, ref.Root, uri)
+	forgetOnClose(req.Session)
+	m, err := projects.get(ctx, ref.Root)
+	if err == nil && !m.watched.Load() {
+		err = fmt.Errorf("cannot watch %s for changes", ref.Root)
+	}
+	if err != nil {
+		subscriptions.remove(req.Session, uri)
+		return err
+	}
+	return nil
+}
+
+// unsubscribeResource drops a subscription; the model is left for the cache to evict
+func unsubscribeResource(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+	subscriptions.remove(req.Session, req.Params.URI)
+	return nil
+}
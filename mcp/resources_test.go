@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// connectServer connects a client declaring roots to a new codemap server in memory
+func connectServer(t *testing.T, opts *mcp.ClientOptions, roots ...string) *mcp.ClientSession {
+	t.Helper()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test"}, opts)
+	for _, r := range roots {
+		client.AddRoots(&mcp.Root{URI: "file://" + filepath.ToSlash(r)})
+	}
+	st, ct := mcp.NewInMemoryTransports()
+	if _, err := newServer().Connect(context.Background(), st, nil); err != nil {
+		t.Fatal(err)
+	}
+	cs, err := client.Connect(context.Background(), ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cs.Close() })
+	return cs
+}
+
+// forgetProject drops root's model from the shared cache when the test ends
+func forgetProject(t *testing.T, root string) {
+	t.Cleanup(func() {
+		projects.mu.Lock()
+		m := projects.models[root]
+		delete(projects.models, root)
+		projects.mu.Unlock()
+		if m != nil {
+			m.close()
+		}
+	})
+}
+
+func TestParseResourceURI(t *testing.T) {
+	root := tempTree(t, "src")
+	project := resourceScheme + url.PathEscape(root)
+	tests := []struct {
+		uri  string
+		want resourceRef // zero if the URI is rejected
+	}{
+		{project + "/tree", resourceRef{Root: root, View: "tree"}},
+		{project + "/hubs", resourceRef{Root: root, View: "hubs"}},
+		{project + "/file/src/main.go/context", resourceRef{Root: root, View: "file", Path: "src/main.go"}},
+		{project + "/symbols", resourceRef{Root: root, View: "symbols"}},
+		{project + "/symbols/src/", resourceRef{Root: root, View: "symbols", Path: "src"}},
+		{project + "/file/../etc/passwd/context", resourceRef{}},
+		{project + "/file//context", resourceRef{}},
+		{project + "/graph", resourceRef{}},
+		{"file://" + root, resourceRef{}},
+		{resourceScheme + "no-such-project/tree", resourceRef{}},
+	}
+	for _, tt := range tests {
+		got, err := parseResourceURI(context.Background(), nil, tt.uri)
+		if tt.want == (resourceRef{}) {
+			if err == nil {
+				t.Errorf("parseResourceURI(%q) = %+v, want an error", tt.uri, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseResourceURI(%q) = %+v, %v; want %+v", tt.uri, got, err, tt.want)
+		}
+	}
+}
+
+func TestSubscriptionRegistry(t *testing.T) {
+	r := &subscriptionRegistry{bySession: make(map[*mcp.ServerSession]*sessionSubscriptions)}
+	a, b := &mcp.ServerSession{}, &mcp.ServerSession{}
+	r.add(nil, a, "/p", "codemap://p/tree")
+	r.add(nil, a, "/p", "codemap://p/hubs")
+	r.add(nil, b, "/p", "codemap://p/tree")
+	r.add(nil, b, "/q", "codemap://q/tree")
+
+	r.remove(a, "codemap://p/tree")
+	r.remove(a, "codemap://p/hubs")
+	if !r.active("/p") {
+		t.Error("/p is still subscribed by the other session")
+	}
+	r.dropSession(b)
+	if r.active("/p") || r.active("/q") || len(r.bySession) != 0 {
+		t.Errorf("ended sessions should leave no subscriptions, got %d sessions", len(r.bySession))
+	}
+}
+
+func TestResourceSubscriptions(t *testing.T) {
+	root := tempTree(t)
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	forgetProject(t, root)
+	uri := resourceScheme + url.PathEscape(root) + "/tree"
+
+	updated := make(chan string, 10)
+	cs := connectServer(t, &mcp.ClientOptions{
+		ResourceUpdatedHandler: func(_ context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+			updated <- req.Params.URI
+		},
+	}, root)
+	ctx := context.Background()
+
+	res, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+	if err != nil {
+		t.Fatalf("ReadResource failed: %v", err)
+	}
+	if len(res.Contents) != 1 || !strings.Contains(res.Contents[0].Text, "main.go") {
+		t.Errorf("tree resource should list main.go, got %+v", res.Contents)
+	}
+	if _, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: resourceScheme + url.PathEscape(filepath.Dir(root)) + "/tree"}); err == nil {
+		t.Error("a project outside the client's roots should not be readable")
+	}
+
+	// Edits are announced to subscribers
+	if err := cs.Subscribe(ctx, &mcp.SubscribeParams{URI: uri}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if !subscriptions.active(root) {
+		t.Fatal("subscription should be registered")
+	}
+	if err := os.WriteFile(filepath.Join(root, "util.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "a resource update", func() bool {
+		select {
+		case got := <-updated:
+			return got == uri
+		default:
+			return false
+		}
+	})
+
+	// A client that disconnects while subscribed leaves nothing behind
+	cs.Close()
+	waitFor(t, "the subscription to be dropped", func() bool { return !subscriptions.active(root) })
+}
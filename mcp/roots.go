@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// allowedRoots limits which directories tools may read or watch. It is set
+// from --root flags and CODEMAP_MCP_ROOTS; empty means no server-side limit.
+// Clients that support MCP roots narrow access further to their own roots.
+var allowedRoots []string
+
+// rootsEnv lists allowed roots separated by the OS path list separator (":" on Unix)
+const rootsEnv = "CODEMAP_MCP_ROOTS"
+
+// rootsFlag collects repeated --root flags
+type rootsFlag []string
+
+func (f *rootsFlag) String() string     { return strings.Join(*f, string(os.PathListSeparator)) }
+func (f *rootsFlag) Set(v string) error { *f = append(*f, v); return nil }
+
+// setAllowedRoots canonicalizes the configured roots; each must be an existing directory
+func setAllowedRoots(roots []string) error {
+	allowedRoots = nil
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		canonical, err := canonicalPath(root)
+		if err != nil {
+			return fmt.Errorf("invalid root %s: %w", root, err)
+		}
+		if info, err := os.Stat(canonical); err != nil || !info.IsDir() {
+			return fmt.Errorf("invalid root %s: not a directory", root)
+		}
+		allowedRoots = append(allowedRoots, canonical)
+	}
+	return nil
+}
+
+// canonicalPath expands ~/, makes path absolute and resolves symlinks, so a
+// link inside an allowed root can't point outside it
+func canonicalPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("path not found: %s", abs)
+		}
+		return "", err
+	}
+	return resolved, nil
+}
+
+// within reports whether path is root or inside it (both canonical)
+func within(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// clientRoots caches each session's roots; clients that don't support
+// roots/list are stored with a nil slice
+var clientRoots sync.Map // *mcp.ServerSession -> []string
+
+// sessionRoots returns the canonical roots a client declared, and false if
+// the client doesn't restrict access through roots. A client that declares
+// no roots, or only ones that don't resolve, is granted nothing. If the
+// client can't be asked, the error is returned and it is asked again next
+// time.
+func sessionRoots(ctx context.Context, ss *mcp.ServerSession) ([]string, bool, error) {
+	if ss == nil {
+		return nil, false, nil
+	}
+	if cached, ok := clientRoots.Load(ss); ok {
+		roots := cached.([]string)
+		return roots, roots != nil, nil
+	}
+
+	res, err := ss.ListRoots(ctx, nil)
+	if err != nil && !methodNotFound(err) {
+		return nil, false, fmt.Errorf("listing the client's roots: %w", err)
+	}
+	var roots []string
+	if err == nil {
+		roots = []string{}
+		for _, r := range res.Roots {
+			u, err := url.Parse(r.URI)
+			if err != nil || u.Scheme != "file" {
+				continue
+			}
+			if canonical, err := canonicalPath(filepath.FromSlash(u.Path)); err == nil {
+				roots = append(roots, canonical)
+			}
+		}
+	}
+	clientRoots.Store(ss, roots)
+	forgetOnClose(ss)
+	return roots, roots != nil, nil
+}
+
+// methodNotFound reports whether err is a JSON-RPC "method not found"
+// reply, which is how clients without roots support answer roots/list.
+// The SDK doesn't export its error type, so the code is read back from
+// the error's JSON form.
+func methodNotFound(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		var wire struct {
+			Code int64 `json:"code"`
+		}
+		if data, jerr := json.Marshal(err); jerr == nil && json.Unmarshal(data, &wire) == nil && wire.Code == -32601 {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetRoots drops a session's cached roots after notifications/roots/list_changed
+func forgetRoots(ctx context.Context, req *mcp.RootsListChangedRequest) {
+	clientRoots.Delete(req.Session)
+}
+
+// closing holds the sessions forgetOnClose is waiting on
+var closing sync.Map // *mcp.ServerSession -> struct{}
+
+// forgetOnClose drops what is kept per session once it ends
+func forgetOnClose(ss *mcp.ServerSession) {
+	if _, waiting := closing.LoadOrStore(ss, struct{}{}); waiting {
+		return
+	}
+	go func() {
+		ss.Wait()
+		clientRoots.Delete(ss)
+		subscriptions.dropSession(ss)
+		closing.Delete(ss)
+	}()
+}
+
+// checkPath resolves path and verifies it lies inside the server's allowed
+// roots and, if the client declared roots, inside one of those as well.
+// It returns the canonical path that handlers should use.
+func checkPath(ctx context.Context, ss *mcp.ServerSession, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	canonical, err := canonicalPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if len(allowedRoots) > 0 && !withinAny(canonical, allowedRoots) {
+		return "", fmt.Errorf("access denied: %s is outside the allowed roots (%s)", canonical, strings.Join(allowedRoots, ", "))
+	}
+
+	roots, ok, err := sessionRoots(ctx, ss)
+	if err != nil {
+		return "", err
+	}
+	if ok && len(roots) == 0 {
+		return "", fmt.Errorf("access denied: the client declared no usable roots")
+	}
+	if ok && !withinAny(canonical, roots) {
+		return "", fmt.Errorf("access denied: %s is outside the client's roots (%s)", canonical, strings.Join(roots, ", "))
+	}
+	return canonical, nil
+}
+
+func withinAny(path string, roots []string) bool {
+	for _, root := range roots {
+		if within(path, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// toolPath checks a tool's path argument; req may be nil for internal calls
+func toolPath(ctx context.Context, req *mcp.CallToolRequest, path string) (string, error) {
+	var ss *mcp.ServerSession
+	if req != nil {
+		ss = req.Session
+	}
+	return checkPath(ctx, ss, path)
+}
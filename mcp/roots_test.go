@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// tempTree creates dirs under a canonical temp directory and returns it
+func tempTree(t *testing.T, dirs ...string) string {
+	t.Helper()
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(base, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return base
+}
+
+func TestWithin(t *testing.T) {
+	sep := string(filepath.Separator)
+	root := filepath.Join(sep+"a", "root")
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{root, true},
+		{filepath.Join(root, "main.go"), true},
+		{filepath.Join(root, "sub", "deep"), true},
+		{filepath.Join(root, "..dotted"), true},
+		{filepath.Join(sep+"a", "rootX"), false},
+		{filepath.Join(sep+"a", "rootX", "main.go"), false},
+		{filepath.Join(sep + "a"), false},
+		{filepath.Join(sep+"a", "other"), false},
+	}
+	for _, tt := range tests {
+		if got := within(tt.path, root); got != tt.want {
+			t.Errorf("within(%q, %q) = %v, want %v", tt.path, root, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	base := tempTree(t, "root/sub", "root/other", "rootX", "outside")
+	root := filepath.Join(base, "root")
+	if err := os.Symlink(filepath.Join(base, "outside"), filepath.Join(root, "escape")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "inside")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A client whose declared roots are already cached, so no request is made
+	narrowed := &mcp.ServerSession{}
+	clientRoots.Store(narrowed, []string{filepath.Join(root, "sub")})
+	defer clientRoots.Delete(narrowed)
+
+	tests := []struct {
+		name    string
+		session *mcp.ServerSession
+		path    string
+		want    string // canonical path, or "" if denied
+		errText string
+	}{
+		{"root itself", nil, root, root, ""},
+		{"inside root", nil, filepath.Join(root, "sub"), filepath.Join(root, "sub"), ""},
+		{"symlink inside root", nil, filepath.Join(root, "inside"), filepath.Join(root, "sub"), ""},
+		{"symlink escaping root", nil, filepath.Join(root, "escape"), "", "access denied"},
+		{"sibling with root as prefix", nil, filepath.Join(base, "rootX"), "", "access denied"},
+		{"dot-dot out of root", nil, filepath.Join(root, "..", "outside"), "", "access denied"},
+		{"path that doesn't exist yet", nil, filepath.Join(root, "new"), "", "path not found"},
+		{"empty path", nil, "", "", "path is required"},
+		{"inside the session's roots", narrowed, filepath.Join(root, "sub"), filepath.Join(root, "sub"), ""},
+		{"flag root outside the session's roots", narrowed, filepath.Join(root, "other"), "", "outside the client's roots"},
+		{"session roots don't widen the flag roots", narrowed, filepath.Join(base, "outside"), "", "outside the allowed roots"},
+	}
+
+	if err := setAllowedRoots([]string{root}); err != nil {
+		t.Fatalf("setAllowedRoots failed: %v", err)
+	}
+	defer setAllowedRoots(nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkPath(context.Background(), tt.session, tt.path)
+			if tt.want != "" {
+				if err != nil || got != tt.want {
+					t.Errorf("checkPath(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("checkPath(%q) = %q, %v; want an error containing %q", tt.path, got, err, tt.errText)
+			}
+		})
+	}
+
+	// Without flag roots, the session's roots alone decide
+	setAllowedRoots(nil)
+	if _, err := checkPath(context.Background(), narrowed, filepath.Join(base, "outside")); err == nil || !strings.Contains(err.Error(), "outside the client's roots") {
+		t.Errorf("Expected the session's roots to deny %s, got %v", filepath.Join(base, "outside"), err)
+	}
+	if _, err := checkPath(context.Background(), nil, filepath.Join(base, "outside")); err != nil {
+		t.Errorf("Expected no limit without flag or session roots, got %v", err)
+	}
+}
+
+func TestSetAllowedRoots(t *testing.T) {
+	base := tempTree(t, "root")
+	defer setAllowedRoots(nil)
+
+	if err := setAllowedRoots([]string{filepath.Join(base, "root"), ""}); err != nil {
+		t.Fatalf("setAllowedRoots failed: %v", err)
+	}
+	if len(allowedRoots) != 1 || allowedRoots[0] != filepath.Join(base, "root") {
+		t.Errorf("Expected one canonical root, got %v", allowedRoots)
+	}
+	if err := setAllowedRoots([]string{filepath.Join(base, "missing")}); err == nil {
+		t.Error("Expected an error for a root that doesn't exist")
+	}
+}
+
+// connectClient connects client to a bare server in memory and returns the
+// server's side of the session
+func connectClient(t *testing.T, client *mcp.Client) (*mcp.ServerSession, *mcp.ClientSession) {
+	t.Helper()
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := mcp.NewServer(&mcp.Implementation{Name: "codemap"}, nil).Connect(context.Background(), st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := client.Connect(context.Background(), ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cs.Close() })
+	return ss, cs
+}
+
+// errUnsupported makes a test client answer roots/list as unknown
+var errUnsupported = errors.New("unsupported")
+
+func TestSessionRoots(t *testing.T) {
+	base := tempTree(t, "root/sub")
+	root := filepath.Join(base, "root")
+	sub := filepath.Join(root, "sub")
+	// fail can refuse a roots/list call; errUnsupported answers it like a
+	// client without roots support
+	newClient := func(fail func(call int) error, roots ...string) *mcp.Client {
+		client := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil)
+		for _, r := range roots {
+			client.AddRoots(&mcp.Root{URI: "file://" + filepath.ToSlash(r)})
+		}
+		calls := 0
+		client.AddReceivingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+			return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+				if method == "roots/list" && fail != nil {
+					calls++
+					switch err := fail(calls); {
+					case err == errUnsupported:
+						return next(ctx, "roots/unsupported", req)
+					case err != nil:
+						return nil, err
+					}
+				}
+				return next(ctx, method, req)
+			}
+		})
+		return client
+	}
+
+	// Declared roots narrow access
+	ss, _ := connectClient(t, newClient(nil, sub))
+	if _, err := checkPath(context.Background(), ss, sub); err != nil {
+		t.Errorf("path inside the client's roots: %v", err)
+	}
+	if _, err := checkPath(context.Background(), ss, root); err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("path outside the client's roots: %v", err)
+	}
+
+	// No roots grant nothing
+	ss, _ = connectClient(t, newClient(nil))
+	if _, err := checkPath(context.Background(), ss, sub); err == nil || !strings.Contains(err.Error(), "no usable roots") {
+		t.Errorf("client without roots: %v", err)
+	}
+
+	// A failed roots/list denies the call and is asked again
+	ss, _ = connectClient(t, newClient(func(call int) error {
+		if call == 1 {
+			return errors.New("busy")
+		}
+		return nil
+	}, sub))
+	if _, err := checkPath(context.Background(), ss, root); err == nil {
+		t.Error("a failed roots/list should deny the call")
+	}
+	if _, err := checkPath(context.Background(), ss, root); err == nil || !strings.Contains(err.Error(), "outside the client's roots") {
+		t.Errorf("roots should be asked for again after a failure: %v", err)
+	}
+
+	// A client that doesn't support roots/list isn't restricted by them
+	ss, cs := connectClient(t, newClient(func(int) error {
+		return errUnsupported
+	}))
+	if _, err := checkPath(context.Background(), ss, root); err != nil {
+		t.Errorf("client without roots support: %v", err)
+	}
+
+	// Ending the session forgets its roots
+	cs.Close()
+	waitFor(t, "the session's roots to be dropped", func() bool {
+		_, ok := clientRoots.Load(ss)
+		return !ok
+	})
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"codemap/render"
+	"codemap/scanner"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type SymbolsInput struct {
+	FormatInput
+	PageInput
+	Path         string `json:"path" jsonschema:"Path to the project directory"`
+	File         string `json:"file,omitempty" jsonschema:"Only symbols in this file or directory (relative path, e.g. src/api)"`
+	Kind         string `json:"kind,omitempty" jsonschema:"Only this kind: function, method, class, interface, type, enum, namespace, constant, variable, field or property"`
+	ExportedOnly bool   `json:"exported_only,omitempty" jsonschema:"Only symbols visible outside their file or package"`
+}
+
+type FindSymbolInput struct {
+	FormatInput
+	PageInput
+	Path  string `json:"path" jsonschema:"Path to the project directory"`
+	Name  string `json:"name" jsonschema:"Symbol name; use Type.member to search inside a class or struct"`
+	Fuzzy bool   `json:"fuzzy,omitempty" jsonschema:"Also match case-insensitive prefixes, substrings and subsequences"`
+}
+
+type OutlineInput struct {
+	FormatInput
+	PageInput
+	Path string `json:"path" jsonschema:"Path to the project directory"`
+	File string `json:"file" jsonschema:"Relative path to the file (e.g. src/app.ts)"`
+}
+
+// maxFuzzyMatches is the default limit of find_symbol in fuzzy mode
+const maxFuzzyMatches = 50
+
+// errAstGrepMissing is shown when the symbol tools can't run
+const errAstGrepMissing = "ast-grep not found. Symbol tools need it installed:\n  brew install ast-grep    # macOS/Linux\n  cargo install ast-grep   # via Rust"
+
+// scanSymbols runs ast-grep over the project, returning symbols sorted by path
+func scanSymbols(ctx context.Context, root string) ([]scanner.SymbolAnalysis, error) {
+	sg, err := scanner.NewAstGrepScanner()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize scanner: %w", err)
+	}
+	defer sg.Close()
+	if !sg.Available() {
+		return nil, fmt.Errorf("%s", errAstGrepMissing)
+	}
+
+	analyses, err := sg.ScanSymbols(ctx, root, false)
+	if err != nil {
+		return nil, fmt.Errorf("symbol scan error: %w", err)
+	}
+	sort.Slice(analyses, func(i, j int) bool { return analyses[i].Path < analyses[j].Path })
+	return analyses, nil
+}
+
+// projectSymbols returns the cached symbols of files at or under path ("" = whole project)
+func projectSymbols(ctx context.Context, root, path string) ([]scanner.SymbolAnalysis, error) {
+	project, err := projects.get(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	analyses, err := project.Symbols(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	path = strings.Trim(filepath.ToSlash(filepath.Clean(path)), "/")
+	result := []scanner.SymbolAnalysis{}
+	for _, a := range analyses {
+		p := filepath.ToSlash(a.Path)
+		if path == "" || path == "." || p == path || strings.HasPrefix(p, path+"/") {
+			result = append(result, a)
+		}
+	}
+	return result, nil
+}
+
+// definitions returns the symbol definitions of a file, in source order.
+// Imports are only included when asked for by kind.
+func definitions(a scanner.SymbolAnalysis, kind string) []SymbolEntry {
+	var entries []SymbolEntry
+	for _, sym := range a.Symbols {
+		if isDefinition(sym, kind) {
+			entries = append(entries, symbolEntry(a, sym))
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Line < entries[j].Line })
+	return entries
+}
+
+// isDefinition reports whether sym is a definition of the given kind ("" = any but imports)
+func isDefinition(sym scanner.Symbol, kind string) bool {
+	if sym.Role != scanner.RoleDefinition {
+		return false
+	}
+	if kind == "" {
+		return sym.Kind != scanner.KindImport
+	}
+	return string(sym.Kind) == kind
+}
+
+// symbolEntry converts a scanned symbol, moving ast-grep's 0-based positions to 1-based
+func symbolEntry(a scanner.SymbolAnalysis, sym scanner.Symbol) SymbolEntry {
+	scope := sym.Scope
+	if scope == "global" {
+		scope = ""
+	}
+	return SymbolEntry{
+		File:      filepath.ToSlash(a.Path),
+		Name:      sym.Name,
+		Kind:      string(sym.Kind),
+		Line:      sym.Line + 1,
+		Column:    sym.Column + 1,
+		Scope:     scope,
+		Parent:    sym.Parent,
+		Signature: sym.Signature,
+		Modifiers: sym.Modifiers,
+		Exported:  sym.IsExported(a.Language),
+	}
+}
+
+// location formats a symbol as "file:line  kind name signature [scope]"
+func (e SymbolEntry) location() string {
+	s := fmt.Sprintf("%s:%d  %s %s%s", e.File, e.Line, e.Kind, e.Name, e.Signature)
+	if e.Scope != "" {
+		s += "  [" + e.Scope + "]"
+	}
+	return s
+}
+
+func handleGetSymbols(ctx context.Context, req *mcp.CallToolRequest, input SymbolsInput) (*mcp.CallToolResult, *SymbolsOutput, error) {
+	ctx = toolProgress(ctx, req)
+	absRoot, err := toolPath(ctx, req, input.Path)
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	analyses, err := projectSymbols(ctx, absRoot, input.File)
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+
+	// Definitions in file and line order, kept with the scanned symbol for rendering
+	type symbolItem struct {
+		file  scanner.SymbolAnalysis // path and language only
+		sym   scanner.Symbol
+		entry SymbolEntry
+	}
+	var items []symbolItem
+	files := 0
+	for _, a := range analyses {
+		var kept []symbolItem
+		for _, sym := range a.Symbols {
+			if !isDefinition(sym, input.Kind) || (input.ExportedOnly && !sym.IsExported(a.Language)) {
+				continue
+			}
+			file := scanner.SymbolAnalysis{Path: a.Path, Language: a.Language}
+			kept = append(kept, symbolItem{file, sym, symbolEntry(a, sym)})
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		sort.SliceStable(kept, func(i, j int) bool { return kept[i].entry.Line < kept[j].entry.Line })
+		items = append(items, kept...)
+		files++
+	}
+
+	if len(items) == 0 {
+		return toolResult(input.Format, "No matching symbols found."), &SymbolsOutput{Root: absRoot}, nil
+	}
+
+	total := len(items)
+	output, out, page, err := paginate(items, input.PageInput, input.Format, func(items []symbolItem) (string, *SymbolsOutput, error) {
+		out := &SymbolsOutput{Root: absRoot}
+		var grouped []scanner.SymbolAnalysis
+		for _, it := range items {
+			if n := len(grouped); n == 0 || grouped[n-1].Path != it.file.Path {
+				grouped = append(grouped, it.file)
+			}
+			last := &grouped[len(grouped)-1]
+			last.Symbols = append(last.Symbols, it.sym)
+			out.Symbols = append(out.Symbols, it.entry)
+		}
+
+		var buf strings.Builder
+		fmt.Fprintf(&buf, "=== Symbols (%d in %d files) ===\n", total, files)
+		if err := render.Symbols(grouped, render.SymbolOptions{Options: render.Options{Writer: &buf}}); err != nil {
+			return "", nil, fmt.Errorf("Render error: %w", err)
+		}
+		return buf.String(), out, nil
+	})
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	out.Page = pageOf(page)
+
+	return toolResult(input.Format, output+page.summary("symbols")), out, nil
+}
+
+func handleFindSymbol(ctx context.Context, req *mcp.CallToolRequest, input FindSymbolInput) (*mcp.CallToolResult, *FindSymbolOutput, error) {
+	ctx = toolProgress(ctx, req)
+	if input.Name == "" {
+		return errorResult("name is required"), nil, nil
+	}
+	absRoot, err := toolPath(ctx, req, input.Path)
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	analyses, err := projectSymbols(ctx, absRoot, "")
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+
+	type match struct {
+		entry SymbolEntry
+		rank  int
+	}
+	var matches []match
+	for _, a := range analyses {
+		for _, e := range definitions(a, "") {
+			if rank, ok := matchSymbol(e, input.Name, input.Fuzzy); ok {
+				matches = append(matches, match{e, rank})
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		if matches[i].entry.File != matches[j].entry.File {
+			return matches[i].entry.File < matches[j].entry.File
+		}
+		return matches[i].entry.Line < matches[j].entry.Line
+	})
+
+	if len(matches) == 0 {
+		hint := ""
+		if !input.Fuzzy {
+			hint = " (try fuzzy: true)"
+		}
+		return toolResult(input.Format, fmt.Sprintf("No definition of '%s' found%s.", input.Name, hint)), &FindSymbolOutput{Name: input.Name, Fuzzy: input.Fuzzy}, nil
+	}
+
+	pageIn := input.PageInput
+	if input.Fuzzy && pageIn.Limit == 0 {
+		pageIn.Limit = maxFuzzyMatches
+	}
+	output, out, page, err := paginate(matches, pageIn, input.Format, func(shown []match) (string, *FindSymbolOutput, error) {
+		out := &FindSymbolOutput{Name: input.Name, Fuzzy: input.Fuzzy}
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("%d definitions of '%s':\n", len(matches), input.Name))
+		for _, m := range shown {
+			out.Matches = append(out.Matches, m.entry)
+			sb.WriteString("  " + m.entry.location() + "\n")
+		}
+		return sb.String(), out, nil
+	})
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	out.Page = pageOf(page)
+
+	return toolResult(input.Format, output+page.summary("definitions")), out, nil
+}
+
+// matchSymbol ranks how well a definition matches query (lower is better).
+// A query of the form Type.member also has to match the symbol's scope.
+func matchSymbol(e SymbolEntry, query string, fuzzy bool) (int, bool) {
+	name := query
+	if owner, member, ok := strings.Cut(query, "."); ok && member != "" {
+		_, scopeName, _ := strings.Cut(e.Scope, ":")
+		if scopeName == "" {
+			scopeName = e.Parent
+		}
+		if !strings.EqualFold(scopeName, owner) {
+			return 0, false
+		}
+		name = member
+	}
+
+	if e.Name == name {
+		return 0, true
+	}
+	if !fuzzy {
+		return 0, false
+	}
+	lower, q := strings.ToLower(e.Name), strings.ToLower(name)
+	switch {
+	case lower == q:
+		return 1, true
+	case strings.HasPrefix(lower, q):
+		return 2, true
+	case strings.Contains(lower, q):
+		return 3, true
+	case isSubsequence(q, lower):
+		return 4, true
+	}
+	return 0, false
+}
+
+// isSubsequence reports whether all runes of sub appear in s in order
+func isSubsequence(sub, s string) bool {
+	r := []rune(sub)
+	if len(r) == 0 {
+		return true
+	}
+	for _, c := range s {
+		if c == r[0] {
+			r = r[1:]
+			if len(r) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func handleGetOutline(ctx context.Context, req *mcp.CallToolRequest, input OutlineInput) (*mcp.CallToolResult, *OutlineOutput, error) {
+	ctx = toolProgress(ctx, req)
+	if input.File == "" {
+		return errorResult("file is required"), nil, nil
+	}
+	absRoot, err := toolPath(ctx, req, input.Path)
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	analyses, err := projectSymbols(ctx, absRoot, input.File)
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+
+	file := filepath.ToSlash(filepath.Clean(input.File))
+	out := &OutlineOutput{File: file, Language: scanner.DetectLanguage(file)}
+	for _, a := range analyses {
+		if filepath.ToSlash(a.Path) != file {
+			continue
+		}
+		for _, e := range definitions(a, "") {
+			depth := 0
+			if e.Scope != "" {
+				depth = 1
+			}
+			out.Entries = append(out.Entries, OutlineEntry{
+				Name:      e.Name,
+				Kind:      e.Kind,
+				Line:      e.Line,
+				Depth:     depth,
+				Signature: e.Signature,
+				Exported:  e.Exported,
+			})
+		}
+	}
+
+	if len(out.Entries) == 0 {
+		return toolResult(input.Format, "No symbols found in "+file), out, nil
+	}
+
+	output, out, page, err := paginate(out.Entries, input.PageInput, input.Format, func(entries []OutlineEntry) (string, *OutlineOutput, error) {
+		pageOut := *out
+		pageOut.Entries = entries
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("%s (%s, %d symbols)\n", file, out.Language, len(out.Entries)))
+		for _, e := range entries {
+			sb.WriteString(fmt.Sprintf("%5d  %s%s %s%s\n", e.Line, strings.Repeat("  ", e.Depth), e.Kind, e.Name, e.Signature))
+		}
+		return sb.String(), &pageOut, nil
+	})
+	if err != nil {
+		return errorResult(err.Error()), nil, nil
+	}
+	out.Page = pageOf(page)
+
+	return toolResult(input.Format, output+page.summary("symbols")), out, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"codemap/scanner"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// callTool calls a tool, decodes its structured result into out and
+// returns its text
+func callTool(t *testing.T, cs *mcp.ClientSession, name string, args map[string]any, out any) string {
+	t.Helper()
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		t.Fatalf("%s failed: %v", name, err)
+	}
+	var text strings.Builder
+	for _, c := range res.Content {
+		if tc, ok := c.(*mcp.TextContent); ok {
+			text.WriteString(tc.Text)
+		}
+	}
+	if res.IsError {
+		t.Fatalf("%s returned an error: %s", name, text.String())
+	}
+	data, err := json.Marshal(res.StructuredContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("%s: structured content doesn't match its output type: %v", name, err)
+	}
+	return text.String()
+}
+
+// seedSymbols caches symbols for root, as if ast-grep had scanned them
+func seedSymbols(t *testing.T, root string, symbols []scanner.SymbolAnalysis) {
+	t.Helper()
+	m := &projectModel{root: root, lastUse: time.Now(), started: true}
+	m.watched.Store(true)
+	m.symbols = cached[[]scanner.SymbolAnalysis]{value: symbols, gen: m.gen.Load(), ok: true}
+	projects.mu.Lock()
+	projects.models[root] = m
+	projects.mu.Unlock()
+	forgetProject(t, root)
+}
+
+func TestStatusListsTools(t *testing.T) {
+	cs := connectServer(t, nil)
+	tools, err := cs.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+	var status StatusOutput
+	text := callTool(t, cs, "status", map[string]any{}, &status)
+	if status.Version != serverVersion {
+		t.Errorf("status version = %q, want %q", status.Version, serverVersion)
+	}
+	for _, tool := range tools.Tools {
+		if tool.OutputSchema == nil {
+			t.Errorf("%s has no output schema", tool.Name)
+		}
+		if tool.Name != "status" && !strings.Contains(text, "  "+tool.Name+" ") {
+			t.Errorf("status doesn't list %s", tool.Name)
+		}
+	}
+}
+
+func TestStructuredOutputs(t *testing.T) {
+	fakeAstGrep(t)
+	root := tempTree(t, "pkg")
+	for _, name := range []string{"main.go", "pkg/util.go"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("package main\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	forgetProject(t, root)
+	cs := connectServer(t, nil, root)
+
+	var structure StructureOutput
+	callTool(t, cs, "get_structure", map[string]any{"path": root}, &structure)
+	if structure.Root != root || structure.FileCount != 2 || len(structure.Files) != 2 {
+		t.Errorf("get_structure = %+v", structure)
+	}
+
+	var found FindOutput
+	callTool(t, cs, "find_file", map[string]any{"path": root, "pattern": "util"}, &found)
+	if len(found.Files) != 1 || found.Files[0].Path != "pkg/util.go" || found.Files[0].Language != "go" {
+		t.Errorf("find_file = %+v", found)
+	}
+
+	var hubs HubsOutput
+	callTool(t, cs, "get_hubs", map[string]any{"path": root}, &hubs)
+	if hubs.Root != root || len(hubs.Hubs) != 0 {
+		t.Errorf("get_hubs = %+v", hubs)
+	}
+
+	var fileContext FileContextOutput
+	callTool(t, cs, "get_file_context", map[string]any{"path": root, "file": "main.go"}, &fileContext)
+	if fileContext.File != "main.go" || fileContext.IsHub {
+		t.Errorf("get_file_context = %+v", fileContext)
+	}
+}
+
+func TestSymbolTools(t *testing.T) {
+	root := tempTree(t)
+	seedSymbols(t, root, []scanner.SymbolAnalysis{
+		{Path: "server.go", Language: "go", Symbols: []scanner.Symbol{
+			{Name: "Server", Kind: scanner.KindType, Role: scanner.RoleDefinition, Line: 2},
+			{Name: "Start", Kind: scanner.KindMethod, Role: scanner.RoleDefinition, Line: 6, Scope: "struct:Server", Parent: "Server", Signature: "() error"},
+			{Name: "newServer", Kind: scanner.KindFunction, Role: scanner.RoleDefinition, Line: 10, Signature: "() *Server"},
+			{Name: "fmt", Kind: scanner.KindImport, Role: scanner.RoleDefinition, Line: 0},
+		}},
+		{Path: "client.go", Language: "go", Symbols: []scanner.Symbol{
+			{Name: "Start", Kind: scanner.KindFunction, Role: scanner.RoleDefinition, Line: 4},
+		}},
+	})
+	cs := connectServer(t, nil, root)
+
+	var symbols SymbolsOutput
+	callTool(t, cs, "get_symbols", map[string]any{"path": root, "kind": "function"}, &symbols)
+	if len(symbols.Symbols) != 2 || symbols.Symbols[0].Name != "newServer" || symbols.Symbols[1].File != "client.go" {
+		t.Errorf("get_symbols kind=function = %+v", symbols.Symbols)
+	}
+	callTool(t, cs, "get_symbols", map[string]any{"path": root, "file": "server.go", "exported_only": true}, &symbols)
+	if len(symbols.Symbols) != 2 || symbols.Symbols[0].Name != "Server" || symbols.Symbols[1].Line != 7 {
+		t.Errorf("get_symbols exported_only = %+v", symbols.Symbols)
+	}
+
+	var found FindSymbolOutput
+	callTool(t, cs, "find_symbol", map[string]any{"path": root, "name": "Start"}, &found)
+	if len(found.Matches) != 2 {
+		t.Errorf("find_symbol Start = %+v", found.Matches)
+	}
+	callTool(t, cs, "find_symbol", map[string]any{"path": root, "name": "Server.Start"}, &found)
+	if len(found.Matches) != 1 || found.Matches[0].File != "server.go" || found.Matches[0].Scope != "struct:Server" {
+		t.Errorf("find_symbol Server.Start = %+v", found.Matches)
+	}
+	callTool(t, cs, "find_symbol", map[string]any{"path": root, "name": "newserv", "fuzzy": true}, &found)
+	if len(found.Matches) != 1 || found.Matches[0].Name != "newServer" || !found.Fuzzy {
+		t.Errorf("find_symbol fuzzy = %+v", found)
+	}
+
+	var outline OutlineOutput
+	text := callTool(t, cs, "get_outline", map[string]any{"path": root, "file": "server.go"}, &outline)
+	if outline.Language != "go" || len(outline.Entries) != 3 {
+		t.Fatalf("get_outline = %+v", outline)
+	}
+	if e := outline.Entries[1]; e.Name != "Start" || e.Depth != 1 || e.Line != 7 {
+		t.Errorf("members should be indented under their type, got %+v", e)
+	}
+	if !strings.Contains(text, "server.go (go, 3 symbols)") {
+		t.Errorf("unexpected outline text:\n%s", text)
+	}
+}
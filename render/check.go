@@ -0,0 +1,249 @@
+package render
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"codemap/config"
+	"codemap/scanner"
+)
+
+// CheckReport is the input for rendering `codemap check` results
+type CheckReport struct {
+	Root       string
+	Rules      config.Rules
+	Violations []scanner.RuleViolation
+}
+
+// Check renders architecture rule violations as text, json, junit or sarif
+func Check(report CheckReport, opts Options) error {
+	w := opts.writer()
+	switch opts.format() {
+	case "text":
+		checkText(w, opts.palette(), report)
+		return nil
+	case "json":
+		return writeJSON(w, report.Violations)
+	case "junit":
+		return checkJUnit(w, report)
+	case "sarif":
+		return checkSARIF(w, report)
+	default:
+		return unknownFormat(opts.Format, "text, json, junit or sarif")
+	}
+}
+
+// violationMessage describes a violation in one line
+func violationMessage(v scanner.RuleViolation) string {
+	var msg string
+	if v.Kind == "allow" {
+		msg = fmt.Sprintf("%s imports %s, which rule %q does not allow", v.File, v.Target, v.Rule)
+	} else {
+		msg = fmt.Sprintf("%s imports %s, forbidden by rule %q", v.File, v.Target, v.Rule)
+	}
+	if v.Reason != "" {
+		msg += " (" + v.Reason + ")"
+	}
+	return msg
+}
+
+// location formats file:line for a violation
+func location(v scanner.RuleViolation) string {
+	if v.Line > 0 {
+		return fmt.Sprintf("%s:%d", v.File, v.Line)
+	}
+	return v.File
+}
+
+func checkText(w io.Writer, c palette, report CheckReport) {
+	ruleCount := len(report.Rules.Deny) + len(report.Rules.Allow)
+	if len(report.Violations) == 0 {
+		fmt.Fprintf(w, "%s✓ %d rules checked, no violations%s\n", c.green, ruleCount, c.reset)
+		return
+	}
+
+	for _, v := range report.Violations {
+		fmt.Fprintf(w, "%s%s%s: %s%s%s -> %s\n", c.bold, location(v), c.reset, c.red, v.Rule, c.reset, v.Target)
+		if v.Reason != "" {
+			fmt.Fprintf(w, "    %s%s%s\n", c.dim, v.Reason, c.reset)
+		}
+	}
+
+	noun := "violations"
+	if len(report.Violations) == 1 {
+		noun = "violation"
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%s✗ %d %s of %d rules%s\n", c.boldRed, len(report.Violations), noun, ruleCount, c.reset)
+}
+
+// JUnit XML structures
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// checkJUnit emits one test case per violation, plus a passing case per clean rule
+func checkJUnit(w io.Writer, report CheckReport) error {
+	suite := junitTestSuite{Name: "codemap-architecture"}
+
+	violated := make(map[string]bool)
+	for _, v := range report.Violations {
+		violated[v.Rule] = true
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      fmt.Sprintf("%s -> %s", location(v), v.Target),
+			ClassName: v.Rule,
+			Failure: &junitFailure{
+				Message: violationMessage(v),
+				Type:    v.Kind,
+				Text:    violationMessage(v),
+			},
+		})
+	}
+	for _, r := range append(append([]config.DepRule{}, report.Rules.Deny...), report.Rules.Allow...) {
+		if !violated[r.ID()] {
+			violated[r.ID()] = true
+			suite.Cases = append(suite.Cases, junitTestCase{Name: r.ID(), ClassName: r.ID()})
+		}
+	}
+	suite.Tests = len(suite.Cases)
+	suite.Failures = len(report.Violations)
+
+	out, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(w, xml.Header)
+	fmt.Fprintln(w, string(out))
+	return nil
+}
+
+// SARIF 2.1.0 structures (only the fields code scanners need)
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           *sarifRegion  `json:"region,omitempty"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+func checkSARIF(w io.Writer, report CheckReport) error {
+	driver := sarifDriver{
+		Name:           "codemap",
+		InformationURI: "https://github.com/JordanCoin/codemap",
+		Rules:          []sarifRule{},
+	}
+	for _, r := range report.Rules.Deny {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:               r.ID(),
+			ShortDescription: sarifMessage{Text: ruleDescription("must not import", r)},
+		})
+	}
+	for _, r := range report.Rules.Allow {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:               r.ID(),
+			ShortDescription: sarifMessage{Text: ruleDescription("may import", r)},
+		})
+	}
+
+	results := []sarifResult{}
+	for _, v := range report.Violations {
+		loc := sarifPhysicalLocation{ArtifactLocation: sarifArtifact{URI: filepath.ToSlash(v.File)}}
+		if v.Line > 0 {
+			loc.Region = &sarifRegion{StartLine: v.Line}
+		}
+		results = append(results, sarifResult{
+			RuleID:    v.Rule,
+			Level:     "error",
+			Message:   sarifMessage{Text: violationMessage(v)},
+			Locations: []sarifLocation{{PhysicalLocation: loc}},
+		})
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+// ruleDescription builds a short human description for a rule
+func ruleDescription(verb string, r config.DepRule) string {
+	desc := strings.TrimSpace(fmt.Sprintf("%s %s %s", r.From, verb, r.To))
+	if r.Reason != "" {
+		desc += ": " + r.Reason
+	}
+	return desc
+}
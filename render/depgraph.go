@@ -176,14 +176,23 @@ func getSystemName(dirPath string) string {
 }
 
 // Depgraph renders the dependency flow visualization
-func Depgraph(project scanner.DepsProject) {
+func Depgraph(project scanner.DepsProject, opts Options) error {
+	switch opts.format() {
+	case "text":
+	case "json":
+		return writeJSON(opts.writer(), project)
+	default:
+		return unknownFormat(opts.Format, "text or json")
+	}
+	w := opts.writer()
+
 	files := project.Files
 	externalDeps := project.ExternalDeps
 	projectName := filepath.Base(project.Root)
 
 	if len(files) == 0 {
-		fmt.Println("  No source files found.")
-		return
+		fmt.Fprintln(w, "  No source files found.")
+		return nil
 	}
 
 	// Build internal names lookup
@@ -216,7 +225,7 @@ func Depgraph(project scanner.DepsProject) {
 		systems[system] = append(systems[system], f)
 	}
 
-	fmt.Println()
+	fmt.Fprintln(w)
 
 	// Build external deps by language
 	extByLang := make(map[string][]string)
@@ -266,19 +275,23 @@ func Depgraph(project scanner.DepsProject) {
 		}
 	}
 
-	// Cap at 80
-	if maxWidth > 80 {
-		maxWidth = 80
+	// Cap at 80 unless a width was requested
+	limit := 80
+	if opts.Width > 0 {
+		limit = opts.Width
+	}
+	if maxWidth > limit {
+		maxWidth = limit
 	}
 	innerWidth := maxWidth - 2
 
 	// Print header box
-	fmt.Printf("╭%s╮\n", strings.Repeat("─", innerWidth))
+	fmt.Fprintf(w, "╭%s╮\n", strings.Repeat("─", innerWidth))
 	titlePadded := CenterString(title, innerWidth)
-	fmt.Printf("│%s│\n", titlePadded)
+	fmt.Fprintf(w, "│%s│\n", titlePadded)
 
 	if len(depLines) > 0 {
-		fmt.Printf("├%s┤\n", strings.Repeat("─", innerWidth))
+		fmt.Fprintf(w, "├%s┤\n", strings.Repeat("─", innerWidth))
 		contentWidth := innerWidth - 2
 
 		for _, line := range depLines {
@@ -289,15 +302,15 @@ func Depgraph(project scanner.DepsProject) {
 				} else {
 					breakAt++
 				}
-				fmt.Printf("│ %-*s │\n", contentWidth, line[:breakAt])
+				fmt.Fprintf(w, "│ %-*s │\n", contentWidth, line[:breakAt])
 				line = "    " + strings.TrimLeft(line[breakAt:], " ")
 			}
-			fmt.Printf("│ %-*s │\n", contentWidth, line)
+			fmt.Fprintf(w, "│ %-*s │\n", contentWidth, line)
 		}
 	}
 
-	fmt.Printf("╰%s╯\n", strings.Repeat("─", innerWidth))
-	fmt.Println()
+	fmt.Fprintf(w, "╰%s╯\n", strings.Repeat("─", innerWidth))
+	fmt.Fprintln(w)
 
 	// Sort systems
 	var systemNames []string
@@ -328,7 +341,7 @@ func Depgraph(project scanner.DepsProject) {
 		if headerLen < 1 {
 			headerLen = 1
 		}
-		fmt.Printf("%s %s\n", systemName, strings.Repeat("═", headerLen))
+		fmt.Fprintf(w, "%s %s\n", systemName, strings.Repeat("═", headerLen))
 
 		rendered := make(map[string]bool)
 
@@ -371,9 +384,9 @@ func Depgraph(project scanner.DepsProject) {
 					if len(subTargets) > 3 {
 						chain += fmt.Sprintf(" +%d", len(subTargets)-3)
 					}
-					fmt.Printf("  %s\n", chain)
+					fmt.Fprintf(w, "  %s\n", chain)
 				} else {
-					fmt.Printf("  %s ───▶ %s\n", nameNoExt, tName)
+					fmt.Fprintf(w, "  %s ───▶ %s\n", nameNoExt, tName)
 				}
 			} else {
 				var targetStrs []string
@@ -382,13 +395,13 @@ func Depgraph(project scanner.DepsProject) {
 				}
 
 				if len(targets) <= 4 {
-					fmt.Printf("  %s ───▶ %s\n", nameNoExt, strings.Join(targetStrs, ", "))
+					fmt.Fprintf(w, "  %s ───▶ %s\n", nameNoExt, strings.Join(targetStrs, ", "))
 				} else {
-					fmt.Printf("  %s ──┬──▶ %s\n", nameNoExt, targetStrs[0])
+					fmt.Fprintf(w, "  %s ──┬──▶ %s\n", nameNoExt, targetStrs[0])
 					for _, t := range targetStrs[1 : len(targetStrs)-1] {
-						fmt.Printf("  %s   ├──▶ %s\n", strings.Repeat(" ", len(nameNoExt)), t)
+						fmt.Fprintf(w, "  %s   ├──▶ %s\n", strings.Repeat(" ", len(nameNoExt)), t)
 					}
-					fmt.Printf("  %s   └──▶ %s\n", strings.Repeat(" ", len(nameNoExt)), targetStrs[len(targetStrs)-1])
+					fmt.Fprintf(w, "  %s   └──▶ %s\n", strings.Repeat(" ", len(nameNoExt)), targetStrs[len(targetStrs)-1])
 				}
 			}
 
@@ -405,10 +418,10 @@ func Depgraph(project scanner.DepsProject) {
 		}
 
 		if standaloneCount > 0 {
-			fmt.Printf("  +%d standalone files\n", standaloneCount)
+			fmt.Fprintf(w, "  +%d standalone files\n", standaloneCount)
 		}
 
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 
 	// HUBS section
@@ -431,12 +444,12 @@ func Depgraph(project scanner.DepsProject) {
 		}
 
 		if len(hubs) > 0 {
-			fmt.Println(strings.Repeat("─", 61))
+			fmt.Fprintln(w, strings.Repeat("─", 61))
 			var hubStrs []string
 			for _, h := range hubs {
 				hubStrs = append(hubStrs, fmt.Sprintf("%s (%d←)", extPattern.ReplaceAllString(h.name, ""), h.count))
 			}
-			fmt.Printf("HUBS: %s\n", strings.Join(hubStrs, ", "))
+			fmt.Fprintf(w, "HUBS: %s\n", strings.Join(hubStrs, ", "))
 		}
 	}
 
@@ -449,6 +462,7 @@ func Depgraph(project scanner.DepsProject) {
 	for _, targets := range internalDeps {
 		internalCount += len(targets)
 	}
-	fmt.Printf("%d files · %d functions · %d deps\n", len(files), totalFuncs, internalCount)
-	fmt.Println()
+	fmt.Fprintf(w, "%d files · %d functions · %d deps\n", len(files), totalFuncs, internalCount)
+	fmt.Fprintln(w)
+	return nil
 }
@@ -0,0 +1,596 @@
+package render
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"codemap/scanner"
+)
+
+// GraphOptions controls dependency graph export
+type GraphOptions struct {
+	Options            // Format: dot, mermaid, graphml, d2, cytoscape
+	Granularity string // file (default), dir, package
+	Cluster     bool   // group nodes by top-level directory
+	Focus       string // only keep nodes matching this path/glob and their direct neighbors
+	MaxNodes    int    // keep the N most connected nodes (0 = unlimited)
+}
+
+// GraphFormats lists the supported export formats
+var GraphFormats = []string{"dot", "mermaid", "graphml", "d2", "cytoscape"}
+
+// graphNode is a vertex in an exported graph (a file, directory or package)
+type graphNode struct {
+	ID        string `json:"id"`
+	Label     string `json:"label"`
+	Cluster   string `json:"cluster,omitempty"` // top-level directory when clustering
+	Files     int    `json:"files"`             // source files folded into this node
+	Importers int    `json:"importers"`         // distinct nodes importing this one
+	Imports   int    `json:"imports"`           // distinct nodes this one imports
+	Hub       bool   `json:"hub,omitempty"`
+	Focus     bool   `json:"focus,omitempty"`
+}
+
+// graphEdge is a directed import edge; Weight counts the file-level imports folded into it
+type graphEdge struct {
+	From   string `json:"source"`
+	To     string `json:"target"`
+	Weight int    `json:"weight"`
+}
+
+// exportGraph is a granularity-adjusted, filtered view of a FileGraph
+type exportGraph struct {
+	Name    string
+	Nodes   []graphNode
+	Edges   []graphEdge
+	Dropped int // nodes removed by --max-nodes
+}
+
+// ExportGraph writes the file graph in one of the GraphFormats
+func ExportGraph(fg *scanner.FileGraph, opts GraphOptions) error {
+	switch opts.Granularity {
+	case "", "file", "dir", "package":
+	default:
+		return fmt.Errorf("unknown granularity %q (use file, dir or package)", opts.Granularity)
+	}
+
+	g := buildExportGraph(fg, opts)
+	w := opts.writer()
+
+	switch opts.Format {
+	case "dot":
+		exportDOT(w, g, opts)
+	case "mermaid":
+		exportMermaid(w, g, opts)
+	case "graphml":
+		return exportGraphML(w, g)
+	case "d2":
+		exportD2(w, g, opts)
+	case "cytoscape":
+		return exportCytoscape(w, g, opts)
+	default:
+		return unknownFormat(opts.Format, strings.Join(GraphFormats, ", "))
+	}
+	return nil
+}
+
+// nodeKey maps a file to its node ID for the chosen granularity
+func nodeKey(fg *scanner.FileGraph, file, granularity string) string {
+	file = filepath.ToSlash(file)
+	dir := filepath.ToSlash(filepath.Dir(file))
+	switch granularity {
+	case "dir":
+		return dir
+	case "package":
+		if fg.Module != "" && strings.HasSuffix(file, ".go") {
+			if dir == "." {
+				return fg.Module
+			}
+			return fg.Module + "/" + dir
+		}
+		return dir
+	default:
+		return file
+	}
+}
+
+// topLevelDir returns the first path component of a file, or "" for root files
+func topLevelDir(file string) string {
+	file = filepath.ToSlash(file)
+	if i := strings.Index(file, "/"); i > 0 {
+		return file[:i]
+	}
+	return ""
+}
+
+// buildExportGraph folds the file graph into nodes/edges and applies focus and size limits
+func buildExportGraph(fg *scanner.FileGraph, opts GraphOptions) *exportGraph {
+	nodes := make(map[string]*graphNode)
+	edgeWeights := make(map[[2]string]int)
+	seenFiles := make(map[string]bool)
+
+	addFile := func(file string) string {
+		key := nodeKey(fg, file, opts.Granularity)
+		n, ok := nodes[key]
+		if !ok {
+			n = &graphNode{ID: key, Label: key}
+			if opts.Granularity == "" || opts.Granularity == "file" {
+				n.Label = filepath.Base(file)
+			}
+			if opts.Cluster {
+				n.Cluster = topLevelDir(file)
+			}
+			nodes[key] = n
+		}
+		if !seenFiles[file] {
+			seenFiles[file] = true
+			n.Files++
+			if opts.Focus != "" && scanner.MatchGlob(opts.Focus, file) {
+				n.Focus = true
+			}
+		}
+		return key
+	}
+
+	for file, targets := range fg.Imports {
+		from := addFile(file)
+		for _, target := range targets {
+			to := addFile(target)
+			if from != to {
+				edgeWeights[[2]string{from, to}]++
+			}
+		}
+	}
+	for file := range fg.Importers {
+		addFile(file)
+	}
+
+	// Degree and hub status at the chosen granularity
+	for e := range edgeWeights {
+		nodes[e[0]].Imports++
+		nodes[e[1]].Importers++
+	}
+	for _, n := range nodes {
+		n.Hub = n.Importers >= scanner.HubThreshold
+	}
+
+	// Focus: keep matching nodes plus their direct neighbors
+	keep := make(map[string]bool)
+	if opts.Focus != "" {
+		for key, n := range nodes {
+			if n.Focus {
+				keep[key] = true
+			}
+		}
+		for e := range edgeWeights {
+			if nodes[e[0]].Focus {
+				keep[e[1]] = true
+			}
+			if nodes[e[1]].Focus {
+				keep[e[0]] = true
+			}
+		}
+	} else {
+		for key := range nodes {
+			keep[key] = true
+		}
+	}
+
+	var list []*graphNode
+	for key := range keep {
+		list = append(list, nodes[key])
+	}
+
+	// Size limit: prefer focus nodes, then the most connected
+	g := &exportGraph{Name: filepath.Base(fg.Root)}
+	if opts.MaxNodes > 0 && len(list) > opts.MaxNodes {
+		sort.Slice(list, func(i, j int) bool {
+			a, b := list[i], list[j]
+			if a.Focus != b.Focus {
+				return a.Focus
+			}
+			da, db := a.Importers+a.Imports, b.Importers+b.Imports
+			if da != db {
+				return da > db
+			}
+			return a.ID < b.ID
+		})
+		g.Dropped = len(list) - opts.MaxNodes
+		list = list[:opts.MaxNodes]
+		keep = make(map[string]bool)
+		for _, n := range list {
+			keep[n.ID] = true
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	for _, n := range list {
+		g.Nodes = append(g.Nodes, *n)
+	}
+	for e, w := range edgeWeights {
+		if keep[e[0]] && keep[e[1]] {
+			g.Edges = append(g.Edges, graphEdge{From: e[0], To: e[1], Weight: w})
+		}
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+// clusters groups node indexes by cluster name (sorted, "" last)
+func (g *exportGraph) clusters() ([]string, map[string][]int) {
+	byCluster := make(map[string][]int)
+	for i, n := range g.Nodes {
+		byCluster[n.Cluster] = append(byCluster[n.Cluster], i)
+	}
+	var names []string
+	for name := range byCluster {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := byCluster[""]; ok {
+		names = append(names, "")
+	}
+	return names, byCluster
+}
+
+// nodeIDs assigns short stable identifiers (n0, n1, ...) for formats with strict ID syntax
+func (g *exportGraph) nodeIDs() map[string]string {
+	ids := make(map[string]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+	}
+	return ids
+}
+
+// quote escapes a string for DOT and D2 double-quoted identifiers
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func exportDOT(w io.Writer, g *exportGraph, opts GraphOptions) {
+	fmt.Fprintf(w, "digraph %s {\n", quote(g.Name))
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, `  node [shape=box, style="rounded", fontname="Helvetica"];`)
+	if g.Dropped > 0 {
+		fmt.Fprintf(w, "  // %d nodes omitted (--max-nodes)\n", g.Dropped)
+	}
+
+	writeNode := func(indent string, n graphNode) {
+		attrs := fmt.Sprintf("label=%s, tooltip=%s", quote(n.Label), quote(n.ID))
+		if n.Hub {
+			attrs += fmt.Sprintf(`, style="rounded,filled,bold", fillcolor="#ffcc80", xlabel=%s`, quote(fmt.Sprintf("%d←", n.Importers)))
+		}
+		if n.Focus {
+			attrs += `, penwidth=2, color="#1e88e5"`
+		}
+		fmt.Fprintf(w, "%s%s [%s];\n", indent, quote(n.ID), attrs)
+	}
+
+	if opts.Cluster {
+		names, byCluster := g.clusters()
+		for i, name := range names {
+			if name == "" {
+				for _, idx := range byCluster[name] {
+					writeNode("  ", g.Nodes[idx])
+				}
+				continue
+			}
+			fmt.Fprintf(w, "  subgraph cluster_%d {\n", i)
+			fmt.Fprintf(w, "    label=%s;\n", quote(name+"/"))
+			fmt.Fprintln(w, `    style="rounded,dashed"; color="#9e9e9e";`)
+			for _, idx := range byCluster[name] {
+				writeNode("    ", g.Nodes[idx])
+			}
+			fmt.Fprintln(w, "  }")
+		}
+	} else {
+		for _, n := range g.Nodes {
+			writeNode("  ", n)
+		}
+	}
+
+	for _, e := range g.Edges {
+		if e.Weight > 1 {
+			fmt.Fprintf(w, "  %s -> %s [penwidth=%d, label=\"%d\"];\n", quote(e.From), quote(e.To), min(e.Weight, 5), e.Weight)
+		} else {
+			fmt.Fprintf(w, "  %s -> %s;\n", quote(e.From), quote(e.To))
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// mermaidLabel escapes a label for a Mermaid ["..."] node
+func mermaidLabel(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
+
+func exportMermaid(w io.Writer, g *exportGraph, opts GraphOptions) {
+	ids := g.nodeIDs()
+	fmt.Fprintln(w, "graph LR")
+	if g.Dropped > 0 {
+		fmt.Fprintf(w, "  %%%% %d nodes omitted (--max-nodes)\n", g.Dropped)
+	}
+
+	writeNode := func(indent string, n graphNode) {
+		label := n.Label
+		if n.Hub {
+			label = fmt.Sprintf("%s (%d←)", label, n.Importers)
+		}
+		fmt.Fprintf(w, "%s%s[\"%s\"]\n", indent, ids[n.ID], mermaidLabel(label))
+	}
+
+	if opts.Cluster {
+		names, byCluster := g.clusters()
+		for i, name := range names {
+			if name == "" {
+				for _, idx := range byCluster[name] {
+					writeNode("  ", g.Nodes[idx])
+				}
+				continue
+			}
+			fmt.Fprintf(w, "  subgraph c%d[\"%s/\"]\n", i, mermaidLabel(name))
+			for _, idx := range byCluster[name] {
+				writeNode("    ", g.Nodes[idx])
+			}
+			fmt.Fprintln(w, "  end")
+		}
+	} else {
+		for _, n := range g.Nodes {
+			writeNode("  ", n)
+		}
+	}
+
+	for _, e := range g.Edges {
+		if e.Weight > 1 {
+			fmt.Fprintf(w, "  %s -->|%d| %s\n", ids[e.From], e.Weight, ids[e.To])
+		} else {
+			fmt.Fprintf(w, "  %s --> %s\n", ids[e.From], ids[e.To])
+		}
+	}
+
+	var hubs, focus []string
+	for _, n := range g.Nodes {
+		if n.Hub {
+			hubs = append(hubs, ids[n.ID])
+		}
+		if n.Focus {
+			focus = append(focus, ids[n.ID])
+		}
+	}
+	if len(hubs) > 0 {
+		fmt.Fprintln(w, "  classDef hub fill:#ffcc80,stroke:#e65100,stroke-width:2px")
+		fmt.Fprintf(w, "  class %s hub\n", strings.Join(hubs, ","))
+	}
+	if len(focus) > 0 {
+		fmt.Fprintln(w, "  classDef focus stroke:#1e88e5,stroke-width:3px")
+		fmt.Fprintf(w, "  class %s focus\n", strings.Join(focus, ","))
+	}
+}
+
+// GraphML structures
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func exportGraphML(w io.Writer, g *exportGraph) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+			{ID: "cluster", For: "node", AttrName: "cluster", AttrType: "string"},
+			{ID: "importers", For: "node", AttrName: "importers", AttrType: "int"},
+			{ID: "imports", For: "node", AttrName: "imports", AttrType: "int"},
+			{ID: "hub", For: "node", AttrName: "hub", AttrType: "boolean"},
+			{ID: "weight", For: "edge", AttrName: "weight", AttrType: "int"},
+		},
+		Graph: graphMLGraph{ID: g.Name, EdgeDefault: "directed"},
+	}
+	for _, n := range g.Nodes {
+		node := graphMLNode{ID: n.ID, Data: []graphMLData{
+			{Key: "label", Value: n.Label},
+			{Key: "importers", Value: fmt.Sprint(n.Importers)},
+			{Key: "imports", Value: fmt.Sprint(n.Imports)},
+			{Key: "hub", Value: fmt.Sprint(n.Hub)},
+		}}
+		if n.Cluster != "" {
+			node.Data = append(node.Data, graphMLData{Key: "cluster", Value: n.Cluster})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: e.From,
+			Target: e.To,
+			Data:   []graphMLData{{Key: "weight", Value: fmt.Sprint(e.Weight)}},
+		})
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(w, xml.Header)
+	fmt.Fprintln(w, string(out))
+	return nil
+}
+
+func exportD2(w io.Writer, g *exportGraph, opts GraphOptions) {
+	fmt.Fprintln(w, "direction: right")
+	if g.Dropped > 0 {
+		fmt.Fprintf(w, "# %d nodes omitted (--max-nodes)\n", g.Dropped)
+	}
+
+	// D2 addresses nested shapes as container.shape
+	ref := make(map[string]string, len(g.Nodes))
+	for _, n := range g.Nodes {
+		ref[n.ID] = quote(n.ID)
+		if opts.Cluster && n.Cluster != "" {
+			ref[n.ID] = quote(n.Cluster+"/") + "." + quote(n.ID)
+		}
+	}
+
+	writeNode := func(indent string, n graphNode) {
+		label := n.Label
+		if n.Hub {
+			label = fmt.Sprintf("%s (%d←)", label, n.Importers)
+		}
+		fmt.Fprintf(w, "%s%s: %s", indent, quote(n.ID), quote(label))
+		if n.Hub || n.Focus {
+			fmt.Fprintln(w, " {")
+			if n.Hub {
+				fmt.Fprintf(w, "%s  style.fill: \"#ffcc80\"\n", indent)
+				fmt.Fprintf(w, "%s  style.bold: true\n", indent)
+			}
+			if n.Focus {
+				fmt.Fprintf(w, "%s  style.stroke: \"#1e88e5\"\n", indent)
+				fmt.Fprintf(w, "%s  style.stroke-width: 3\n", indent)
+			}
+			fmt.Fprintf(w, "%s}\n", indent)
+		} else {
+			fmt.Fprintln(w)
+		}
+	}
+
+	if opts.Cluster {
+		names, byCluster := g.clusters()
+		for _, name := range names {
+			if name == "" {
+				for _, idx := range byCluster[name] {
+					writeNode("", g.Nodes[idx])
+				}
+				continue
+			}
+			fmt.Fprintf(w, "%s: {\n", quote(name+"/"))
+			for _, idx := range byCluster[name] {
+				writeNode("  ", g.Nodes[idx])
+			}
+			fmt.Fprintln(w, "}")
+		}
+	} else {
+		for _, n := range g.Nodes {
+			writeNode("", n)
+		}
+	}
+
+	for _, e := range g.Edges {
+		if e.Weight > 1 {
+			fmt.Fprintf(w, "%s -> %s: %d\n", ref[e.From], ref[e.To], e.Weight)
+		} else {
+			fmt.Fprintf(w, "%s -> %s\n", ref[e.From], ref[e.To])
+		}
+	}
+}
+
+// cytoscapeElement wraps node/edge data the way Cytoscape.js expects
+type cytoscapeElement struct {
+	Data    map[string]any `json:"data"`
+	Classes string         `json:"classes,omitempty"`
+}
+
+// cytoscapeElements converts the graph to Cytoscape.js elements, using compound
+// parent nodes for clusters
+func cytoscapeElements(g *exportGraph, opts GraphOptions) map[string][]cytoscapeElement {
+	var nodes, edges []cytoscapeElement
+
+	if opts.Cluster {
+		names, _ := g.clusters()
+		for _, name := range names {
+			if name != "" {
+				nodes = append(nodes, cytoscapeElement{
+					Data:    map[string]any{"id": "cluster:" + name, "label": name + "/"},
+					Classes: "cluster",
+				})
+			}
+		}
+	}
+
+	for _, n := range g.Nodes {
+		data := map[string]any{
+			"id":        n.ID,
+			"label":     n.Label,
+			"files":     n.Files,
+			"importers": n.Importers,
+			"imports":   n.Imports,
+			"hub":       n.Hub,
+		}
+		if opts.Cluster && n.Cluster != "" {
+			data["parent"] = "cluster:" + n.Cluster
+		}
+		var classes []string
+		if n.Hub {
+			classes = append(classes, "hub")
+		}
+		if n.Focus {
+			classes = append(classes, "focus")
+		}
+		nodes = append(nodes, cytoscapeElement{Data: data, Classes: strings.Join(classes, " ")})
+	}
+
+	for _, e := range g.Edges {
+		edges = append(edges, cytoscapeElement{Data: map[string]any{
+			"id":     e.From + "->" + e.To,
+			"source": e.From,
+			"target": e.To,
+			"weight": e.Weight,
+		}})
+	}
+
+	return map[string][]cytoscapeElement{"nodes": nodes, "edges": edges}
+}
+
+func exportCytoscape(w io.Writer, g *exportGraph, opts GraphOptions) error {
+	out := map[string]any{
+		"elements": cytoscapeElements(g, opts),
+	}
+	if g.Dropped > 0 {
+		out["omitted_nodes"] = g.Dropped
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
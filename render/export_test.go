@@ -0,0 +1,142 @@
+package render
+
+import (
+	"testing"
+
+	"codemap/scanner"
+)
+
+func testExportFileGraph() *scanner.FileGraph {
+	imports := map[string][]string{
+		"main.go":            {"scanner/types.go", "render/tree.go"},
+		"render/tree.go":     {"scanner/types.go"},
+		"render/depgraph.go": {"scanner/types.go"},
+		"mcp/main.go":        {"scanner/types.go", "render/tree.go"},
+		"scanner/walker.go":  {"scanner/types.go"},
+		"watch/daemon.go":    {"scanner/walker.go"},
+	}
+	importers := make(map[string][]string)
+	for from, targets := range imports {
+		for _, to := range targets {
+			importers[to] = append(importers[to], from)
+		}
+	}
+	return &scanner.FileGraph{
+		Root:      "/tmp/project",
+		Module:    "codemap",
+		Imports:   imports,
+		Importers: importers,
+	}
+}
+
+func findNode(g *exportGraph, id string) *graphNode {
+	for i := range g.Nodes {
+		if g.Nodes[i].ID == id {
+			return &g.Nodes[i]
+		}
+	}
+	return nil
+}
+
+func TestBuildExportGraphFile(t *testing.T) {
+	g := buildExportGraph(testExportFileGraph(), GraphOptions{})
+
+	if len(g.Nodes) != 7 {
+		t.Errorf("expected 7 file nodes, got %d", len(g.Nodes))
+	}
+	if len(g.Edges) != 8 {
+		t.Errorf("expected 8 edges, got %d", len(g.Edges))
+	}
+
+	types := findNode(g, "scanner/types.go")
+	if types == nil || !types.Hub || types.Importers != 5 {
+		t.Errorf("scanner/types.go should be a hub with 5 importers, got %+v", types)
+	}
+	if types.Label != "types.go" {
+		t.Errorf("file nodes should be labelled by basename, got %q", types.Label)
+	}
+	if tree := findNode(g, "render/tree.go"); tree == nil || tree.Hub {
+		t.Errorf("render/tree.go should not be a hub, got %+v", tree)
+	}
+
+	// Deterministic ordering
+	for i := 1; i < len(g.Nodes); i++ {
+		if g.Nodes[i-1].ID > g.Nodes[i].ID {
+			t.Errorf("nodes not sorted: %s > %s", g.Nodes[i-1].ID, g.Nodes[i].ID)
+		}
+	}
+}
+
+func TestBuildExportGraphDir(t *testing.T) {
+	g := buildExportGraph(testExportFileGraph(), GraphOptions{Granularity: "dir"})
+
+	// ".", render, scanner, mcp, watch
+	if len(g.Nodes) != 5 {
+		t.Fatalf("expected 5 dir nodes, got %d: %+v", len(g.Nodes), g.Nodes)
+	}
+	render := findNode(g, "render")
+	if render == nil || render.Files != 2 {
+		t.Errorf("render dir should fold 2 files, got %+v", render)
+	}
+	for _, e := range g.Edges {
+		if e.From == e.To {
+			t.Errorf("self edge should be dropped: %+v", e)
+		}
+		if e.From == "render" && e.To == "scanner" && e.Weight != 2 {
+			t.Errorf("render -> scanner should have weight 2, got %d", e.Weight)
+		}
+	}
+}
+
+func TestBuildExportGraphPackage(t *testing.T) {
+	g := buildExportGraph(testExportFileGraph(), GraphOptions{Granularity: "package"})
+	if findNode(g, "codemap/scanner") == nil || findNode(g, "codemap") == nil {
+		t.Errorf("expected Go package nodes, got %+v", g.Nodes)
+	}
+}
+
+func TestBuildExportGraphFocus(t *testing.T) {
+	g := buildExportGraph(testExportFileGraph(), GraphOptions{Focus: "watch"})
+
+	// watch/daemon.go plus its neighbor scanner/walker.go
+	if len(g.Nodes) != 2 {
+		t.Fatalf("expected focus node and neighbor, got %+v", g.Nodes)
+	}
+	if n := findNode(g, "watch/daemon.go"); n == nil || !n.Focus {
+		t.Errorf("watch/daemon.go should be marked as focus, got %+v", n)
+	}
+	if len(g.Edges) != 1 {
+		t.Errorf("expected 1 edge, got %+v", g.Edges)
+	}
+}
+
+func TestBuildExportGraphMaxNodes(t *testing.T) {
+	g := buildExportGraph(testExportFileGraph(), GraphOptions{MaxNodes: 3})
+
+	if len(g.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes, got %d", len(g.Nodes))
+	}
+	if g.Dropped != 4 {
+		t.Errorf("expected 4 dropped nodes, got %d", g.Dropped)
+	}
+	if findNode(g, "scanner/types.go") == nil {
+		t.Error("most connected node should be kept")
+	}
+	for _, e := range g.Edges {
+		if findNode(g, e.From) == nil || findNode(g, e.To) == nil {
+			t.Errorf("edge references dropped node: %+v", e)
+		}
+	}
+}
+
+func TestBuildExportGraphCluster(t *testing.T) {
+	g := buildExportGraph(testExportFileGraph(), GraphOptions{Cluster: true})
+
+	names, byCluster := g.clusters()
+	if names[len(names)-1] != "" {
+		t.Errorf("root cluster should sort last, got %v", names)
+	}
+	if len(byCluster["render"]) != 2 {
+		t.Errorf("render cluster should contain 2 nodes, got %d", len(byCluster["render"]))
+	}
+}
@@ -0,0 +1,108 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// Options controls where and how a renderer writes its output.
+// The zero value writes plain text to stdout, sized to the terminal.
+// Renderers keep no global state, so separate Options can be used concurrently.
+type Options struct {
+	Writer io.Writer // destination (default: os.Stdout)
+	Color  bool      // emit ANSI color codes
+	Width  int       // line width in columns (0 = terminal width, or 80)
+	Format string    // "text" (default), "json", or a renderer-specific format
+}
+
+// writer returns the destination, defaulting to stdout
+func (o Options) writer() io.Writer {
+	if o.Writer == nil {
+		return os.Stdout
+	}
+	return o.Writer
+}
+
+// width returns the configured width, falling back to the writer's terminal size
+func (o Options) width() int {
+	if o.Width > 0 {
+		return o.Width
+	}
+	if f, ok := o.writer().(*os.File); ok {
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+	return 80
+}
+
+// format returns the output format, defaulting to text
+func (o Options) format() string {
+	if o.Format == "" {
+		return "text"
+	}
+	return o.Format
+}
+
+// palette returns the escape codes to use, all empty when color is off
+func (o Options) palette() palette {
+	if !o.Color {
+		return palette{}
+	}
+	return palette{
+		enabled:   true,
+		reset:     Reset,
+		bold:      Bold,
+		dim:       Dim,
+		white:     White,
+		cyan:      Cyan,
+		yellow:    Yellow,
+		green:     Green,
+		red:       Red,
+		boldWhite: BoldWhite,
+		boldRed:   BoldRed,
+		boldBlue:  BoldBlue,
+		dimWhite:  DimWhite,
+	}
+}
+
+// palette holds the ANSI codes for one render call
+type palette struct {
+	enabled   bool
+	reset     string
+	bold      string
+	dim       string
+	white     string
+	cyan      string
+	yellow    string
+	green     string
+	red       string
+	boldWhite string
+	boldRed   string
+	boldBlue  string
+	dimWhite  string
+}
+
+// code passes through a dynamic color (file or building color) when color is on
+func (p palette) code(c string) string {
+	if !p.enabled {
+		return ""
+	}
+	return c
+}
+
+// writeJSON encodes v as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// unknownFormat is the error for an unsupported Options.Format
+func unknownFormat(format, supported string) error {
+	return fmt.Errorf("unknown format %q (use %s)", format, supported)
+}
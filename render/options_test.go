@@ -0,0 +1,136 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"codemap/scanner"
+)
+
+func testProject() scanner.Project {
+	return scanner.Project{
+		Root: "/tmp/project",
+		Files: []scanner.FileInfo{
+			{Path: "main.go", Size: 1200, Ext: ".go"},
+			{Path: "render/tree.go", Size: 800, Ext: ".go"},
+			{Path: "README.md", Size: 300, Ext: ".md"},
+		},
+	}
+}
+
+func TestOptionsDefaults(t *testing.T) {
+	var opts Options
+	if opts.format() != "text" {
+		t.Errorf("default format = %q, want text", opts.format())
+	}
+	if opts.palette().reset != "" {
+		t.Error("zero Options should not emit color codes")
+	}
+
+	opts.Writer = &bytes.Buffer{}
+	if opts.width() != 80 {
+		t.Errorf("non-terminal writer width = %d, want 80", opts.width())
+	}
+	opts.Width = 120
+	if opts.width() != 120 {
+		t.Errorf("explicit width = %d, want 120", opts.width())
+	}
+}
+
+func TestTreeWritesPlainText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Tree(testProject(), Options{Writer: &buf}); err != nil {
+		t.Fatalf("Tree failed: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "\033[") {
+		t.Error("plain output should not contain ANSI codes")
+	}
+	if !strings.Contains(out, "project") || !strings.Contains(out, "render/") {
+		t.Errorf("expected project name and directories in output, got:\n%s", out)
+	}
+}
+
+func TestTreeWritesColor(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Tree(testProject(), Options{Writer: &buf, Color: true}); err != nil {
+		t.Fatalf("Tree failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), BoldBlue) {
+		t.Error("colored output should contain ANSI codes")
+	}
+}
+
+func TestTreeJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Tree(testProject(), Options{Writer: &buf, Format: "json"}); err != nil {
+		t.Fatalf("Tree failed: %v", err)
+	}
+	var project scanner.Project
+	if err := json.Unmarshal(buf.Bytes(), &project); err != nil {
+		t.Fatalf("expected JSON output: %v", err)
+	}
+	if len(project.Files) != 3 {
+		t.Errorf("expected 3 files, got %d", len(project.Files))
+	}
+
+	// Indented by writeJSON, like the symbols and check JSON
+	if !strings.HasPrefix(buf.String(), "{\n  \"") {
+		t.Errorf("tree JSON should be indented, got %.40q", buf.String())
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	opts := Options{Writer: &bytes.Buffer{}, Format: "yaml"}
+	if err := Tree(testProject(), opts); err == nil {
+		t.Error("Tree should reject unknown format")
+	}
+	if err := Skyline(testProject(), opts); err == nil {
+		t.Error("Skyline should reject unknown format")
+	}
+	if err := Symbols(nil, SymbolOptions{Options: opts}); err == nil {
+		t.Error("Symbols should reject unknown format")
+	}
+	if err := Check(CheckReport{}, opts); err == nil {
+		t.Error("Check should reject unknown format")
+	}
+}
+
+func TestSkylineWidth(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Skyline(testProject(), Options{Writer: &buf, Width: 60}); err != nil {
+		t.Fatalf("Skyline failed: %v", err)
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if n := len([]rune(line)); n > 60 {
+			t.Fatalf("line exceeds width 60 (%d): %q", n, line)
+		}
+	}
+}
+
+func TestConcurrentRender(t *testing.T) {
+	// Renderers share no global state, so output must not interleave
+	var want bytes.Buffer
+	Tree(testProject(), Options{Writer: &want})
+
+	var wg sync.WaitGroup
+	outputs := make([]bytes.Buffer, 8)
+	for i := range outputs {
+		wg.Add(1)
+		go func(buf *bytes.Buffer) {
+			defer wg.Done()
+			Tree(testProject(), Options{Writer: buf})
+			Skyline(testProject(), Options{Writer: &bytes.Buffer{}})
+		}(&outputs[i])
+	}
+	wg.Wait()
+
+	for i := range outputs {
+		if outputs[i].String() != want.String() {
+			t.Fatalf("render %d produced different output", i)
+		}
+	}
+}
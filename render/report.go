@@ -0,0 +1,199 @@
+package render
+
+import (
+	"embed"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"codemap/scanner"
+)
+
+//go:embed report/*
+var reportAssets embed.FS
+
+// Report bundles everything the HTML report shows. Graph and Symbols are
+// optional: sections without data are hidden.
+type Report struct {
+	Project scanner.Project
+	Graph   *scanner.FileGraph
+	Symbols []scanner.SymbolAnalysis
+}
+
+// reportLanguage is one row of the language breakdown
+type reportLanguage struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// reportHub is a hub file with its dependents
+type reportHub struct {
+	Path      string   `json:"path"`
+	Importers []string `json:"importers"`
+}
+
+// reportSymbol is a compact symbol definition for the outline view
+type reportSymbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Line      int    `json:"line"`
+	Scope     string `json:"scope,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// reportData is serialized into the page as JSON and rendered client-side
+type reportData struct {
+	Name      string                    `json:"name"`
+	Root      string                    `json:"root"`
+	Generated string                    `json:"generated"`
+	DiffRef   string                    `json:"diff_ref,omitempty"`
+	Files     []scanner.FileInfo        `json:"files"`
+	TotalSize int64                     `json:"total_size"`
+	Languages []reportLanguage          `json:"languages"`
+	Impact    []scanner.ImpactInfo      `json:"impact,omitempty"`
+	Hubs      []reportHub               `json:"hubs,omitempty"`
+	Nodes     []graphNode               `json:"nodes,omitempty"`
+	Edges     []graphEdge               `json:"edges,omitempty"`
+	Omitted   int                       `json:"omitted,omitempty"`
+	Symbols   map[string][]reportSymbol `json:"symbols,omitempty"`
+}
+
+// reportMaxNodes keeps the in-browser force layout responsive
+const reportMaxNodes = 400
+
+// HTMLReport writes a single self-contained HTML file (inline CSS/JS, no network access needed)
+func HTMLReport(w io.Writer, report Report) error {
+	tmpl, err := template.ParseFS(reportAssets, "report/report.html")
+	if err != nil {
+		return err
+	}
+	css, err := reportAssets.ReadFile("report/report.css")
+	if err != nil {
+		return err
+	}
+	js, err := reportAssets.ReadFile("report/report.js")
+	if err != nil {
+		return err
+	}
+
+	data := buildReportData(report)
+	return tmpl.Execute(w, map[string]any{
+		"Title": data.Name + " · codemap",
+		"CSS":   template.CSS(css),
+		"JS":    template.JS(js),
+		"Data":  data,
+	})
+}
+
+// WriteHTMLReport renders the report into a file
+func WriteHTMLReport(path string, report Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := HTMLReport(f, report); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// buildReportData flattens the project, graph and symbols into the page model
+func buildReportData(report Report) reportData {
+	project := report.Project
+	data := reportData{
+		Name:      filepath.Base(project.Root),
+		Root:      project.Root,
+		Generated: time.Now().Format("2006-01-02 15:04"),
+		DiffRef:   project.DiffRef,
+		Files:     append([]scanner.FileInfo{}, project.Files...),
+		Impact:    project.Impact,
+	}
+	for i := range data.Files {
+		data.Files[i].Path = filepath.ToSlash(data.Files[i].Path)
+	}
+
+	// Language breakdown (unknown languages grouped by extension)
+	byLang := make(map[string]*reportLanguage)
+	for _, f := range project.Files {
+		data.TotalSize += f.Size
+		name := scanner.LangDisplay[scanner.DetectLanguage(f.Path)]
+		if name == "" {
+			if f.Ext == "" {
+				continue
+			}
+			name = f.Ext
+		}
+		lang, ok := byLang[name]
+		if !ok {
+			lang = &reportLanguage{Name: name}
+			byLang[name] = lang
+		}
+		lang.Files++
+		lang.Size += f.Size
+	}
+	for _, lang := range byLang {
+		data.Languages = append(data.Languages, *lang)
+	}
+	sort.Slice(data.Languages, func(i, j int) bool {
+		if data.Languages[i].Size != data.Languages[j].Size {
+			return data.Languages[i].Size > data.Languages[j].Size
+		}
+		return data.Languages[i].Name < data.Languages[j].Name
+	})
+
+	if fg := report.Graph; fg != nil {
+		hubs := fg.HubFiles()
+		sort.Slice(hubs, func(i, j int) bool {
+			if len(fg.Importers[hubs[i]]) != len(fg.Importers[hubs[j]]) {
+				return len(fg.Importers[hubs[i]]) > len(fg.Importers[hubs[j]])
+			}
+			return hubs[i] < hubs[j]
+		})
+		for _, hub := range hubs {
+			importers := append([]string(nil), fg.Importers[hub]...)
+			sort.Strings(importers)
+			data.Hubs = append(data.Hubs, reportHub{Path: filepath.ToSlash(hub), Importers: importers})
+		}
+
+		g := buildExportGraph(fg, GraphOptions{Cluster: true, MaxNodes: reportMaxNodes})
+		data.Nodes = g.Nodes
+		data.Edges = g.Edges
+		data.Omitted = g.Dropped
+	}
+
+	if len(report.Symbols) > 0 {
+		data.Symbols = make(map[string][]reportSymbol)
+		for _, a := range report.Symbols {
+			var outline []reportSymbol
+			for _, sym := range a.Symbols {
+				if sym.Role != scanner.RoleDefinition || sym.Kind == scanner.KindImport {
+					continue
+				}
+				scope := sym.Scope
+				if scope == "global" {
+					scope = ""
+				}
+				outline = append(outline, reportSymbol{
+					Name:      sym.Name,
+					Kind:      string(sym.Kind),
+					Line:      sym.Line + 1, // ast-grep lines are 0-indexed
+					Scope:     scope,
+					Signature: strings.TrimSpace(sym.Signature),
+				})
+			}
+			if len(outline) == 0 {
+				continue
+			}
+			sort.SliceStable(outline, func(i, j int) bool { return outline[i].Line < outline[j].Line })
+			data.Symbols[filepath.ToSlash(a.Path)] = outline
+		}
+	}
+
+	return data
+}
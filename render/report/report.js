@@ -0,0 +1,410 @@
+// codemap HTML report - renders the embedded JSON model, no external dependencies
+(function () {
+  "use strict";
+
+  var data = JSON.parse(document.getElementById("codemap-data").textContent);
+
+  // el creates a DOM element with optional class and text (text is never parsed as HTML)
+  function el(tag, cls, text) {
+    var e = document.createElement(tag);
+    if (cls) e.className = cls;
+    if (text !== undefined) e.textContent = text;
+    return e;
+  }
+
+  function formatSize(size) {
+    var units = ["B", "KB", "MB", "GB", "TB"];
+    var i = 0;
+    while (size >= 1024 && i < units.length - 1) { size /= 1024; i++; }
+    return size.toFixed(1) + units[i];
+  }
+
+  var hubSet = {};
+  (data.hubs || []).forEach(function (h) { hubSet[h.path] = h; });
+  var fileByPath = {};
+  data.files.forEach(function (f) { fileByPath[f.path] = f; });
+
+  // === Header and tabs ===
+  document.getElementById("title").textContent = data.name;
+  document.getElementById("subtitle").textContent = data.root + " · generated " + data.generated +
+    (data.diff_ref ? " · changes vs " + data.diff_ref : "");
+
+  var buttons = document.querySelectorAll("#tabs button");
+  var tabRenderers = {};
+  var rendered = {};
+  function showTab(name) {
+    buttons.forEach(function (b) { b.classList.toggle("active", b.dataset.tab === name); });
+    document.querySelectorAll(".tab").forEach(function (t) { t.classList.toggle("active", t.id === name); });
+    if (!rendered[name] && tabRenderers[name]) {
+      rendered[name] = true;
+      tabRenderers[name]();
+    }
+  }
+  buttons.forEach(function (b) { b.addEventListener("click", function () { showTab(b.dataset.tab); }); });
+  if (!data.nodes || data.nodes.length === 0) document.querySelector('[data-tab="graph"]').hidden = true;
+  if (!data.hubs || data.hubs.length === 0) document.querySelector('[data-tab="hubs"]').hidden = true;
+  if (!data.symbols) document.querySelector('[data-tab="symbols"]').hidden = true;
+
+  // === Overview ===
+  tabRenderers.overview = function () {
+    var stats = document.getElementById("stats");
+    function card(label, value) {
+      var c = el("div", "card");
+      c.appendChild(el("div", "value", String(value)));
+      c.appendChild(el("div", "muted", label));
+      stats.appendChild(c);
+    }
+    card(data.diff_ref ? "changed files" : "files", data.files.length);
+    card("total size", formatSize(data.total_size));
+    card("languages", (data.languages || []).length);
+    if (data.hubs) card("hub files", data.hubs.length);
+    if (data.edges) card("internal imports", data.edges.length);
+    if (data.diff_ref) {
+      var added = 0, removed = 0;
+      data.files.forEach(function (f) { added += f.added || 0; removed += f.removed || 0; });
+      card("lines vs " + data.diff_ref, "+" + added + " −" + removed);
+    }
+
+    var langs = document.getElementById("languages");
+    var total = data.total_size || 1;
+    (data.languages || []).forEach(function (l) {
+      var row = el("div", "lang-row");
+      row.appendChild(el("span", null, l.name));
+      var bar = el("div", "bar");
+      var fill = el("span");
+      fill.style.width = Math.max(0.5, (100 * l.size) / total).toFixed(1) + "%";
+      bar.appendChild(fill);
+      row.appendChild(bar);
+      row.appendChild(el("span", "muted", l.files + " files · " + formatSize(l.size)));
+      langs.appendChild(row);
+    });
+
+    if (data.impact && data.impact.length) {
+      document.getElementById("impact-section").hidden = false;
+      var list = document.getElementById("impact");
+      data.impact.forEach(function (imp) {
+        list.appendChild(el("li", null, "⚠ " + imp.File + " is used by " + imp.UsedBy + " other " + (imp.UsedBy === 1 ? "file" : "files")));
+      });
+    }
+  };
+
+  // === Tree ===
+  function buildTree(files) {
+    var root = { dirs: {}, files: [] };
+    files.forEach(function (f) {
+      var parts = f.path.split("/");
+      var node = root;
+      for (var i = 0; i < parts.length - 1; i++) {
+        node = node.dirs[parts[i]] || (node.dirs[parts[i]] = { dirs: {}, files: [] });
+      }
+      node.files.push(f);
+    });
+    return root;
+  }
+
+  function dirStats(node) {
+    var count = node.files.length, size = 0;
+    node.files.forEach(function (f) { size += f.size; });
+    Object.keys(node.dirs).forEach(function (d) {
+      var s = dirStats(node.dirs[d]);
+      count += s.count; size += s.size;
+    });
+    return { count: count, size: size };
+  }
+
+  function renderTreeNode(node, container, depth, expandAll) {
+    Object.keys(node.dirs).sort().forEach(function (name) {
+      var child = node.dirs[name];
+      // Flatten single-child directory chains like the terminal tree
+      var label = name;
+      while (Object.keys(child.dirs).length === 1 && child.files.length === 0) {
+        var only = Object.keys(child.dirs)[0];
+        label += "/" + only;
+        child = child.dirs[only];
+      }
+      var details = el("details");
+      details.open = expandAll || depth < 1;
+      var summary = el("summary");
+      var s = dirStats(child);
+      summary.appendChild(el("span", "dir", label + "/"));
+      summary.appendChild(el("span", "size", " (" + s.count + " files, " + formatSize(s.size) + ")"));
+      details.appendChild(summary);
+      renderTreeNode(child, details, depth + 1, expandAll);
+      container.appendChild(details);
+    });
+    node.files.slice().sort(function (a, b) { return a.path < b.path ? -1 : 1; }).forEach(function (f) {
+      var name = f.path.split("/").pop();
+      var row = el("div", "file");
+      var label = el("span", null, name);
+      if (f.is_new) { label.className = "new"; label.textContent = "(new) " + name; }
+      else if (f.added || f.removed) { label.className = "changed"; label.textContent = "✎ " + name; }
+      if (hubSet[f.path]) label.classList.add("hub");
+      row.appendChild(label);
+      var stats = " " + formatSize(f.size);
+      if (f.added || f.removed) stats += "  +" + (f.added || 0) + (f.removed ? " −" + f.removed : "");
+      row.appendChild(el("span", "stats", stats));
+      container.appendChild(row);
+    });
+  }
+
+  tabRenderers.tree = function () {
+    var view = document.getElementById("tree-view");
+    function draw(filter) {
+      view.textContent = "";
+      var files = filter ? data.files.filter(function (f) { return f.path.toLowerCase().indexOf(filter) >= 0; }) : data.files;
+      renderTreeNode(buildTree(files), view, 0, !!filter);
+    }
+    draw("");
+    document.getElementById("tree-filter").addEventListener("input", function (e) { draw(e.target.value.toLowerCase()); });
+  };
+
+  // === Graph (force-directed layout in SVG) ===
+  tabRenderers.graph = function () {
+    var svgNS = "http://www.w3.org/2000/svg";
+    var svg = document.getElementById("graph-view");
+    var info = document.getElementById("graph-info");
+    var nodes = data.nodes.map(function (n) { return Object.assign({}, n); });
+    var index = {};
+    nodes.forEach(function (n, i) { index[n.id] = i; });
+    var edges = data.edges.filter(function (e) { return e.source in index && e.target in index; });
+    var changed = {};
+    if (data.diff_ref) data.files.forEach(function (f) { changed[f.path] = true; });
+
+    if (data.omitted) {
+      document.getElementById("graph-note").textContent = data.omitted + " less connected nodes omitted";
+    }
+
+    // Seed positions on a circle per cluster so clusters start grouped
+    var clusters = {};
+    nodes.forEach(function (n) { (clusters[n.cluster || ""] = clusters[n.cluster || ""] || []).push(n); });
+    var clusterNames = Object.keys(clusters);
+    clusterNames.forEach(function (c, ci) {
+      var angle = (2 * Math.PI * ci) / clusterNames.length;
+      var cx = Math.cos(angle) * 300, cy = Math.sin(angle) * 300;
+      clusters[c].forEach(function (n, i) {
+        var a = (2 * Math.PI * i) / clusters[c].length;
+        n.x = cx + Math.cos(a) * 60; n.y = cy + Math.sin(a) * 60;
+        n.vx = 0; n.vy = 0;
+      });
+    });
+
+    // Fruchterman-Reingold style iterations, computed once up front
+    var k = 60;
+    for (var iter = 0; iter < 300; iter++) {
+      var temp = 20 * (1 - iter / 300) + 0.5;
+      nodes.forEach(function (n) { n.dx = 0; n.dy = 0; });
+      for (var i = 0; i < nodes.length; i++) {
+        for (var j = i + 1; j < nodes.length; j++) {
+          var a = nodes[i], b = nodes[j];
+          var dx = a.x - b.x, dy = a.y - b.y;
+          var d2 = dx * dx + dy * dy + 0.01;
+          var f = (k * k) / d2;
+          a.dx += dx * f; a.dy += dy * f;
+          b.dx -= dx * f; b.dy -= dy * f;
+        }
+      }
+      edges.forEach(function (e) {
+        var a = nodes[index[e.source]], b = nodes[index[e.target]];
+        var dx = a.x - b.x, dy = a.y - b.y;
+        var d = Math.sqrt(dx * dx + dy * dy) + 0.01;
+        var f = d / k;
+        a.dx -= dx * f / d * d / 10; a.dy -= dy * f / d * d / 10;
+        b.dx += dx * f / d * d / 10; b.dy += dy * f / d * d / 10;
+      });
+      nodes.forEach(function (n) {
+        // Gentle pull towards the center keeps disconnected parts on screen
+        n.dx -= n.x * 0.01; n.dy -= n.y * 0.01;
+        var len = Math.sqrt(n.dx * n.dx + n.dy * n.dy) + 0.01;
+        n.x += (n.dx / len) * Math.min(len, temp);
+        n.y += (n.dy / len) * Math.min(len, temp);
+      });
+    }
+
+    var viewport = document.createElementNS(svgNS, "g");
+    svg.appendChild(viewport);
+    var edgeLayer = document.createElementNS(svgNS, "g");
+    var nodeLayer = document.createElementNS(svgNS, "g");
+    viewport.appendChild(edgeLayer);
+    viewport.appendChild(nodeLayer);
+
+    var edgeEls = edges.map(function (e) {
+      var a = nodes[index[e.source]], b = nodes[index[e.target]];
+      var line = document.createElementNS(svgNS, "line");
+      line.setAttribute("class", "edge");
+      line.setAttribute("x1", a.x); line.setAttribute("y1", a.y);
+      line.setAttribute("x2", b.x); line.setAttribute("y2", b.y);
+      line.setAttribute("stroke-width", Math.min(1 + Math.log2(e.weight), 4));
+      edgeLayer.appendChild(line);
+      return line;
+    });
+
+    var nodeEls = nodes.map(function (n) {
+      var g = document.createElementNS(svgNS, "g");
+      var cls = "node" + (n.hub ? " hub" : "") + (changed[n.id] ? " changed" : "");
+      g.setAttribute("class", cls);
+      g.setAttribute("transform", "translate(" + n.x + "," + n.y + ")");
+      var c = document.createElementNS(svgNS, "circle");
+      c.setAttribute("r", 4 + Math.min(n.importers, 12));
+      g.appendChild(c);
+      var t = document.createElementNS(svgNS, "text");
+      t.setAttribute("x", 8 + Math.min(n.importers, 12));
+      t.setAttribute("y", 3);
+      t.textContent = n.label;
+      g.appendChild(t);
+      var title = document.createElementNS(svgNS, "title");
+      title.textContent = n.id + " (" + n.importers + " importers, " + n.imports + " imports)";
+      g.appendChild(title);
+      g.addEventListener("click", function (ev) { ev.stopPropagation(); select(n); });
+      nodeLayer.appendChild(g);
+      return g;
+    });
+
+    function select(n) {
+      var related = {};
+      related[n.id] = true;
+      var imports = [], importers = [];
+      edges.forEach(function (e, i) {
+        var active = e.source === n.id || e.target === n.id;
+        edgeEls[i].classList.toggle("active", active);
+        if (e.source === n.id) { imports.push(e.target); related[e.target] = true; }
+        if (e.target === n.id) { importers.push(e.source); related[e.source] = true; }
+      });
+      nodes.forEach(function (m, i) {
+        nodeEls[i].classList.toggle("dim", !related[m.id]);
+        nodeEls[i].classList.toggle("selected", m.id === n.id);
+      });
+
+      info.textContent = "";
+      info.classList.remove("muted");
+      info.appendChild(el("h2", null, n.id));
+      if (n.hub) info.appendChild(el("p", null, "⚠ Hub file: " + n.importers + " dependents"));
+      [["Imports", imports], ["Imported by", importers]].forEach(function (section) {
+        info.appendChild(el("strong", null, section[0] + " (" + section[1].length + ")"));
+        var ul = el("ul");
+        section[1].sort().forEach(function (p) { ul.appendChild(el("li", "mono", p)); });
+        info.appendChild(ul);
+      });
+    }
+
+    function clearSelection() {
+      edgeEls.forEach(function (e) { e.classList.remove("active"); });
+      nodeEls.forEach(function (e) { e.classList.remove("dim", "selected"); });
+    }
+
+    // Pan and zoom
+    var view = { x: 0, y: 0, scale: 1 };
+    function apply() {
+      viewport.setAttribute("transform", "translate(" + view.x + "," + view.y + ") scale(" + view.scale + ")");
+    }
+    function fit() {
+      var rect = svg.getBoundingClientRect();
+      var minX = Infinity, minY = Infinity, maxX = -Infinity, maxY = -Infinity;
+      nodes.forEach(function (n) {
+        minX = Math.min(minX, n.x); minY = Math.min(minY, n.y);
+        maxX = Math.max(maxX, n.x); maxY = Math.max(maxY, n.y);
+      });
+      var w = Math.max(maxX - minX, 1) + 160, h = Math.max(maxY - minY, 1) + 80;
+      view.scale = Math.min(rect.width / w, rect.height / h, 2);
+      view.x = rect.width / 2 - ((minX + maxX) / 2) * view.scale;
+      view.y = rect.height / 2 - ((minY + maxY) / 2) * view.scale;
+      apply();
+    }
+    svg.addEventListener("wheel", function (ev) {
+      ev.preventDefault();
+      var rect = svg.getBoundingClientRect();
+      var mx = ev.clientX - rect.left, my = ev.clientY - rect.top;
+      var factor = ev.deltaY < 0 ? 1.15 : 1 / 1.15;
+      view.x = mx - (mx - view.x) * factor;
+      view.y = my - (my - view.y) * factor;
+      view.scale *= factor;
+      apply();
+    }, { passive: false });
+    var drag = null;
+    svg.addEventListener("mousedown", function (ev) {
+      drag = { x: ev.clientX, y: ev.clientY, vx: view.x, vy: view.y, moved: false };
+      svg.classList.add("dragging");
+    });
+    window.addEventListener("mousemove", function (ev) {
+      if (!drag) return;
+      if (Math.abs(ev.clientX - drag.x) + Math.abs(ev.clientY - drag.y) > 3) drag.moved = true;
+      view.x = drag.vx + ev.clientX - drag.x;
+      view.y = drag.vy + ev.clientY - drag.y;
+      apply();
+    });
+    window.addEventListener("mouseup", function () {
+      svg.classList.remove("dragging");
+      drag = null;
+    });
+    svg.addEventListener("click", function () { clearSelection(); });
+    document.getElementById("graph-reset").addEventListener("click", function () { clearSelection(); fit(); });
+    document.getElementById("graph-filter").addEventListener("input", function (e) {
+      var q = e.target.value.toLowerCase();
+      nodes.forEach(function (n, i) { nodeEls[i].classList.toggle("dim", q !== "" && n.id.toLowerCase().indexOf(q) < 0); });
+    });
+    fit();
+  };
+
+  // === Hubs ===
+  tabRenderers.hubs = function () {
+    var list = document.getElementById("hub-list");
+    (data.hubs || []).forEach(function (h) {
+      var item = el("details", "hub-item");
+      var summary = el("summary");
+      summary.appendChild(el("span", "mono", h.path));
+      summary.appendChild(el("span", "muted", "  " + h.importers.length + " importers"));
+      item.appendChild(summary);
+      var ul = el("ul");
+      h.importers.forEach(function (p) { ul.appendChild(el("li", "mono", p)); });
+      item.appendChild(ul);
+      list.appendChild(item);
+    });
+  };
+
+  // === Symbols ===
+  tabRenderers.symbols = function () {
+    var fileList = document.getElementById("symbol-files");
+    var outline = document.getElementById("symbol-outline");
+    var paths = Object.keys(data.symbols || {}).sort();
+    var selected = null;
+
+    function showOutline(path, li) {
+      if (selected) selected.classList.remove("selected");
+      selected = li;
+      li.classList.add("selected");
+      outline.textContent = "";
+      outline.classList.remove("muted");
+      outline.appendChild(el("h2", null, path));
+      var table = el("table");
+      data.symbols[path].forEach(function (s) {
+        var tr = el("tr");
+        tr.appendChild(el("td", "line", String(s.line)));
+        tr.appendChild(el("td", "kind", s.kind));
+        var name = el("td");
+        name.appendChild(el("span", null, s.name + (s.signature ? s.signature : "")));
+        if (s.scope) name.appendChild(el("span", "scope", "  " + s.scope));
+        tr.appendChild(name);
+        table.appendChild(tr);
+      });
+      outline.appendChild(table);
+    }
+
+    function draw(filter) {
+      fileList.textContent = "";
+      paths.forEach(function (p) {
+        var syms = data.symbols[p];
+        if (filter && p.toLowerCase().indexOf(filter) < 0 &&
+            !syms.some(function (s) { return s.name.toLowerCase().indexOf(filter) >= 0; })) {
+          return;
+        }
+        var li = el("li", null, p);
+        li.appendChild(el("span", "muted", " (" + syms.length + ")"));
+        li.addEventListener("click", function () { showOutline(p, li); });
+        fileList.appendChild(li);
+      });
+    }
+    draw("");
+    document.getElementById("symbol-filter").addEventListener("input", function (e) { draw(e.target.value.toLowerCase()); });
+  };
+
+  showTab("overview");
+})();
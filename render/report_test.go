@@ -0,0 +1,101 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"codemap/scanner"
+)
+
+func testReport() Report {
+	return Report{
+		Project: scanner.Project{
+			Root: "/tmp/project",
+			Files: []scanner.FileInfo{
+				{Path: "main.go", Size: 1200, Ext: ".go"},
+				{Path: "scanner/types.go", Size: 800, Ext: ".go"},
+				{Path: "web/app.ts", Size: 400, Ext: ".ts"},
+			},
+		},
+		Graph: testExportFileGraph(),
+		Symbols: []scanner.SymbolAnalysis{{
+			Path: "main.go",
+			Symbols: []scanner.Symbol{
+				{Name: "fmt", Kind: scanner.KindImport, Role: scanner.RoleDefinition, Line: 2},
+				{Name: "run", Kind: scanner.KindFunction, Role: scanner.RoleDefinition, Line: 20},
+				{Name: "main", Kind: scanner.KindFunction, Role: scanner.RoleDefinition, Line: 9},
+			},
+		}},
+	}
+}
+
+func TestBuildReportData(t *testing.T) {
+	data := buildReportData(testReport())
+
+	if data.Name != "project" {
+		t.Errorf("expected name from root basename, got %q", data.Name)
+	}
+	if data.TotalSize != 2400 {
+		t.Errorf("expected total size 2400, got %d", data.TotalSize)
+	}
+	if len(data.Languages) != 2 || data.Languages[0].Files != 2 {
+		t.Errorf("expected Go first with 2 files, got %+v", data.Languages)
+	}
+	if len(data.Hubs) != 1 || data.Hubs[0].Path != "scanner/types.go" || len(data.Hubs[0].Importers) != 5 {
+		t.Errorf("expected scanner/types.go hub with 5 importers, got %+v", data.Hubs)
+	}
+	if len(data.Nodes) == 0 || len(data.Edges) == 0 {
+		t.Error("expected graph nodes and edges")
+	}
+
+	outline := data.Symbols["main.go"]
+	if len(outline) != 2 {
+		t.Fatalf("expected imports to be excluded from outline, got %+v", outline)
+	}
+	if outline[0].Name != "main" || outline[0].Line != 10 {
+		t.Errorf("expected outline sorted by 1-based line, got %+v", outline)
+	}
+}
+
+func TestBuildReportDataWithoutGraph(t *testing.T) {
+	report := testReport()
+	report.Graph = nil
+	report.Symbols = nil
+	data := buildReportData(report)
+
+	if data.Hubs != nil || data.Nodes != nil || data.Symbols != nil {
+		t.Errorf("expected graph and symbol sections to be empty, got %+v", data)
+	}
+}
+
+func TestHTMLReportSelfContained(t *testing.T) {
+	var buf bytes.Buffer
+	if err := HTMLReport(&buf, testReport()); err != nil {
+		t.Fatalf("HTMLReport failed: %v", err)
+	}
+	out := buf.String()
+
+	if !strings.HasPrefix(out, "<!DOCTYPE html>") {
+		t.Error("expected an HTML document")
+	}
+	external := regexp.MustCompile(`<(script|link)[^>]+(src|href)=`)
+	if external.MatchString(out) {
+		t.Error("report should not reference external scripts or stylesheets")
+	}
+
+	// The embedded data block must be valid JSON
+	m := regexp.MustCompile(`(?s)<script type="application/json" id="codemap-data">(.*?)</script>`).FindStringSubmatch(out)
+	if m == nil {
+		t.Fatal("embedded data block not found")
+	}
+	var data reportData
+	if err := json.Unmarshal([]byte(m[1]), &data); err != nil {
+		t.Fatalf("embedded data is not valid JSON: %v", err)
+	}
+	if len(data.Files) != 3 {
+		t.Errorf("expected 3 files in embedded data, got %d", len(data.Files))
+	}
+}
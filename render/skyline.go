@@ -2,9 +2,9 @@ package render
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"math/rand/v2"
-	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -13,12 +13,8 @@ import (
 	"codemap/scanner"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"golang.org/x/term"
 )
 
-// rng is a reproducible random generator for consistent skyline layouts
-var rng = rand.New(rand.NewPCG(42, 0))
-
 // Code extensions for skyline (what counts as "source code")
 var codeExtensions = map[string]bool{
 	".py": true, ".js": true, ".ts": true, ".jsx": true, ".tsx": true, ".go": true, ".rs": true, ".rb": true, ".java": true,
@@ -134,7 +130,7 @@ func getBuildingChar(ext string) rune {
 }
 
 // createBuildings creates building data from aggregated files
-func createBuildings(sorted []extAgg, width int) []building {
+func createBuildings(sorted []extAgg, width int, rng *rand.Rand) []building {
 	if len(sorted) == 0 {
 		return nil
 	}
@@ -206,23 +202,28 @@ func createBuildings(sorted []extAgg, width int) []building {
 	return arranged
 }
 
-// Skyline renders the city skyline visualization
-func Skyline(project scanner.Project, animate bool) {
+// Skyline renders the city skyline visualization, animated if project.Animate is set
+func Skyline(project scanner.Project, opts Options) error {
+	if f := opts.format(); f != "text" {
+		return unknownFormat(f, "text")
+	}
+	w := opts.writer()
+	c := opts.palette()
+	width := opts.width()
+
+	// A fixed seed keeps skyline layouts reproducible between runs
+	rng := rand.New(rand.NewPCG(42, 0))
+
 	files := project.Files
 	projectName := filepath.Base(project.Root)
 
-	width, _, err := term.GetSize(int(os.Stdout.Fd()))
-	if err != nil || width <= 0 {
-		width = 80
-	}
-
 	codeFiles := filterCodeFiles(files)
 	sorted := aggregateByExtension(codeFiles)
-	arranged := createBuildings(sorted, width)
+	arranged := createBuildings(sorted, width, rng)
 
 	if len(arranged) == 0 {
-		fmt.Println(Dim + "No source files to display" + Reset)
-		return
+		fmt.Fprintln(w, c.dim+"No source files to display"+c.reset)
+		return nil
 	}
 
 	// Calculate layout
@@ -236,16 +237,49 @@ func Skyline(project scanner.Project, animate bool) {
 	sceneRight := min(width, leftMargin+totalWidth+scenePadding)
 	sceneWidth := sceneRight - sceneLeft
 
-	if animate {
-		renderAnimated(arranged, width, leftMargin, sceneLeft, sceneRight, sceneWidth, codeFiles, projectName, sorted)
-	} else {
-		renderStatic(arranged, width, leftMargin, sceneLeft, sceneRight, sceneWidth, codeFiles, projectName, sorted)
-	}
+	scene := skylineScene{
+		w:           w,
+		c:           c,
+		rng:         rng,
+		arranged:    arranged,
+		width:       width,
+		leftMargin:  leftMargin,
+		sceneLeft:   sceneLeft,
+		sceneRight:  sceneRight,
+		sceneWidth:  sceneWidth,
+		codeFiles:   codeFiles,
+		projectName: projectName,
+		sorted:      sorted,
+	}
+	if project.Animate {
+		return scene.renderAnimated()
+	}
+	scene.renderStatic()
+	return nil
+}
+
+// skylineScene is the computed layout plus output settings for one render
+type skylineScene struct {
+	w           io.Writer
+	c           palette
+	rng         *rand.Rand
+	arranged    []building
+	width       int
+	leftMargin  int
+	sceneLeft   int
+	sceneRight  int
+	sceneWidth  int
+	codeFiles   []scanner.FileInfo
+	projectName string
+	sorted      []extAgg
 }
 
 // renderStatic renders static skyline
-func renderStatic(arranged []building, width, leftMargin, sceneLeft, sceneRight, sceneWidth int,
-	codeFiles []scanner.FileInfo, projectName string, sorted []extAgg) {
+func (s *skylineScene) renderStatic() {
+	w, pal, rng := s.w, s.c, s.rng
+	arranged, width, leftMargin := s.arranged, s.width, s.leftMargin
+	sceneLeft, sceneRight, sceneWidth := s.sceneLeft, s.sceneRight, s.sceneWidth
+
 	// Build grid
 	grid := make([][]rune, skyHeight+maxHeight+1)
 	for i := range grid {
@@ -310,7 +344,7 @@ func renderStatic(arranged []building, width, leftMargin, sceneLeft, sceneRight,
 		col += buildingWidth + b.gap
 	}
 
-	fmt.Println()
+	fmt.Fprintln(w)
 
 	// Print with colors
 	colPositions := make([][3]interface{}, 0) // start, end, color
@@ -326,14 +360,14 @@ func renderStatic(arranged []building, width, leftMargin, sceneLeft, sceneRight,
 			ch := grid[row][c]
 			switch ch {
 			case '◐':
-				fmt.Print(Bold + Yellow + string(ch) + Reset)
+				fmt.Fprint(w, pal.bold+pal.yellow+string(ch)+pal.reset)
 			case '·', '✦', '*':
-				fmt.Print(DimWhite + string(ch) + Reset)
+				fmt.Fprint(w, pal.dimWhite+string(ch)+pal.reset)
 			default:
-				fmt.Print(" ")
+				fmt.Fprint(w, " ")
 			}
 		}
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 
 	// Building rows
@@ -341,54 +375,56 @@ func renderStatic(arranged []building, width, leftMargin, sceneLeft, sceneRight,
 		for c := 0; c < width; c++ {
 			ch := grid[row][c]
 			if ch == ' ' {
-				fmt.Print(" ")
+				fmt.Fprint(w, " ")
 			} else if ch == '▄' {
-				color := White
+				color := pal.white
 				for _, pos := range colPositions {
 					if c >= pos[0].(int) && c < pos[1].(int) {
-						color = pos[2].(string)
+						color = pal.code(pos[2].(string))
 						break
 					}
 				}
-				fmt.Print(color + string(ch) + Reset)
+				fmt.Fprint(w, color+string(ch)+pal.reset)
 			} else if ch == '.' || (ch >= 'a' && ch <= 'z') {
-				fmt.Print(DimWhite + string(ch) + Reset)
+				fmt.Fprint(w, pal.dimWhite+string(ch)+pal.reset)
 			} else if (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '_' || ch == '-' {
-				fmt.Print(BoldWhite + string(ch) + Reset)
+				fmt.Fprint(w, pal.boldWhite+string(ch)+pal.reset)
 			} else {
-				color := White
+				color := pal.white
 				for _, pos := range colPositions {
 					if c >= pos[0].(int) && c < pos[1].(int) {
-						color = pos[2].(string)
+						color = pal.code(pos[2].(string))
 						break
 					}
 				}
-				fmt.Print(color + string(ch) + Reset)
+				fmt.Fprint(w, color+string(ch)+pal.reset)
 			}
 		}
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 
 	// Ground
 	ground := strings.Repeat(" ", max(0, sceneLeft)) + strings.Repeat("▀", sceneWidth)
-	fmt.Println(DimWhite + ground + Reset)
+	fmt.Fprintln(w, pal.dimWhite+ground+pal.reset)
 
 	// Stats
-	fmt.Println()
-	title := fmt.Sprintf("─── %s ───", projectName)
-	fmt.Printf("%s%s%s\n", BoldWhite, CenterString(title, width), Reset)
+	fmt.Fprintln(w)
+	title := fmt.Sprintf("─── %s ───", s.projectName)
+	fmt.Fprintf(w, "%s%s%s\n", pal.boldWhite, CenterString(title, width), pal.reset)
 
 	var codeSize int64
-	for _, f := range codeFiles {
+	for _, f := range s.codeFiles {
 		codeSize += f.Size
 	}
-	stats := fmt.Sprintf("%d languages · %d files · %s", len(sorted), len(codeFiles), formatSize(codeSize))
-	fmt.Printf("%s%s%s\n", Cyan, CenterString(stats, width), Reset)
-	fmt.Println()
+	stats := fmt.Sprintf("%d languages · %d files · %s", len(s.sorted), len(s.codeFiles), formatSize(codeSize))
+	fmt.Fprintf(w, "%s%s%s\n", pal.cyan, CenterString(stats, width), pal.reset)
+	fmt.Fprintln(w)
 }
 
 // animationModel holds state for bubbletea animation
 type animationModel struct {
+	c                  palette
+	rng                *rand.Rand
 	arranged           []building
 	width              int
 	leftMargin         int
@@ -445,7 +481,7 @@ func (m animationModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			} else if m.frame == 10 || m.frame == 28 {
 				m.shootingStarActive = true
-				m.shootingStarRow = rng.IntN(3)
+				m.shootingStarRow = m.rng.IntN(3)
 				m.shootingStarCol = m.sceneLeft
 			}
 			if m.frame >= 40 {
@@ -470,9 +506,9 @@ func (m animationModel) View() string {
 
 		// Stars (random twinkling)
 		for _, pos := range m.starPositions {
-			if pos[0] == row && rng.Float32() > 0.25 {
+			if pos[0] == row && m.rng.Float32() > 0.25 {
 				stars := []rune{'·', '·', '✦', '*'}
-				line[pos[1]] = stars[rng.IntN(len(stars))]
+				line[pos[1]] = stars[m.rng.IntN(len(stars))]
 			}
 		}
 
@@ -487,15 +523,15 @@ func (m animationModel) View() string {
 			if m.phase == 2 && m.shootingStarActive && row == m.shootingStarRow {
 				if c >= m.shootingStarCol && c < m.shootingStarCol+3 {
 					trail := []rune{'─', '─', '★'}
-					sb.WriteString(Bold + Yellow + string(trail[c-m.shootingStarCol]) + Reset)
+					sb.WriteString(m.c.bold + m.c.yellow + string(trail[c-m.shootingStarCol]) + m.c.reset)
 					continue
 				}
 			}
 			switch ch {
 			case '◐':
-				sb.WriteString(Bold + Yellow + string(ch) + Reset)
+				sb.WriteString(m.c.bold + m.c.yellow + string(ch) + m.c.reset)
 			case '·', '✦', '*':
-				sb.WriteString(DimWhite + string(ch) + Reset)
+				sb.WriteString(m.c.dimWhite + string(ch) + m.c.reset)
 			default:
 				sb.WriteString(" ")
 			}
@@ -562,27 +598,27 @@ func (m animationModel) View() string {
 			if ch == ' ' {
 				sb.WriteString(" ")
 			} else if ch == '▄' {
-				color := White
+				color := m.c.white
 				for _, pos := range colPositions {
 					if c >= pos[0].(int) && c < pos[1].(int) {
-						color = pos[2].(string)
+						color = m.c.code(pos[2].(string))
 						break
 					}
 				}
-				sb.WriteString(color + string(ch) + Reset)
+				sb.WriteString(color + string(ch) + m.c.reset)
 			} else if ch == '.' || (ch >= 'a' && ch <= 'z') {
-				sb.WriteString(DimWhite + string(ch) + Reset)
+				sb.WriteString(m.c.dimWhite + string(ch) + m.c.reset)
 			} else if (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') {
-				sb.WriteString(BoldWhite + string(ch) + Reset)
+				sb.WriteString(m.c.boldWhite + string(ch) + m.c.reset)
 			} else {
-				color := White
+				color := m.c.white
 				for _, pos := range colPositions {
 					if c >= pos[0].(int) && c < pos[1].(int) {
-						color = pos[2].(string)
+						color = m.c.code(pos[2].(string))
 						break
 					}
 				}
-				sb.WriteString(color + string(ch) + Reset)
+				sb.WriteString(color + string(ch) + m.c.reset)
 			}
 		}
 		sb.WriteString("\n")
@@ -590,14 +626,17 @@ func (m animationModel) View() string {
 
 	// Ground
 	ground := strings.Repeat(" ", max(0, m.sceneLeft)) + strings.Repeat("▀", m.sceneWidth)
-	sb.WriteString(DimWhite + ground + Reset + "\n")
+	sb.WriteString(m.c.dimWhite + ground + m.c.reset + "\n")
 
 	return sb.String()
 }
 
 // renderAnimated renders animated skyline using bubbletea
-func renderAnimated(arranged []building, width, leftMargin, sceneLeft, sceneRight, sceneWidth int,
-	codeFiles []scanner.FileInfo, projectName string, sorted []extAgg) {
+func (s *skylineScene) renderAnimated() error {
+	rng := s.rng
+	arranged, width, leftMargin := s.arranged, s.width, s.leftMargin
+	sceneLeft, sceneRight, sceneWidth := s.sceneLeft, s.sceneRight, s.sceneWidth
+
 	// Generate star positions
 	var starPositions [][2]int
 	for row := 0; row < skyHeight; row++ {
@@ -618,15 +657,17 @@ func renderAnimated(arranged []building, width, leftMargin, sceneLeft, sceneRigh
 	}
 
 	m := animationModel{
+		c:                 s.c,
+		rng:               rng,
 		arranged:          arranged,
 		width:             width,
 		leftMargin:        leftMargin,
 		sceneLeft:         sceneLeft,
 		sceneRight:        sceneRight,
 		sceneWidth:        sceneWidth,
-		codeFiles:         codeFiles,
-		projectName:       projectName,
-		sorted:            sorted,
+		codeFiles:         s.codeFiles,
+		projectName:       s.projectName,
+		sorted:            s.sorted,
 		starPositions:     starPositions,
 		moonCol:           moonCol,
 		maxBuildingHeight: maxBuildingHeight,
@@ -634,11 +675,14 @@ func renderAnimated(arranged []building, width, leftMargin, sceneLeft, sceneRigh
 		visibleRows:       1,
 	}
 
-	p := tea.NewProgram(m, tea.WithAltScreen())
-	p.Run()
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithOutput(s.w))
+	if _, err := p.Run(); err != nil {
+		return err
+	}
 
 	// After animation, print static final frame to main screen
-	renderStatic(arranged, width, leftMargin, sceneLeft, sceneRight, sceneWidth, codeFiles, projectName, sorted)
+	s.renderStatic()
+	return nil
 }
 
 func max(a, b int) int {
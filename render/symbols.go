@@ -1,7 +1,6 @@
 package render
 
 import (
-	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -9,18 +8,23 @@ import (
 	"codemap/scanner"
 )
 
-// RenderOptions controls symbol rendering behavior
-type RenderOptions struct {
+// SymbolOptions controls symbol rendering behavior
+type SymbolOptions struct {
+	Options
 	ShowReferences bool
-	JSONOutput     bool
 }
 
 // Symbols renders rich symbol information with scopes and metadata
-func Symbols(analyses []scanner.SymbolAnalysis, options RenderOptions) {
-	if options.JSONOutput {
-		SymbolsJSON(analyses)
-		return
+func Symbols(analyses []scanner.SymbolAnalysis, options SymbolOptions) error {
+	switch options.format() {
+	case "text":
+	case "json":
+		return writeJSON(options.writer(), analyses)
+	default:
+		return unknownFormat(options.Format, "text or json")
 	}
+	w := options.writer()
+	c := options.palette()
 
 	// Sort files by path for consistent output
 	sort.Slice(analyses, func(i, j int) bool {
@@ -32,7 +36,7 @@ func Symbols(analyses []scanner.SymbolAnalysis, options RenderOptions) {
 			continue
 		}
 
-		fmt.Printf("\n%s%s%s\n", Cyan, a.Path, Reset)
+		fmt.Fprintf(w, "\n%s%s%s\n", c.cyan, a.Path, c.reset)
 
 		// Group symbols by scope
 		byScope := groupByScope(a.Symbols)
@@ -59,7 +63,7 @@ func Symbols(analyses []scanner.SymbolAnalysis, options RenderOptions) {
 
 			// Print scope header if not global
 			if scope != "global" {
-				fmt.Printf("  %s%s%s\n", Dim, scope, Reset)
+				fmt.Fprintf(w, "  %s%s%s\n", c.dim, scope, c.reset)
 			}
 
 			// Group by kind within scope
@@ -100,28 +104,19 @@ func Symbols(analyses []scanner.SymbolAnalysis, options RenderOptions) {
 				if len(defs) > 0 {
 					names := extractNames(defs)
 					label := kindToLabel(kind)
-					fmt.Printf("%s%s%s:%s %s\n", indent, Dim, label, Reset, strings.Join(names, ", "))
+					fmt.Fprintf(w, "%s%s%s:%s %s\n", indent, c.dim, label, c.reset, strings.Join(names, ", "))
 				}
 
 				if options.ShowReferences && len(refs) > 0 {
 					names := extractNames(refs)
 					label := kindToLabel(kind) + " (refs)"
-					fmt.Printf("%s%s%s:%s %s\n", indent, Dim, label, Reset, strings.Join(names, ", "))
+					fmt.Fprintf(w, "%s%s%s:%s %s\n", indent, c.dim, label, c.reset, strings.Join(names, ", "))
 				}
 			}
 		}
 	}
-	fmt.Println()
-}
-
-// SymbolsJSON outputs symbol information as JSON
-func SymbolsJSON(analyses []scanner.SymbolAnalysis) {
-	output, err := json.MarshalIndent(analyses, "", "  ")
-	if err != nil {
-		fmt.Printf("Error marshaling JSON: %v\n", err)
-		return
-	}
-	fmt.Println(string(output))
+	fmt.Fprintln(w)
+	return nil
 }
 
 // groupByScope groups symbols by their scope
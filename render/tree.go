@@ -2,6 +2,7 @@ package render
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -103,8 +104,18 @@ func formatSize(size int64) string {
 	return fmt.Sprintf("%.1f%s", fsize, units[len(units)-1])
 }
 
-// Tree renders the file tree to stdout
-func Tree(project scanner.Project) {
+// Tree renders the file tree
+func Tree(project scanner.Project, opts Options) error {
+	switch opts.format() {
+	case "text":
+	case "json":
+		return writeJSON(opts.writer(), project)
+	default:
+		return unknownFormat(opts.Format, "text or json")
+	}
+	w := opts.writer()
+	c := opts.palette()
+
 	files := project.Files
 	projectName := filepath.Base(project.Root)
 	isDiffMode := project.DiffRef != ""
@@ -168,7 +179,7 @@ func Tree(project scanner.Project) {
 	padding := innerWidth - len(titleLine)
 	leftPad := padding / 2
 	rightPad := padding - leftPad
-	fmt.Printf("╭%s%s%s╮\n", strings.Repeat("─", leftPad), titleLine, strings.Repeat("─", rightPad))
+	fmt.Fprintf(w, "╭%s%s%s╮\n", strings.Repeat("─", leftPad), titleLine, strings.Repeat("─", rightPad))
 
 	// Stats line - different for diff mode
 	var statsLine string
@@ -181,36 +192,49 @@ func Tree(project scanner.Project) {
 	} else {
 		statsLine = fmt.Sprintf("Files: %d | Size: %s", totalFiles, formatSize(totalSize))
 	}
-	fmt.Printf("│ %-*s │\n", innerWidth-2, statsLine)
+	fmt.Fprintf(w, "│ %-*s │\n", innerWidth-2, statsLine)
 
 	// Extensions line
 	if extLine != "" {
-		fmt.Printf("│ %-*s │\n", innerWidth-2, extLine)
+		fmt.Fprintf(w, "│ %-*s │\n", innerWidth-2, extLine)
 	}
 
-	fmt.Printf("╰%s╯\n", strings.Repeat("─", innerWidth))
+	fmt.Fprintf(w, "╰%s╯\n", strings.Repeat("─", innerWidth))
 
 	// Build and render tree
 	root := buildTreeStructure(files)
-	fmt.Printf("%s%s%s\n", Bold, projectName, Reset)
-	printTreeNode(root, "", true, topLarge, 1, maxDepth)
+	fmt.Fprintf(w, "%s%s%s\n", c.bold, projectName, c.reset)
+	tp := treePrinter{w: w, c: c, width: opts.width(), topLarge: topLarge, maxDepth: maxDepth}
+	tp.printNode(root, "", 1)
 
 	// Print impact footer for diff mode
 	if isDiffMode && len(project.Impact) > 0 {
-		fmt.Println()
+		fmt.Fprintln(w)
 		for _, imp := range project.Impact {
 			files := "files"
 			if imp.UsedBy == 1 {
 				files = "file"
 			}
-			fmt.Printf("%s⚠ %s is used by %d other %s%s\n", Yellow, imp.File, imp.UsedBy, files, Reset)
+			fmt.Fprintf(w, "%s⚠ %s is used by %d other %s%s\n", c.yellow, imp.File, imp.UsedBy, files, c.reset)
 		}
 	}
+	return nil
 }
 
-// printTreeNode recursively prints tree nodes
-// currentDepth starts at 1 for the root level, maxDepth 0 means unlimited
-func printTreeNode(node *treeNode, prefix string, isLast bool, topLarge map[string]bool, currentDepth, maxDepth int) {
+// treePrinter carries per-render state for printing tree nodes
+type treePrinter struct {
+	w        io.Writer
+	c        palette
+	width    int
+	topLarge map[string]bool
+	maxDepth int // 0 means unlimited
+}
+
+// printNode recursively prints tree nodes
+// currentDepth starts at 1 for the root level
+func (tp *treePrinter) printNode(node *treeNode, prefix string, currentDepth int) {
+	w, c, maxDepth := tp.w, tp.c, tp.maxDepth
+
 	// Check if we've exceeded depth limit
 	if maxDepth > 0 && currentDepth > maxDepth {
 		return
@@ -289,8 +313,8 @@ func printTreeNode(node *treeNode, prefix string, isLast bool, topLarge map[stri
 			connector = "└── "
 		}
 
-		fmt.Printf("%s%s%s  %s/%s %s(%s)%s\n",
-			prefix, connector, BoldBlue, mergedName, Reset, Dim, strings.Join(statsParts, ", "), Reset)
+		fmt.Fprintf(w, "%s%s%s  %s/%s %s(%s)%s\n",
+			prefix, connector, c.boldBlue, mergedName, c.reset, c.dim, strings.Join(statsParts, ", "), c.reset)
 
 		newPrefix := prefix + "│   "
 		if isLastDir {
@@ -325,17 +349,17 @@ func printTreeNode(node *treeNode, prefix string, isLast bool, topLarge map[stri
 						parts = append(parts, fmt.Sprintf("%d files", hiddenFiles))
 					}
 				}
-				fmt.Printf("%s└── %s... %s%s\n", newPrefix, Dim, strings.Join(parts, ", "), Reset)
+				fmt.Fprintf(w, "%s└── %s... %s%s\n", newPrefix, c.dim, strings.Join(parts, ", "), c.reset)
 			}
 		} else {
-			printTreeNode(current, newPrefix, isLastDir, topLarge, currentDepth+1, maxDepth)
+			tp.printNode(current, newPrefix, currentDepth+1)
 		}
 	}
 
 	// Print files as a grid (multi-column layout like Python)
 	if len(fileNodes) > 0 {
 		connector := "└── "
-		termWidth := GetTerminalWidth()
+		termWidth := tp.width
 		availableWidth := termWidth - len(prefix) - len(connector)
 		if availableWidth < 40 {
 			availableWidth = 40
@@ -363,7 +387,7 @@ func printTreeNode(node *treeNode, prefix string, isLast bool, topLarge map[stri
 		}
 		var entries []fileEntry
 		for _, f := range fileNodes {
-			color := GetFileColor(f.file.Ext)
+			color := c.code(GetFileColor(f.file.Ext))
 			displayName := f.name
 			// Strip extension if all files have same extension
 			if stripExt != "" {
@@ -379,15 +403,15 @@ func printTreeNode(node *treeNode, prefix string, isLast bool, topLarge map[stri
 			if f.file.IsNew {
 				prefix = "(new) "
 				prefixWidth = 6
-				color = Bold + Green
+				color = c.bold + c.green
 			} else if f.file.Added > 0 || f.file.Removed > 0 {
 				prefix = "✎ "
 				prefixWidth = 3
-				color = Bold + Yellow
-			} else if topLarge[f.file.Path] {
+				color = c.bold + c.yellow
+			} else if tp.topLarge[f.file.Path] {
 				prefix = "⭐️ "
 				prefixWidth = 3
-				color = Bold + color
+				color = c.bold + color
 			}
 
 			// Suffix: diff stats
@@ -408,7 +432,7 @@ func printTreeNode(node *treeNode, prefix string, isLast bool, topLarge map[stri
 			}
 
 			display := prefix + displayName + suffix
-			colored := fmt.Sprintf("%s%s%s%s%s%s", color, prefix, displayName, Reset, Dim, suffix+Reset)
+			colored := fmt.Sprintf("%s%s%s%s%s%s", color, prefix, displayName, c.reset, c.dim, suffix+c.reset)
 			width := prefixWidth + len(displayName) + suffixWidth
 			entries = append(entries, fileEntry{display, colored, width})
 		}
@@ -435,9 +459,9 @@ func printTreeNode(node *treeNode, prefix string, isLast bool, topLarge map[stri
 		// Print in column-major order (like Python)
 		for row := 0; row < numRows; row++ {
 			if row == 0 {
-				fmt.Printf("%s%s", prefix, connector)
+				fmt.Fprintf(w, "%s%s", prefix, connector)
 			} else {
-				fmt.Printf("%s    ", prefix)
+				fmt.Fprintf(w, "%s    ", prefix)
 			}
 			for col := 0; col < numCols; col++ {
 				idx := col*numRows + row
@@ -448,10 +472,10 @@ func printTreeNode(node *treeNode, prefix string, isLast bool, topLarge map[stri
 					if padding < 0 {
 						padding = 0
 					}
-					fmt.Printf("%s%s", e.colored, strings.Repeat(" ", padding))
+					fmt.Fprintf(w, "%s%s", e.colored, strings.Repeat(" ", padding))
 				}
 			}
-			fmt.Println()
+			fmt.Fprintln(w)
 		}
 	}
 }
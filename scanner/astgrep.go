@@ -2,13 +2,18 @@ package scanner
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 //go:embed sg-rules/*.yml
@@ -69,17 +74,27 @@ func NewAstGrepScanner() (*AstGrepScanner, error) {
 }
 
 // findAstGrepBinary checks for "ast-grep" first, then "sg"
-// Note: Linux has a system "sg" command (setgroups), so we check ast-grep first
+// Note: Linux has a system "sg" command (setgroups), so we check ast-grep
+// first and only use "sg" if it is ast-grep
 func findAstGrepBinary() string {
 	if _, err := exec.LookPath("ast-grep"); err == nil {
 		return "ast-grep"
 	}
-	if _, err := exec.LookPath("sg"); err == nil {
+	if _, err := exec.LookPath("sg"); err == nil && isAstGrep("sg") {
 		return "sg"
 	}
 	return ""
 }
 
+// isAstGrep reports whether binary is ast-grep rather than another tool of
+// the same name, like Linux's "sg" (setgroups)
+func isAstGrep(binary string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, _ := exec.CommandContext(ctx, binary, "--version").CombinedOutput()
+	return bytes.Contains(out, []byte("ast-grep"))
+}
+
 // Close cleans up temp rules directory
 func (s *AstGrepScanner) Close() {
 	if s.rulesDir != "" {
@@ -92,8 +107,65 @@ func (s *AstGrepScanner) Available() bool {
 	return s.binary != ""
 }
 
+// errNoScanOutput means ast-grep printed no JSON, as it exits non-zero when
+// nothing matches
+var errNoScanOutput = errors.New("no ast-grep output")
+
+// runScan runs sg scan with the given rules and decodes its JSON matches as
+// they stream in, reporting each newly seen file as analyzed if report is set.
+// The subprocess is killed when ctx is cancelled.
+func (s *AstGrepScanner) runScan(ctx context.Context, root, inlineRules string, report bool) ([]ScanMatch, error) {
+	cmd := exec.CommandContext(ctx, s.binary, "scan", "--inline-rules", inlineRules, "--json", root)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run ast-grep: %w", err)
+	}
+
+	matches, err := decodeMatches(ctx, stdout, report)
+	// Drain the rest so ast-grep can exit after a decode error
+	io.Copy(io.Discard, stdout)
+	cmd.Wait() // non-zero exits are normal when nothing matched
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if errors.Is(err, errNoScanOutput) {
+		return nil, nil
+	}
+	return matches, err
+}
+
+// decodeMatches reads the JSON array of matches printed by sg scan --json
+func decodeMatches(ctx context.Context, r io.Reader, report bool) ([]ScanMatch, error) {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, errNoScanOutput
+	}
+
+	var matches []ScanMatch
+	seen := make(map[string]bool)
+	for dec.More() {
+		var m ScanMatch
+		if err := dec.Decode(&m); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+		if report && !seen[m.File] {
+			seen[m.File] = true
+			reportProgress(ctx, StageAnalyze, len(seen))
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
 // ScanDirectory analyzes all files in a directory using sg scan
-func (s *AstGrepScanner) ScanDirectory(root string) ([]FileAnalysis, error) {
+func (s *AstGrepScanner) ScanDirectory(ctx context.Context, root string) ([]FileAnalysis, error) {
 	if !s.Available() {
 		return nil, nil
 	}
@@ -111,17 +183,8 @@ func (s *AstGrepScanner) ScanDirectory(root string) ([]FileAnalysis, error) {
 	}
 	inlineRules := strings.Join(rules, "\n---\n")
 
-	cmd := exec.Command(s.binary, "scan", "--inline-rules", inlineRules, "--json", root)
-	out, err := cmd.CombinedOutput()
+	matches, err := s.runScan(ctx, root, inlineRules, true)
 	if err != nil {
-		// sg scan returns non-zero if no matches, check if output is valid JSON
-		if len(out) == 0 || !strings.HasPrefix(string(out), "[") {
-			return nil, nil
-		}
-	}
-
-	var matches []ScanMatch
-	if err := json.Unmarshal(out, &matches); err != nil {
 		return nil, err
 	}
 
@@ -151,7 +214,14 @@ func (s *AstGrepScanner) ScanDirectory(root string) ([]FileAnalysis, error) {
 				mod = extractImportPath(m.Text)
 			}
 			if mod != "" {
-				fileMap[relPath].Imports = append(fileMap[relPath].Imports, mod)
+				fa := fileMap[relPath]
+				fa.Imports = append(fa.Imports, mod)
+				if fa.ImportLines == nil {
+					fa.ImportLines = make(map[string]int)
+				}
+				if _, seen := fa.ImportLines[mod]; !seen {
+					fa.ImportLines[mod] = m.Range.Start.Line + 1 // ast-grep lines are 0-indexed
+				}
 			}
 		} else if strings.HasSuffix(m.RuleID, "-arrow-functions") {
 			// Arrow functions: extract name from the full line (const name = () => {})
@@ -389,7 +459,32 @@ func (s *AstGrepScanner) ScanDirectory(root string) ([]FileAnalysis, error) {
 }
 
 // ScanSymbols analyzes all files and returns rich symbol data with scopes and metadata
-func (s *AstGrepScanner) ScanSymbols(root string, includeRefs bool) ([]SymbolAnalysis, error) {
+func (s *AstGrepScanner) ScanSymbols(ctx context.Context, root string, includeRefs bool) ([]SymbolAnalysis, error) {
+	return s.scanSymbols(ctx, root, root, includeRefs)
+}
+
+// ScanFileSymbols is ScanSymbols for the single file path under root. It
+// returns an analysis without symbols if the file defines none.
+func (s *AstGrepScanner) ScanFileSymbols(ctx context.Context, root, path string, includeRefs bool) (*SymbolAnalysis, error) {
+	relPath, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.scanSymbols(ctx, root, path, includeRefs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if results[i].Path == relPath {
+			return &results[i], nil
+		}
+	}
+	return &SymbolAnalysis{Path: relPath, Language: DetectLanguage(relPath), Symbols: []Symbol{}}, nil
+}
+
+// scanSymbols analyzes target, a directory or file under root; paths in
+// the results are relative to root
+func (s *AstGrepScanner) scanSymbols(ctx context.Context, root, target string, includeRefs bool) ([]SymbolAnalysis, error) {
 	if !s.Available() {
 		return nil, nil
 	}
@@ -398,7 +493,10 @@ func (s *AstGrepScanner) ScanSymbols(root string, includeRefs bool) ([]SymbolAna
 	cache := newFileCache()
 
 	// Extract scope containers first (two-pass approach)
-	containers, err := s.extractScopeContainers(root, cache)
+	containers, err := s.extractScopeContainers(ctx, root, target, cache)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		// Continue without scope resolution if container extraction fails
 		containers = make(map[string][]ScopeContainer)
@@ -425,16 +523,8 @@ func (s *AstGrepScanner) ScanSymbols(root string, includeRefs bool) ([]SymbolAna
 	}
 	inlineRules := strings.Join(rules, "\n---\n")
 
-	cmd := exec.Command(s.binary, "scan", "--inline-rules", inlineRules, "--json", root)
-	out, err := cmd.CombinedOutput()
+	matches, err := s.runScan(ctx, target, inlineRules, true)
 	if err != nil {
-		if len(out) == 0 || !strings.HasPrefix(string(out), "[") {
-			return nil, nil
-		}
-	}
-
-	var matches []ScanMatch
-	if err := json.Unmarshal(out, &matches); err != nil {
 		return nil, err
 	}
 
@@ -665,9 +755,61 @@ func extractSymbol(m ScanMatch, lang string) Symbol {
 	// Extract modifiers if present
 	sym.Modifiers = extractModifiers(m.Text, lang)
 
+	if sym.Role == RoleDefinition && (sym.Kind == KindFunction || sym.Kind == KindMethod) {
+		sym.Signature = extractSignature(m.Text, sym.Name, lang)
+	}
+
 	return sym
 }
 
+// extractSignature extracts the parameters and result of a function or
+// method declared as name in text, with whitespace collapsed:
+// "func (s *T) Scan(ctx context.Context) error {" -> "(ctx context.Context) error"
+func extractSignature(text, name, lang string) string {
+	if name == "" {
+		return ""
+	}
+	// The name followed by its parameter (or type parameter) list; skips
+	// earlier mentions such as a Go receiver of the same name
+	start := -1
+	for from := 0; start < 0; {
+		i := strings.Index(text[from:], name)
+		if i < 0 {
+			return ""
+		}
+		after := strings.TrimLeft(text[from+i+len(name):], " \t")
+		if after != "" && strings.ContainsRune("(<[", rune(after[0])) {
+			start = len(text) - len(after)
+		}
+		from += i + len(name)
+	}
+
+	// Up to the body: '{' (':' in Python) or the end of the line outside
+	// brackets
+	depth := 0
+	end := len(text)
+scan:
+	for i := start; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case '{', ';', '\n':
+			if depth == 0 {
+				end = i
+				break scan
+			}
+		case ':':
+			if depth == 0 && lang == "python" {
+				end = i
+				break scan
+			}
+		}
+	}
+	return strings.Join(strings.Fields(text[start:end]), " ")
+}
+
 // determineRole returns whether a rule captures definitions or references
 func determineRole(ruleID string) SymbolRole {
 	if strings.Contains(ruleID, "-ref-") {
@@ -2266,9 +2408,9 @@ func (c *fileCache) get(path string) ([]byte, error) {
 	return data, nil
 }
 
-// extractScopeContainers runs ast-grep to find all scope-creating containers
+// extractScopeContainers runs ast-grep to find all scope-creating containers in target
 // and returns them grouped by file path
-func (s *AstGrepScanner) extractScopeContainers(root string, cache *fileCache) (map[string][]ScopeContainer, error) {
+func (s *AstGrepScanner) extractScopeContainers(ctx context.Context, root, target string, cache *fileCache) (map[string][]ScopeContainer, error) {
 	if !s.Available() {
 		return nil, nil
 	}
@@ -2290,16 +2432,8 @@ func (s *AstGrepScanner) extractScopeContainers(root string, cache *fileCache) (
 	}
 
 	inlineRules := strings.Join(containerRules, "\n---\n")
-	cmd := exec.Command(s.binary, "scan", "--inline-rules", inlineRules, "--json", root)
-	out, err := cmd.CombinedOutput()
+	matches, err := s.runScan(ctx, target, inlineRules, false)
 	if err != nil {
-		if len(out) == 0 || !strings.HasPrefix(string(out), "[") {
-			return make(map[string][]ScopeContainer), nil
-		}
-	}
-
-	var matches []ScanMatch
-	if err := json.Unmarshal(out, &matches); err != nil {
 		return nil, err
 	}
 
@@ -2571,7 +2705,7 @@ func NewAstGrepAnalyzer() *AstGrepAnalyzer {
 }
 
 func (s *AstGrepScanner) AnalyzeFile(filePath string) (*FileAnalysis, error) {
-	results, err := s.ScanDirectory(filepath.Dir(filePath))
+	results, err := s.ScanDirectory(context.Background(), filepath.Dir(filePath))
 	if err != nil {
 		return nil, err
 	}
@@ -1,8 +1,12 @@
 package scanner
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -167,6 +171,31 @@ func TestExtractMethodName(t *testing.T) {
 	}
 }
 
+func TestExtractSignature(t *testing.T) {
+	tests := []struct {
+		input    string
+		name     string
+		lang     string
+		expected string
+	}{
+		{"func ScanFiles(ctx context.Context, root string) ([]FileInfo, error) {\n}", "ScanFiles", "go", "(ctx context.Context, root string) ([]FileInfo, error)"},
+		{"func (s Scan) Scan(p []byte) error { }", "Scan", "go", "(p []byte) error"},
+		{"func Map[T any](xs []T,\n\tf func(T) T) []T {", "Map", "go", "[T any](xs []T, f func(T) T) []T"},
+		{"def load(path: str, opts: dict = {}) -> Dict[str, int]:\n    pass", "load", "python", "(path: str, opts: dict = {}) -> Dict[str, int]"},
+		{"function fetch<T>(url: string, init?: {retries: number}): Promise<T> {", "fetch", "typescript", "<T>(url: string, init?: {retries: number}): Promise<T>"},
+		{"fn parse(input: &str) -> Result<Ast, Error> {", "parse", "rust", "(input: &str) -> Result<Ast, Error>"},
+		{"const handler = (req) => {", "handler", "javascript", ""},
+		{"", "", "go", ""},
+	}
+	for _, tt := range tests {
+		got := extractSignature(tt.input, tt.name, tt.lang)
+		if got != tt.expected {
+			t.Errorf("extractSignature(%q, %q, %q) = %q, want %q",
+				tt.input, tt.name, tt.lang, got, tt.expected)
+		}
+	}
+}
+
 func TestExtractConstantNames(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -1643,6 +1672,35 @@ func TestExtractModifiers(t *testing.T) {
 	}
 }
 
+func TestSymbolIsExported(t *testing.T) {
+	tests := []struct {
+		name     string
+		sym      Symbol
+		lang     string
+		expected bool
+	}{
+		{"go upper", Symbol{Name: "Scan"}, "go", true},
+		{"go lower", Symbol{Name: "scan"}, "go", false},
+		{"python public", Symbol{Name: "load"}, "python", true},
+		{"python private", Symbol{Name: "_load"}, "python", false},
+		{"ts export", Symbol{Name: "App", Scope: "global", Modifiers: []string{"export"}}, "typescript", true},
+		{"ts module local", Symbol{Name: "helper", Scope: "global"}, "typescript", false},
+		{"ts public member", Symbol{Name: "start", Scope: "class:App"}, "typescript", true},
+		{"ts private member", Symbol{Name: "state", Scope: "class:App", Modifiers: []string{"private"}}, "typescript", false},
+		{"ts hash member", Symbol{Name: "#id", Scope: "class:App"}, "typescript", false},
+		{"other language", Symbol{Name: "main"}, "rust", true},
+		{"empty name", Symbol{}, "go", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.sym.IsExported(tc.lang); got != tc.expected {
+				t.Errorf("IsExported(%q) for %q = %v, want %v", tc.lang, tc.sym.Name, got, tc.expected)
+			}
+		})
+	}
+}
+
 func TestExtractCallExpressionName(t *testing.T) {
 	tests := []struct {
 		text     string
@@ -1755,7 +1813,7 @@ enum Color { Red, Green, Blue }
 `), 0644)
 
 	// Test without refs
-	results, err := scanner.ScanSymbols(tmpDir, false)
+	results, err := scanner.ScanSymbols(context.Background(), tmpDir, false)
 	if err != nil {
 		t.Fatalf("ScanSymbols failed: %v", err)
 	}
@@ -1802,7 +1860,7 @@ enum Color { Red, Green, Blue }
 	}
 
 	// Test with refs enabled
-	resultsWithRefs, err := scanner.ScanSymbols(tmpDir, true)
+	resultsWithRefs, err := scanner.ScanSymbols(context.Background(), tmpDir, true)
 	if err != nil {
 		t.Fatalf("ScanSymbols with refs failed: %v", err)
 	}
@@ -1984,7 +2042,7 @@ interface IFoo {
 enum Color { Red, Green, Blue }
 `), 0644)
 
-	results, err := scanner.ScanSymbols(tmpDir, false)
+	results, err := scanner.ScanSymbols(context.Background(), tmpDir, false)
 	if err != nil {
 		t.Fatalf("ScanSymbols failed: %v", err)
 	}
@@ -2064,7 +2122,7 @@ class MyClass {
 }
 `), 0644)
 
-	results, err := scanner.ScanSymbols(tmpDir, false)
+	results, err := scanner.ScanSymbols(context.Background(), tmpDir, false)
 	if err != nil {
 		t.Fatalf("ScanSymbols failed: %v", err)
 	}
@@ -2118,7 +2176,7 @@ class DecoratedClass {
 }
 `), 0644)
 
-	results, err := scanner.ScanSymbols(tmpDir, false)
+	results, err := scanner.ScanSymbols(context.Background(), tmpDir, false)
 	if err != nil {
 		t.Fatalf("ScanSymbols failed: %v", err)
 	}
@@ -2168,7 +2226,7 @@ class WithComputed {
 }
 `), 0644)
 
-	results, err := scanner.ScanSymbols(tmpDir, false)
+	results, err := scanner.ScanSymbols(context.Background(), tmpDir, false)
 	if err != nil {
 		t.Fatalf("ScanSymbols failed: %v", err)
 	}
@@ -2257,7 +2315,7 @@ type MyInterface interface {
 func standalone() {}
 `), 0644)
 
-	results, err := scanner.ScanSymbols(tmpDir, false)
+	results, err := scanner.ScanSymbols(context.Background(), tmpDir, false)
 	if err != nil {
 		t.Fatalf("ScanSymbols failed: %v", err)
 	}
@@ -2631,7 +2689,7 @@ def another_top_level():
     pass
 `), 0644)
 
-	results, err := analyzer.ScanSymbols(tmpDir, false)
+	results, err := analyzer.ScanSymbols(context.Background(), tmpDir, false)
 	if err != nil {
 		t.Fatalf("ScanSymbols failed: %v", err)
 	}
@@ -3028,3 +3086,72 @@ func TestJavaScriptProperties(t *testing.T) {
 		t.Errorf("Expected 'regular' method, got: %v", analysis.Methods)
 	}
 }
+
+func TestDecodeMatches(t *testing.T) {
+	input := `[
+{"file": "/p/a.go", "ruleId": "go-imports", "text": "import \"fmt\""},
+{"file": "/p/a.go", "ruleId": "go-functions", "text": "func main()"},
+{"file": "/p/b.go", "ruleId": "go-functions", "text": "func helper()"}
+]`
+	var analyzed []int
+	ctx := WithProgress(context.Background(), func(stage string, files int) {
+		if stage == StageAnalyze {
+			analyzed = append(analyzed, files)
+		}
+	})
+
+	matches, err := decodeMatches(ctx, strings.NewReader(input), true)
+	if err != nil {
+		t.Fatalf("decodeMatches failed: %v", err)
+	}
+	if len(matches) != 3 || matches[2].File != "/p/b.go" {
+		t.Errorf("Expected 3 matches ending in /p/b.go, got %+v", matches)
+	}
+	// Progress counts distinct files, not matches
+	if len(analyzed) != 2 || analyzed[1] != 2 {
+		t.Errorf("Expected analyze progress [1 2], got %v", analyzed)
+	}
+
+	// No JSON at all (ast-grep found nothing, or "sg" is not ast-grep)
+	if _, err := decodeMatches(ctx, strings.NewReader("sg: invalid option"), false); !errors.Is(err, errNoScanOutput) {
+		t.Errorf("Expected errNoScanOutput, got %v", err)
+	}
+}
+
+// TestRunScanMissingBinary tests that an ast-grep that can't be started is
+// an error rather than a scan without matches
+func TestRunScanMissingBinary(t *testing.T) {
+	s := &AstGrepScanner{binary: filepath.Join(t.TempDir(), "no-such-sg")}
+	matches, err := s.runScan(context.Background(), t.TempDir(), "", false)
+	if err == nil {
+		t.Fatalf("Expected an error for a missing binary, got %d matches", len(matches))
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the start error to be wrapped, got %v", err)
+	}
+}
+
+// TestFindAstGrepBinarySkipsSetgroups tests that a "sg" that isn't ast-grep,
+// like Linux's setgroups, isn't used
+func TestFindAstGrepBinarySkipsSetgroups(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell scripts as fake binaries")
+	}
+	bin := t.TempDir()
+	t.Setenv("PATH", bin)
+	writeScript := func(script string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(bin, "sg"), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeScript("echo 'Usage: sg group [[-c] command]' >&2; exit 1\n")
+	if got := findAstGrepBinary(); got != "" {
+		t.Errorf("Expected setgroups to be skipped, got %q", got)
+	}
+	writeScript("echo 'ast-grep 0.39.0'\n")
+	if got := findAstGrepBinary(); got != "sg" {
+		t.Errorf("Expected ast-grep installed as sg, got %q", got)
+	}
+}
@@ -1,6 +1,7 @@
 package scanner
 
 import (
+	"context"
 	"os"
 	"testing"
 	"time"
@@ -23,7 +24,7 @@ func TestBenchmarkAstGrep(t *testing.T) {
 	defer scanner.Close()
 
 	start := time.Now()
-	results, err := scanner.ScanDirectory(testDir)
+	results, err := scanner.ScanDirectory(context.Background(), testDir)
 	if err != nil {
 		t.Fatalf("ast-grep scan error: %v", err)
 	}
@@ -49,7 +50,7 @@ func TestAstGrepScanner(t *testing.T) {
 	}
 
 	// Test on codemap's own codebase
-	results, err := scanner.ScanDirectory("..")
+	results, err := scanner.ScanDirectory(context.Background(), "..")
 	if err != nil {
 		t.Fatalf("ScanDirectory failed: %v", err)
 	}
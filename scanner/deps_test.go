@@ -1,10 +1,12 @@
 package scanner
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 )
 
@@ -312,3 +314,14 @@ func TestReadExternalDepsIgnoresNodeModules(t *testing.T) {
 		t.Errorf("Expected javascript deps, got: %v", deps)
 	}
 }
+
+func TestDepsJSONOmitsImportLines(t *testing.T) {
+	fa := FileAnalysis{Path: "main.go", Language: "go", Imports: []string{"fmt"}, ImportLines: map[string]int{"fmt": 3}}
+	data, err := json.Marshal(DepsProject{Root: ".", Mode: "deps", Files: []FileAnalysis{fa}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "import_lines") || strings.Contains(string(data), "ImportLines") {
+		t.Errorf("--deps JSON should not carry import lines: %s", data)
+	}
+}
@@ -2,6 +2,7 @@ package scanner
 
 import (
 	"bufio"
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,6 +15,8 @@ type FileGraph struct {
 	Imports   map[string][]string // file -> files it imports
 	Importers map[string][]string // file -> files that import it
 	Packages  map[string][]string // package path -> files in that package
+	// ImportLines records where each edge comes from: file -> imported file -> 1-based line
+	ImportLines map[string]map[string]int
 }
 
 // fileIndex provides fast lookup of files by various import-like keys
@@ -26,39 +29,46 @@ type fileIndex struct {
 
 // BuildFileGraph analyzes a project and returns file-level dependencies
 // Uses ast-grep for multi-language support with universal fuzzy resolution
-func BuildFileGraph(root string) (*FileGraph, error) {
-	absRoot, err := filepath.Abs(root)
+func BuildFileGraph(ctx context.Context, root string) (*FileGraph, error) {
+	// Scan all files
+	gitCache := NewGitIgnoreCache(root)
+	files, err := ScanFiles(ctx, root, gitCache, nil, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	fg := &FileGraph{
-		Root:      absRoot,
-		Imports:   make(map[string][]string),
-		Importers: make(map[string][]string),
-		Packages:  make(map[string][]string),
+	// Use ast-grep to extract imports for all languages
+	analyses, err := ScanForDeps(ctx, root)
+	if err != nil {
+		return nil, err
 	}
 
-	// Detect module name from go.mod (for Go import resolution)
-	fg.Module = detectModule(absRoot)
+	return NewFileGraph(root, files, analyses)
+}
 
-	// Scan all files
-	gitCache := NewGitIgnoreCache(root)
-	files, err := ScanFiles(root, gitCache, nil, nil)
+// NewFileGraph resolves already-scanned imports into a file graph, for callers
+// that also need the raw files and analyses
+func NewFileGraph(root string, files []FileInfo, analyses []FileAnalysis) (*FileGraph, error) {
+	absRoot, err := filepath.Abs(root)
 	if err != nil {
 		return nil, err
 	}
 
+	fg := &FileGraph{
+		Root:        absRoot,
+		Imports:     make(map[string][]string),
+		Importers:   make(map[string][]string),
+		Packages:    make(map[string][]string),
+		ImportLines: make(map[string]map[string]int),
+	}
+
+	// Detect module name from go.mod (for Go import resolution)
+	fg.Module = detectModule(absRoot)
+
 	// Build file index for fast fuzzy matching
 	idx := buildFileIndex(files, fg.Module)
 	fg.Packages = idx.goPkgs
 
-	// Use ast-grep to extract imports for all languages
-	analyses, err := ScanForDeps(root)
-	if err != nil {
-		return nil, err
-	}
-
 	// Resolve imports to files using universal fuzzy matching
 	for _, a := range analyses {
 		var resolvedImports []string
@@ -66,6 +76,12 @@ func BuildFileGraph(root string) (*FileGraph, error) {
 		for _, imp := range a.Imports {
 			resolved := fuzzyResolve(imp, a.Path, idx, fg.Module)
 			resolvedImports = append(resolvedImports, resolved...)
+
+			if line := a.ImportLines[imp]; line > 0 {
+				for _, target := range resolved {
+					fg.recordImportLine(a.Path, target, line)
+				}
+			}
 		}
 
 		if len(resolvedImports) > 0 {
@@ -81,6 +97,23 @@ func BuildFileGraph(root string) (*FileGraph, error) {
 	return fg, nil
 }
 
+// recordImportLine remembers the first line at which file imports target
+func (fg *FileGraph) recordImportLine(file, target string, line int) {
+	lines := fg.ImportLines[file]
+	if lines == nil {
+		lines = make(map[string]int)
+		fg.ImportLines[file] = lines
+	}
+	if _, ok := lines[target]; !ok {
+		lines[target] = line
+	}
+}
+
+// ImportLine returns the 1-based line where file imports target, or 0 if unknown
+func (fg *FileGraph) ImportLine(file, target string) int {
+	return fg.ImportLines[file][target]
+}
+
 // buildFileIndex creates a multi-key index for fast import resolution
 func buildFileIndex(files []FileInfo, goModule string) *fileIndex {
 	idx := &fileIndex{
@@ -282,22 +315,69 @@ func detectModule(root string) string {
 	return ""
 }
 
-// IsHub returns true if a file has 3+ importers
+// HubThreshold is how many importers make a file a hub
+const HubThreshold = 3
+
+// IsHub returns true if a file has HubThreshold+ importers
 func (fg *FileGraph) IsHub(path string) bool {
-	return len(fg.Importers[path]) >= 3
+	return len(fg.Importers[path]) >= HubThreshold
 }
 
-// HubFiles returns all files that are imported by 3+ other files
+// HubFiles returns all files that are imported by HubThreshold+ other files
 func (fg *FileGraph) HubFiles() []string {
 	var hubs []string
 	for path, importers := range fg.Importers {
-		if len(importers) >= 3 {
+		if len(importers) >= HubThreshold {
 			hubs = append(hubs, path)
 		}
 	}
 	return hubs
 }
 
+// Renamed returns a copy of the graph with file oldPath moved to newPath:
+// its edges, import lines and package membership follow it. The receiver is
+// left unchanged, so readers holding it stay consistent.
+func (fg *FileGraph) Renamed(oldPath, newPath string) *FileGraph {
+	rename := func(p string) string {
+		if p == oldPath {
+			return newPath
+		}
+		return p
+	}
+	renameAll := func(m map[string][]string) map[string][]string {
+		out := make(map[string][]string, len(m))
+		for k, files := range m {
+			renamed := make([]string, len(files))
+			for i, f := range files {
+				renamed[i] = rename(f)
+			}
+			out[rename(k)] = renamed
+		}
+		return out
+	}
+
+	c := *fg
+	c.Imports = renameAll(fg.Imports)
+	c.Importers = renameAll(fg.Importers)
+	c.Packages = make(map[string][]string, len(fg.Packages))
+	for pkg, files := range fg.Packages {
+		renamed := make([]string, len(files))
+		for i, f := range files {
+			renamed[i] = rename(f)
+		}
+		c.Packages[pkg] = renamed
+	}
+	c.ImportLines = make(map[string]map[string]int, len(fg.ImportLines))
+	for file, lines := range fg.ImportLines {
+		renamed := make(map[string]int, len(lines))
+		for target, line := range lines {
+			renamed[rename(target)] = line
+		}
+		c.ImportLines[rename(file)] = renamed
+	}
+	return &c
+}
+
 // ConnectedFiles returns all files connected to the given file (imports + importers)
 func (fg *FileGraph) ConnectedFiles(path string) []string {
 	seen := make(map[string]bool)
@@ -0,0 +1,72 @@
+package scanner
+
+import "testing"
+
+func TestNewFileGraph(t *testing.T) {
+	root := t.TempDir()
+	files := []FileInfo{
+		{Path: "src/app.ts", Ext: ".ts"},
+		{Path: "src/utils.ts", Ext: ".ts"},
+		{Path: "src/api.ts", Ext: ".ts"},
+	}
+	analyses := []FileAnalysis{
+		{Path: "src/app.ts", Language: "typescript", Imports: []string{"./utils", "./api"}, ImportLines: map[string]int{"./utils": 1, "./api": 2}},
+		{Path: "src/api.ts", Language: "typescript", Imports: []string{"./utils", "react"}},
+	}
+
+	fg, err := NewFileGraph(root, files, analyses)
+	if err != nil {
+		t.Fatalf("NewFileGraph failed: %v", err)
+	}
+
+	if got := fg.Imports["src/app.ts"]; len(got) != 2 {
+		t.Errorf("expected app.ts to import 2 files, got %v", got)
+	}
+	if got := fg.Importers["src/utils.ts"]; len(got) != 2 {
+		t.Errorf("expected utils.ts to have 2 importers, got %v", got)
+	}
+	if got := fg.Imports["src/api.ts"]; len(got) != 1 {
+		t.Errorf("external imports should not resolve, got %v", got)
+	}
+	if line := fg.ImportLine("src/app.ts", "src/api.ts"); line != 2 {
+		t.Errorf("expected import line 2, got %d", line)
+	}
+}
+
+func TestFileGraphRenamed(t *testing.T) {
+	fg := &FileGraph{
+		Imports:     map[string][]string{"main.go": {"util.go"}, "util.go": {"log.go"}},
+		Importers:   map[string][]string{"util.go": {"main.go"}, "log.go": {"util.go"}},
+		Packages:    map[string][]string{"app": {"main.go", "util.go"}},
+		ImportLines: map[string]map[string]int{"main.go": {"util.go": 3}, "util.go": {"log.go": 5}},
+	}
+
+	moved := fg.Renamed("util.go", "lib/util.go")
+
+	if got := moved.Imports["main.go"]; len(got) != 1 || got[0] != "lib/util.go" {
+		t.Errorf("main.go should import lib/util.go, got %v", got)
+	}
+	if got := moved.Imports["lib/util.go"]; len(got) != 1 || got[0] != "log.go" {
+		t.Errorf("lib/util.go should keep its imports, got %v", got)
+	}
+	if _, ok := moved.Imports["util.go"]; ok {
+		t.Error("old path should be gone from Imports")
+	}
+	if got := moved.Importers["lib/util.go"]; len(got) != 1 || got[0] != "main.go" {
+		t.Errorf("lib/util.go importers = %v", got)
+	}
+	if got := moved.Importers["log.go"]; len(got) != 1 || got[0] != "lib/util.go" {
+		t.Errorf("log.go importers = %v", got)
+	}
+	if moved.ImportLine("main.go", "lib/util.go") != 3 || moved.ImportLine("lib/util.go", "log.go") != 5 {
+		t.Errorf("import lines should follow the file, got %v", moved.ImportLines)
+	}
+	if got := moved.Packages["app"]; got[1] != "lib/util.go" {
+		t.Errorf("package files = %v", got)
+	}
+
+	// The original graph is untouched
+	if got := fg.Imports["main.go"]; got[0] != "util.go" {
+		t.Errorf("original graph changed: %v", got)
+	}
+}
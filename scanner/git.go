@@ -1,6 +1,7 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"path/filepath"
@@ -162,7 +163,7 @@ type ImpactInfo struct {
 
 // AnalyzeImpact checks which changed files are imported by other files
 // Uses ast-grep to extract actual imports for accuracy
-func AnalyzeImpact(root string, changedFiles []FileInfo) []ImpactInfo {
+func AnalyzeImpact(ctx context.Context, root string, changedFiles []FileInfo) []ImpactInfo {
 	if len(changedFiles) == 0 {
 		return nil
 	}
@@ -185,7 +186,7 @@ func AnalyzeImpact(root string, changedFiles []FileInfo) []ImpactInfo {
 	}
 
 	// Scan all files to get their imports using ast-grep
-	analyses, err := ScanForDeps(root)
+	analyses, err := ScanForDeps(ctx, root)
 	if err != nil {
 		return nil
 	}
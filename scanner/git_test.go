@@ -1,6 +1,7 @@
 package scanner
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -247,12 +248,12 @@ func TestImpactInfo(t *testing.T) {
 
 func TestAnalyzeImpactEmpty(t *testing.T) {
 	// Test with empty changed files
-	impacts := AnalyzeImpact(".", nil)
+	impacts := AnalyzeImpact(context.Background(), ".", nil)
 	if impacts != nil {
 		t.Errorf("Expected nil impacts for empty input, got %v", impacts)
 	}
 
-	impacts = AnalyzeImpact(".", []FileInfo{})
+	impacts = AnalyzeImpact(context.Background(), ".", []FileInfo{})
 	if impacts != nil {
 		t.Errorf("Expected nil impacts for empty slice, got %v", impacts)
 	}
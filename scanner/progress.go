@@ -0,0 +1,28 @@
+package scanner
+
+import "context"
+
+// Scan stages reported to a Progress callback
+const (
+	StageWalk    = "walk"    // files found while walking the tree
+	StageAnalyze = "analyze" // files analyzed by ast-grep
+)
+
+// Progress receives the number of files a scan stage has handled so far.
+// It is called from the scanning goroutine and should return quickly.
+type Progress func(stage string, files int)
+
+type progressKey struct{}
+
+// WithProgress returns a context that makes the scans it is passed to
+// report their progress to fn
+func WithProgress(ctx context.Context, fn Progress) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// reportProgress calls the context's Progress callback, if any
+func reportProgress(ctx context.Context, stage string, files int) {
+	if fn, ok := ctx.Value(progressKey{}).(Progress); ok && fn != nil {
+		fn(stage, files)
+	}
+}
@@ -0,0 +1,154 @@
+package scanner
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"codemap/config"
+)
+
+// RuleViolation is a single import that breaks an architecture rule
+type RuleViolation struct {
+	Rule   string `json:"rule"`             // rule ID (name or "from->to")
+	Kind   string `json:"kind"`             // "deny" or "allow"
+	File   string `json:"file"`             // importing file
+	Line   int    `json:"line,omitempty"`   // 1-based line of the import (0 if unknown)
+	Target string `json:"target"`           // imported file
+	Reason string `json:"reason,omitempty"` // human explanation from the config
+}
+
+// CheckRules evaluates dependency rules against the resolved file graph.
+// An edge violates a deny rule when both ends match it. A file matched by the
+// "from" side of any allow rule may only import targets matched by one of
+// those rules' "to" side. Results are sorted by file, line and target.
+func CheckRules(fg *FileGraph, rules config.Rules) []RuleViolation {
+	var violations []RuleViolation
+
+	var files []string
+	for file := range fg.Imports {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		from := filepath.ToSlash(file)
+
+		// Allow rules that apply to this file (whitelist mode)
+		var allows []config.DepRule
+		for _, r := range rules.Allow {
+			if matchesRulePattern(rules.Layers, r.From, from) {
+				allows = append(allows, r)
+			}
+		}
+
+		for _, target := range fg.Imports[file] {
+			to := filepath.ToSlash(target)
+			line := fg.ImportLine(file, target)
+
+			denied := false
+			for _, r := range rules.Deny {
+				if matchesRulePattern(rules.Layers, r.From, from) && matchesRulePattern(rules.Layers, r.To, to) {
+					violations = append(violations, RuleViolation{
+						Rule:   r.ID(),
+						Kind:   "deny",
+						File:   file,
+						Line:   line,
+						Target: target,
+						Reason: r.Reason,
+					})
+					denied = true
+				}
+			}
+			if denied || len(allows) == 0 {
+				continue
+			}
+
+			allowed := false
+			for _, r := range allows {
+				if matchesRulePattern(rules.Layers, r.To, to) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				violations = append(violations, RuleViolation{
+					Rule:   allows[0].ID(),
+					Kind:   "allow",
+					File:   file,
+					Line:   line,
+					Target: target,
+					Reason: allows[0].Reason,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		a, b := violations[i], violations[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Target < b.Target
+	})
+	return violations
+}
+
+// matchesRulePattern resolves a rule pattern (layer name or glob) against a slash path
+func matchesRulePattern(layers map[string][]string, pattern, relPath string) bool {
+	if globs, ok := layers[pattern]; ok {
+		for _, g := range globs {
+			if MatchGlob(g, relPath) {
+				return true
+			}
+		}
+		return false
+	}
+	return MatchGlob(pattern, relPath)
+}
+
+// MatchGlob matches a slash-separated path against a glob where "**" spans
+// any number of directories. A pattern without wildcards also matches
+// everything beneath it, so "render" matches "render/tree.go".
+func MatchGlob(pattern, relPath string) bool {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		return relPath == pattern || strings.HasPrefix(relPath, pattern+"/")
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+// matchSegments does segment-wise glob matching with ** support
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse consecutive ** and try every possible split
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
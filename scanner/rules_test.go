@@ -0,0 +1,122 @@
+package scanner
+
+import (
+	"testing"
+
+	"codemap/config"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"render", "render/tree.go", true},
+		{"render", "render", true},
+		{"render", "renderer/tree.go", false},
+		{"render/", "render/tree.go", true},
+		{"domain/**", "domain/user/model.go", true},
+		{"domain/**", "infra/db.go", false},
+		{"**/*.go", "a/b/c.go", true},
+		{"**/*.go", "c.go", true},
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/hooks.go", false},
+		{"src/**/api/*.ts", "src/api/user.ts", true},
+		{"src/**/api/*.ts", "src/v1/v2/api/user.ts", true},
+		{"src/**/api/*.ts", "src/v1/api/nested/user.ts", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func testRuleGraph() *FileGraph {
+	fg := &FileGraph{
+		Imports: map[string][]string{
+			"render/tree.go":       {"scanner/types.go", "mcp/main.go"},
+			"domain/user.go":       {"domain/id.go", "infra/db.go"},
+			"domain/id.go":         {"scanner/types.go"},
+			"infra/db.go":          {"domain/user.go"},
+			"scanner/walker.go":    {"scanner/types.go"},
+			"scanner/filegraph.go": {"scanner/types.go"},
+		},
+		ImportLines: map[string]map[string]int{
+			"render/tree.go": {"mcp/main.go": 12},
+		},
+	}
+	return fg
+}
+
+func TestCheckRulesDeny(t *testing.T) {
+	rules := config.Rules{
+		Deny: []config.DepRule{{From: "render", To: "mcp", Reason: "render is a library"}},
+	}
+
+	violations := CheckRules(testRuleGraph(), rules)
+	if len(violations) != 1 {
+		t.Fatalf("expected 1 violation, got %d: %+v", len(violations), violations)
+	}
+	v := violations[0]
+	if v.File != "render/tree.go" || v.Target != "mcp/main.go" {
+		t.Errorf("unexpected violation edge: %+v", v)
+	}
+	if v.Line != 12 {
+		t.Errorf("expected line 12, got %d", v.Line)
+	}
+	if v.Rule != "render->mcp" || v.Kind != "deny" || v.Reason != "render is a library" {
+		t.Errorf("unexpected violation metadata: %+v", v)
+	}
+}
+
+func TestCheckRulesLayers(t *testing.T) {
+	rules := config.Rules{
+		Layers: map[string][]string{
+			"domain": {"domain/**"},
+			"infra":  {"infra/**"},
+		},
+		Deny: []config.DepRule{{Name: "domain-is-pure", From: "domain", To: "infra"}},
+	}
+
+	violations := CheckRules(testRuleGraph(), rules)
+	if len(violations) != 1 {
+		t.Fatalf("expected 1 violation, got %d: %+v", len(violations), violations)
+	}
+	if violations[0].File != "domain/user.go" || violations[0].Rule != "domain-is-pure" {
+		t.Errorf("unexpected violation: %+v", violations[0])
+	}
+}
+
+func TestCheckRulesAllowWhitelist(t *testing.T) {
+	rules := config.Rules{
+		Allow: []config.DepRule{
+			{From: "domain/**", To: "domain/**"},
+		},
+	}
+
+	violations := CheckRules(testRuleGraph(), rules)
+	// domain/user.go -> infra/db.go and domain/id.go -> scanner/types.go are not whitelisted
+	if len(violations) != 2 {
+		t.Fatalf("expected 2 violations, got %d: %+v", len(violations), violations)
+	}
+	for _, v := range violations {
+		if v.Kind != "allow" {
+			t.Errorf("expected allow violation, got %+v", v)
+		}
+	}
+	if violations[0].File != "domain/id.go" || violations[1].File != "domain/user.go" {
+		t.Errorf("violations should be sorted by file: %+v", violations)
+	}
+}
+
+func TestCheckRulesClean(t *testing.T) {
+	rules := config.Rules{
+		Deny: []config.DepRule{{From: "scanner", To: "render"}},
+	}
+	if violations := CheckRules(testRuleGraph(), rules); len(violations) != 0 {
+		t.Errorf("expected no violations, got %+v", violations)
+	}
+}
@@ -2,7 +2,10 @@ package scanner
 
 import (
 	"path/filepath"
+	"slices"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // FileInfo represents a single file in the codebase.
@@ -44,6 +47,9 @@ type FileAnalysis struct {
 	Fields     []string `json:"fields,omitempty"`     // class/struct fields (TS/JS)
 	Properties []string `json:"properties,omitempty"` // interface properties (TS)
 	Decorators []string `json:"decorators,omitempty"` // decorators (TS)
+	// ImportLines maps each raw import to the 1-based line where it first
+	// appears, for check to point at; not part of the --deps output
+	ImportLines map[string]int `json:"-"`
 }
 
 // DepsProject is the JSON output for --deps mode.
@@ -168,6 +174,32 @@ type Symbol struct {
 	Signature string     `json:"signature,omitempty"` // e.g., "(x: number): string"
 }
 
+// IsExported reports whether the symbol is visible outside its file or package,
+// following the conventions of lang. Languages without a known convention
+// treat every non-private symbol as exported.
+func (s Symbol) IsExported(lang string) bool {
+	if s.Name == "" {
+		return false
+	}
+	switch lang {
+	case "go":
+		r, _ := utf8.DecodeRuneInString(s.Name)
+		return unicode.IsUpper(r)
+	case "python":
+		return !strings.HasPrefix(s.Name, "_")
+	case "typescript", "javascript":
+		if s.Scope != "" && s.Scope != "global" {
+			// Class members are public unless marked otherwise
+			return !slices.Contains(s.Modifiers, "private") &&
+				!slices.Contains(s.Modifiers, "protected") &&
+				!strings.HasPrefix(s.Name, "#")
+		}
+		return slices.Contains(s.Modifiers, "export")
+	default:
+		return !slices.Contains(s.Modifiers, "private")
+	}
+}
+
 // SymbolAnalysis holds rich symbol data with scopes and metadata
 type SymbolAnalysis struct {
 	Path     string   `json:"path"`
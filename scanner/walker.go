@@ -2,6 +2,7 @@ package scanner
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -64,6 +65,13 @@ func (c *GitIgnoreCache) tryLoadGitignore(dir string) {
 	}
 }
 
+// EnterDir loads the .gitignore of dir, if any, and reports whether dir
+// itself is ignored. Walkers call it before descending into a directory.
+func (c *GitIgnoreCache) EnterDir(absDir string) bool {
+	c.tryLoadGitignore(absDir)
+	return c.ShouldIgnore(absDir)
+}
+
 // ShouldIgnore checks if a path should be ignored based on all applicable .gitignore files.
 // Git evaluates rules from root to leaf, with later rules overriding earlier ones.
 func (c *GitIgnoreCache) ShouldIgnore(absPath string) bool {
@@ -101,6 +109,7 @@ func (c *GitIgnoreCache) ShouldIgnore(absPath string) bool {
 // IgnoredDirs are directories to skip during scanning
 var IgnoredDirs = map[string]bool{
 	".git":           true,
+	".codemap":       true, // codemap's own config and watch state
 	"node_modules":   true,
 	"vendor":         true,
 	"Pods":           true,
@@ -129,11 +138,11 @@ var IgnoredDirs = map[string]bool{
 	"grammars":       true,
 }
 
-// matchesPattern does smart pattern matching:
+// MatchesPattern does smart pattern matching of a path relative to the root:
 // - ".png" or "png" → extension match (case-insensitive)
 // - "Fonts" → directory/component match (contains /Fonts/ or ends with /Fonts)
 // - "*test*" → glob pattern (only if contains * or ?)
-func matchesPattern(relPath string, pattern string) bool {
+func MatchesPattern(relPath string, pattern string) bool {
 	// If pattern contains glob characters, use glob matching
 	if strings.ContainsAny(pattern, "*?") {
 		// Match against filename
@@ -185,7 +194,7 @@ func shouldIncludeFile(relPath string, ext string, only []string, exclude []stri
 	// If --exclude specified, check against each pattern
 	for _, pattern := range exclude {
 		pattern = strings.TrimSpace(pattern)
-		if pattern != "" && matchesPattern(relPath, pattern) {
+		if pattern != "" && MatchesPattern(relPath, pattern) {
 			return false
 		}
 	}
@@ -211,7 +220,7 @@ func LoadGitignore(root string) *ignore.GitIgnore {
 // Supports nested .gitignore files via GitIgnoreCache.
 // only: list of extensions to include (empty = all)
 // exclude: list of patterns to exclude
-func ScanFiles(root string, cache *GitIgnoreCache, only []string, exclude []string) ([]FileInfo, error) {
+func ScanFiles(ctx context.Context, root string, cache *GitIgnoreCache, only []string, exclude []string) ([]FileInfo, error) {
 	var files []FileInfo
 	absRoot, _ := filepath.Abs(root)
 
@@ -219,6 +228,9 @@ func ScanFiles(root string, cache *GitIgnoreCache, only []string, exclude []stri
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		name := info.Name()
 
@@ -235,18 +247,15 @@ func ScanFiles(root string, cache *GitIgnoreCache, only []string, exclude []stri
 
 		// For directories: load any .gitignore, then check if dir itself should be skipped
 		if info.IsDir() {
-			if cache != nil {
-				cache.tryLoadGitignore(absPath)
-				if cache.ShouldIgnore(absPath) {
-					return filepath.SkipDir
-				}
+			if cache != nil && cache.EnterDir(absPath) {
+				return filepath.SkipDir
 			}
 			// Check if directory matches any exclude pattern
 			relPath, _ := filepath.Rel(absRoot, absPath)
 			if relPath != "." {
 				for _, pattern := range exclude {
 					pattern = strings.TrimSpace(pattern)
-					if pattern != "" && matchesPattern(relPath, pattern) {
+					if pattern != "" && MatchesPattern(relPath, pattern) {
 						return filepath.SkipDir
 					}
 				}
@@ -272,6 +281,7 @@ func ScanFiles(root string, cache *GitIgnoreCache, only []string, exclude []stri
 			Size: info.Size(),
 			Ext:  ext,
 		})
+		reportProgress(ctx, StageWalk, len(files))
 
 		return nil
 	})
@@ -280,7 +290,7 @@ func ScanFiles(root string, cache *GitIgnoreCache, only []string, exclude []stri
 }
 
 // ScanForDeps uses ast-grep for batched dependency analysis.
-func ScanForDeps(root string) ([]FileAnalysis, error) {
+func ScanForDeps(ctx context.Context, root string) ([]FileAnalysis, error) {
 	scanner, err := NewAstGrepScanner()
 	if err != nil {
 		return nil, err
@@ -291,5 +301,5 @@ func ScanForDeps(root string) ([]FileAnalysis, error) {
 		return nil, fmt.Errorf("ast-grep not found in PATH (tried 'sg' and 'ast-grep')")
 	}
 
-	return scanner.ScanDirectory(root)
+	return scanner.ScanDirectory(ctx, root)
 }
@@ -1,8 +1,11 @@
 package scanner
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -55,7 +58,7 @@ func TestScanFiles(t *testing.T) {
 	}
 
 	// Scan the directory
-	result, err := ScanFiles(tmpDir, nil, nil, nil)
+	result, err := ScanFiles(context.Background(), tmpDir, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("ScanFiles failed: %v", err)
 	}
@@ -86,7 +89,7 @@ func TestScanFilesIgnoresDirs(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result, err := ScanFiles(tmpDir, nil, nil, nil)
+	result, err := ScanFiles(context.Background(), tmpDir, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("ScanFiles failed: %v", err)
 	}
@@ -120,7 +123,7 @@ func TestScanFilesExtensions(t *testing.T) {
 		}
 	}
 
-	result, err := ScanFiles(tmpDir, nil, nil, nil)
+	result, err := ScanFiles(context.Background(), tmpDir, nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -291,7 +294,7 @@ func TestNestedGitignore(t *testing.T) {
 
 	// Scan with GitIgnoreCache
 	cache := NewGitIgnoreCache(tmpDir)
-	files, err := ScanFiles(tmpDir, cache, nil, nil)
+	files, err := ScanFiles(context.Background(), tmpDir, cache, nil, nil)
 	if err != nil {
 		t.Fatalf("ScanFiles failed: %v", err)
 	}
@@ -334,7 +337,7 @@ func TestGitIgnoreCacheNil(t *testing.T) {
 	}
 
 	// Scan without gitignore cache
-	files, err := ScanFiles(tmpDir, nil, nil, nil)
+	files, err := ScanFiles(context.Background(), tmpDir, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("ScanFiles failed: %v", err)
 	}
@@ -432,7 +435,7 @@ func TestNestedGitignoreMonorepo(t *testing.T) {
 
 	// Scan with GitIgnoreCache
 	cache := NewGitIgnoreCache(tmpDir)
-	files, err := ScanFiles(tmpDir, cache, nil, nil)
+	files, err := ScanFiles(context.Background(), tmpDir, cache, nil, nil)
 	if err != nil {
 		t.Fatalf("ScanFiles failed: %v", err)
 	}
@@ -479,7 +482,7 @@ func TestNestedGitignoreUnignore(t *testing.T) {
 	os.WriteFile(filepath.Join(tmpDir, "sub", "other.log"), []byte("other"), 0644)
 
 	cache := NewGitIgnoreCache(tmpDir)
-	files, err := ScanFiles(tmpDir, cache, nil, nil)
+	files, err := ScanFiles(context.Background(), tmpDir, cache, nil, nil)
 	if err != nil {
 		t.Fatalf("ScanFiles failed: %v", err)
 	}
@@ -536,7 +539,7 @@ func TestNestedGitignoreDirectoryIgnore(t *testing.T) {
 	}
 
 	cache := NewGitIgnoreCache(tmpDir)
-	files, err := ScanFiles(tmpDir, cache, nil, nil)
+	files, err := ScanFiles(context.Background(), tmpDir, cache, nil, nil)
 	if err != nil {
 		t.Fatalf("ScanFiles failed: %v", err)
 	}
@@ -564,3 +567,40 @@ func TestNestedGitignoreDirectoryIgnore(t *testing.T) {
 		t.Errorf("Expected 3 files, got %d: %v", len(files), foundPaths)
 	}
 }
+
+func TestScanFilesProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, f := range []string{"a.go", "b.go", "sub/c.go"} {
+		path := filepath.Join(tmpDir, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("package x"), 0644)
+	}
+
+	var counts []int
+	ctx := WithProgress(context.Background(), func(stage string, files int) {
+		if stage != StageWalk {
+			t.Errorf("Expected stage %q, got %q", StageWalk, stage)
+		}
+		counts = append(counts, files)
+	})
+	if _, err := ScanFiles(ctx, tmpDir, nil, nil, nil); err != nil {
+		t.Fatalf("ScanFiles failed: %v", err)
+	}
+
+	if want := []int{1, 2, 3}; !slices.Equal(counts, want) {
+		t.Errorf("Expected progress %v, got %v", want, counts)
+	}
+}
+
+func TestScanFilesCancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	files, err := ScanFiles(ctx, tmpDir, nil, nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got files=%v err=%v", files, err)
+	}
+}
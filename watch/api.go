@@ -0,0 +1,288 @@
+package watch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// maxSocketPath keeps socket paths under the sun_path limit (104 bytes on
+// macOS, 108 on Linux)
+const maxSocketPath = 100
+
+// SocketPath returns where the daemon for root serves its query API:
+// .codemap/watch.sock, or a file in the temp dir when that path is too long
+func SocketPath(root string) string {
+	path := filepath.Join(root, ".codemap", "watch.sock")
+	if len(path) <= maxSocketPath {
+		return path
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(os.TempDir(), "codemap-"+hex.EncodeToString(sum[:8])+".sock")
+}
+
+// Health is the daemon's heartbeat, answered by /health
+type Health struct {
+	PID       int         `json:"pid"`
+	Root      string      `json:"root"`
+	StartedAt time.Time   `json:"started_at"`
+	LastEvent time.Time   `json:"last_event,omitzero"`
+	Files     int         `json:"files"`
+	Events    int         `json:"events"`
+	HasDeps   bool        `json:"has_deps"`
+	Mode      string      `json:"mode"`             // ModeNotify, ModePolling or ModeMixed
+	Polled    []PolledDir `json:"polled,omitempty"` // subtrees checked every pollInterval
+	Triggers  int         `json:"triggers,omitempty"`
+	// Trigger commands that don't run until codemap watch trust
+	Untrusted int `json:"untrusted_triggers,omitempty"`
+	// Run by the supervisor, which watches several projects in one process
+	Supervised bool `json:"supervised,omitempty"`
+}
+
+// GraphInfo is the dependency graph answered by /graph
+type GraphInfo struct {
+	Hubs      []string            `json:"hubs"`
+	Importers map[string][]string `json:"importers"` // file -> files that import it
+	Imports   map[string][]string `json:"imports"`   // file -> files it imports
+}
+
+// FileContext is the dependency context of one file, answered by /context
+type FileContext struct {
+	Path      string   `json:"path"`
+	Imports   []string `json:"imports"`
+	Importers []string `json:"importers"`
+	IsHub     bool     `json:"is_hub"`
+}
+
+// Serve starts answering queries on SocketPath until Stop. It replaces a
+// socket left behind by a daemon that didn't shut down cleanly.
+func (d *Daemon) Serve() error {
+	path := SocketPath(d.root)
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", d.serveHealth)
+	mux.HandleFunc("GET /graph", d.serveGraph)
+	mux.HandleFunc("GET /hubs", d.serveHubs)
+	mux.HandleFunc("GET /importers", d.serveImporters)
+	mux.HandleFunc("GET /imports", d.serveImports)
+	mux.HandleFunc("GET /context", d.serveContext)
+	mux.HandleFunc("GET /events", d.serveEvents)
+	mux.HandleFunc("GET /events/stream", d.serveEventStream)
+	mux.HandleFunc("GET /session", d.serveSession)
+	mux.HandleFunc("POST /history", d.serveSnapshot)
+
+	d.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := d.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) && d.verbose {
+			fmt.Printf("[watch] Query API stopped: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// closeServer stops the query API and removes its socket
+func (d *Daemon) closeServer() {
+	if d.server == nil {
+		return
+	}
+	d.server.Close()
+	os.Remove(SocketPath(d.root))
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (d *Daemon) serveHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.health())
+}
+
+// health returns the daemon's heartbeat (thread-safe)
+func (d *Daemon) health() Health {
+	d.graph.mu.RLock()
+	h := Health{
+		PID:        os.Getpid(),
+		Root:       d.root,
+		StartedAt:  d.started,
+		Files:      len(d.graph.Files),
+		Events:     d.graph.Events.Len(),
+		HasDeps:    d.graph.HasDeps,
+		Mode:       d.poller.mode(d.root),
+		Polled:     d.poller.dirs(d.root),
+		Triggers:   d.triggers.count(),
+		Untrusted:  d.triggers.untrustedCount(),
+		Supervised: d.supervised,
+	}
+	if n := d.graph.Events.Len(); n > 0 {
+		h.LastEvent = d.graph.Events.At(n - 1).Time
+	}
+	d.graph.mu.RUnlock()
+	return h
+}
+
+func (d *Daemon) serveGraph(w http.ResponseWriter, r *http.Request) {
+	d.graph.mu.RLock()
+	defer d.graph.mu.RUnlock()
+
+	info := GraphInfo{}
+	if fg := d.graph.FileGraph; fg != nil {
+		info = GraphInfo{Hubs: fg.HubFiles(), Importers: fg.Importers, Imports: fg.Imports}
+	}
+	writeJSON(w, info)
+}
+
+func (d *Daemon) serveHubs(w http.ResponseWriter, r *http.Request) {
+	d.graph.mu.RLock()
+	defer d.graph.mu.RUnlock()
+
+	hubs := []string{}
+	if fg := d.graph.FileGraph; fg != nil {
+		hubs = append(hubs, fg.HubFiles()...)
+	}
+	writeJSON(w, hubs)
+}
+
+func (d *Daemon) serveImporters(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.fileContext(r.URL.Query().Get("file")).Importers)
+}
+
+func (d *Daemon) serveImports(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.fileContext(r.URL.Query().Get("file")).Imports)
+}
+
+func (d *Daemon) serveContext(w http.ResponseWriter, r *http.Request) {
+	file := r.URL.Query().Get("file")
+	if file == "" {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, d.fileContext(file))
+}
+
+// fileContext looks up a file's dependencies in the graph (thread-safe)
+func (d *Daemon) fileContext(file string) FileContext {
+	d.graph.mu.RLock()
+	defer d.graph.mu.RUnlock()
+
+	fc := FileContext{Path: file, Imports: []string{}, Importers: []string{}}
+	if fg := d.graph.FileGraph; fg != nil {
+		fc.Imports = append(fc.Imports, fg.Imports[file]...)
+		fc.Importers = append(fc.Importers, fg.Importers[file]...)
+		fc.IsHub = fg.IsHub(file)
+	}
+	return fc
+}
+
+// serveEvents answers recent events, oldest first. since (RFC 3339) drops
+// older events and limit keeps only the newest ones.
+func (d *Daemon) serveEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var since time.Time
+	if s := q.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	limit := 0
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	events := []Event{}
+	for _, e := range d.GetEvents(0) {
+		if !e.Time.Before(since) {
+			events = append(events, e)
+		}
+	}
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	writeJSON(w, events)
+}
+
+// serveEventStream sends each event as a JSON line as soon as it is
+// recorded, until the client disconnects or the daemon stops
+func (d *Daemon) serveEventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	events, unsubscribe := d.subscribe()
+	defer unsubscribe()
+
+	// Send the headers now, so the client knows it is subscribed
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-d.done:
+			return
+		}
+	}
+}
+
+func (d *Daemon) serveSession(w http.ResponseWriter, r *http.Request) {
+	s := d.Session()
+	if s == nil {
+		http.Error(w, "no session", http.StatusNotFound)
+		return
+	}
+	s.Active = true
+	writeJSON(w, s)
+}
+
+// serveSnapshot records a file's current content in the history before a
+// restore replaces it, so only the daemon numbers versions while it runs
+func (d *Daemon) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	file := r.URL.Query().Get("file")
+	if !filepath.IsLocal(file) {
+		http.Error(w, "invalid file", http.StatusBadRequest)
+		return
+	}
+	if d.history == nil || d.inMemory {
+		http.Error(w, ErrHistoryDisabled.Error(), http.StatusConflict)
+		return
+	}
+	v, err := d.history.snapshot(file, "WRITE", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, v)
+}
@@ -0,0 +1,122 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// StartBackground forks "exe watch daemon root" as a detached background
+// daemon and returns its pid. exe is the codemap CLI. If the supervisor is
+// running, root is added to it instead and the supervisor's pid returned.
+// The daemon writes its pid file once the initial scan is done; use
+// WaitRunning to wait for that.
+func StartBackground(root, exe string) (int, error) {
+	if pid := SupervisorPID(); pid != 0 {
+		if err := NewSupervisorClient().Add(root); err != nil {
+			return 0, fmt.Errorf("adding to supervisor: %w", err)
+		}
+		return pid, nil
+	}
+	return startDetached(DaemonLogPath(root), exe, "watch", "daemon", root)
+}
+
+// StartSupervisor forks "exe daemon" as the detached background supervisor
+// and waits until it answers, or ctx is done
+func StartSupervisor(ctx context.Context, exe string) (int, error) {
+	logPath, err := SupervisorLogPath()
+	if err != nil {
+		return 0, err
+	}
+	pid, err := startDetached(logPath, exe, "daemon")
+	if err != nil {
+		return 0, err
+	}
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for SupervisorPID() == 0 {
+		if !processAlive(pid) {
+			return pid, fmt.Errorf("supervisor (pid %d) exited; see %s", pid, logPath)
+		}
+		select {
+		case <-ctx.Done():
+			return pid, fmt.Errorf("supervisor (pid %d) did not start: %w", pid, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return pid, nil
+}
+
+// startDetached starts exe with args, detached from this process, with
+// its output appended to logPath
+func startDetached(logPath, exe string, args ...string) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return 0, err
+	}
+	if info, err := os.Stat(logPath); err == nil && info.Size() >= daemonLogSize {
+		os.Rename(logPath, rotatedLog(logPath, 1))
+	}
+	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("opening daemon log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.Stdin = nil
+	// Detach from parent process group (Unix only)
+	setSysProcAttr(cmd)
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("starting daemon: %w", err)
+	}
+	// Reap the daemon if it exits while we're still running, so a long-lived
+	// parent (the MCP server) doesn't leave a zombie that looks alive
+	go cmd.Wait()
+	return cmd.Process.Pid, nil
+}
+
+// WaitStarted waits until the daemon with pid, just started by
+// StartBackground, holds the project's lock (its initial scan is running).
+// Returns ErrAlreadyRunning if it exited because another daemon got there
+// first, or another error if it exited for some other reason.
+func WaitStarted(ctx context.Context, root string, pid int) error {
+	lockPath := LockPath(root)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if held, _ := lockHeld(lockPath); held && lockOwner(lockPath) == pid {
+			return nil
+		}
+		if !processAlive(pid) {
+			if held, _ := lockHeld(lockPath); held {
+				return fmt.Errorf("%w (pid %d)", ErrAlreadyRunning, lockOwner(lockPath))
+			}
+			return fmt.Errorf("daemon (pid %d) exited; see %s", pid, DaemonLogPath(root))
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("daemon (pid %d) did not start: %w", pid, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitRunning polls until the daemon for root is running, returning false
+// if ctx is done first
+func WaitRunning(ctx context.Context, root string) bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for !IsRunning(root) {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
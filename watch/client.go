@@ -0,0 +1,261 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clientTimeout bounds each query; hooks run on every prompt and edit, so a
+// stuck daemon must not stall them
+const clientTimeout = 500 * time.Millisecond
+
+// Client queries a running daemon's API over its Unix socket. Every method
+// returns an error when no daemon answers, so callers can fall back to
+// ReadState or a fresh scan.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a client for the daemon watching root
+func NewClient(root string) *Client {
+	return &Client{http: socketClient(SocketPath(root), clientTimeout)}
+}
+
+// socketClient returns an HTTP client that talks to a Unix socket
+func socketClient(socket string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+// get decodes the JSON answer to a query into v
+func (c *Client) get(path string, query url.Values, v any) error {
+	u := url.URL{Scheme: "http", Host: "codemap", Path: path, RawQuery: query.Encode()}
+	resp, err := c.http.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("daemon query %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Health returns the daemon's heartbeat
+func (c *Client) Health() (*Health, error) {
+	var h Health
+	if err := c.get("/health", nil, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Graph returns the daemon's dependency graph
+func (c *Client) Graph() (*GraphInfo, error) {
+	var g GraphInfo
+	if err := c.get("/graph", nil, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Hubs returns files imported by 3+ others
+func (c *Client) Hubs() ([]string, error) {
+	var hubs []string
+	err := c.get("/hubs", nil, &hubs)
+	return hubs, err
+}
+
+// Importers returns the files that import file
+func (c *Client) Importers(file string) ([]string, error) {
+	var importers []string
+	err := c.get("/importers", url.Values{"file": {file}}, &importers)
+	return importers, err
+}
+
+// Imports returns the files that file imports
+func (c *Client) Imports(file string) ([]string, error) {
+	var imports []string
+	err := c.get("/imports", url.Values{"file": {file}}, &imports)
+	return imports, err
+}
+
+// FileContext returns the imports, importers and hub status of file
+func (c *Client) FileContext(file string) (*FileContext, error) {
+	var fc FileContext
+	if err := c.get("/context", url.Values{"file": {file}}, &fc); err != nil {
+		return nil, err
+	}
+	return &fc, nil
+}
+
+// Events returns the events recorded at or after since, oldest first.
+// A positive limit keeps only the newest ones.
+func (c *Client) Events(since time.Time, limit int) ([]Event, error) {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339Nano))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var events []Event
+	err := c.get("/events", query, &events)
+	return events, err
+}
+
+// EventStream is a live feed of a daemon's events, from Client.Subscribe
+type EventStream struct {
+	body   io.ReadCloser
+	dec    *json.Decoder
+	cancel context.CancelFunc
+}
+
+// Subscribe opens a stream of the events the daemon records from now on.
+// It fails if no daemon answers; the stream then lasts until ctx is done,
+// the daemon stops or Close is called.
+func (c *Client) Subscribe(ctx context.Context) (*EventStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://codemap/events/stream", nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Only connecting is bounded by clientTimeout; the stream itself has no
+	// deadline, so it gets a client without one
+	timer := time.AfterFunc(clientTimeout, cancel)
+	resp, err := (&http.Client{Transport: c.http.Transport}).Do(req)
+	if !timer.Stop() && err == nil {
+		resp.Body.Close()
+		err = context.DeadlineExceeded
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("daemon query /events/stream: %s", resp.Status)
+	}
+	return &EventStream{body: resp.Body, dec: json.NewDecoder(resp.Body), cancel: cancel}, nil
+}
+
+// Next blocks until the daemon records an event. Once the stream has ended
+// it returns an error.
+func (s *EventStream) Next() (Event, error) {
+	var e Event
+	err := s.dec.Decode(&e)
+	return e, err
+}
+
+// Close ends the stream
+func (s *EventStream) Close() error {
+	s.cancel()
+	return s.body.Close()
+}
+
+// Session returns the daemon's current session
+func (c *Client) Session() (*Session, error) {
+	var s Session
+	if err := c.get("/session", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Snapshot asks the daemon to record file's current content in its
+// history and returns the version holding it
+func (c *Client) Snapshot(file string) (Version, error) {
+	u := url.URL{Scheme: "http", Host: "codemap", Path: "/history", RawQuery: url.Values{"file": {file}}.Encode()}
+	resp, err := c.http.Post(u.String(), "", nil)
+	if err != nil {
+		return Version{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		return Version{}, ErrHistoryDisabled
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return Version{}, fmt.Errorf("daemon snapshot: %s", strings.TrimSpace(string(msg)))
+	}
+	var v Version
+	err = json.NewDecoder(resp.Body).Decode(&v)
+	return v, err
+}
+
+// SupervisorClient manages the projects of the running supervisor
+type SupervisorClient struct {
+	http *http.Client
+	err  error // no socket path
+}
+
+// NewSupervisorClient returns a client for the user's supervisor
+func NewSupervisorClient() *SupervisorClient {
+	socket, err := supervisorSocket()
+	return &SupervisorClient{http: socketClient(socket, 5*time.Second), err: err}
+}
+
+// do sends a request about root and decodes the JSON answer into v, if
+// v is not nil
+func (c *SupervisorClient) do(method, root string, v any) error {
+	if c.err != nil {
+		return c.err
+	}
+	u := url.URL{Scheme: "http", Host: "codemap", Path: "/projects"}
+	if root != "" {
+		u.RawQuery = url.Values{"root": {root}}.Encode()
+	}
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s", strings.TrimSpace(string(msg)))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Projects returns the status of the supervisor's projects
+func (c *SupervisorClient) Projects() ([]Project, error) {
+	var projects []Project
+	err := c.do(http.MethodGet, "", &projects)
+	return projects, err
+}
+
+// Add registers root with the supervisor and starts watching it in the
+// background
+func (c *SupervisorClient) Add(root string) error {
+	return c.do(http.MethodPost, root, nil)
+}
+
+// Remove stops watching root and unregisters it
+func (c *SupervisorClient) Remove(root string) error {
+	return c.do(http.MethodDelete, root, nil)
+}
@@ -2,12 +2,19 @@
 package watch
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"codemap/config"
 	"codemap/scanner"
 
 	"github.com/fsnotify/fsnotify"
@@ -15,13 +22,38 @@ import (
 
 // Daemon is the watch daemon that keeps the graph updated
 type Daemon struct {
-	root     string
-	graph    *Graph
-	watcher  *fsnotify.Watcher
-	gitCache *scanner.GitIgnoreCache
-	eventLog string // path to event log file
-	verbose  bool
-	done     chan struct{}
+	root       string
+	graph      *Graph
+	watcher    *fsnotify.Watcher
+	gitCache   *scanner.GitIgnoreCache // guarded by gitMu, as poll walks run off the event loop
+	gitMu      sync.Mutex
+	include    []string                // extra file patterns to track (config)
+	exclude    []string                // file and directory patterns to skip (config)
+	sg         *scanner.AstGrepScanner // for symbol diffs; nil without ast-grep
+	git        *gitWatch               // nil outside git repositories
+	poller     *poller                 // subtrees fsnotify can't watch
+	triggers   *triggers               // configured actions; nil if there are none
+	history    *history                // local history of tracked files; nil if disabled
+	log        *eventLog
+	verbose    bool
+	inMemory   bool     // skip .codemap/ state and event log files
+	supervised bool     // run by a Supervisor rather than its own process
+	lock       *os.File // held while watching (LockPath); nil for in-memory daemons
+	done       chan struct{}
+	started    time.Time    // when Start was called
+	server     *http.Server // query API, if Serve was called
+
+	stateMu    sync.Mutex
+	stateTimer *time.Timer // pending batched state.json write
+
+	pendingMoves []pendingMove // renames awaiting their create, oldest first; guarded by graph.mu
+
+	session   *Session   // guarded by graph.mu; nil for in-memory daemons
+	sessionMu sync.Mutex // serializes session saves
+
+	listenersMu sync.Mutex
+	listeners   []func(Event)           // called after each recorded event
+	streams     map[chan Event]struct{} // event stream subscribers (subscribe)
 }
 
 // NewDaemon creates a new watch daemon for the given root
@@ -31,6 +63,11 @@ func NewDaemon(root string, verbose bool) (*Daemon, error) {
 		return nil, fmt.Errorf("invalid root path: %w", err)
 	}
 
+	cfg, err := config.Load(absRoot)
+	if err != nil {
+		return nil, err
+	}
+
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create watcher: %w", err)
@@ -48,15 +85,21 @@ func NewDaemon(root string, verbose bool) (*Daemon, error) {
 		root:     absRoot,
 		watcher:  watcher,
 		gitCache: gitCache,
+		include:  cfg.Watch.Include,
+		exclude:  cfg.Watch.Exclude,
 		verbose:  verbose,
 		done:     make(chan struct{}),
-		eventLog: filepath.Join(absRoot, ".codemap", "events.log"),
+		log:      newEventLog(EventLogPath(absRoot)),
+		poller:   newPoller(),
+		triggers: newTriggers(absRoot, cfg.Watch, verbose),
+		history:  newHistory(absRoot, cfg.Watch.History, verbose),
 		graph: &Graph{
 			Root:      absRoot,
 			Files:     make(map[string]*scanner.FileInfo),
 			DepCtx:    make(map[string]*DepContext),
 			State:     make(map[string]*FileState),
-			Events:    make([]Event, 0),
+			Symbols:   make(map[string][]scanner.Symbol),
+			Events:    NewEventRing(eventBufferSize),
 			IsGitRepo: isGitRepo,
 		},
 	}
@@ -64,29 +107,84 @@ func NewDaemon(root string, verbose bool) (*Daemon, error) {
 	return d, nil
 }
 
+// SetInMemory keeps events and state in memory only, without writing
+// .codemap/ files into the project, keeping history or running triggers.
+// Must be called before Start.
+func (d *Daemon) SetInMemory(inMemory bool) {
+	d.inMemory = inMemory
+}
+
 // Start begins watching and returns immediately
 func (d *Daemon) Start() error {
+	return d.StartContext(context.Background())
+}
+
+// StartContext is like Start, but ctx can cancel the initial scan and carry
+// a scanner.Progress callback. The daemon keeps running after ctx is done.
+// Returns ErrAlreadyRunning if another daemon watches the project.
+func (d *Daemon) StartContext(ctx context.Context) (err error) {
+	d.started = time.Now()
+
 	// Ensure .codemap directory exists
-	codemapDir := filepath.Join(d.root, ".codemap")
-	if err := os.MkdirAll(codemapDir, 0755); err != nil {
-		return fmt.Errorf("failed to create .codemap dir: %w", err)
+	if !d.inMemory {
+		codemapDir := filepath.Join(d.root, ".codemap")
+		if err := os.MkdirAll(codemapDir, 0755); err != nil {
+			return fmt.Errorf("failed to create .codemap dir: %w", err)
+		}
+		if err := d.acquireLock(); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				d.releaseLock()
+			}
+		}()
+		if err := d.log.migrate(); err != nil && d.verbose {
+			fmt.Printf("[watch] Converting events.log: %v\n", err)
+		}
+		d.log.prune()
+		pruneSessions(d.root)
+		d.session = newSession(d.root, d.graph.IsGitRepo)
+		if d.triggers != nil {
+			if n := d.triggers.untrusted; n > 0 {
+				d.triggers.logf("%d trigger action(s) in .codemap/config.json not run: review them, then run codemap watch trust", n)
+			}
+			d.OnEvent(d.triggers.handle)
+		}
+		if d.history != nil {
+			if err := d.history.load(); err != nil && d.verbose {
+				fmt.Printf("[watch] History: %v\n", err)
+			}
+			d.OnEvent(d.history.handle)
+		}
 	}
 
 	// Initial full scan
-	if err := d.fullScan(); err != nil {
+	if err := d.fullScan(ctx); err != nil {
 		return fmt.Errorf("initial scan failed: %w", err)
 	}
 
+	// Keep uncommitted work, so the first write to it can be undone
+	if !d.inMemory {
+		d.snapshotDirty()
+	}
+
 	// Compute dependency graph (best effort - don't fail if deps unavailable)
-	d.computeDeps()
+	d.computeDeps(ctx)
+	d.computeSymbols(ctx)
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("initial scan failed: %w", err)
+	}
 
 	// Add directories to watcher
 	if err := d.addWatchDirs(); err != nil {
 		return fmt.Errorf("failed to add watch dirs: %w", err)
 	}
+	d.watchGit()
 
 	// Write initial state for hooks to read immediately
 	d.writeState()
+	d.saveSession(false)
 
 	// Start event loop
 	go d.eventLoop()
@@ -98,6 +196,98 @@ func (d *Daemon) Start() error {
 func (d *Daemon) Stop() {
 	close(d.done)
 	d.watcher.Close()
+	d.expireMoves(true)
+	d.closeServer()
+	d.flushState()
+	d.saveSession(true)
+	d.triggers.stop()
+	if d.sg != nil {
+		d.sg.Close()
+	}
+	d.releaseLock()
+}
+
+// acquireLock takes the project's lock, failing if another daemon holds it
+func (d *Daemon) acquireLock() error {
+	path := LockPath(d.root)
+	lock, err := acquireLock(path)
+	if errors.Is(err, errLocked) {
+		if pid := lockOwner(path); pid != 0 {
+			return fmt.Errorf("%w (pid %d)", ErrAlreadyRunning, pid)
+		}
+		return ErrAlreadyRunning
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	d.lock = lock
+	return nil
+}
+
+// releaseLock removes the PID file, if it names this process, and then
+// releases the lock, so a new daemon never finds its PID file removed
+func (d *Daemon) releaseLock() {
+	if d.lock == nil {
+		return
+	}
+	if pid, err := ReadPID(d.root); err == nil && pid == os.Getpid() {
+		RemovePID(d.root)
+	}
+	d.lock.Close()
+	d.lock = nil
+}
+
+// OnEvent registers fn to be called after each recorded event.
+// Callbacks run on the event loop goroutine and should return quickly.
+func (d *Daemon) OnEvent(fn func(Event)) {
+	d.listenersMu.Lock()
+	defer d.listenersMu.Unlock()
+	d.listeners = append(d.listeners, fn)
+}
+
+// notify calls the registered event listeners
+func (d *Daemon) notify(e Event) {
+	d.listenersMu.Lock()
+	listeners := slices.Clone(d.listeners)
+	d.listenersMu.Unlock()
+
+	for _, fn := range listeners {
+		fn(e)
+	}
+
+	d.listenersMu.Lock()
+	defer d.listenersMu.Unlock()
+	for ch := range d.streams {
+		select {
+		case ch <- e:
+		default:
+			// Too far behind: end its stream rather than stall the event loop
+			delete(d.streams, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns a channel that receives each recorded event, and a
+// function that unsubscribes it. The channel is closed if its reader falls
+// streamBuffer events behind.
+func (d *Daemon) subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, streamBuffer)
+	d.listenersMu.Lock()
+	if d.streams == nil {
+		d.streams = make(map[chan Event]struct{})
+	}
+	d.streams[ch] = struct{}{}
+	d.listenersMu.Unlock()
+
+	return ch, func() {
+		d.listenersMu.Lock()
+		defer d.listenersMu.Unlock()
+		if _, ok := d.streams[ch]; ok {
+			delete(d.streams, ch)
+			close(ch)
+		}
+	}
 }
 
 // GetGraph returns the current graph (thread-safe)
@@ -110,15 +300,28 @@ func (d *Daemon) GetEvents(limit int) []Event {
 	d.graph.mu.RLock()
 	defer d.graph.mu.RUnlock()
 
-	events := d.graph.Events
-	if limit > 0 && len(events) > limit {
-		events = events[len(events)-limit:]
+	return d.graph.Events.Last(limit)
+}
+
+// Files returns a snapshot of the tracked files, sorted by path (thread-safe)
+func (d *Daemon) Files() []scanner.FileInfo {
+	d.graph.mu.RLock()
+	defer d.graph.mu.RUnlock()
+
+	files := make([]scanner.FileInfo, 0, len(d.graph.Files))
+	for _, f := range d.graph.Files {
+		files = append(files, *f)
 	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
 
-	// Return a copy
-	result := make([]Event, len(events))
-	copy(result, events)
-	return result
+// FileGraph returns the dependency graph computed at startup, or nil if
+// deps were unavailable (thread-safe)
+func (d *Daemon) FileGraph() *scanner.FileGraph {
+	d.graph.mu.RLock()
+	defer d.graph.mu.RUnlock()
+	return d.graph.FileGraph
 }
 
 // FileCount returns current tracked file count
@@ -128,16 +331,52 @@ func (d *Daemon) FileCount() int {
 	return len(d.graph.Files)
 }
 
+// Session returns a copy of the current session, or nil for in-memory
+// daemons (thread-safe)
+func (d *Daemon) Session() *Session {
+	d.graph.mu.RLock()
+	defer d.graph.mu.RUnlock()
+	if d.session == nil {
+		return nil
+	}
+	s := d.session.snapshot()
+	return &s
+}
+
+// saveSession writes the current session to .codemap/sessions/; end marks
+// it finished
+func (d *Daemon) saveSession(end bool) {
+	d.sessionMu.Lock()
+	defer d.sessionMu.Unlock()
+
+	d.graph.mu.Lock()
+	if d.session == nil {
+		d.graph.mu.Unlock()
+		return
+	}
+	if end {
+		d.session.End = time.Now()
+	}
+	s := d.session.snapshot()
+	d.graph.mu.Unlock()
+
+	if err := s.save(d.root); err != nil && d.verbose {
+		fmt.Printf("[watch] Session: %v\n", err)
+	}
+}
+
 // WriteInitialState writes state after initial scan (for hooks)
 func (d *Daemon) WriteInitialState() {
 	d.writeState()
 }
 
 // fullScan does a complete scan of the project
-func (d *Daemon) fullScan() error {
+func (d *Daemon) fullScan(ctx context.Context) error {
 	start := time.Now()
 
-	files, err := scanner.ScanFiles(d.root, d.gitCache, nil, nil)
+	d.gitMu.Lock()
+	files, err := scanner.ScanFiles(ctx, d.root, d.gitCache, nil, d.exclude)
+	d.gitMu.Unlock()
 	if err != nil {
 		return err
 	}
@@ -148,9 +387,15 @@ func (d *Daemon) fullScan() error {
 	for i := range files {
 		f := &files[i]
 		d.graph.Files[f.Path] = f
-		// Cache line count for delta calculations (fast: ~1ms per file)
-		if lines := countLines(filepath.Join(d.root, f.Path)); lines > 0 {
-			d.graph.State[f.Path] = &FileState{Lines: lines, Size: f.Size}
+		// Cache line count for delta calculations and the fingerprint
+		// for move detection (fast: ~1ms per file)
+		path := filepath.Join(d.root, f.Path)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if state := statFile(path, info); state.Lines > 0 {
+			d.graph.State[f.Path] = state
 		}
 	}
 	d.graph.LastScan = time.Now()
@@ -164,11 +409,11 @@ func (d *Daemon) fullScan() error {
 }
 
 // computeDeps builds the file-to-file dependency graph
-func (d *Daemon) computeDeps() {
+func (d *Daemon) computeDeps(ctx context.Context) {
 	start := time.Now()
 
 	// Build file graph (internal file-to-file dependencies)
-	fg, err := scanner.BuildFileGraph(d.root)
+	fg, err := scanner.BuildFileGraph(ctx, d.root)
 	if err != nil {
 		if d.verbose {
 			fmt.Printf("[watch] File graph unavailable: %v\n", err)
@@ -205,15 +450,44 @@ func (d *Daemon) addWatchDirs() error {
 		if err != nil {
 			return nil // skip errors
 		}
-
-		// Skip hidden directories and common ignores
-		name := info.Name()
-		if info.IsDir() {
-			if strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" {
-				return filepath.SkipDir
-			}
-			return d.watcher.Add(path)
+		if !info.IsDir() {
+			return nil
 		}
-		return nil
+		if path != d.root && !d.shouldWatchDir(path) {
+			return filepath.SkipDir
+		}
+		polled, err := d.addWatch(path)
+		if polled {
+			return filepath.SkipDir
+		}
+		return err
 	})
 }
+
+// shouldWatchDir reports whether a directory below the root is watched:
+// not hidden (.git, .codemap), not one of scanner.IgnoredDirs, not ignored
+// by .gitignore and not excluded by the config. Loads its .gitignore.
+func (d *Daemon) shouldWatchDir(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") || scanner.IgnoredDirs[name] {
+		return false
+	}
+	d.gitMu.Lock()
+	ignored := d.gitCache.EnterDir(path)
+	d.gitMu.Unlock()
+	if ignored {
+		return false
+	}
+	rel, err := filepath.Rel(d.root, path)
+	return err != nil || !matchesAny(filepath.ToSlash(rel), d.exclude)
+}
+
+// matchesAny reports whether relPath matches one of the patterns
+func matchesAny(relPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern = strings.TrimSpace(pattern); pattern != "" && scanner.MatchesPattern(relPath, pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package watch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event log limits. The log is rotated to events.jsonl.1, .2, ... when it
+// reaches logMaxSize, and rotated files past logMaxFiles or logMaxAge are
+// deleted.
+const (
+	logMaxSize  = 5 << 20 // 5 MB
+	logMaxFiles = 3
+	logMaxAge   = 7 * 24 * time.Hour
+	logMaxLine  = 1 << 20 // longer lines are skipped when reading
+)
+
+// EventLogPath returns the daemon's JSONL event log for root
+func EventLogPath(root string) string {
+	return filepath.Join(root, ".codemap", "events.jsonl")
+}
+
+// legacyLogFormat is the timestamp of the plain-text events.log that
+// daemons wrote before events.jsonl
+const legacyLogFormat = "2006-01-02 15:04:05"
+
+// eventLog appends events as JSON lines and rotates the file
+type eventLog struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	maxAge   time.Duration
+}
+
+func newEventLog(path string) *eventLog {
+	return &eventLog{path: path, maxSize: logMaxSize, maxFiles: logMaxFiles, maxAge: logMaxAge}
+}
+
+// append writes e as one line, rotating first if the log is full
+func (l *eventLog) append(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if info, err := os.Stat(l.path); err == nil && info.Size()+int64(len(data)) >= l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// rotate shifts events.jsonl to .1, .1 to .2 and so on, dropping the oldest.
+// Must be called with l.mu held.
+func (l *eventLog) rotate() error {
+	os.Remove(rotatedLog(l.path, l.maxFiles))
+	for i := l.maxFiles - 1; i >= 1; i-- {
+		os.Rename(rotatedLog(l.path, i), rotatedLog(l.path, i+1))
+	}
+	if err := os.Rename(l.path, rotatedLog(l.path, 1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// prune deletes rotated files older than maxAge, and rotates the current log
+// if it hasn't been written for that long, so old sessions age out
+func (l *eventLog) prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := time.Now().Add(-l.maxAge)
+	if info, err := os.Stat(l.path); err == nil && info.ModTime().Before(cutoff) {
+		l.rotate()
+	}
+	for i := 1; i <= l.maxFiles; i++ {
+		path := rotatedLog(l.path, i)
+		if info, err := os.Stat(path); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(path)
+		}
+	}
+}
+
+func rotatedLog(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// logFiles lists the log and its rotated files, oldest first
+func logFiles(path string, maxFiles int) []string {
+	var files []string
+	for i := maxFiles; i >= 1; i-- {
+		files = append(files, rotatedLog(path, i))
+	}
+	return append(files, path)
+}
+
+// ReadEvents reads the events a daemon logged for root at or after since,
+// oldest first, including rotated logs. Lines that don't parse, or are
+// longer than logMaxLine, are skipped.
+func ReadEvents(root string, since time.Time) ([]Event, error) {
+	var events []Event
+	for _, path := range logFiles(EventLogPath(root), logMaxFiles) {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = readLines(f, logMaxLine, func(line []byte) {
+			var e Event
+			if err := json.Unmarshal(line, &e); err == nil && !e.Time.Before(since) {
+				events = append(events, e)
+			}
+		})
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// readLines calls fn with each line of r up to max bytes long, skipping
+// longer ones instead of failing on them. fn must not keep the line.
+func readLines(r io.Reader, max int, fn func(line []byte)) error {
+	br := bufio.NewReader(r)
+	var line []byte
+	skip := false
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if len(line)+len(chunk) > max {
+			skip = true
+			line = line[:0]
+		}
+		if !skip {
+			line = append(line, chunk...)
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if len(line) > 0 {
+			fn(line)
+		}
+		line, skip = line[:0], false
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// migrate converts the plain-text events.log of older daemons into the
+// JSONL log and removes it. When the JSONL log already exists the old
+// events predate it, so they are dropped rather than logged out of order.
+// Must be called before the daemon logs anything.
+func (l *eventLog) migrate() error {
+	legacy := filepath.Join(filepath.Dir(l.path), "events.log")
+	f, err := os.Open(legacy)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer os.Remove(legacy)
+	defer f.Close()
+
+	for _, path := range logFiles(l.path, l.maxFiles) {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+	}
+
+	var data []byte
+	err = readLines(f, logMaxLine, func(line []byte) {
+		if e, ok := parseLegacyEvent(string(line)); ok {
+			if line, err := json.Marshal(e); err == nil {
+				data = append(append(data, line...), '\n')
+			}
+		}
+	})
+	if err != nil || len(data) == 0 {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// parseLegacyEvent parses an events.log line:
+// "time | OP | path | lines | delta | dirty"
+func parseLegacyEvent(line string) (Event, bool) {
+	fields := strings.Split(line, "|")
+	if len(fields) != 6 {
+		return Event{}, false
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	t, err := time.ParseInLocation(legacyLogFormat, fields[0], time.Local)
+	if err != nil || fields[1] == "" || fields[2] == "" {
+		return Event{}, false
+	}
+	e := Event{Time: t, Op: fields[1], Path: fields[2], Dirty: fields[5] == "dirty"}
+	e.Lines, _ = strconv.Atoi(fields[3])
+	if fields[4] != "" {
+		e.Delta, _ = strconv.Atoi(fields[4])
+	}
+	return e, true
+}
@@ -4,9 +4,12 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,48 +18,70 @@ import (
 	"github.com/fsnotify/fsnotify"
 )
 
+// debounceWindow drops repeats of an event on the same file (e.g., save +
+// format)
+const debounceWindow = 100 * time.Millisecond
+
 // eventLoop processes file system events
 func (d *Daemon) eventLoop() {
 	// Debounce rapid changes (e.g., save + format)
 	debounce := make(map[string]time.Time)
-	debounceWindow := 100 * time.Millisecond
+
+	// Fires when the oldest unpaired rename is due to be logged as is
+	var moveExpiry <-chan time.Time
+	// Fires when a git operation may have finished
+	var gitSettle <-chan time.Time
+	// Fires when polled subtrees are due to be checked
+	var pollTick <-chan time.Time
+	// Receives the walk of the polled subtrees; nil unless one is running
+	var pollDone chan pollWalk
 
 	for {
+		if pollTick == nil && pollDone == nil && d.poller.active() {
+			pollTick = time.After(pollInterval)
+		}
+
+		if moveExpiry == nil {
+			if wait, ok := d.nextMoveExpiry(); ok {
+				moveExpiry = time.After(wait)
+			}
+		}
+
 		select {
 		case <-d.done:
 			return
 
-		case event, ok := <-d.watcher.Events:
-			if !ok {
-				return
-			}
+		case <-moveExpiry:
+			moveExpiry = nil
+			d.expireMoves(false)
 
-			// Allow directory creates through (to add new dirs to watcher)
-			// but skip non-source files otherwise
-			isCreate := event.Op&fsnotify.Create != 0
-			if !d.isSourceFile(event.Name) {
-				// Check if it's a directory create - let those through
-				if isCreate {
-					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
-						// Directory create - let it through to handleEvent
-					} else {
-						continue
-					}
-				} else {
-					continue
-				}
+		case <-gitSettle:
+			gitSettle = nil
+			if !d.settleGit() {
+				gitSettle = time.After(gitSettleDelay)
 			}
 
-			// Debounce rapid events on same file
-			if last, exists := debounce[event.Name]; exists {
-				if time.Since(last) < debounceWindow {
-					continue
+		case <-pollTick:
+			// Walk off the loop, so a slow mount doesn't hold up fsnotify
+			pollTick = nil
+			pollDone = make(chan pollWalk, 1)
+			go func(done chan<- pollWalk) { done <- d.walkPolledRoots() }(pollDone)
+
+		case walk := <-pollDone:
+			pollDone = nil
+			for _, event := range d.pollChanges(walk) {
+				if d.dispatch(event, debounce) {
+					gitSettle = time.After(gitSettleDelay)
 				}
 			}
-			debounce[event.Name] = time.Now()
 
-			// Process the event
-			d.handleEvent(event)
+		case event, ok := <-d.watcher.Events:
+			if !ok {
+				return
+			}
+			if d.dispatch(event, debounce) {
+				gitSettle = time.After(gitSettleDelay)
+			}
 
 		case err, ok := <-d.watcher.Errors:
 			if !ok {
@@ -69,16 +94,97 @@ func (d *Daemon) eventLoop() {
 	}
 }
 
-// isSourceFile checks if a file should be tracked
-func (d *Daemon) isSourceFile(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".go", ".py", ".js", ".ts", ".tsx", ".jsx", ".rs", ".rb", ".java", ".swift", ".kt", ".c", ".cpp", ".h":
-		return true
+// dispatch routes one file system event, watched or polled. Returns whether
+// a git operation may have finished and should be settled.
+func (d *Daemon) dispatch(event fsnotify.Event, debounce map[string]time.Time) bool {
+	// Git operations are batched until they settle
+	if d.isGitPath(event.Name) {
+		return d.handleGitEvent(event)
+	}
+
+	// Re-read ignore rules when a .gitignore changes; newly
+	// ignored directories stay watched but their files are skipped
+	if filepath.Base(event.Name) == ".gitignore" {
+		gitCache := scanner.NewGitIgnoreCache(d.root)
+		d.gitMu.Lock()
+		d.gitCache = gitCache
+		d.gitMu.Unlock()
+		d.addWatchDirs()
+		return false
+	}
+
+	// Allow directory creates through (to add new dirs to watcher)
+	// but skip non-source files otherwise
+	isCreate := event.Op&fsnotify.Create != 0
+	if !d.isSourceFile(event.Name) {
+		// Check if it's a directory create - let those through
+		if !isCreate {
+			return false
+		}
+		if info, err := os.Stat(event.Name); err != nil || !info.IsDir() {
+			return false
+		}
 	}
+
+	// Hold file changes back while git is at work, but still
+	// watch new directories right away
+	if !isCreate || d.isSourceFile(event.Name) {
+		if d.holdForGit(event) {
+			return false
+		}
+	}
+
+	// Debounce rapid events on same file
+	if last, exists := debounce[event.Name]; exists {
+		if time.Since(last) < debounceWindow {
+			return false
+		}
+	}
+	debounce[event.Name] = time.Now()
+
+	// Process the event
+	d.handleEvent(event)
 	return false
 }
 
+// isSourceFile checks if a file should be tracked: a language codemap
+// knows, a configured include pattern or a trigger's path, and not ignored
+// or excluded
+func (d *Daemon) isSourceFile(path string) bool {
+	rel, err := filepath.Rel(d.root, path)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if scanner.DetectLanguage(path) == "" && !matchesAny(rel, d.include) && !d.triggers.tracks(rel) {
+		return false
+	}
+	// Files under directories that aren't watched, e.g. reached by a rename
+	dirs := strings.Split(rel, "/")
+	for _, dir := range dirs[:len(dirs)-1] {
+		if strings.HasPrefix(dir, ".") || scanner.IgnoredDirs[dir] {
+			return false
+		}
+	}
+	if matchesAny(rel, d.exclude) {
+		return false
+	}
+	d.gitMu.Lock()
+	defer d.gitMu.Unlock()
+	return !d.gitCache.ShouldIgnore(path)
+}
+
+// moveWindow is how long a rename waits for the create that completes it
+// before it is logged as a plain RENAME
+const moveWindow = 500 * time.Millisecond
+
+// pendingMove is a rename whose destination hasn't been seen yet
+type pendingMove struct {
+	event   Event            // the RENAME, with what the old path lost
+	state   *FileState       // the file before it moved; nil if untracked
+	symbols []scanner.Symbol // its functions and types
+}
+
 // handleEvent processes a single file event
 func (d *Daemon) handleEvent(fsEvent fsnotify.Event) {
 	relPath, err := filepath.Rel(d.root, fsEvent.Name)
@@ -108,6 +214,14 @@ func (d *Daemon) handleEvent(fsEvent fsnotify.Event) {
 		Language: scanner.DetectLanguage(relPath),
 	}
 
+	// Scan the file's functions and types to diff them below; ast-grep runs
+	// before taking the lock so queries aren't held up
+	var symbols []scanner.Symbol
+	scanned := false
+	if (op == "CREATE" || op == "WRITE") && d.isSourceFile(fsEvent.Name) {
+		symbols, scanned = d.scanFileSymbols(fsEvent.Name)
+	}
+
 	// Update graph and calculate deltas
 	d.graph.mu.Lock()
 	switch op {
@@ -120,30 +234,37 @@ func (d *Daemon) handleEvent(fsEvent fsnotify.Event) {
 
 		// If a new directory was created, add it to the watcher
 		if info.IsDir() {
-			name := filepath.Base(fsEvent.Name)
-			// Skip hidden directories and common ignores
-			if !strings.HasPrefix(name, ".") && name != "node_modules" && name != "vendor" {
-				d.watcher.Add(fsEvent.Name)
+			if d.shouldWatchDir(fsEvent.Name) {
+				d.addWatch(fsEvent.Name)
 			}
 			d.graph.mu.Unlock()
 			return
 		}
 
-		// Count new lines
-		newLines := countLines(fsEvent.Name)
-		event.Lines = newLines
+		// Count new lines and fingerprint the content
+		state := statFile(fsEvent.Name, info)
+		event.Lines = state.Lines
+
+		// A create may be the other half of a rename
+		prev, exists := d.graph.State[relPath]
+		if op == "CREATE" && !exists {
+			if i := d.matchMove(state); i >= 0 {
+				d.completeMove(i, &event, state)
+				break
+			}
+		}
 
 		// Calculate deltas from cached state
-		if prev, exists := d.graph.State[relPath]; exists {
-			event.Delta = newLines - prev.Lines
+		if exists {
+			event.Delta = state.Lines - prev.Lines
 			event.SizeDelta = info.Size() - prev.Size
 		} else {
-			event.Delta = newLines // new file, all lines are added
+			event.Delta = state.Lines // new file, all lines are added
 			event.SizeDelta = info.Size()
 		}
 
 		// Update cached state
-		d.graph.State[relPath] = &FileState{Lines: newLines, Size: info.Size()}
+		d.graph.State[relPath] = state
 
 		// Update file info
 		d.graph.Files[relPath] = &scanner.FileInfo{
@@ -154,20 +275,134 @@ func (d *Daemon) handleEvent(fsEvent fsnotify.Event) {
 
 	case "REMOVE", "RENAME":
 		// Record what was lost
-		if prev, exists := d.graph.State[relPath]; exists {
+		prev, exists := d.graph.State[relPath]
+		if exists {
 			event.Lines = 0
 			event.Delta = -prev.Lines
 			event.SizeDelta = -prev.Size
 		}
+		symbols := d.graph.Symbols[relPath]
 		delete(d.graph.Files, relPath)
 		delete(d.graph.State, relPath)
+		delete(d.graph.Symbols, relPath)
+
+		// Hold renames back until the matching create shows up or
+		// moveWindow passes
+		if op == "RENAME" {
+			d.pendingMoves = append(d.pendingMoves, pendingMove{event: event, state: prev, symbols: symbols})
+			d.graph.mu.Unlock()
+			return
+		}
+	}
+
+	if scanned {
+		event.Symbols = diffSymbols(d.graph.Symbols[relPath], symbols)
+		d.graph.Symbols[relPath] = symbols
 	}
 
 	// Check if file is dirty (uncommitted) - only if git repo
-	if d.graph.IsGitRepo && (op == "CREATE" || op == "WRITE") {
+	if d.graph.IsGitRepo && (event.Op == "CREATE" || event.Op == "WRITE" || event.Op == "MOVE") {
 		event.Dirty = isFileDirty(d.root, relPath)
 	}
 
+	d.commitEvent(event)
+}
+
+// matchMove finds the pending rename whose file is the one just created at
+// state: the same inode, or else the same content. Returns -1 if none.
+// Must be called while holding d.graph.mu lock.
+func (d *Daemon) matchMove(state *FileState) int {
+	for i, p := range d.pendingMoves {
+		if p.state == nil {
+			continue
+		}
+		if p.state.Inode != 0 && p.state.Inode == state.Inode {
+			return i
+		}
+		if p.state.Size > 0 && p.state.Size == state.Size && p.state.Hash == state.Hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// completeMove turns event, the create of a file, into the MOVE of pending
+// rename i, and migrates the file's state and dependencies to its new path.
+// Must be called while holding d.graph.mu lock.
+func (d *Daemon) completeMove(i int, event *Event, state *FileState) {
+	p := d.pendingMoves[i]
+	d.pendingMoves = slices.Delete(d.pendingMoves, i, i+1)
+
+	oldPath, newPath := p.event.Path, event.Path
+	event.Op = "MOVE"
+	event.OldPath = oldPath
+	event.Delta = state.Lines - p.state.Lines
+	event.SizeDelta = state.Size - p.state.Size
+
+	d.graph.State[newPath] = state
+	if p.symbols != nil {
+		d.graph.Symbols[newPath] = p.symbols
+	}
+	d.graph.Files[newPath] = &scanner.FileInfo{
+		Path: newPath,
+		Size: state.Size,
+		Ext:  filepath.Ext(newPath),
+	}
+
+	fg := d.graph.FileGraph
+	if fg == nil {
+		return
+	}
+	fg = fg.Renamed(oldPath, newPath)
+	d.graph.FileGraph = fg
+
+	// The file and everything connected to it now refer to the new path
+	if _, ok := d.graph.DepCtx[oldPath]; ok {
+		delete(d.graph.DepCtx, oldPath)
+		d.graph.DepCtx[newPath] = &DepContext{Imports: fg.Imports[newPath], Importers: fg.Importers[newPath]}
+	}
+	for _, f := range fg.ConnectedFiles(newPath) {
+		if _, ok := d.graph.DepCtx[f]; ok {
+			d.graph.DepCtx[f] = &DepContext{Imports: fg.Imports[f], Importers: fg.Importers[f]}
+		}
+	}
+}
+
+// nextMoveExpiry returns how long until the oldest pending rename expires
+func (d *Daemon) nextMoveExpiry() (time.Duration, bool) {
+	d.graph.mu.RLock()
+	defer d.graph.mu.RUnlock()
+	if len(d.pendingMoves) == 0 {
+		return 0, false
+	}
+	return max(time.Until(d.pendingMoves[0].event.Time.Add(moveWindow)), 0), true
+}
+
+// expireMoves logs renames that found no matching create within moveWindow
+// (all of them if all is set) as RENAME events: the file left the project
+// or was renamed to a name that isn't watched
+func (d *Daemon) expireMoves(all bool) {
+	d.graph.mu.Lock()
+	var expired []Event
+	cutoff := time.Now().Add(-moveWindow)
+	for len(d.pendingMoves) > 0 && (all || !d.pendingMoves[0].event.Time.After(cutoff)) {
+		expired = append(expired, d.pendingMoves[0].event)
+		d.pendingMoves = d.pendingMoves[1:]
+	}
+	d.graph.mu.Unlock()
+
+	for _, e := range expired {
+		d.graph.mu.Lock()
+		d.commitEvent(e)
+	}
+}
+
+// commitEvent enriches event with its structural context, records it and
+// tells listeners. Must be called while holding d.graph.mu lock, which it
+// releases.
+func (d *Daemon) commitEvent(event Event) {
+	relPath := event.Path
+
 	// Enrich with structural context from file graph (if available)
 	if d.graph.HasDeps && d.graph.FileGraph != nil {
 		fg := d.graph.FileGraph
@@ -179,11 +414,15 @@ func (d *Daemon) handleEvent(fsEvent fsnotify.Event) {
 		event.RelatedHot = d.findRelatedHot(relPath, 5*time.Minute)
 	}
 
-	d.graph.Events = append(d.graph.Events, event)
+	d.graph.Events.Add(event)
+	if d.session != nil {
+		d.session.record(event)
+	}
 	d.graph.mu.Unlock()
 
 	// Log event
 	d.logEvent(event)
+	d.notify(event)
 
 	if d.verbose {
 		deltaStr := ""
@@ -202,7 +441,11 @@ func (d *Daemon) handleEvent(fsEvent fsnotify.Event) {
 		if len(event.RelatedHot) > 0 {
 			hotStr = fmt.Sprintf(" [related:%d]", len(event.RelatedHot))
 		}
-		fmt.Printf("[watch] %s %s %s%s%s%s%s\n", event.Time.Format("15:04:05"), op, relPath, deltaStr, dirtyStr, hubStr, hotStr)
+		symStr := ""
+		if len(event.Symbols) > 0 {
+			symStr = " - " + SummarizeSymbols(event.Symbols, 3)
+		}
+		fmt.Printf("[watch] %s %s %s%s%s%s%s%s\n", event.Time.Format("15:04:05"), event.Op, event.DisplayPath(), deltaStr, dirtyStr, hubStr, hotStr, symStr)
 	}
 }
 
@@ -227,8 +470,8 @@ func (d *Daemon) findRelatedHot(path string, window time.Duration) []string {
 	// Look at recent events and find matches
 	cutoff := time.Now().Add(-window)
 	recentlyEdited := make(map[string]bool)
-	for i := len(d.graph.Events) - 1; i >= 0; i-- {
-		e := d.graph.Events[i]
+	for i := d.graph.Events.Len() - 1; i >= 0; i-- {
+		e := d.graph.Events.At(i)
 		if e.Time.Before(cutoff) {
 			break
 		}
@@ -248,43 +491,57 @@ func (d *Daemon) findRelatedHot(path string, window time.Duration) []string {
 	return hot
 }
 
-// logEvent appends an event to the log file
+// logEvent appends an event to the JSONL log
 func (d *Daemon) logEvent(e Event) {
-	f, err := os.OpenFile(d.eventLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
+	if d.inMemory {
 		return
 	}
-	defer f.Close()
-
-	// Format: timestamp | OP | path | lines | delta | dirty
-	deltaStr := ""
-	if e.Delta > 0 {
-		deltaStr = fmt.Sprintf("+%d", e.Delta)
-	} else if e.Delta < 0 {
-		deltaStr = fmt.Sprintf("%d", e.Delta)
+	if err := d.log.append(e); err != nil && d.verbose {
+		fmt.Printf("[watch] Event log: %v\n", err)
 	}
 
-	dirtyStr := ""
-	if e.Dirty {
-		dirtyStr = "dirty"
-	}
+	// Update the fallback snapshot for hooks that can't reach the socket
+	d.scheduleStateWrite()
+}
 
-	line := fmt.Sprintf("%s | %-6s | %-40s | %4d | %6s | %s\n",
-		e.Time.Format("2006-01-02 15:04:05"),
-		e.Op,
-		e.Path,
-		e.Lines,
-		deltaStr,
-		dirtyStr,
-	)
-	f.WriteString(line)
+// stateWriteDelay batches state.json and session rewrites during bursts of
+// edits; live data is served by the query API
+const stateWriteDelay = 2 * time.Second
 
-	// Update state file for hooks to read
-	d.writeState()
+// scheduleStateWrite writes state.json and the session after
+// stateWriteDelay, unless a write is already pending
+func (d *Daemon) scheduleStateWrite() {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	if d.stateTimer != nil {
+		return
+	}
+	d.stateTimer = time.AfterFunc(stateWriteDelay, func() {
+		d.stateMu.Lock()
+		d.stateTimer = nil
+		d.stateMu.Unlock()
+		d.writeState()
+		d.saveSession(false)
+	})
+}
+
+// flushState writes a pending state.json update now
+func (d *Daemon) flushState() {
+	d.stateMu.Lock()
+	pending := d.stateTimer != nil && d.stateTimer.Stop()
+	d.stateTimer = nil
+	d.stateMu.Unlock()
+	if pending {
+		d.writeState()
+	}
 }
 
 // writeState persists current state for hooks to read
 func (d *Daemon) writeState() {
+	if d.inMemory {
+		return
+	}
+
 	d.graph.mu.RLock()
 	defer d.graph.mu.RUnlock()
 
@@ -293,10 +550,7 @@ func (d *Daemon) writeState() {
 	}
 
 	// Get last 50 events for timeline
-	events := d.graph.Events
-	if len(events) > 50 {
-		events = events[len(events)-50:]
-	}
+	events := d.graph.Events.Last(50)
 
 	state := State{
 		UpdatedAt:    time.Now(),
@@ -305,6 +559,7 @@ func (d *Daemon) writeState() {
 		Importers:    d.graph.FileGraph.Importers,
 		Imports:      d.graph.FileGraph.Imports,
 		RecentEvents: events,
+		WatchMode:    d.poller.mode(d.root),
 	}
 
 	data, err := json.MarshalIndent(state, "", "  ")
@@ -332,6 +587,26 @@ func countLines(path string) int {
 	return count
 }
 
+// statFile counts the lines of a file and fingerprints it so it can be
+// recognized after a move. info is the file's already-known stat.
+func statFile(path string, info os.FileInfo) *FileState {
+	state := &FileState{Size: info.Size(), Inode: fileInode(info)}
+	f, err := os.Open(path)
+	if err != nil {
+		return state
+	}
+	defer f.Close()
+
+	h := fnv.New64a()
+	sc := bufio.NewScanner(io.TeeReader(f, h))
+	for sc.Scan() {
+		state.Lines++
+	}
+	io.Copy(h, f) // the rest, if a line was too long to scan
+	state.Hash = h.Sum64()
+	return state
+}
+
 // isFileDirty checks if a file has uncommitted changes (fast git check)
 func isFileDirty(root, relPath string) bool {
 	cmd := exec.Command("git", "diff", "--quiet", "--", relPath)
@@ -0,0 +1,387 @@
+package watch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Git operations rewrite many files at once. While one runs (git holds
+// index.lock, or touched HEAD or refs within gitSettleDelay) working-tree
+// events are held back, then either collapsed into one COMMIT, CHECKOUT or
+// MERGE event or, if HEAD didn't move, replayed as usual.
+const (
+	gitSettleDelay = 300 * time.Millisecond
+	gitBatchMaxAge = 30 * time.Second // gives up on a stale index.lock
+	gitBatchMax    = 5000             // held events before the batch counts as churn anyway
+)
+
+// gitHead is what HEAD points at
+type gitHead struct {
+	branch string // "" when detached
+	commit string // "" before the first commit
+}
+
+// gitWatch tracks the repository's git dir. It is only used from the event
+// loop goroutine.
+type gitWatch struct {
+	dir       string // absolute git dir (.git, or elsewhere for worktrees)
+	head      gitHead
+	logOffset int64     // bytes of logs/HEAD already seen
+	batch     *gitBatch // nil when no git operation is in progress
+}
+
+// gitBatch holds the working-tree events seen during a git operation
+type gitBatch struct {
+	start    time.Time
+	events   []fsnotify.Event
+	files    map[string]bool // relative paths
+	overflow bool
+}
+
+// watchGit starts watching HEAD, the HEAD reflog and branch refs, if root
+// is a git repository
+func (d *Daemon) watchGit() {
+	if !d.graph.IsGitRepo {
+		return
+	}
+	cmd := exec.Command("git", "rev-parse", "--absolute-git-dir")
+	cmd.Dir = d.root
+	out, err := cmd.Output()
+	if err != nil {
+		return
+	}
+	g := &gitWatch{dir: strings.TrimSpace(string(out))}
+	g.head = g.readHead(d.root)
+	if info, err := os.Stat(filepath.Join(g.dir, "logs", "HEAD")); err == nil {
+		g.logOffset = info.Size()
+	}
+
+	if err := d.watcher.Add(g.dir); err != nil {
+		return
+	}
+	d.watcher.Add(filepath.Join(g.dir, "logs"))
+	filepath.WalkDir(filepath.Join(g.dir, "refs", "heads"), func(path string, entry os.DirEntry, err error) error {
+		if err == nil && entry.IsDir() {
+			d.watcher.Add(path)
+		}
+		return nil
+	})
+	d.git = g
+}
+
+// isGitPath reports whether path is inside the watched git dir
+func (d *Daemon) isGitPath(path string) bool {
+	return d.git != nil && (path == d.git.dir || strings.HasPrefix(path, d.git.dir+string(filepath.Separator)))
+}
+
+// gitActivity reports whether a change to path in the git dir means a git
+// operation that may move HEAD or rewrite the working tree
+func (g *gitWatch) gitActivity(path string) bool {
+	rel, err := filepath.Rel(g.dir, path)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	switch rel {
+	case "index.lock", "HEAD", "HEAD.lock", "ORIG_HEAD", "MERGE_HEAD", "packed-refs", "logs/HEAD":
+		return true
+	}
+	return strings.HasPrefix(rel, "refs/heads/")
+}
+
+// handleGitEvent notes a change in the git dir, opening a batch if it
+// starts a git operation. Returns whether the batch should settle.
+func (d *Daemon) handleGitEvent(event fsnotify.Event) bool {
+	g := d.git
+	// New branch namespaces (feature/...) get their own ref directories
+	if event.Op&fsnotify.Create != 0 {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() && d.isGitRefsDir(event.Name) {
+			d.watcher.Add(event.Name)
+		}
+	}
+	if !g.gitActivity(event.Name) {
+		return false
+	}
+	if g.batch == nil {
+		g.batch = &gitBatch{start: time.Now(), files: make(map[string]bool)}
+	}
+	return true
+}
+
+func (d *Daemon) isGitRefsDir(path string) bool {
+	return strings.HasPrefix(path, filepath.Join(d.git.dir, "refs", "heads"))
+}
+
+// holdForGit keeps a working-tree event for the running git operation.
+// Returns false if no git operation is running.
+func (d *Daemon) holdForGit(event fsnotify.Event) bool {
+	if d.git == nil || d.git.batch == nil {
+		return false
+	}
+	b := d.git.batch
+	if relPath, err := filepath.Rel(d.root, event.Name); err == nil {
+		b.files[relPath] = true
+	}
+	if len(b.events) < gitBatchMax {
+		b.events = append(b.events, event)
+	} else {
+		b.overflow = true
+	}
+	return true
+}
+
+// settleGit ends the running git operation once git has let go of the
+// index: it records what the operation did to HEAD and releases the held
+// events. Returns false if git is still busy.
+func (d *Daemon) settleGit() bool {
+	g := d.git
+	b := g.batch
+	if b == nil {
+		return true
+	}
+	if _, err := os.Stat(filepath.Join(g.dir, "index.lock")); err == nil && time.Since(b.start) < gitBatchMaxAge {
+		return false
+	}
+	g.batch = nil
+
+	event, moved := g.headEvent(d.root)
+	if !moved && !b.overflow {
+		d.replay(b.events)
+		return true
+	}
+	if moved && event.Op == "COMMIT" && !b.overflow {
+		// Commits don't touch the working tree; the held events are
+		// the user's own edits
+		d.commitGitEvent(event)
+		d.replay(b.events)
+		return true
+	}
+
+	// A checkout, merge, reset or rebase: one event for all of its churn,
+	// then a rescan, since the graph may have changed everywhere
+	if !moved {
+		event.Op = "CHECKOUT"
+		event.Message = "working tree updated by git"
+	}
+	d.graph.mu.RLock()
+	before := make(map[string]int, len(b.files))
+	for path := range b.files {
+		if s, ok := d.graph.State[path]; ok {
+			before[path] = s.Lines
+		}
+	}
+	d.graph.mu.RUnlock()
+
+	d.rescan()
+
+	d.graph.mu.RLock()
+	for path := range b.files {
+		after := 0
+		if s, ok := d.graph.State[path]; ok {
+			after = s.Lines
+		}
+		event.Delta += after - before[path]
+	}
+	d.graph.mu.RUnlock()
+	event.Files = len(b.files)
+	d.commitGitEvent(event)
+	return true
+}
+
+// replay processes held events as if they had just arrived: the last one
+// for each file, corrected by whether the file exists now, since git
+// often deletes and rewrites a file in one go
+func (d *Daemon) replay(events []fsnotify.Event) {
+	last := make(map[string]int, len(events))
+	var order []string
+	for i, e := range events {
+		if _, seen := last[e.Name]; !seen {
+			order = append(order, e.Name)
+		}
+		last[e.Name] = i
+	}
+	for _, name := range order {
+		e := events[last[name]]
+		_, err := os.Stat(name)
+		exists := err == nil
+		switch {
+		case exists && e.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+			e.Op = fsnotify.Write
+		case !exists && e.Op&(fsnotify.Create|fsnotify.Write) != 0:
+			e.Op = fsnotify.Remove
+		}
+		d.handleEvent(e)
+	}
+}
+
+// commitGitEvent records a git event
+func (d *Daemon) commitGitEvent(event Event) {
+	d.graph.mu.Lock()
+	d.commitEvent(event)
+}
+
+// rescan rebuilds the file list, dependency graph and symbols from scratch
+func (d *Daemon) rescan() {
+	ctx := context.Background()
+	if err := d.fullScan(ctx); err != nil {
+		if d.verbose {
+			fmt.Printf("[watch] Rescan failed: %v\n", err)
+		}
+		return
+	}
+	d.computeDeps(ctx)
+	d.computeSymbols(ctx)
+	d.addWatchDirs()
+}
+
+// headEvent describes how HEAD moved since it was last seen, from the new
+// HEAD reflog entries, or from HEAD itself when there is no reflog
+func (g *gitWatch) headEvent(root string) (Event, bool) {
+	head := g.readHead(root)
+	entries := g.readReflog()
+	prev := g.head
+	g.head = head
+
+	event := Event{
+		Time:      time.Now(),
+		Branch:    head.branch,
+		Commit:    head.commit,
+		OldCommit: prev.commit,
+	}
+	if len(entries) == 0 {
+		if head == prev {
+			return event, false
+		}
+		event.Op = "COMMIT"
+		if head.branch != prev.branch {
+			event.Op = "CHECKOUT"
+			event.OldBranch = prev.branch
+		}
+		return event, true
+	}
+
+	// One event for the whole operation: a checkout outranks a merge,
+	// which outranks commits (a rebase logs one entry per commit)
+	rank := map[string]int{"COMMIT": 0, "MERGE": 1, "CHECKOUT": 2}
+	event.Op = "COMMIT"
+	for _, entry := range entries {
+		op := classifyReflog(entry.message)
+		if rank[op] > rank[event.Op] {
+			event.Op = op
+		}
+		if from, _, ok := checkoutBranches(entry.message); ok && event.OldBranch == "" {
+			event.OldBranch = from
+		}
+	}
+	first, last := entries[0], entries[len(entries)-1]
+	event.OldCommit = first.oldCommit
+	event.Commit = last.newCommit
+	event.Message = last.message
+	if event.Op != "CHECKOUT" {
+		event.OldBranch = ""
+	}
+	return event, true
+}
+
+// readHead reads the current branch and commit
+func (g *gitWatch) readHead(root string) gitHead {
+	var head gitHead
+	if data, err := os.ReadFile(filepath.Join(g.dir, "HEAD")); err == nil {
+		if ref, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "ref: refs/heads/"); ok {
+			head.branch = ref
+		}
+	}
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", "HEAD")
+	cmd.Dir = root
+	if out, err := cmd.Output(); err == nil {
+		head.commit = strings.TrimSpace(string(out))
+	}
+	return head
+}
+
+// reflogEntry is one line of a reflog
+type reflogEntry struct {
+	oldCommit string
+	newCommit string
+	message   string
+}
+
+// readReflog returns the HEAD reflog entries appended since the last call
+func (g *gitWatch) readReflog() []reflogEntry {
+	f, err := os.Open(filepath.Join(g.dir, "logs", "HEAD"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	if info.Size() < g.logOffset {
+		// Expired or rewritten; start over from what's there now
+		g.logOffset = info.Size()
+		return nil
+	}
+	if _, err := f.Seek(g.logOffset, io.SeekStart); err != nil {
+		return nil
+	}
+
+	var entries []reflogEntry
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break // a partial last line is read next time
+		}
+		g.logOffset += int64(len(line))
+		if entry, ok := parseReflogLine(line); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// parseReflogLine parses "<old> <new> <name> <email> <time> <tz>\t<message>"
+func parseReflogLine(line string) (reflogEntry, bool) {
+	meta, message, ok := strings.Cut(strings.TrimRight(line, "\n"), "\t")
+	fields := strings.Fields(meta)
+	if !ok || len(fields) < 2 {
+		return reflogEntry{}, false
+	}
+	entry := reflogEntry{oldCommit: fields[0], newCommit: fields[1], message: message}
+	if strings.Trim(entry.oldCommit, "0") == "" {
+		entry.oldCommit = "" // the first commit
+	}
+	return entry, true
+}
+
+// classifyReflog maps a reflog message to COMMIT, MERGE or CHECKOUT; resets,
+// rebases and other moves of HEAD count as checkouts
+func classifyReflog(message string) string {
+	switch {
+	case strings.HasPrefix(message, "commit (merge)"), strings.HasPrefix(message, "merge "), strings.HasPrefix(message, "pull"):
+		return "MERGE"
+	case strings.HasPrefix(message, "commit"), strings.HasPrefix(message, "cherry-pick"), strings.HasPrefix(message, "revert"):
+		return "COMMIT"
+	}
+	return "CHECKOUT"
+}
+
+// checkoutBranches parses "checkout: moving from <from> to <to>"
+func checkoutBranches(message string) (from, to string, ok bool) {
+	rest, ok := strings.CutPrefix(message, "checkout: moving from ")
+	if !ok {
+		return "", "", false
+	}
+	from, to, ok = strings.Cut(rest, " to ")
+	return from, to, ok
+}
@@ -0,0 +1,483 @@
+package watch
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"codemap/config"
+	"codemap/scanner"
+)
+
+// History limits, for settings left out of the config. Snapshots older than
+// historyMaxAge are dropped, then the oldest ones until the compressed
+// snapshots fit in historyMaxSize.
+const (
+	historyMaxAge      = 7 * 24 * time.Hour
+	historyMaxSize     = 100 << 20 // 100 MB
+	historyMaxFileSize = 1 << 20   // larger files aren't snapshotted
+	historyPruneEvery  = 100       // snapshots between prunes
+)
+
+// ErrNoVersion is returned for a version a file's history doesn't have
+var ErrNoVersion = errors.New("no such version")
+
+// ErrHistoryDisabled is returned by Snapshot and Restore when the project's
+// config turns history off, whether or not a daemon is running
+var ErrHistoryDisabled = errors.New("history is disabled (watch.history.disabled in .codemap/config.json)")
+
+// HistoryDir returns where the daemon keeps snapshots of the files it
+// tracks: index.jsonl lists the versions, objects/ holds their contents,
+// gzipped and named by hash so unchanged content is stored once
+func HistoryDir(root string) string {
+	return filepath.Join(root, ".codemap", "history")
+}
+
+// Version is one snapshot of a file in its local history
+type Version struct {
+	Path    string    `json:"path"`
+	Version int       `json:"version"` // counts up per path, starting at 1
+	Time    time.Time `json:"time"`
+	Op      string    `json:"op"` // CREATE, WRITE or MOVE; START for uncommitted work when the daemon started; RESTORE
+	OldPath string    `json:"old_path,omitempty"`
+	Hash    string    `json:"hash"` // sha256 of the content
+	Size    int64     `json:"size"`
+	Stored  int64     `json:"stored"` // compressed size
+	Lines   int       `json:"lines"`
+	Delta   int       `json:"delta"` // lines added (+) or removed (-) since the previous version
+}
+
+// HashContent returns the hash that identifies content in the history
+func HashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// history snapshots files as the daemon sees them written. It is only used
+// from the event loop and, through the query API, from restores.
+type history struct {
+	root    string
+	maxAge  time.Duration
+	maxSize int64
+	verbose bool
+
+	mu     sync.Mutex
+	latest map[string]Version // path -> newest version
+	added  int                // snapshots since the last prune
+}
+
+// newHistory prepares the history of root; nil if cfg disables it
+func newHistory(root string, cfg config.History, verbose bool) *history {
+	if cfg.Disabled {
+		return nil
+	}
+	h := &history{
+		root:    root,
+		maxAge:  historyMaxAge,
+		maxSize: historyMaxSize,
+		verbose: verbose,
+		latest:  make(map[string]Version),
+	}
+	if cfg.MaxAge > 0 {
+		h.maxAge = time.Duration(cfg.MaxAge)
+	}
+	if cfg.MaxSizeMB > 0 {
+		h.maxSize = cfg.MaxSizeMB << 20
+	}
+	return h
+}
+
+// load prunes the history and reads the newest version of each file
+func (h *history) load() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.prune()
+}
+
+// handle snapshots the file an event wrote. Registered with OnEvent.
+func (h *history) handle(e Event) {
+	switch e.Op {
+	case "CREATE", "WRITE", "MOVE":
+	default:
+		return
+	}
+	if _, err := h.snapshot(e.Path, e.Op, e.OldPath); err != nil && h.verbose {
+		fmt.Printf("[watch] History: %v\n", err)
+	}
+}
+
+// snapshot records relPath's content as a new version, unless it is what
+// the newest version already holds. Returns the version holding the
+// content, or a zero Version if the file is missing or too large.
+func (h *history) snapshot(relPath, op, oldPath string) (Version, error) {
+	path := filepath.Join(h.root, relPath)
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > historyMaxFileSize {
+		return Version{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Version{}, err
+	}
+	hash := HashContent(data)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	prev, ok := h.latest[relPath]
+	if ok && prev.Hash == hash {
+		return prev, nil
+	}
+	stored, err := h.writeObject(hash, data)
+	if err != nil {
+		return Version{}, err
+	}
+	v := Version{
+		Path:    relPath,
+		Version: prev.Version + 1,
+		Time:    time.Now(),
+		Op:      op,
+		OldPath: oldPath,
+		Hash:    hash,
+		Size:    int64(len(data)),
+		Stored:  stored,
+		Lines:   countContentLines(data),
+	}
+	v.Delta = v.Lines - prev.Lines
+	if err := appendVersion(h.root, v); err != nil {
+		return Version{}, err
+	}
+	h.latest[relPath] = v
+
+	if h.added++; h.added >= historyPruneEvery {
+		if err := h.prune(); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+// snapshotDirty snapshots the tracked files with uncommitted changes, as
+// the daemon starts
+func (d *Daemon) snapshotDirty() {
+	if d.history == nil || !d.graph.IsGitRepo {
+		return
+	}
+	info, err := scanner.GitDiffInfo(d.root, "HEAD")
+	if err != nil {
+		return
+	}
+	for path := range info.Changed {
+		if !d.isSourceFile(filepath.Join(d.root, path)) {
+			continue
+		}
+		if _, err := d.history.snapshot(path, "START", ""); err != nil && d.verbose {
+			fmt.Printf("[watch] History: %v\n", err)
+		}
+	}
+}
+
+// writeObject stores data gzipped under its hash, if it isn't already,
+// and returns its compressed size
+func (h *history) writeObject(hash string, data []byte) (int64, error) {
+	path := objectPath(h.root, hash)
+	if info, err := os.Stat(path); err == nil {
+		return info.Size(), nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	// Write and rename, so a crash never leaves a truncated object
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+	return int64(buf.Len()), nil
+}
+
+// prune drops versions older than maxAge, then the oldest ones until the
+// objects fit in maxSize, deletes objects no version uses any more, and
+// reloads the newest version of each file. Must be called with h.mu held.
+func (h *history) prune() error {
+	versions, err := readVersions(h.root)
+	if err != nil {
+		return err
+	}
+	h.added = 0
+
+	cutoff := time.Now().Add(-h.maxAge)
+	kept := versions[:0]
+	for _, v := range versions {
+		if v.Time.After(cutoff) {
+			kept = append(kept, v)
+		}
+	}
+	// Versions are oldest first; drop from the front until the objects
+	// they use fit
+	sizes := make(map[string]int64)
+	uses := make(map[string]int)
+	var total int64
+	for _, v := range kept {
+		if uses[v.Hash] == 0 {
+			sizes[v.Hash] = v.Stored
+			total += v.Stored
+		}
+		uses[v.Hash]++
+	}
+	drop := 0
+	for drop < len(kept) && total > h.maxSize {
+		v := kept[drop]
+		if uses[v.Hash]--; uses[v.Hash] == 0 {
+			total -= sizes[v.Hash]
+		}
+		drop++
+	}
+	kept = kept[drop:]
+
+	if len(kept) < len(versions) {
+		if err := writeVersions(h.root, kept); err != nil {
+			return err
+		}
+	}
+	h.removeUnused(uses)
+
+	h.latest = make(map[string]Version)
+	for _, v := range kept {
+		h.latest[v.Path] = v
+	}
+	return nil
+}
+
+// removeUnused deletes the objects no remaining version uses
+func (h *history) removeUnused(uses map[string]int) {
+	objects := filepath.Join(HistoryDir(h.root), "objects")
+	filepath.Walk(objects, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		hash := strings.TrimSuffix(filepath.Base(path), ".gz")
+		if uses[hash] == 0 {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// objectPath returns where the content with hash is stored
+func objectPath(root, hash string) string {
+	return filepath.Join(HistoryDir(root), "objects", hash[:2], hash+".gz")
+}
+
+// indexPath returns the list of versions
+func indexPath(root string) string {
+	return filepath.Join(HistoryDir(root), "index.jsonl")
+}
+
+// appendVersion adds v to the index
+func appendVersion(root string, v Version) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(indexPath(root), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// readVersions reads the index, oldest first, skipping malformed lines
+func readVersions(root string) ([]Version, error) {
+	f, err := os.Open(indexPath(root))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var versions []Version
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var v Version
+		if err := json.Unmarshal(sc.Bytes(), &v); err != nil || len(v.Hash) < 2 {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	return versions, sc.Err()
+}
+
+// writeVersions replaces the index with versions
+func writeVersions(root string, versions []Version) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, v := range versions {
+		enc.Encode(v)
+	}
+	tmp := indexPath(root) + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, indexPath(root))
+}
+
+// countContentLines counts lines the way countLines does for files
+func countContentLines(data []byte) int {
+	n := bytes.Count(data, []byte{'\n'})
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// ReadHistory returns the versions of relPath in root's history, newest
+// first
+func ReadHistory(root, relPath string) ([]Version, error) {
+	versions, err := readVersions(root)
+	if err != nil {
+		return nil, err
+	}
+	var file []Version
+	for _, v := range versions {
+		if v.Path == relPath {
+			file = append(file, v)
+		}
+	}
+	sort.SliceStable(file, func(i, j int) bool { return file[i].Version > file[j].Version })
+	return file, nil
+}
+
+// FindVersion returns version n of relPath
+func FindVersion(root, relPath string, n int) (Version, error) {
+	versions, err := ReadHistory(root, relPath)
+	if err != nil {
+		return Version{}, err
+	}
+	for _, v := range versions {
+		if v.Version == n {
+			return v, nil
+		}
+	}
+	return Version{}, fmt.Errorf("%s v%d: %w", relPath, n, ErrNoVersion)
+}
+
+// HistoryContent returns the content of a version
+func HistoryContent(root string, v Version) ([]byte, error) {
+	f, err := os.Open(objectPath(root, v.Hash))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
+
+// HistoryRoot returns the project whose history covers path: the nearest
+// directory at or above it with a .codemap/history
+func HistoryRoot(path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if info, err := os.Stat(HistoryDir(dir)); err == nil && info.IsDir() {
+			return dir, true
+		}
+		if dir == filepath.Dir(dir) {
+			return "", false
+		}
+	}
+}
+
+// Snapshot records relPath's current content in root's history and
+// returns the version holding it. A running daemon takes the snapshot,
+// so versions are numbered by one process. Returns a zero Version if the
+// file doesn't exist, and ErrHistoryDisabled if history is off.
+func Snapshot(root, relPath, op string) (Version, error) {
+	if IsRunning(root) {
+		return NewClient(root).Snapshot(relPath)
+	}
+	cfg, err := config.Load(root)
+	if err != nil {
+		return Version{}, err
+	}
+	h := newHistory(root, cfg.Watch.History, false)
+	if h == nil {
+		return Version{}, ErrHistoryDisabled
+	}
+	if err := os.MkdirAll(HistoryDir(root), 0755); err != nil {
+		return Version{}, err
+	}
+	if err := h.load(); err != nil {
+		return Version{}, err
+	}
+	return h.snapshot(relPath, op, "")
+}
+
+// Restore writes version n of relPath back to the file, recreating it if
+// it was removed. The content it replaces is snapshotted first, and that
+// version is returned (zero if there was no file), so a restore can be
+// undone. With history disabled nothing is restored (ErrHistoryDisabled).
+func Restore(root, relPath string, n int) (restored, saved Version, err error) {
+	restored, err = FindVersion(root, relPath, n)
+	if err != nil {
+		return
+	}
+	data, err := HistoryContent(root, restored)
+	if err != nil {
+		return
+	}
+	saved, err = Snapshot(root, relPath, "WRITE")
+	if errors.Is(err, ErrHistoryDisabled) {
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("saving current content: %w", err)
+		return
+	}
+
+	path := filepath.Join(root, relPath)
+	mode := os.FileMode(0644)
+	if info, statErr := os.Stat(path); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	if err = os.WriteFile(path, data, mode); err != nil {
+		return
+	}
+	// A running daemon records the restored content when it sees the write
+	if !IsRunning(root) {
+		_, err = Snapshot(root, relPath, "RESTORE")
+	}
+	return
+}
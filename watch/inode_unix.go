@@ -0,0 +1,16 @@
+//go:build !windows
+
+package watch
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode of a file, which survives renames
+func fileInode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package watch
+
+import "os"
+
+// fileInode is unavailable on Windows; moves are matched by content hash
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
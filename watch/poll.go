@@ -0,0 +1,283 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// pollInterval is how often polled directories are checked for changes
+const pollInterval = 2 * time.Second
+
+// Watch modes, reported by Health and State
+const (
+	ModeNotify  = "fsnotify" // every directory watched by fsnotify
+	ModePolling = "polling"  // the whole project is polled
+	ModeMixed   = "mixed"    // some subtrees are polled
+)
+
+// PolledDir is a subtree the daemon polls because fsnotify can't watch it
+type PolledDir struct {
+	Path   string `json:"path"` // relative to the root; "." for the root
+	Reason string `json:"reason"`
+}
+
+// fileStamp is what polling compares to notice a change
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	inode   uint64
+}
+
+// poller checks subtrees that fsnotify can't watch (the inotify watch limit
+// is used up, or the directory is on a network or FUSE mount, where fsnotify
+// delivers nothing) by comparing file mtimes and sizes every pollInterval.
+// The subtrees are walked off the event loop, so only roots is shared;
+// stamps is only used from Start and the event loop.
+type poller struct {
+	mu    sync.Mutex
+	roots map[string]string // abs dir -> why it is polled
+
+	stamps map[string]fileStamp // abs path -> last seen
+}
+
+func newPoller() *poller {
+	return &poller{roots: make(map[string]string), stamps: make(map[string]fileStamp)}
+}
+
+// covers reports whether dir is inside a polled subtree
+func (p *poller) covers(dir string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, ok := p.roots[d]; ok {
+			return true
+		}
+		if d == filepath.Dir(d) {
+			return false
+		}
+	}
+}
+
+// active reports whether anything is polled
+func (p *poller) active() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.roots) > 0
+}
+
+// dirs lists the polled subtrees relative to root, sorted by path
+func (p *poller) dirs(root string) []PolledDir {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dirs := make([]PolledDir, 0, len(p.roots))
+	for dir, reason := range p.roots {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			rel = dir
+		}
+		dirs = append(dirs, PolledDir{Path: filepath.ToSlash(rel), Reason: reason})
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Path < dirs[j].Path })
+	return dirs
+}
+
+// mode describes how the daemon watches root
+func (p *poller) mode(root string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.roots[root]; ok {
+		return ModePolling
+	}
+	if len(p.roots) > 0 {
+		return ModeMixed
+	}
+	return ModeNotify
+}
+
+// addWatch watches dir with fsnotify, or falls back to polling the subtree
+// below it when fsnotify can't watch it. Returns whether dir is polled, so
+// a walk can skip its subtree.
+func (d *Daemon) addWatch(dir string) (bool, error) {
+	if d.poller.covers(dir) {
+		return true, nil
+	}
+	reason := ""
+	if fs := remoteFS(dir); fs != "" {
+		reason = fs + " mount"
+	} else if err := d.watcher.Add(dir); err != nil {
+		if reason = watchLimitReason(err); reason == "" {
+			return false, err
+		}
+	}
+	if reason == "" {
+		return false, nil
+	}
+
+	d.poller.mu.Lock()
+	d.poller.roots[dir] = reason
+	d.poller.mu.Unlock()
+	d.snapshotPolled(dir)
+	if d.verbose {
+		rel, _ := filepath.Rel(d.root, dir)
+		fmt.Printf("[watch] Polling %s every %v: %s\n", rel, pollInterval, reason)
+	}
+	return true, nil
+}
+
+// watchLimitReason explains a watcher.Add error that polling works around,
+// or returns "" for other errors
+func watchLimitReason(err error) string {
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return "inotify watch limit reached (fs.inotify.max_user_watches)"
+	case errors.Is(err, syscall.EMFILE):
+		return "too many open files"
+	}
+	return ""
+}
+
+// snapshotPolled records the files below a newly polled dir, so the first
+// poll only reports what changed after it
+func (d *Daemon) snapshotPolled(dir string) {
+	d.walkPolled(dir, func(path string, stamp fileStamp) {
+		d.poller.stamps[path] = stamp
+	})
+}
+
+// walkPolled calls fn for each tracked file below dir, skipping the
+// directories the daemon wouldn't watch
+func (d *Daemon) walkPolled(dir string, fn func(path string, stamp fileStamp)) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // skip errors
+		}
+		if info.IsDir() {
+			if path != dir && path != d.root && !d.shouldWatchDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.isSourceFile(path) {
+			fn(path, fileStamp{modTime: info.ModTime(), size: info.Size(), inode: fileInode(info)})
+		}
+		return nil
+	})
+}
+
+// pollWalk is the state of the polled subtrees at one point in time
+type pollWalk struct {
+	roots []string             // the subtrees walked
+	seen  map[string]fileStamp // abs path -> stamp of each tracked file
+}
+
+// walkPolledRoots stats the tracked files of every polled subtree. It runs
+// off the event loop, and only reads the daemon's state.
+func (d *Daemon) walkPolledRoots() pollWalk {
+	d.poller.mu.Lock()
+	roots := make([]string, 0, len(d.poller.roots))
+	for dir := range d.poller.roots {
+		roots = append(roots, dir)
+	}
+	d.poller.mu.Unlock()
+
+	walk := pollWalk{roots: roots, seen: make(map[string]fileStamp)}
+	for _, dir := range roots {
+		d.walkPolled(dir, func(path string, stamp fileStamp) {
+			walk.seen[path] = stamp
+		})
+	}
+	return walk
+}
+
+// poll walks the polled subtrees and returns what changed since last time
+func (d *Daemon) poll() []fsnotify.Event {
+	return d.pollChanges(d.walkPolledRoots())
+}
+
+// pollChanges compares a walk with what was seen last time and returns the
+// changes as fsnotify events. A vanished file is reported as renamed when a
+// new file is the same one, so moves are still detected.
+func (d *Daemon) pollChanges(walk pollWalk) []fsnotify.Event {
+	var created, written []fsnotify.Event
+	for path, stamp := range walk.seen {
+		prev, ok := d.poller.stamps[path]
+		switch {
+		case !ok:
+			created = append(created, fsnotify.Event{Name: path, Op: fsnotify.Create})
+		case !stamp.modTime.Equal(prev.modTime) || stamp.size != prev.size:
+			written = append(written, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		}
+	}
+
+	var removed []fsnotify.Event
+	for path, prev := range d.poller.stamps {
+		// Subtrees that started being polled during the walk keep their stamps
+		if _, ok := walk.seen[path]; ok || !withinAny(path, walk.roots) {
+			continue
+		}
+		delete(d.poller.stamps, path)
+		op := fsnotify.Remove
+		for _, c := range created {
+			if d.movedTo(path, prev, c.Name, walk.seen[c.Name]) {
+				op = fsnotify.Rename
+				break
+			}
+		}
+		removed = append(removed, fsnotify.Event{Name: path, Op: op})
+	}
+	for path, stamp := range walk.seen {
+		d.poller.stamps[path] = stamp
+	}
+
+	// Renames before creates, so the create completes the move
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Name < removed[j].Name })
+	sort.Slice(created, func(i, j int) bool { return created[i].Name < created[j].Name })
+	sort.Slice(written, func(i, j int) bool { return written[i].Name < written[j].Name })
+	return append(append(removed, created...), written...)
+}
+
+// movedTo reports whether the file that vanished from oldPath is the one
+// created at newPath: the same inode, or else the same content, as for
+// fsnotify renames (matchMove). Content is only read when the sizes match.
+func (d *Daemon) movedTo(oldPath string, prev fileStamp, newPath string, stamp fileStamp) bool {
+	if prev.inode != 0 && prev.inode == stamp.inode {
+		return true
+	}
+	if prev.size == 0 || prev.size != stamp.size {
+		return false
+	}
+	rel, err := filepath.Rel(d.root, oldPath)
+	if err != nil {
+		return false
+	}
+	d.graph.mu.RLock()
+	state := d.graph.State[rel]
+	d.graph.mu.RUnlock()
+	if state == nil || state.Size != stamp.size {
+		return false
+	}
+	info, err := os.Stat(newPath)
+	if err != nil {
+		return false
+	}
+	return statFile(newPath, info).Hash == state.Hash
+}
+
+// withinAny reports whether path is one of dirs or inside one
+func withinAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+//go:build !windows
+
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// setSysProcAttr sets Unix-specific process attributes for daemon detachment
+func setSysProcAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// shellCommand runs command with sh in its own process group, so canceling
+// ctx kills whatever the command started too
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	setSysProcAttr(cmd)
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return cmd
+}
+
+// lockFile takes an exclusive flock on path, held until the file is closed
+// or the process exits. Returns errLocked if another process holds it.
+func lockFile(path string, create bool) (*os.File, error) {
+	flags := os.O_RDWR
+	if create {
+		flags |= os.O_CREATE
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// processStartTime identifies when a process started, so a PID reused by
+// another process can be told apart: the start time in clock ticks since
+// boot on Linux, the ps start time elsewhere. "" if unknown.
+func processStartTime(pid int) string {
+	if runtime.GOOS == "linux" {
+		data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+		if err != nil {
+			return ""
+		}
+		// The command name may contain spaces; fields after it start at
+		// state (field 3), and starttime is field 22
+		_, rest, ok := strings.Cut(string(data), ") ")
+		fields := strings.Fields(rest)
+		if !ok || len(fields) < 20 {
+			return ""
+		}
+		return fields[19]
+	}
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(string(out)), "_")
+}
+
+// terminate asks a process to exit
+func terminate(proc *os.Process) error {
+	return proc.Signal(syscall.SIGTERM)
+}
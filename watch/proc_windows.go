@@ -0,0 +1,56 @@
+//go:build windows
+
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/windows"
+)
+
+// setSysProcAttr is a no-op on Windows (Setpgid not available)
+func setSysProcAttr(cmd *exec.Cmd) {
+	// Windows doesn't support Setpgid
+}
+
+// shellCommand runs command with cmd.exe
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
+
+// lockFile takes an exclusive lock on path, held until the file is closed
+// or the process exits. Returns errLocked if another process holds it.
+func lockFile(path string, create bool) (*os.File, error) {
+	flags := os.O_RDWR
+	if create {
+		flags |= os.O_CREATE
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	ol := new(windows.Overlapped)
+	lockFlags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK | windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if err := windows.LockFileEx(windows.Handle(f.Fd()), lockFlags, 0, 1, 0, ol); err != nil {
+		f.Close()
+		if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// processStartTime is not checked on Windows; the lock file covers reused
+// PIDs there
+func processStartTime(pid int) string {
+	return ""
+}
+
+// terminate stops a process; Windows has no SIGTERM
+func terminate(proc *os.Process) error {
+	return proc.Kill()
+}
@@ -0,0 +1,27 @@
+package watch
+
+import (
+	"strings"
+	"syscall"
+)
+
+// remoteFS returns the type of network or FUSE filesystem dir is on, or ""
+// for local filesystems
+func remoteFS(dir string) string {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return ""
+	}
+	var name strings.Builder
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name.WriteByte(byte(c))
+	}
+	switch fs := name.String(); {
+	case fs == "nfs", fs == "smbfs", fs == "afpfs", fs == "webdav", strings.Contains(fs, "fuse"):
+		return fs
+	}
+	return ""
+}
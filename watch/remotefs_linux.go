@@ -0,0 +1,26 @@
+package watch
+
+import "syscall"
+
+// Filesystems fsnotify gets no events from, by statfs magic number
+var remoteFSTypes = map[int64]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x01021997: "9p",
+	0x00c36400: "ceph",
+	0x5346414f: "afs",
+	0x73757245: "coda",
+}
+
+// remoteFS returns the type of network or FUSE filesystem dir is on, or ""
+// for local filesystems
+func remoteFS(dir string) string {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return ""
+	}
+	return remoteFSTypes[int64(st.Type)]
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package watch
+
+// remoteFS can't tell network filesystems apart here; they are only polled
+// if watching them fails
+func remoteFS(dir string) string {
+	return ""
+}
@@ -0,0 +1,280 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxSessions is how many session files are kept in .codemap/sessions/
+const maxSessions = 100
+
+// sessionIDLayout names sessions after their start time
+const sessionIDLayout = "20060102-150405"
+
+// Session summarizes one run of the watch daemon. It is saved to
+// .codemap/sessions/<id>.json while the daemon runs and when it stops, so it
+// outlives the daemon and the rotation of the event log.
+type Session struct {
+	ID         string        `json:"id"`
+	Start      time.Time     `json:"start"`
+	End        time.Time     `json:"end,omitzero"` // zero while running or if the daemon died
+	Branch     string        `json:"branch,omitempty"`
+	Events     int           `json:"events"`
+	FirstEvent time.Time     `json:"first_event,omitzero"`
+	LastEvent  time.Time     `json:"last_event,omitzero"`
+	Delta      int           `json:"delta"` // net line change
+	HubEdits   int           `json:"hub_edits"`
+	Moves      int           `json:"moves,omitempty"`
+	Commits    int           `json:"commits,omitempty"`   // commits and merges
+	Checkouts  int           `json:"checkouts,omitempty"` // branch switches, resets and rebases
+	Files      []SessionFile `json:"files,omitempty"`     // most edited first
+	Active     bool          `json:"active,omitempty"`    // the running daemon's session
+
+	index map[string]int // path -> position in Files
+}
+
+// SessionFile is one file touched in a session
+type SessionFile struct {
+	Path      string `json:"path"`
+	MovedFrom string `json:"moved_from,omitempty"` // path at session start, if moved since
+	Edits     int    `json:"edits"`
+	Delta     int    `json:"delta"`
+	IsHub     bool   `json:"is_hub,omitempty"`
+	// Net changes to its functions and types over the session
+	Symbols []SymbolChange `json:"symbols,omitempty"`
+}
+
+// SessionsDir returns where sessions of root are saved
+func SessionsDir(root string) string {
+	return filepath.Join(root, ".codemap", "sessions")
+}
+
+// newSession starts a session for root now. A daemon restarted within the
+// same second gets the ID with a -2, -3, ... suffix, so the last session
+// isn't overwritten.
+func newSession(root string, isGitRepo bool) *Session {
+	now := time.Now()
+	id := now.Format(sessionIDLayout)
+	for n := 2; sessionExists(root, id); n++ {
+		id = fmt.Sprintf("%s-%d", now.Format(sessionIDLayout), n)
+	}
+	s := &Session{ID: id, Start: now}
+	if isGitRepo {
+		s.Branch = currentBranch(root)
+	}
+	return s
+}
+
+// sessionExists reports whether a session with id was saved for root
+func sessionExists(root, id string) bool {
+	_, err := os.Stat(filepath.Join(SessionsDir(root), id+".json"))
+	return err == nil
+}
+
+// currentBranch returns the checked-out git branch (which may have no
+// commits yet), the short commit when detached, or "" if unknown
+func currentBranch(root string) string {
+	for _, args := range [][]string{{"branch", "--show-current"}, {"rev-parse", "--short", "HEAD"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+		if out, err := cmd.Output(); err == nil {
+			if branch := strings.TrimSpace(string(out)); branch != "" {
+				return branch
+			}
+		}
+	}
+	return ""
+}
+
+// record adds an event to the session's counters
+func (s *Session) record(e Event) {
+	if s.Events == 0 {
+		s.FirstEvent = e.Time
+	}
+	s.Events++
+	s.LastEvent = e.Time
+
+	// Git operations aren't edits; their file churn isn't counted
+	switch e.Op {
+	case "COMMIT", "MERGE":
+		s.Commits++
+		return
+	case "CHECKOUT":
+		s.Checkouts++
+		return
+	}
+
+	s.Delta += e.Delta
+	if e.IsHub {
+		s.HubEdits++
+	}
+
+	if s.index == nil {
+		s.index = make(map[string]int, len(s.Files))
+		for i, f := range s.Files {
+			s.index[f.Path] = i
+		}
+	}
+	if e.Op == "MOVE" {
+		s.Moves++
+		s.move(e.OldPath, e.Path)
+	}
+	i, ok := s.index[e.Path]
+	if !ok {
+		i = len(s.Files)
+		s.index[e.Path] = i
+		s.Files = append(s.Files, SessionFile{Path: e.Path})
+	}
+	f := &s.Files[i]
+	f.Edits++
+	f.Delta += e.Delta
+	f.IsHub = f.IsHub || e.IsHub
+	f.Symbols = MergeSymbolChanges(f.Symbols, e.Symbols)
+}
+
+// move carries the file entry at oldPath over to newPath, remembering where
+// the file started out
+func (s *Session) move(oldPath, newPath string) {
+	i, ok := s.index[oldPath]
+	if _, taken := s.index[newPath]; taken {
+		return
+	}
+	f := SessionFile{Path: oldPath}
+	if ok {
+		delete(s.index, oldPath)
+		f = s.Files[i]
+	} else {
+		i = len(s.Files)
+		s.Files = append(s.Files, f)
+	}
+	if f.MovedFrom == "" {
+		f.MovedFrom = oldPath
+	}
+	if f.MovedFrom == newPath {
+		f.MovedFrom = "" // moved back
+	}
+	f.Path = newPath
+	s.Files[i] = f
+	s.index[newPath] = i
+}
+
+// Duration is how long the session ran; for a session that is still running
+// or was cut short it runs until the last event
+func (s *Session) Duration() time.Duration {
+	if !s.End.IsZero() {
+		return s.End.Sub(s.Start)
+	}
+	if s.Active {
+		return time.Since(s.Start)
+	}
+	if s.LastEvent.After(s.Start) {
+		return s.LastEvent.Sub(s.Start)
+	}
+	return 0
+}
+
+// snapshot copies the session with its files sorted, most edited first
+func (s *Session) snapshot() Session {
+	c := *s
+	c.index = nil
+	c.Files = append([]SessionFile(nil), s.Files...)
+	for i := range c.Files {
+		c.Files[i].Symbols = slices.Clone(c.Files[i].Symbols)
+	}
+	sort.SliceStable(c.Files, func(i, j int) bool {
+		if c.Files[i].Edits != c.Files[j].Edits {
+			return c.Files[i].Edits > c.Files[j].Edits
+		}
+		return c.Files[i].Path < c.Files[j].Path
+	})
+	return c
+}
+
+// save writes the session to SessionsDir(root)
+func (s Session) save(root string) error {
+	dir := SessionsDir(root)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, s.ID+".json"), data, 0644)
+}
+
+// ListSessions returns the saved sessions of root, newest first. The
+// running daemon's session is marked Active.
+func ListSessions(root string) ([]Session, error) {
+	entries, err := os.ReadDir(SessionsDir(root))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []Session
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if s, err := LoadSession(root, id); err == nil {
+			sessions = append(sessions, *s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Start.After(sessions[j].Start) })
+
+	if len(sessions) > 0 && sessions[0].End.IsZero() && IsRunning(root) {
+		sessions[0].Active = true
+	}
+	return sessions, nil
+}
+
+// LoadSession reads one saved session of root
+func LoadSession(root, id string) (*Session, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid session id %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(SessionsDir(root), id+".json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no session %q", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("session %s: %w", id, err)
+	}
+	return &s, nil
+}
+
+// pruneSessions deletes all but the newest maxSessions session files
+func pruneSessions(root string) {
+	entries, err := os.ReadDir(SessionsDir(root))
+	if err != nil || len(entries) <= maxSessions {
+		return
+	}
+	// IDs are start times, with a suffix for restarts in the same second,
+	// so they sort oldest first
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), ".json"); ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for len(ids) > maxSessions {
+		os.Remove(filepath.Join(SessionsDir(root), ids[0]+".json"))
+		ids = ids[1:]
+	}
+}
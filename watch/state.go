@@ -2,16 +2,37 @@ package watch
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 )
 
-// ReadState reads the daemon state from disk (for hooks to use)
-// Returns nil if state doesn't exist or is stale (> 30 seconds old)
+// ReadState reads the daemon state snapshot from disk, the fallback when the
+// query API (see Client) can't be reached. Returns nil if state doesn't
+// exist, or is stale (> 30 seconds old) and no daemon is running.
 func ReadState(root string) *State {
+	state := LoadState(root)
+	if state == nil {
+		return nil
+	}
+
+	// The daemon only rewrites state on changes, so age alone doesn't mean
+	// it stopped
+	if time.Since(state.UpdatedAt) > 30*time.Second && !IsRunning(root) {
+		return nil
+	}
+
+	return state
+}
+
+// LoadState reads the daemon state from disk however old it is. The daemon
+// only rewrites it on changes, so callers that know the daemon is running
+// (see IsRunning) can trust it. Returns nil if it doesn't exist.
+func LoadState(root string) *State {
 	stateFile := filepath.Join(root, ".codemap", "state.json")
 	data, err := os.ReadFile(stateFile)
 	if err != nil {
@@ -22,46 +43,150 @@ func ReadState(root string) *State {
 	if err := json.Unmarshal(data, &state); err != nil {
 		return nil
 	}
+	return &state
+}
+
+// Stopping and locking
+const (
+	stopTimeout   = 10 * time.Second       // how long Stop waits before killing the daemon
+	killTimeout   = 2 * time.Second        // how long Stop waits for a killed daemon to go
+	lockRetry     = 200 * time.Millisecond // how long acquireLock waits out a probe (see lockHeld)
+	daemonLogSize = 1 << 20                // watch.log is rotated to .1 past this when a daemon starts
+)
+
+// ErrAlreadyRunning is returned when starting a daemon for a project that
+// another daemon already watches
+var ErrAlreadyRunning = errors.New("watch daemon already running")
+
+// errLocked is returned by lockFile when another process holds the lock
+var errLocked = errors.New("locked")
+
+// LockPath returns the lock file a daemon holds for as long as it watches
+// root, so two daemons can't watch the same project
+func LockPath(root string) string {
+	return filepath.Join(root, ".codemap", "watch.lock")
+}
+
+// DaemonLogPath returns where a background daemon's output goes
+func DaemonLogPath(root string) string {
+	return filepath.Join(root, ".codemap", "watch.log")
+}
+
+// pidPath returns the daemon's PID file
+func pidPath(root string) string {
+	return filepath.Join(root, ".codemap", "watch.pid")
+}
+
+// acquireLock takes the lock at path and records this process in it.
+// Returns errLocked if another process holds it.
+func acquireLock(path string) (*os.File, error) {
+	deadline := time.Now().Add(lockRetry)
+	for {
+		f, err := lockFile(path, true)
+		if err == nil {
+			f.Truncate(0)
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			return f, nil
+		}
+		// lockHeld takes the lock for a moment; don't mistake that for a daemon
+		if !errors.Is(err, errLocked) || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
 
-	// Check if state is fresh (daemon still running)
-	if time.Since(state.UpdatedAt) > 30*time.Second {
-		return nil // stale, daemon probably not running
+// lockHeld reports whether some process holds the lock at path. known is
+// false if there is no lock file, as with daemons from before lock files.
+func lockHeld(path string) (held, known bool) {
+	f, err := lockFile(path, false)
+	switch {
+	case err == nil:
+		f.Close()
+		return false, true
+	case errors.Is(err, errLocked):
+		return true, true
 	}
+	return false, false
+}
 
-	return &state
+// lockOwner returns the PID recorded in the lock file at path
+func lockOwner(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	var pid int
+	fmt.Sscanf(string(data), "%d", &pid)
+	return pid
 }
 
-// WritePID writes the daemon PID to .codemap/watch.pid
+// WritePID writes the daemon PID to .codemap/watch.pid, with the process
+// start time so IsRunning can tell if the PID was since reused
 func WritePID(root string) error {
-	pidFile := filepath.Join(root, ".codemap", "watch.pid")
-	return os.WriteFile(pidFile, []byte(fmt.Sprintf("%d", os.Getpid())), 0644)
+	return writePIDFile(pidPath(root), os.Getpid())
+}
+
+// writePIDFile records pid and its start time in path
+func writePIDFile(path string, pid int) error {
+	return os.WriteFile(path, []byte(fmt.Sprintf("%d\n%s\n", pid, processStartTime(pid))), 0644)
 }
 
 // ReadPID reads the daemon PID from .codemap/watch.pid
 func ReadPID(root string) (int, error) {
-	pidFile := filepath.Join(root, ".codemap", "watch.pid")
-	data, err := os.ReadFile(pidFile)
+	pid, _, err := readPIDFile(pidPath(root))
+	return pid, err
+}
+
+// readPIDFile reads a PID file, returning the PID and the start time it
+// recorded ("" in PID files from before start times were recorded)
+func readPIDFile(path string) (int, string, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 	var pid int
-	_, err = fmt.Sscanf(string(data), "%d", &pid)
-	return pid, err
+	if _, err := fmt.Sscanf(string(data), "%d", &pid); err != nil {
+		return 0, "", err
+	}
+	_, start, _ := strings.Cut(string(data), "\n")
+	return pid, strings.TrimSpace(start), nil
 }
 
 // RemovePID removes the PID file
 func RemovePID(root string) {
-	pidFile := filepath.Join(root, ".codemap", "watch.pid")
-	os.Remove(pidFile)
+	os.Remove(pidPath(root))
 }
 
-// IsRunning checks if the daemon is running
+// IsRunning checks if the daemon is running: its PID file names a live
+// process that started when the file says (so a PID reused after a reboot
+// doesn't count), and the daemon still holds its lock
 func IsRunning(root string) bool {
-	pid, err := ReadPID(root)
+	pid, start, err := readPIDFile(pidPath(root))
 	if err != nil {
 		return false
 	}
-	// Check if process exists by sending signal 0
+	if held, known := lockHeld(LockPath(root)); known && !held {
+		return false
+	}
+	return sameProcess(pid, start)
+}
+
+// sameProcess reports whether pid is alive and is the process that started
+// at start. Start times that can't be read aren't compared.
+func sameProcess(pid int, start string) bool {
+	if !processAlive(pid) {
+		return false
+	}
+	if start == "" {
+		return true
+	}
+	now := processStartTime(pid)
+	return now == "" || now == start
+}
+
+// processAlive checks whether a process with pid exists
+func processAlive(pid int) bool {
 	proc, err := os.FindProcess(pid)
 	if err != nil {
 		return false
@@ -71,20 +196,66 @@ func IsRunning(root string) bool {
 	return err == nil
 }
 
-// Stop sends SIGTERM to the daemon process
+// Stop asks the daemon to shut down and waits for it to exit, killing it
+// if it hasn't after a timeout. If the daemon is one of the supervisor's
+// projects, the supervisor is asked to stop watching root instead.
 func Stop(root string) error {
-	pid, err := ReadPID(root)
+	pid, start, err := readPIDFile(pidPath(root))
 	if err != nil {
 		return fmt.Errorf("no daemon running: %w", err)
 	}
+	if !sameProcess(pid, start) {
+		RemovePID(root)
+		return fmt.Errorf("no daemon running (stale pid %d)", pid)
+	}
+	if pid == SupervisorPID() {
+		return NewSupervisorClient().Remove(root)
+	}
+	killed, err := stopProcess(pid, LockPath(root), stopTimeout)
+	if killed {
+		// It had no chance to clean up after itself
+		RemovePID(root)
+		os.Remove(SocketPath(root))
+	}
+	return err
+}
+
+// stopProcess terminates pid and waits until it exits or releases the lock
+// at lockPath, killing it after timeout. Reports whether it had to be killed.
+func stopProcess(pid int, lockPath string, timeout time.Duration) (bool, error) {
 	proc, err := os.FindProcess(pid)
 	if err != nil {
-		return err
+		return false, err
 	}
-	if err := proc.Signal(syscall.SIGTERM); err != nil {
-		return err
+	gone := func() bool {
+		if held, known := lockHeld(lockPath); known && !held && lockOwner(lockPath) == pid {
+			return true
+		}
+		return !processAlive(pid)
+	}
+	if err := terminate(proc); err != nil && !gone() {
+		return false, err
+	}
+	if waitFor(gone, timeout) {
+		return false, nil
+	}
+	if err := proc.Kill(); err != nil && !gone() {
+		return true, fmt.Errorf("killing pid %d: %w", pid, err)
+	}
+	if !waitFor(gone, killTimeout) {
+		return true, fmt.Errorf("pid %d still running after kill", pid)
+	}
+	return true, nil
+}
+
+// waitFor polls done until it returns true, or timeout passes
+func waitFor(done func() bool, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
 	}
-	// Clean up PID file
-	RemovePID(root)
-	return nil
+	return true
 }
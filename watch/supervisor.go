@@ -0,0 +1,437 @@
+package watch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SupervisorDir returns the user-level directory of the supervisor, which
+// watches several projects in one process: $CODEMAP_HOME, or codemap/ in
+// the user config dir. Each project still keeps its own .codemap/ files.
+func SupervisorDir() (string, error) {
+	if dir := os.Getenv("CODEMAP_HOME"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "codemap"), nil
+}
+
+// supervisorFile returns a file in SupervisorDir
+func supervisorFile(name string) (string, error) {
+	dir, err := SupervisorDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// supervisorSocket returns where the supervisor serves its API, moved to
+// the temp dir like SocketPath when the path is too long
+func supervisorSocket() (string, error) {
+	path, err := supervisorFile("supervisor.sock")
+	if err != nil || len(path) <= maxSocketPath {
+		return path, err
+	}
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(os.TempDir(), "codemap-supervisor-"+hex.EncodeToString(sum[:8])+".sock"), nil
+}
+
+// registry is the list of projects the supervisor watches, saved to
+// projects.json so they are watched again when it restarts
+type registry struct {
+	Projects []string `json:"projects"`
+}
+
+// Projects returns the projects registered with the supervisor
+func Projects() ([]string, error) {
+	path, err := supervisorFile("projects.json")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r registry
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return r.Projects, nil
+}
+
+// saveProjects writes the registered projects, sorted
+func saveProjects(projects []string) error {
+	path, err := supervisorFile("projects.json")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	sort.Strings(projects)
+	data, err := json.MarshalIndent(registry{Projects: projects}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Project statuses reported by the supervisor
+const (
+	ProjectStarting = "starting" // initial scan running
+	ProjectRunning  = "running"
+	ProjectFailed   = "failed"
+)
+
+// Project is one project in the supervisor's status
+type Project struct {
+	Root   string  `json:"root"`
+	Status string  `json:"status"` // ProjectStarting, ProjectRunning or ProjectFailed
+	Error  string  `json:"error,omitempty"`
+	Health *Health `json:"health,omitempty"` // while running
+}
+
+// Supervisor runs the daemons of several projects in one process. Each
+// daemon serves its own socket and gets a PID file naming the supervisor,
+// so hooks, MCP and IsRunning can't tell it from a standalone daemon.
+type Supervisor struct {
+	mu       sync.Mutex
+	projects map[string]*supervised
+	server   *http.Server
+	lock     *os.File // supervisor.lock, held while serving
+	verbose  bool
+}
+
+// supervised is a project's daemon and how its start went
+type supervised struct {
+	daemon *Daemon // nil until started
+	status string
+	err    error
+}
+
+// NewSupervisor returns a supervisor watching no projects yet
+func NewSupervisor(verbose bool) *Supervisor {
+	return &Supervisor{projects: make(map[string]*supervised), verbose: verbose}
+}
+
+// Start begins watching the registered projects, in the background; see
+// Projects for how each start went
+func (s *Supervisor) Start() error {
+	roots, err := Projects()
+	if err != nil {
+		return err
+	}
+	for _, root := range roots {
+		if err := s.Add(root); err != nil && s.verbose {
+			fmt.Printf("[supervisor] %s: %v\n", root, err)
+		}
+	}
+	return nil
+}
+
+// Add registers root and starts watching it. The initial scan runs in the
+// background; the project's PID file appears once it is done, as with a
+// standalone daemon (see WaitRunning).
+func (s *Supervisor) Add(root string) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("invalid root path: %w", err)
+	}
+	if info, err := os.Stat(absRoot); err != nil || !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", absRoot)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.projects[absRoot]; ok && p.status != ProjectFailed {
+		return nil
+	}
+	if IsRunning(absRoot) {
+		pid, _ := ReadPID(absRoot)
+		return fmt.Errorf("already watched by another daemon (pid %d); stop it first", pid)
+	}
+	p := &supervised{status: ProjectStarting}
+	s.projects[absRoot] = p
+	if err := s.register(absRoot, true); err != nil && s.verbose {
+		fmt.Printf("[supervisor] Saving projects: %v\n", err)
+	}
+
+	go s.start(absRoot, p)
+	return nil
+}
+
+// start runs a project's initial scan and brings up its daemon
+func (s *Supervisor) start(root string, p *supervised) {
+	d, err := NewDaemon(root, s.verbose)
+	if err == nil {
+		d.supervised = true
+		if err = d.Start(); err != nil {
+			d.watcher.Close()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.projects[root] != p {
+		// Removed (or the supervisor stopped) during the scan
+		if err == nil {
+			d.Stop()
+		}
+		return
+	}
+	if err != nil {
+		p.status, p.err = ProjectFailed, err
+		return
+	}
+	if err := d.Serve(); err != nil && s.verbose {
+		fmt.Printf("[supervisor] %s: query API unavailable: %v\n", root, err)
+	}
+	if err := WritePID(root); err != nil {
+		d.Stop()
+		p.status, p.err = ProjectFailed, err
+		return
+	}
+	p.daemon, p.status = d, ProjectRunning
+}
+
+// Remove stops watching root and unregisters it
+func (s *Supervisor) Remove(root string) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("invalid root path: %w", err)
+	}
+
+	s.mu.Lock()
+	p, ok := s.projects[absRoot]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("not watching %s", absRoot)
+	}
+	delete(s.projects, absRoot)
+	err = s.register(absRoot, false)
+	s.mu.Unlock()
+
+	if p.daemon != nil {
+		p.daemon.Stop()
+	}
+	return err
+}
+
+// register adds root to or removes it from projects.json. Must be called
+// with s.mu held.
+func (s *Supervisor) register(root string, add bool) error {
+	projects, err := Projects()
+	if err != nil {
+		return err
+	}
+	i := slices.Index(projects, root)
+	switch {
+	case add && i < 0:
+		projects = append(projects, root)
+	case !add && i >= 0:
+		projects = slices.Delete(projects, i, i+1)
+	default:
+		return nil
+	}
+	return saveProjects(projects)
+}
+
+// Projects returns the status of every project, sorted by root
+func (s *Supervisor) Projects() []Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	projects := make([]Project, 0, len(s.projects))
+	for root, p := range s.projects {
+		proj := Project{Root: root, Status: p.status}
+		if p.err != nil {
+			proj.Error = p.err.Error()
+		}
+		if p.daemon != nil {
+			h := p.daemon.health()
+			proj.Health = &h
+		}
+		projects = append(projects, proj)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Root < projects[j].Root })
+	return projects
+}
+
+// Serve starts the supervisor's API and writes its PID file, marking it as
+// running. Fails if another supervisor is running.
+func (s *Supervisor) Serve() error {
+	lockPath, err := supervisorFile("supervisor.lock")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return err
+	}
+	s.lock, err = acquireLock(lockPath)
+	if errors.Is(err, errLocked) {
+		return fmt.Errorf("supervisor already running (pid %d)", lockOwner(lockPath))
+	}
+	if err != nil {
+		return err
+	}
+
+	path, err := supervisorSocket()
+	if err != nil {
+		return err
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /projects", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.Projects())
+	})
+	mux.HandleFunc("POST /projects", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Add(r.URL.Query().Get("root")); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("DELETE /projects", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Remove(r.URL.Query().Get("root")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	})
+
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := s.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) && s.verbose {
+			fmt.Printf("[supervisor] API stopped: %v\n", err)
+		}
+	}()
+
+	pidFile, err := supervisorFile("supervisor.pid")
+	if err != nil {
+		return err
+	}
+	return writePIDFile(pidFile, os.Getpid())
+}
+
+// Stop stops every daemon, keeping the projects registered for the next
+// start
+func (s *Supervisor) Stop() {
+	if pidFile, err := supervisorFile("supervisor.pid"); err == nil {
+		os.Remove(pidFile)
+	}
+	if s.server != nil {
+		s.server.Close()
+		if path, err := supervisorSocket(); err == nil {
+			os.Remove(path)
+		}
+	}
+
+	s.mu.Lock()
+	projects := s.projects
+	s.projects = make(map[string]*supervised)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range projects {
+		if p.daemon == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.daemon.Stop()
+		}()
+	}
+	wg.Wait()
+
+	if s.lock != nil {
+		s.lock.Close()
+	}
+}
+
+// SupervisorPID returns the running supervisor's PID, or 0 if none runs,
+// checked the way IsRunning checks a daemon
+func SupervisorPID() int {
+	pidFile, err := supervisorFile("supervisor.pid")
+	if err != nil {
+		return 0
+	}
+	pid, start, err := readPIDFile(pidFile)
+	if err != nil {
+		return 0
+	}
+	if held, known := lockHeld(filepath.Join(filepath.Dir(pidFile), "supervisor.lock")); known && !held {
+		return 0
+	}
+	if !sameProcess(pid, start) {
+		return 0
+	}
+	return pid
+}
+
+// SupervisorLogPath returns where the background supervisor's output goes
+func SupervisorLogPath() (string, error) {
+	return supervisorFile("supervisor.log")
+}
+
+// StopSupervisor stops the running supervisor and waits for it to exit,
+// killing it if it hasn't after a timeout. Its projects stay registered.
+func StopSupervisor() error {
+	pid := SupervisorPID()
+	if pid == 0 {
+		return errors.New("supervisor not running")
+	}
+	lockPath, err := supervisorFile("supervisor.lock")
+	if err != nil {
+		return err
+	}
+	killed, err := stopProcess(pid, lockPath, stopTimeout)
+	if killed {
+		if pidFile, err := supervisorFile("supervisor.pid"); err == nil {
+			os.Remove(pidFile)
+		}
+		if path, err := supervisorSocket(); err == nil {
+			os.Remove(path)
+		}
+	}
+	return err
+}
+
+// WatchedRoot returns the watched project that path is in: the nearest
+// directory at or above path with a running daemon, standalone or
+// supervised
+func WatchedRoot(path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if IsRunning(dir) {
+			return dir, true
+		}
+		if dir == filepath.Dir(dir) {
+			return "", false
+		}
+	}
+}
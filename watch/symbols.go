@@ -0,0 +1,205 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"codemap/scanner"
+)
+
+// SymbolChange is a function or type that an edit added, removed or gave a
+// new signature
+type SymbolChange struct {
+	Change       string `json:"change"`                  // added, removed, signature
+	Kind         string `json:"kind"`                    // function, method, class, ...
+	Name         string `json:"name"`                    // Type.Method for methods
+	Signature    string `json:"signature,omitempty"`     // the last known signature
+	OldSignature string `json:"old_signature,omitempty"` // signature changes: the one before
+}
+
+// String describes the change, e.g. "changed signature of `ScanFiles`"
+func (c SymbolChange) String() string {
+	switch c.Change {
+	case "added":
+		return fmt.Sprintf("added %s `%s`", c.Kind, c.Name)
+	case "removed":
+		return fmt.Sprintf("removed %s `%s`", c.Kind, c.Name)
+	default:
+		return fmt.Sprintf("changed signature of `%s`", c.Name)
+	}
+}
+
+// SummarizeSymbols describes up to max changes (all if max <= 0) in one line
+func SummarizeSymbols(changes []SymbolChange, max int) string {
+	var parts []string
+	for i, c := range changes {
+		if max > 0 && i >= max {
+			parts = append(parts, fmt.Sprintf("+%d more", len(changes)-max))
+			break
+		}
+		parts = append(parts, c.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// trackedKinds are the symbol kinds whose changes are reported
+var trackedKinds = map[scanner.SymbolKind]bool{
+	scanner.KindFunction:  true,
+	scanner.KindMethod:    true,
+	scanner.KindClass:     true,
+	scanner.KindInterface: true,
+	scanner.KindType:      true,
+	scanner.KindEnum:      true,
+}
+
+// trackedSymbols keeps the function and type definitions of a file
+func trackedSymbols(symbols []scanner.Symbol) []scanner.Symbol {
+	tracked := []scanner.Symbol{}
+	for _, sym := range symbols {
+		if sym.Role == scanner.RoleDefinition && trackedKinds[sym.Kind] && sym.Name != "" {
+			tracked = append(tracked, scanner.Symbol{Name: sym.Name, Kind: sym.Kind, Scope: sym.Scope, Signature: sym.Signature})
+		}
+	}
+	return tracked
+}
+
+// qualifiedName names a symbol within its file: Type.Method for methods
+func qualifiedName(sym scanner.Symbol) string {
+	if _, owner, ok := strings.Cut(sym.Scope, ":"); ok && owner != "" {
+		return owner + "." + sym.Name
+	}
+	return sym.Name
+}
+
+// diffSymbols compares a file's definitions before and after an edit.
+// Signature changes come first, then additions and removals, each by name.
+func diffSymbols(before, after []scanner.Symbol) []SymbolChange {
+	index := func(symbols []scanner.Symbol) map[string]scanner.Symbol {
+		m := make(map[string]scanner.Symbol, len(symbols))
+		for _, sym := range symbols {
+			m[string(sym.Kind)+" "+qualifiedName(sym)] = sym
+		}
+		return m
+	}
+	old, cur := index(before), index(after)
+
+	var changes []SymbolChange
+	for key, sym := range cur {
+		change := SymbolChange{Kind: string(sym.Kind), Name: qualifiedName(sym), Signature: sym.Signature}
+		prev, existed := old[key]
+		switch {
+		case !existed:
+			change.Change = "added"
+		case prev.Signature != sym.Signature && prev.Signature != "" && sym.Signature != "":
+			change.Change = "signature"
+			change.OldSignature = prev.Signature
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	for key, sym := range old {
+		if _, exists := cur[key]; !exists {
+			changes = append(changes, SymbolChange{Change: "removed", Kind: string(sym.Kind), Name: qualifiedName(sym), Signature: sym.Signature})
+		}
+	}
+
+	order := map[string]int{"signature": 0, "added": 1, "removed": 2}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Change != changes[j].Change {
+			return order[changes[i].Change] < order[changes[j].Change]
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// MergeSymbolChanges folds later changes into earlier ones so each symbol
+// shows its net change: a function added and then re-signed is just added,
+// and one added and removed again drops out
+func MergeSymbolChanges(changes, later []SymbolChange) []SymbolChange {
+	for _, c := range later {
+		i := slices.IndexFunc(changes, func(p SymbolChange) bool { return p.Kind == c.Kind && p.Name == c.Name })
+		if i < 0 {
+			changes = append(changes, c)
+			continue
+		}
+		p := changes[i]
+		switch {
+		case p.Change == "added" && c.Change == "removed":
+			changes = slices.Delete(changes, i, i+1)
+			continue
+		case p.Change == "added":
+			p.Signature = c.Signature
+		case p.Change == "removed" && c.Change == "added", p.Change == "signature" && c.Change == "signature":
+			old := p.OldSignature
+			if p.Change == "removed" {
+				old = p.Signature
+			}
+			if old == c.Signature {
+				changes = slices.Delete(changes, i, i+1)
+				continue
+			}
+			p = SymbolChange{Change: "signature", Kind: c.Kind, Name: c.Name, Signature: c.Signature, OldSignature: old}
+		case p.Change == "signature" && c.Change == "removed":
+			p = SymbolChange{Change: "removed", Kind: c.Kind, Name: c.Name, Signature: p.OldSignature}
+		default:
+			p = c
+		}
+		changes[i] = p
+	}
+	return changes
+}
+
+// computeSymbols records the functions and types of every file so edits
+// can be diffed against them (best effort - needs ast-grep)
+func (d *Daemon) computeSymbols(ctx context.Context) {
+	sg := d.sg
+	if sg == nil {
+		var err error
+		if sg, err = scanner.NewAstGrepScanner(); err != nil {
+			return
+		}
+		if !sg.Available() {
+			sg.Close()
+			return
+		}
+	}
+
+	// A project without sources yet keeps sg, so files added later are
+	// diffed; only an ast-grep that fails stops it from running on every edit
+	analyses, err := sg.ScanSymbols(ctx, d.root, false)
+	if err != nil {
+		sg.Close()
+		d.sg = nil
+		if d.verbose {
+			fmt.Printf("[watch] Symbols unavailable: %v\n", err)
+		}
+		return
+	}
+
+	symbols := make(map[string][]scanner.Symbol, len(analyses))
+	for _, a := range analyses {
+		symbols[a.Path] = trackedSymbols(a.Symbols)
+	}
+	d.graph.mu.Lock()
+	d.graph.Symbols = symbols
+	d.graph.mu.Unlock()
+	d.sg = sg
+}
+
+// scanFileSymbols returns the functions and types a file defines now, or
+// false if it couldn't be scanned
+func (d *Daemon) scanFileSymbols(path string) ([]scanner.Symbol, bool) {
+	if d.sg == nil {
+		return nil, false
+	}
+	a, err := d.sg.ScanFileSymbols(context.Background(), d.root, path, false)
+	if err != nil || a == nil {
+		return nil, false
+	}
+	return trackedSymbols(a.Symbols), true
+}
@@ -0,0 +1,326 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"codemap/config"
+	"codemap/scanner"
+)
+
+// Trigger defaults, for settings left out of the config
+const (
+	triggerDebounce      = time.Second
+	triggerTimeout       = 5 * time.Minute
+	triggerMaxConcurrent = 2
+	triggerMaxPending    = 1000    // events kept per firing; older ones are dropped
+	triggerLogMaxSize    = 1 << 20 // triggers.log is rotated to .1 past this
+)
+
+// TriggersLogPath returns where the output of trigger commands is logged
+func TriggersLogPath(root string) string {
+	return filepath.Join(root, ".codemap", "triggers.log")
+}
+
+// triggers runs the configured actions for matching events. Each trigger
+// fires once its events have been quiet for its debounce time, never runs
+// twice at once (events during a run fire it again afterwards), and at most
+// max_concurrent commands run across all triggers.
+type triggers struct {
+	root    string
+	verbose bool
+	sem     chan struct{} // one slot per running command
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup // running actions
+
+	mu     sync.Mutex // guards the trigger states and closed
+	list   []*trigger
+	closed bool
+
+	untrusted int // actions skipped until the user trusts them
+
+	logMu sync.Mutex // serializes writes to triggers.log
+}
+
+// trigger is one configured trigger and its firing state
+type trigger struct {
+	config.Trigger
+	ops     map[string]bool
+	pending []Event     // matched since the last firing
+	timer   *time.Timer // nil when nothing is pending
+	running bool
+	rerun   bool // fired while running; fire again when done
+}
+
+// newTriggers prepares the triggers in cfg; nil if there are none. Unless
+// the user trusted them (see TrustTriggers), none of them run.
+func newTriggers(root string, cfg config.Watch, verbose bool) *triggers {
+	if len(cfg.Triggers) == 0 {
+		return nil
+	}
+	actions := trustedActions(cfg.Triggers)
+	trusted := isTrusted(root, actions)
+	limit := cfg.MaxConcurrent
+	if limit == 0 {
+		limit = triggerMaxConcurrent
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &triggers{
+		root:    root,
+		verbose: verbose,
+		sem:     make(chan struct{}, limit),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	if !trusted {
+		t.untrusted = len(actions)
+		return t
+	}
+	for _, c := range cfg.Triggers {
+		tr := &trigger{Trigger: c, ops: make(map[string]bool, len(c.Ops))}
+		for _, op := range c.Ops {
+			tr.ops[strings.ToUpper(op)] = true
+		}
+		t.list = append(t.list, tr)
+	}
+	return t
+}
+
+// count returns how many triggers are configured
+func (t *triggers) count() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.list)
+}
+
+// untrustedCount returns how many actions are skipped until trusted
+func (t *triggers) untrustedCount() int {
+	if t == nil {
+		return 0
+	}
+	return t.untrusted
+}
+
+// tracks reports whether some trigger's path names relPath, so files
+// codemap has no language for (go.mod) are watched for it
+func (t *triggers) tracks(relPath string) bool {
+	if t == nil {
+		return false
+	}
+	for _, tr := range t.list {
+		if tr.Path != "" && scanner.MatchGlob(tr.Path, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether e meets all of the trigger's conditions
+func (tr *trigger) matches(e Event) bool {
+	if len(tr.ops) > 0 && !tr.ops[e.Op] {
+		return false
+	}
+	if tr.Path != "" && !scanner.MatchGlob(tr.Path, e.Path) && (e.OldPath == "" || !scanner.MatchGlob(tr.Path, e.OldPath)) {
+		return false
+	}
+	if tr.Hub && !e.IsHub {
+		return false
+	}
+	return e.Importers >= tr.MinImporters
+}
+
+// handle queues e for the triggers it matches. Registered with OnEvent, so
+// it only starts timers.
+func (t *triggers) handle(e Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	for _, tr := range t.list {
+		if !tr.matches(e) {
+			continue
+		}
+		tr.pending = append(tr.pending, e)
+		if len(tr.pending) > triggerMaxPending {
+			tr.pending = tr.pending[len(tr.pending)-triggerMaxPending:]
+		}
+		debounce := time.Duration(tr.Debounce)
+		if debounce == 0 {
+			debounce = triggerDebounce
+		}
+		if tr.timer == nil {
+			tr.timer = time.AfterFunc(debounce, func() { t.fire(tr) })
+		} else {
+			tr.timer.Reset(debounce)
+		}
+	}
+}
+
+// fire runs the trigger's action on its pending events, or marks it to run
+// again if it is still running
+func (t *triggers) fire(tr *trigger) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tr.timer = nil
+	if t.closed || len(tr.pending) == 0 {
+		return
+	}
+	if tr.running {
+		tr.rerun = true
+		return
+	}
+	events := tr.pending
+	tr.pending = nil
+	tr.running = true
+	t.wg.Add(1)
+	go t.run(tr, events)
+}
+
+// run executes one firing and fires again if events arrived meanwhile
+func (t *triggers) run(tr *trigger, events []Event) {
+	defer t.wg.Done()
+	if tr.Notify != "" {
+		if err := t.appendNotify(tr, events); err != nil {
+			t.logf("%s: %v", tr.ID(), err)
+		}
+	}
+	if tr.Command != "" {
+		select {
+		case t.sem <- struct{}{}:
+			t.runCommand(tr, events)
+			<-t.sem
+		case <-t.ctx.Done():
+		}
+	}
+
+	t.mu.Lock()
+	tr.running = false
+	again := tr.rerun
+	tr.rerun = false
+	t.mu.Unlock()
+	if again {
+		t.fire(tr)
+	}
+}
+
+// eventLines encodes events as JSON lines
+func eventLines(events []Event) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		enc.Encode(e)
+	}
+	return buf.Bytes()
+}
+
+// appendNotify appends the events to the trigger's notify file
+func (t *triggers) appendNotify(tr *trigger, events []Event) error {
+	path := tr.Notify
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(t.root, path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(eventLines(events))
+	return err
+}
+
+// runCommand runs the trigger's command with the events on stdin and logs
+// its output to triggers.log
+func (t *triggers) runCommand(tr *trigger, events []Event) {
+	timeout := time.Duration(tr.Timeout)
+	if timeout == 0 {
+		timeout = triggerTimeout
+	}
+	ctx, cancel := context.WithTimeout(t.ctx, timeout)
+	defer cancel()
+
+	last := events[len(events)-1]
+	cmd := shellCommand(ctx, tr.Command)
+	cmd.Dir = t.root
+	cmd.Stdin = bytes.NewReader(eventLines(events))
+	cmd.Env = append(os.Environ(),
+		"CODEMAP_ROOT="+t.root,
+		"CODEMAP_TRIGGER="+tr.ID(),
+		"CODEMAP_EVENTS="+strconv.Itoa(len(events)),
+		"CODEMAP_OP="+last.Op,
+		"CODEMAP_PATH="+last.Path,
+	)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	status := "ok"
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		status = fmt.Sprintf("timed out after %v", timeout)
+	case t.ctx.Err() != nil:
+		status = "killed (daemon stopped)"
+	case err != nil:
+		status = err.Error()
+	}
+	t.logf("%s: %d event(s), last %s %s; %s in %v\n%s", tr.ID(), len(events), last.Op, last.DisplayPath(), status, time.Since(start).Round(time.Millisecond), out.Bytes())
+}
+
+// logf appends a timestamped entry to triggers.log, rotating it when full
+func (t *triggers) logf(format string, args ...any) {
+	t.logMu.Lock()
+	defer t.logMu.Unlock()
+
+	msg := fmt.Sprintf(format, args...)
+	if t.verbose {
+		fmt.Printf("[watch] Trigger %s\n", strings.TrimRight(msg, "\n"))
+	}
+	path := TriggersLogPath(t.root)
+	if info, err := os.Stat(path); err == nil && info.Size() >= triggerLogMaxSize {
+		os.Rename(path, rotatedLog(path, 1))
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	fmt.Fprintf(f, "%s %s", time.Now().Format("2006-01-02 15:04:05"), msg)
+}
+
+// stop drops pending events and kills running commands
+func (t *triggers) stop() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.closed = true
+	for _, tr := range t.list {
+		if tr.timer != nil {
+			tr.timer.Stop()
+			tr.timer = nil
+		}
+		tr.pending = nil
+	}
+	t.mu.Unlock()
+	t.cancel()
+	t.wg.Wait()
+}
@@ -0,0 +1,156 @@
+package watch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"codemap/config"
+)
+
+// Trigger commands come from .codemap/config.json, which is usually
+// committed, and hooks start the daemon on their own, so opening a cloned
+// repository must not run its commands. They only run once the user has
+// trusted them with codemap watch trust, which records a hash of them in
+// trusted.json in SupervisorDir; changing them makes them untrusted again.
+// Notify files need the same trust, since they can name any file in the
+// project, .git/hooks included.
+
+// trustStore maps project roots to the hash of their trusted actions
+type trustStore struct {
+	Projects map[string]string `json:"projects"`
+}
+
+// trustedActions lists the actions of triggers, which need the user's trust
+func trustedActions(triggers []config.Trigger) []string {
+	var actions []string
+	for _, tr := range triggers {
+		if tr.Command != "" {
+			actions = append(actions, "command: "+tr.Command)
+		}
+		if tr.Notify != "" {
+			actions = append(actions, "notify: "+tr.Notify)
+		}
+	}
+	return actions
+}
+
+// actionsHash identifies a list of trusted actions
+func actionsHash(actions []string) string {
+	data, _ := json.Marshal(actions)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadTrust reads trusted.json; empty if it doesn't exist
+func loadTrust() (trustStore, error) {
+	s := trustStore{Projects: map[string]string{}}
+	path, err := supervisorFile("trusted.json")
+	if err != nil {
+		return s, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	if s.Projects == nil {
+		s.Projects = map[string]string{}
+	}
+	return s, nil
+}
+
+// saveTrust writes trusted.json, replacing it whole
+func saveTrust(s trustStore) error {
+	path, err := supervisorFile("trusted.json")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// isTrusted reports whether the user trusted these actions for root
+func isTrusted(root string, actions []string) bool {
+	if len(actions) == 0 {
+		return true
+	}
+	s, err := loadTrust()
+	return err == nil && s.Projects[root] == actionsHash(actions)
+}
+
+// UntrustedTriggers returns the trigger actions in root's config that
+// won't run until the user trusts them; nil if there are none
+func UntrustedTriggers(root string) ([]string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.Load(absRoot)
+	if err != nil {
+		return nil, err
+	}
+	actions := trustedActions(cfg.Watch.Triggers)
+	if isTrusted(absRoot, actions) {
+		return nil, nil
+	}
+	return actions, nil
+}
+
+// TrustTriggers lets the trigger actions in root's current config run and
+// returns them; nil if the config has none
+func TrustTriggers(root string) ([]string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.Load(absRoot)
+	if err != nil {
+		return nil, err
+	}
+	actions := trustedActions(cfg.Watch.Triggers)
+	if len(actions) == 0 {
+		return nil, nil
+	}
+	s, err := loadTrust()
+	if err != nil {
+		return nil, err
+	}
+	s.Projects[absRoot] = actionsHash(actions)
+	return actions, saveTrust(s)
+}
+
+// UntrustTriggers forgets that the user trusted root's trigger actions
+func UntrustTriggers(root string) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	s, err := loadTrust()
+	if err != nil {
+		return err
+	}
+	if _, ok := s.Projects[absRoot]; !ok {
+		return nil
+	}
+	delete(s.Projects, absRoot)
+	return saveTrust(s)
+}
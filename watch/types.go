@@ -1,6 +1,8 @@
 package watch
 
 import (
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,9 +12,10 @@ import (
 // Event represents a file change event with timestamp and structural context
 type Event struct {
 	Time      time.Time `json:"time"`
-	Op        string    `json:"op"`             // CREATE, WRITE, REMOVE, RENAME
-	Path      string    `json:"path"`           // relative path
-	Language  string    `json:"lang,omitempty"` // go, py, js, etc.
+	Op        string    `json:"op"`                 // CREATE, WRITE, REMOVE, RENAME, MOVE
+	Path      string    `json:"path"`               // relative path
+	OldPath   string    `json:"old_path,omitempty"` // MOVE: where the file was
+	Language  string    `json:"lang,omitempty"`     // go, py, js, etc.
 	Lines     int       `json:"lines,omitempty"`
 	Delta     int       `json:"delta,omitempty"` // line count change (+/-)
 	SizeDelta int64     `json:"size_delta,omitempty"`
@@ -22,12 +25,79 @@ type Event struct {
 	Imports    int      `json:"imports,omitempty"`     // how many files this imports
 	IsHub      bool     `json:"is_hub,omitempty"`      // importers >= 3
 	RelatedHot []string `json:"related_hot,omitempty"` // connected files also edited recently
+	// Functions and types the edit added, removed or re-signed
+	Symbols []SymbolChange `json:"symbols,omitempty"`
+	// Git operations (COMMIT, CHECKOUT, MERGE)
+	Branch    string `json:"branch,omitempty"`     // checked out afterwards; "" if detached
+	OldBranch string `json:"old_branch,omitempty"` // CHECKOUT: checked out before
+	Commit    string `json:"commit,omitempty"`     // HEAD afterwards
+	OldCommit string `json:"old_commit,omitempty"` // HEAD before
+	Message   string `json:"message,omitempty"`    // reflog message, e.g. "commit: Fix parser"
+	Files     int    `json:"files,omitempty"`      // working-tree files the operation changed
+}
+
+// DisplayPath returns the path for display: "old -> new" for moves, and
+// a summary such as "main -> feature (12 files)" for git operations
+func (e Event) DisplayPath() string {
+	if e.IsGit() {
+		return e.gitSummary()
+	}
+	if e.Op == "MOVE" && e.OldPath != "" {
+		return e.OldPath + " -> " + e.Path
+	}
+	return e.Path
+}
+
+// IsGit reports whether the event is a git operation rather than a file change
+func (e Event) IsGit() bool {
+	return e.Op == "COMMIT" || e.Op == "CHECKOUT" || e.Op == "MERGE"
+}
+
+func (e Event) gitSummary() string {
+	at := e.Branch
+	if at == "" {
+		at = shortCommit(e.Commit)
+	}
+	var s string
+	switch {
+	case e.Op == "CHECKOUT" && e.OldBranch != "" && e.OldBranch != e.Branch:
+		s = e.OldBranch + " -> " + at
+	case e.Op == "CHECKOUT" && e.OldCommit != "" && e.OldCommit != e.Commit:
+		s = at + " " + shortCommit(e.OldCommit) + " -> " + shortCommit(e.Commit)
+	default:
+		s = at
+		if e.Branch != "" && e.Commit != "" {
+			s += " " + shortCommit(e.Commit)
+		}
+	}
+	if e.Op != "CHECKOUT" && e.Message != "" {
+		msg := e.Message
+		if strings.HasPrefix(msg, "commit") {
+			_, msg, _ = strings.Cut(msg, ": ") // just the subject
+		}
+		s += " " + msg
+	}
+	if e.Files > 0 {
+		s += fmt.Sprintf(" (%d files)", e.Files)
+	}
+	return s
+}
+
+// shortCommit abbreviates a commit hash for display
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
 }
 
 // FileState tracks lightweight per-file state for delta calculations
+// and for recognizing a file after it moves
 type FileState struct {
 	Lines int
 	Size  int64
+	Inode uint64 // 0 where unsupported
+	Hash  uint64 // FNV-1a of the content
 }
 
 // DepContext holds pre-computed dependency context for a file
@@ -44,7 +114,8 @@ type Graph struct {
 	FileGraph *scanner.FileGraph           // internal file-to-file dependencies
 	DepCtx    map[string]*DepContext       // path -> dependency context (precomputed)
 	State     map[string]*FileState        // path -> line/size cache for deltas
-	Events    []Event
+	Symbols   map[string][]scanner.Symbol  // path -> functions and types, for symbol diffs
+	Events    *EventRing                   // newest events, bounded
 	LastScan  time.Time
 	IsGitRepo bool
 	HasDeps   bool // whether deps were successfully computed
@@ -55,7 +126,61 @@ type State struct {
 	UpdatedAt    time.Time           `json:"updated_at"`
 	FileCount    int                 `json:"file_count"`
 	Hubs         []string            `json:"hubs"`
-	Importers    map[string][]string `json:"importers"`     // file -> files that import it
-	Imports      map[string][]string `json:"imports"`       // file -> files it imports
-	RecentEvents []Event             `json:"recent_events"` // last 50 events for timeline
+	Importers    map[string][]string `json:"importers"`            // file -> files that import it
+	Imports      map[string][]string `json:"imports"`              // file -> files it imports
+	RecentEvents []Event             `json:"recent_events"`        // last 50 events for timeline
+	WatchMode    string              `json:"watch_mode,omitempty"` // ModeNotify, ModePolling or ModeMixed
+}
+
+// eventBufferSize is how many events a daemon keeps in memory; older ones
+// are only in the event log
+const eventBufferSize = 1000
+
+// streamBuffer is how many events a /events/stream subscriber may fall
+// behind by before its stream is ended
+const streamBuffer = 256
+
+// EventRing is a fixed-capacity ring buffer that keeps the newest events
+type EventRing struct {
+	events []Event
+	size   int
+	next   int // slot of the oldest event, overwritten next once full
+}
+
+// NewEventRing returns an empty ring holding up to size events
+func NewEventRing(size int) *EventRing {
+	return &EventRing{size: size}
+}
+
+// Add records e, replacing the oldest event when the ring is full
+func (r *EventRing) Add(e Event) {
+	if len(r.events) < r.size {
+		r.events = append(r.events, e)
+		return
+	}
+	r.events[r.next] = e
+	r.next = (r.next + 1) % r.size
+}
+
+// Len returns the number of events held
+func (r *EventRing) Len() int {
+	return len(r.events)
+}
+
+// At returns the i-th oldest event held
+func (r *EventRing) At(i int) Event {
+	return r.events[(r.next+i)%len(r.events)]
+}
+
+// Last returns the newest n events (all if n <= 0), oldest first, as a copy
+func (r *EventRing) Last(n int) []Event {
+	count := len(r.events)
+	if n > 0 && n < count {
+		count = n
+	}
+	out := make([]Event, count)
+	for i := range out {
+		out[i] = r.At(len(r.events) - count + i)
+	}
+	return out
 }
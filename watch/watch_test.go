@@ -1,10 +1,23 @@
 package watch
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
+
+	"codemap/config"
+	"codemap/scanner"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 // TestDaemonStartStop tests basic daemon lifecycle
@@ -378,3 +391,1495 @@ func TestCountLines(t *testing.T) {
 		})
 	}
 }
+
+// TestOnEvent tests that registered listeners see recorded events
+func TestOnEvent(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "codemap-watch-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	testFile := filepath.Join(tmpDir, "listen.go")
+	if err := os.WriteFile(testFile, []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	daemon, err := NewDaemon(tmpDir, false)
+	if err != nil {
+		t.Fatalf("NewDaemon failed: %v", err)
+	}
+
+	seen := make(chan Event, 10)
+	daemon.OnEvent(func(e Event) { seen <- e })
+
+	if err := daemon.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer daemon.Stop()
+
+	time.Sleep(500 * time.Millisecond)
+
+	if err := os.WriteFile(testFile, []byte("package main\n\nfunc f() {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+
+	select {
+	case e := <-seen:
+		if e.Path != "listen.go" {
+			t.Errorf("Expected event for listen.go, got %s", e.Path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Skip("fsnotify may not work reliably in temp directories on this platform")
+	}
+}
+
+// TestInMemoryDaemon tests that an in-memory daemon tracks files without writing .codemap/
+func TestInMemoryDaemon(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"b.go", "a.go"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("package main\n"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	daemon, err := NewDaemon(tmpDir, false)
+	if err != nil {
+		t.Fatalf("NewDaemon failed: %v", err)
+	}
+	daemon.SetInMemory(true)
+	if err := daemon.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer daemon.Stop()
+
+	files := daemon.Files()
+	if len(files) != 2 || files[0].Path != "a.go" || files[1].Path != "b.go" {
+		t.Errorf("Expected sorted [a.go b.go], got %v", files)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, ".codemap")); !os.IsNotExist(err) {
+		t.Error("In-memory daemon should not create .codemap/")
+	}
+}
+
+// TestReadEvents tests that events written to the event log read back
+func TestReadEvents(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, ".codemap"), 0755); err != nil {
+		t.Fatalf("Failed to create .codemap: %v", err)
+	}
+
+	daemon, err := NewDaemon(tmpDir, false)
+	if err != nil {
+		t.Fatalf("NewDaemon failed: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	daemon.logEvent(Event{Time: now.Add(-time.Hour), Op: "WRITE", Path: "old.go", Lines: 3, Delta: 1})
+	daemon.logEvent(Event{Time: now, Op: "WRITE", Path: "main.go", Lines: 42, Delta: -5, Dirty: true, IsHub: true, Importers: 4, RelatedHot: []string{"util.go"}})
+	daemon.logEvent(Event{Time: now, Op: "CREATE", Path: "new.go", Lines: 7})
+
+	events, err := ReadEvents(tmpDir, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("ReadEvents failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events since cutoff, got %d", len(events))
+	}
+	e := events[0]
+	if !e.Time.Equal(now) || e.Op != "WRITE" || e.Path != "main.go" || e.Lines != 42 || e.Delta != -5 || !e.Dirty ||
+		!e.IsHub || e.Importers != 4 || len(e.RelatedHot) != 1 {
+		t.Errorf("Unexpected first event: %+v", e)
+	}
+	if events[1].Path != "new.go" || events[1].Delta != 0 || events[1].Dirty {
+		t.Errorf("Unexpected second event: %+v", events[1])
+	}
+
+	all, err := ReadEvents(tmpDir, time.Time{})
+	if err != nil || len(all) != 3 {
+		t.Errorf("Expected all 3 events, got %d (%v)", len(all), err)
+	}
+
+	if events, err := ReadEvents(t.TempDir(), time.Time{}); err != nil || events != nil {
+		t.Errorf("Missing log should read as no events, got %v, %v", events, err)
+	}
+}
+
+// TestReadEventsLongLine tests that one oversized line is skipped instead
+// of failing the whole read
+func TestReadEventsLongLine(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, ".codemap"), 0755); err != nil {
+		t.Fatalf("Failed to create .codemap: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	log := newEventLog(EventLogPath(tmpDir))
+	log.append(Event{Time: now, Op: "WRITE", Path: "before.go"})
+	log.append(Event{Time: now, Op: "WRITE", Path: strings.Repeat("x", logMaxLine)})
+	log.append(Event{Time: now, Op: "WRITE", Path: "after.go"})
+
+	events, err := ReadEvents(tmpDir, time.Time{})
+	if err != nil {
+		t.Fatalf("ReadEvents failed: %v", err)
+	}
+	if len(events) != 2 || events[0].Path != "before.go" || events[1].Path != "after.go" {
+		t.Errorf("Expected the events around the long line, got %d events", len(events))
+	}
+}
+
+// TestMigrateLegacyLog tests that the old text events.log is converted to
+// events.jsonl and removed
+func TestMigrateLegacyLog(t *testing.T) {
+	tmpDir := t.TempDir()
+	codemapDir := filepath.Join(tmpDir, ".codemap")
+	if err := os.MkdirAll(codemapDir, 0755); err != nil {
+		t.Fatalf("Failed to create .codemap: %v", err)
+	}
+	legacy := filepath.Join(codemapDir, "events.log")
+	lines := "2025-12-06 14:46:13 | WRITE  | main.go                                  |   42 |     +3 | dirty\n" +
+		"not an event\n" +
+		"2025-12-06 14:47:01 | REMOVE | old.go                                   |    0 |        | \n"
+	if err := os.WriteFile(legacy, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newEventLog(EventLogPath(tmpDir)).migrate(); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("migrate should remove events.log")
+	}
+	events, err := ReadEvents(tmpDir, time.Time{})
+	if err != nil || len(events) != 2 {
+		t.Fatalf("Expected 2 converted events, got %v (%v)", events, err)
+	}
+	want := time.Date(2025, 12, 6, 14, 46, 13, 0, time.Local)
+	if e := events[0]; !e.Time.Equal(want) || e.Op != "WRITE" || e.Path != "main.go" || e.Lines != 42 || e.Delta != 3 || !e.Dirty {
+		t.Errorf("Unexpected first event: %+v", e)
+	}
+	if e := events[1]; e.Op != "REMOVE" || e.Path != "old.go" || e.Delta != 0 || e.Dirty {
+		t.Errorf("Unexpected second event: %+v", e)
+	}
+
+	// Next to an existing events.jsonl, the older text log is only removed
+	if err := os.WriteFile(legacy, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newEventLog(EventLogPath(tmpDir)).migrate(); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("migrate should remove events.log")
+	}
+	if events, _ := ReadEvents(tmpDir, time.Time{}); len(events) != 2 {
+		t.Errorf("Expected the JSONL log unchanged, got %d events", len(events))
+	}
+}
+
+// TestQueryAPI tests that a serving daemon answers client queries
+func TestQueryAPI(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	daemon, err := NewDaemon(tmpDir, false)
+	if err != nil {
+		t.Fatalf("NewDaemon failed: %v", err)
+	}
+	if err := daemon.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := daemon.Serve(); err != nil {
+		daemon.Stop()
+		t.Fatalf("Serve failed: %v", err)
+	}
+
+	client := NewClient(tmpDir)
+	h, err := client.Health()
+	if err != nil {
+		daemon.Stop()
+		t.Fatalf("Health failed: %v", err)
+	}
+	if h.PID != os.Getpid() || h.Files != 1 || h.Root != daemon.root {
+		t.Errorf("Unexpected health: %+v", h)
+	}
+
+	daemon.graph.mu.Lock()
+	now := time.Now()
+	daemon.graph.Events.Add(Event{Time: now.Add(-time.Hour), Op: "WRITE", Path: "old.go"})
+	daemon.graph.Events.Add(Event{Time: now, Op: "WRITE", Path: "main.go", Delta: 2})
+	daemon.graph.mu.Unlock()
+
+	events, err := client.Events(now.Add(-time.Minute), 0)
+	if err != nil || len(events) != 1 || events[0].Path != "main.go" || events[0].Delta != 2 {
+		t.Errorf("Expected the main.go event, got %v (%v)", events, err)
+	}
+	if events, err := client.Events(time.Time{}, 1); err != nil || len(events) != 1 || events[0].Path != "main.go" {
+		t.Errorf("Expected only the newest event, got %v (%v)", events, err)
+	}
+	if fc, err := client.FileContext("main.go"); err != nil || fc.Path != "main.go" || fc.IsHub {
+		t.Errorf("Unexpected file context: %+v (%v)", fc, err)
+	}
+	if hubs, err := client.Hubs(); err != nil || len(hubs) != 0 {
+		t.Errorf("Expected no hubs, got %v (%v)", hubs, err)
+	}
+
+	stream, err := client.Subscribe(context.Background())
+	if err != nil {
+		daemon.Stop()
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	defer stream.Close()
+	daemon.notify(Event{Time: now, Op: "CREATE", Path: "new.go"})
+	if e, err := stream.Next(); err != nil || e.Op != "CREATE" || e.Path != "new.go" {
+		t.Errorf("Expected the streamed CREATE event, got %+v (%v)", e, err)
+	}
+
+	daemon.Stop()
+	if _, err := stream.Next(); err == nil {
+		t.Error("The event stream should end after Stop")
+	}
+	if _, err := client.Health(); err == nil {
+		t.Error("Health should fail after Stop")
+	}
+	if _, err := os.Stat(SocketPath(tmpDir)); !os.IsNotExist(err) {
+		t.Error("Stop should remove the socket")
+	}
+}
+
+// TestSocketPathLength tests that long roots get a short socket path
+func TestSocketPathLength(t *testing.T) {
+	short := SocketPath("/tmp/project")
+	if short != filepath.Join("/tmp/project", ".codemap", "watch.sock") {
+		t.Errorf("Expected socket in .codemap/, got %s", short)
+	}
+
+	long := "/" + strings.Repeat("nested/", 20) + "project"
+	path := SocketPath(long)
+	if len(path) > maxSocketPath {
+		t.Errorf("Socket path too long (%d): %s", len(path), path)
+	}
+	if path != SocketPath(long) || path == SocketPath(long+"2") {
+		t.Error("Socket path should be stable and distinct per root")
+	}
+}
+
+// TestEventRing tests that the ring keeps only the newest events in order
+func TestEventRing(t *testing.T) {
+	ring := NewEventRing(3)
+	if got := ring.Last(0); len(got) != 0 {
+		t.Errorf("Expected empty ring, got %v", got)
+	}
+
+	for _, p := range []string{"a", "b", "c", "d", "e"} {
+		ring.Add(Event{Path: p})
+	}
+	if ring.Len() != 3 {
+		t.Fatalf("Expected 3 events, got %d", ring.Len())
+	}
+
+	var paths []string
+	for _, e := range ring.Last(0) {
+		paths = append(paths, e.Path)
+	}
+	if strings.Join(paths, ",") != "c,d,e" {
+		t.Errorf("Expected c,d,e, got %v", paths)
+	}
+	if last := ring.Last(2); len(last) != 2 || last[0].Path != "d" || last[1].Path != "e" {
+		t.Errorf("Expected d,e, got %v", last)
+	}
+	if ring.At(0).Path != "c" {
+		t.Errorf("Expected oldest c, got %s", ring.At(0).Path)
+	}
+}
+
+// TestEventLogRotation tests size-based rotation and age-based pruning
+func TestEventLogRotation(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, ".codemap"), 0755); err != nil {
+		t.Fatalf("Failed to create .codemap: %v", err)
+	}
+	path := EventLogPath(tmpDir)
+	log := newEventLog(path)
+	log.maxSize = 300
+	log.maxFiles = 2
+
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	for i := 0; i < 20; i++ {
+		if err := log.append(Event{Time: start.Add(time.Duration(i) * time.Second), Op: "WRITE", Path: "main.go", Lines: i}); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("Expected %s: %v", p, err)
+		}
+		if info.Size() >= 300 {
+			t.Errorf("%s should be below the size limit, is %d bytes", p, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Only 2 rotated files should be kept")
+	}
+
+	// Rotated files are read too, oldest first, ending with the newest event
+	events, err := ReadEvents(tmpDir, time.Time{})
+	if err != nil || len(events) == 0 || len(events) >= 20 {
+		t.Fatalf("Expected some but not all events, got %d (%v)", len(events), err)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Lines != events[i-1].Lines+1 {
+			t.Fatalf("Events out of order: %d after %d", events[i].Lines, events[i-1].Lines)
+		}
+	}
+	if events[len(events)-1].Lines != 19 {
+		t.Errorf("Expected newest event last, got %d", events[len(events)-1].Lines)
+	}
+
+	// Logs untouched for longer than maxAge age out
+	old := time.Now().Add(-2 * logMaxAge)
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		os.Chtimes(p, old, old)
+	}
+	log.prune()
+	if events, _ := ReadEvents(tmpDir, time.Time{}); len(events) != 0 {
+		t.Errorf("Expected old logs pruned, got %d events", len(events))
+	}
+}
+
+// TestSessionSaved tests that a daemon run is saved as a session
+func TestSessionSaved(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	daemon, err := NewDaemon(tmpDir, false)
+	if err != nil {
+		t.Fatalf("NewDaemon failed: %v", err)
+	}
+	if err := daemon.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	sessions, err := ListSessions(tmpDir)
+	if err != nil || len(sessions) != 1 || !sessions[0].End.IsZero() {
+		t.Fatalf("Expected one open session after Start, got %+v (%v)", sessions, err)
+	}
+
+	now := time.Now()
+	daemon.graph.mu.Lock()
+	daemon.session.record(Event{Time: now, Op: "WRITE", Path: "util.go", Delta: 2})
+	daemon.session.record(Event{Time: now, Op: "WRITE", Path: "main.go", Delta: 5, IsHub: true})
+	daemon.session.record(Event{Time: now, Op: "WRITE", Path: "main.go", Delta: -1, IsHub: true})
+	daemon.graph.mu.Unlock()
+	daemon.Stop()
+
+	s, err := LoadSession(tmpDir, sessions[0].ID)
+	if err != nil {
+		t.Fatalf("LoadSession failed: %v", err)
+	}
+	if s.End.IsZero() || s.Events != 3 || s.Delta != 6 || s.HubEdits != 2 {
+		t.Errorf("Unexpected session: %+v", s)
+	}
+	if len(s.Files) != 2 || s.Files[0].Path != "main.go" || s.Files[0].Edits != 2 || s.Files[0].Delta != 4 || !s.Files[0].IsHub {
+		t.Errorf("Expected main.go first with 2 edits, got %+v", s.Files)
+	}
+	if _, err := LoadSession(tmpDir, "../state"); err == nil {
+		t.Error("Session ids with separators should be rejected")
+	}
+}
+
+// TestSessionIDsUnique tests that daemons started within the same second
+// don't overwrite each other's session
+func TestSessionIDsUnique(t *testing.T) {
+	tmpDir := t.TempDir()
+	seen := make(map[string]bool)
+	var first *Session
+	for i := 0; i < 3; i++ {
+		s := newSession(tmpDir, false)
+		if seen[s.ID] {
+			t.Fatalf("Session ID %s reused", s.ID)
+		}
+		seen[s.ID] = true
+		if first == nil {
+			first = s
+		} else if s.Start.Truncate(time.Second).Equal(first.Start.Truncate(time.Second)) && s.ID != fmt.Sprintf("%s-%d", first.ID, i+1) {
+			t.Errorf("Expected %s-%d for a session in the same second, got %s", first.ID, i+1, s.ID)
+		}
+		if err := s.save(tmpDir); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+	if sessions, err := ListSessions(tmpDir); err != nil || len(sessions) != 3 {
+		t.Errorf("Expected 3 saved sessions, got %d (%v)", len(sessions), err)
+	}
+}
+
+// newScannedDaemon returns an in-memory daemon that has scanned tmpDir but
+// isn't watching, so tests can feed it events directly
+func newScannedDaemon(t *testing.T, tmpDir string) *Daemon {
+	t.Helper()
+	daemon, err := NewDaemon(tmpDir, false)
+	if err != nil {
+		t.Fatalf("NewDaemon failed: %v", err)
+	}
+	t.Cleanup(func() { daemon.watcher.Close() })
+	daemon.SetInMemory(true)
+	if err := daemon.fullScan(context.Background()); err != nil {
+		t.Fatalf("fullScan failed: %v", err)
+	}
+	return daemon
+}
+
+func TestMoveDetection(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.go": "package main\n\nfunc main() { util() }\n",
+		"util.go": "package main\n\nfunc util() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(tmpDir, "lib"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	daemon := newScannedDaemon(t, tmpDir)
+	daemon.session = &Session{ID: "test", Start: time.Now()}
+	daemon.graph.mu.Lock()
+	daemon.graph.FileGraph = &scanner.FileGraph{
+		Imports:   map[string][]string{"main.go": {"util.go"}},
+		Importers: map[string][]string{"util.go": {"main.go"}},
+	}
+	daemon.graph.DepCtx = map[string]*DepContext{
+		"main.go": {Imports: []string{"util.go"}},
+		"util.go": {Importers: []string{"main.go"}},
+	}
+	daemon.graph.HasDeps = true
+	daemon.graph.mu.Unlock()
+
+	oldPath, newPath := filepath.Join(tmpDir, "util.go"), filepath.Join(tmpDir, "lib", "util.go")
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	daemon.handleEvent(fsnotify.Event{Name: oldPath, Op: fsnotify.Rename})
+	if n := len(daemon.GetEvents(0)); n != 0 {
+		t.Fatalf("Rename should wait for its create, got %d events", n)
+	}
+	daemon.handleEvent(fsnotify.Event{Name: newPath, Op: fsnotify.Create})
+
+	events := daemon.GetEvents(0)
+	if len(events) != 1 {
+		t.Fatalf("Expected one MOVE event, got %+v", events)
+	}
+	e := events[0]
+	if e.Op != "MOVE" || e.OldPath != "util.go" || e.Path != "lib/util.go" || e.Delta != 0 || e.Importers != 1 {
+		t.Errorf("Unexpected move event: %+v", e)
+	}
+	if got := e.DisplayPath(); got != "util.go -> lib/util.go" {
+		t.Errorf("DisplayPath() = %q", got)
+	}
+
+	g := daemon.GetGraph()
+	if _, ok := g.State["util.go"]; ok {
+		t.Error("State should no longer track the old path")
+	}
+	if g.State["lib/util.go"] == nil || g.Files["lib/util.go"] == nil {
+		t.Error("State and Files should track the new path")
+	}
+	if imports := g.FileGraph.Imports["main.go"]; len(imports) != 1 || imports[0] != "lib/util.go" {
+		t.Errorf("main.go should import lib/util.go, got %v", imports)
+	}
+	if ctx := g.DepCtx["lib/util.go"]; ctx == nil || len(ctx.Importers) != 1 || ctx.Importers[0] != "main.go" {
+		t.Errorf("DepCtx should move to the new path, got %+v", ctx)
+	}
+	if ctx := g.DepCtx["main.go"]; ctx == nil || len(ctx.Imports) != 1 || ctx.Imports[0] != "lib/util.go" {
+		t.Errorf("Importer DepCtx should point at the new path, got %+v", ctx)
+	}
+
+	s := daemon.Session()
+	if s.Moves != 1 || len(s.Files) != 1 || s.Files[0].Path != "lib/util.go" || s.Files[0].MovedFrom != "util.go" {
+		t.Errorf("Session should record the move, got %+v", s)
+	}
+}
+
+func TestMoveMatchedByContent(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := []byte("package main\n\nfunc util() {}\n")
+	oldPath, newPath := filepath.Join(tmpDir, "util.go"), filepath.Join(tmpDir, "helpers.go")
+	if err := os.WriteFile(oldPath, content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	daemon := newScannedDaemon(t, tmpDir)
+
+	// A copy and delete gives the file a new inode but the same content
+	if err := os.WriteFile(newPath, content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Remove(oldPath); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	daemon.handleEvent(fsnotify.Event{Name: oldPath, Op: fsnotify.Rename})
+	daemon.handleEvent(fsnotify.Event{Name: newPath, Op: fsnotify.Create})
+
+	events := daemon.GetEvents(0)
+	if len(events) != 1 || events[0].Op != "MOVE" || events[0].OldPath != "util.go" || events[0].Path != "helpers.go" {
+		t.Errorf("Expected util.go -> helpers.go, got %+v", events)
+	}
+}
+
+func TestUnmatchedRenameExpires(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldPath := filepath.Join(tmpDir, "util.go")
+	if err := os.WriteFile(oldPath, []byte("package main\n\nfunc util() {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	daemon := newScannedDaemon(t, tmpDir)
+
+	// Renamed out of the project
+	if err := os.Rename(oldPath, filepath.Join(t.TempDir(), "util.go")); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	daemon.handleEvent(fsnotify.Event{Name: oldPath, Op: fsnotify.Rename})
+
+	daemon.expireMoves(false)
+	if n := len(daemon.GetEvents(0)); n != 0 {
+		t.Fatalf("Rename should be held for moveWindow, got %d events", n)
+	}
+	if wait, ok := daemon.nextMoveExpiry(); !ok || wait > moveWindow {
+		t.Errorf("nextMoveExpiry() = %v, %v", wait, ok)
+	}
+
+	daemon.graph.mu.Lock()
+	daemon.pendingMoves[0].event.Time = time.Now().Add(-moveWindow)
+	daemon.graph.mu.Unlock()
+	daemon.expireMoves(false)
+
+	events := daemon.GetEvents(0)
+	if len(events) != 1 || events[0].Op != "RENAME" || events[0].Path != "util.go" || events[0].Delta != -3 {
+		t.Errorf("Expected a RENAME losing 3 lines, got %+v", events)
+	}
+	if _, ok := daemon.nextMoveExpiry(); ok {
+		t.Error("No renames should be pending")
+	}
+}
+
+func TestDiffSymbols(t *testing.T) {
+	before := []scanner.Symbol{
+		{Name: "ScanFiles", Kind: scanner.KindFunction, Scope: "global", Signature: "(root string) []FileInfo"},
+		{Name: "Stop", Kind: scanner.KindMethod, Scope: "struct:Daemon", Signature: "()"},
+		{Name: "Walker", Kind: scanner.KindClass, Scope: "global"},
+	}
+	after := []scanner.Symbol{
+		{Name: "ScanFiles", Kind: scanner.KindFunction, Scope: "global", Signature: "(ctx context.Context, root string) []FileInfo"},
+		{Name: "Stop", Kind: scanner.KindMethod, Scope: "struct:Daemon", Signature: "()"},
+		{Name: "walk", Kind: scanner.KindFunction, Scope: "global", Signature: "(dir string)"},
+	}
+
+	got := SummarizeSymbols(diffSymbols(before, after), 0)
+	want := "changed signature of `ScanFiles`, added function `walk`, removed class `Walker`"
+	if got != want {
+		t.Errorf("diffSymbols summary = %q, want %q", got, want)
+	}
+	if changes := diffSymbols(after, after); len(changes) != 0 {
+		t.Errorf("Expected no changes for identical symbols, got %+v", changes)
+	}
+	if got := SummarizeSymbols(diffSymbols(nil, after), 1); got != "added method `Daemon.Stop`, +2 more" {
+		t.Errorf("Unexpected capped summary %q", got)
+	}
+}
+
+func TestMergeSymbolChanges(t *testing.T) {
+	sig := func(name, old, cur string) SymbolChange {
+		return SymbolChange{Change: "signature", Kind: "function", Name: name, OldSignature: old, Signature: cur}
+	}
+	changes := []SymbolChange{
+		{Change: "added", Kind: "function", Name: "walk", Signature: "()"},
+		{Change: "removed", Kind: "function", Name: "old", Signature: "(a int)"},
+		sig("ScanFiles", "()", "(ctx)"),
+		sig("Stop", "()", "(force bool)"),
+	}
+	later := []SymbolChange{
+		sig("walk", "()", "(dir string)"),                                      // still added
+		{Change: "added", Kind: "function", Name: "old", Signature: "(a int)"}, // restored as it was
+		sig("ScanFiles", "(ctx)", "(ctx, root)"),                               // one net signature change
+		sig("Stop", "(force bool)", "()"),                                      // changed back
+	}
+
+	merged := MergeSymbolChanges(changes, later)
+	if len(merged) != 2 {
+		t.Fatalf("Expected 2 net changes, got %+v", merged)
+	}
+	if merged[0].Change != "added" || merged[0].Signature != "(dir string)" {
+		t.Errorf("walk should stay added with its new signature, got %+v", merged[0])
+	}
+	if merged[1] != sig("ScanFiles", "()", "(ctx, root)") {
+		t.Errorf("ScanFiles should keep its first old signature, got %+v", merged[1])
+	}
+
+	merged = MergeSymbolChanges(merged, []SymbolChange{{Change: "removed", Kind: "function", Name: "walk"}})
+	if len(merged) != 1 || merged[0].Name != "ScanFiles" {
+		t.Errorf("A function added and removed should drop out, got %+v", merged)
+	}
+}
+
+func TestSymbolChangeEvents(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(path, []byte("package main\n\nfunc run(name string) {}\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	daemon := newScannedDaemon(t, tmpDir)
+	daemon.computeSymbols(context.Background())
+	if daemon.sg == nil {
+		t.Skip("ast-grep not available")
+	}
+	defer daemon.sg.Close()
+
+	if err := os.WriteFile(path, []byte("package main\n\nfunc run(name string, verbose bool) {}\n\nfunc helper() {}\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+	daemon.handleEvent(fsnotify.Event{Name: path, Op: fsnotify.Write})
+
+	events := daemon.GetEvents(0)
+	if len(events) != 1 {
+		t.Fatalf("Expected one event, got %+v", events)
+	}
+	if got := SummarizeSymbols(events[0].Symbols, 0); got != "changed signature of `run`, added function `helper`" {
+		t.Errorf("Unexpected symbol changes %q", got)
+	}
+}
+
+// TestSymbolsKeptForEmptyProject tests that a project without sources at
+// startup keeps ast-grep for the files added later
+func TestSymbolsKeptForEmptyProject(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script as a fake ast-grep")
+	}
+	// An ast-grep that finds nothing
+	bin := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = --version ]; then echo 'ast-grep 0.39.0'; else echo '[]'; fi\n"
+	if err := os.WriteFile(filepath.Join(bin, "ast-grep"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	daemon := newScannedDaemon(t, t.TempDir())
+	daemon.computeSymbols(context.Background())
+	if daemon.sg == nil {
+		t.Fatal("An empty scan should keep ast-grep for later edits")
+	}
+	daemon.sg.Close()
+}
+
+func TestParseReflog(t *testing.T) {
+	line := "1111111111111111111111111111111111111111 2222222222222222222222222222222222222222 Ann <ann@example.com> 1760000000 +0200\tcheckout: moving from main to feature/x\n"
+	entry, ok := parseReflogLine(line)
+	if !ok || entry.oldCommit != strings.Repeat("1", 40) || entry.newCommit != strings.Repeat("2", 40) || entry.message != "checkout: moving from main to feature/x" {
+		t.Fatalf("parseReflogLine = %+v, %v", entry, ok)
+	}
+	if from, to, ok := checkoutBranches(entry.message); !ok || from != "main" || to != "feature/x" {
+		t.Errorf("checkoutBranches = %q, %q, %v", from, to, ok)
+	}
+	if entry, _ := parseReflogLine(strings.Repeat("0", 40) + " " + strings.Repeat("2", 40) + " Ann <a> 1 +0000\tcommit (initial): init"); entry.oldCommit != "" {
+		t.Errorf("The first commit should have no old commit, got %q", entry.oldCommit)
+	}
+	if _, ok := parseReflogLine("garbage"); ok {
+		t.Error("Lines without a message should be skipped")
+	}
+
+	for message, want := range map[string]string{
+		"commit: Fix parser":               "COMMIT",
+		"commit (amend): Fix parser":       "COMMIT",
+		"commit (merge): Merge branch 'x'": "MERGE",
+		"merge feature: Fast-forward":      "MERGE",
+		"pull: Fast-forward":               "MERGE",
+		"checkout: moving from a to b":     "CHECKOUT",
+		"reset: moving to HEAD~1":          "CHECKOUT",
+		"rebase (finish): returning to x":  "CHECKOUT",
+	} {
+		if got := classifyReflog(message); got != want {
+			t.Errorf("classifyReflog(%q) = %s, want %s", message, got, want)
+		}
+	}
+}
+
+func TestGitEventDisplay(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  string
+	}{
+		{Event{Op: "COMMIT", Branch: "main", Commit: "a9c6a04f00", Message: "commit: Fix parser"}, "main a9c6a04 Fix parser"},
+		{Event{Op: "CHECKOUT", Branch: "feature", OldBranch: "main", Files: 20}, "main -> feature (20 files)"},
+		{Event{Op: "CHECKOUT", Branch: "main", Commit: "bbbbbbbbbb", OldCommit: "aaaaaaaaaa", Message: "reset: moving to HEAD~1"}, "main aaaaaaa -> bbbbbbb"},
+		{Event{Op: "MERGE", Branch: "main", Commit: "cccccccccc", Message: "merge feature: Fast-forward", Files: 3}, "main ccccccc merge feature: Fast-forward (3 files)"},
+	}
+	for _, tt := range tests {
+		if got := tt.event.DisplayPath(); got != tt.want {
+			t.Errorf("DisplayPath() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+// TestGitCheckoutEvent checks that a branch switch becomes one CHECKOUT event
+// and a rescan instead of a WRITE per file
+func TestGitCheckoutEvent(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	tmpDir := t.TempDir()
+	gitCmd := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.email=test@example.com", "-c", "user.name=test"}, args...)...)
+		cmd.Dir = tmpDir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	gitCmd("init", "-q", "-b", "main")
+	for i := range 5 {
+		os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("f%d.go", i)), []byte("package main\n"), 0644)
+	}
+	gitCmd("add", ".")
+	gitCmd("commit", "-q", "-m", "init")
+	gitCmd("checkout", "-q", "-b", "feature")
+	for i := range 5 {
+		os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("f%d.go", i)), []byte("package main\n\nfunc f() {}\n"), 0644)
+	}
+	os.WriteFile(filepath.Join(tmpDir, "extra.go"), []byte("package main\n"), 0644)
+	gitCmd("add", ".")
+	gitCmd("commit", "-q", "-m", "feature work")
+	gitCmd("checkout", "-q", "main")
+
+	daemon, err := NewDaemon(tmpDir, false)
+	if err != nil {
+		t.Fatalf("NewDaemon failed: %v", err)
+	}
+	daemon.SetInMemory(true)
+	if err := daemon.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer daemon.Stop()
+	if daemon.git == nil {
+		t.Fatal("Expected the git dir to be watched")
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	gitCmd("checkout", "-q", "feature")
+
+	var events []Event
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		if events = daemon.GetEvents(0); len(events) > 0 {
+			break
+		}
+	}
+	if len(events) == 0 {
+		t.Skip("fsnotify may not work reliably in temp directories on this platform")
+	}
+	time.Sleep(500 * time.Millisecond)
+	events = daemon.GetEvents(0)
+
+	if len(events) != 1 {
+		t.Fatalf("Expected one CHECKOUT event, got %+v", events)
+	}
+	e := events[0]
+	if e.Op != "CHECKOUT" || e.OldBranch != "main" || e.Branch != "feature" || e.Files != 6 || e.Delta != 11 {
+		t.Errorf("Unexpected checkout event: %+v", e)
+	}
+	if n := daemon.FileCount(); n != 6 {
+		t.Errorf("Expected the rescan to find 6 files, got %d", n)
+	}
+}
+
+func TestWatchedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		".gitignore":            "build/\n*.gen.go\n",
+		".codemap/config.json":  `{"watch": {"include": [".vue"], "exclude": ["generated"]}}`,
+		"main.go":               "package main\n",
+		"api.gen.go":            "package main\n",
+		"App.vue":               "<template></template>\n",
+		"Program.cs":            "class Program {}\n",
+		"index.php":             "<?php\n",
+		"notes.txt":             "notes\n",
+		"build/out.go":          "package build\n",
+		"generated/types.go":    "package generated\n",
+		"target/debug/build.rs": "fn main() {}\n",
+		"lib/util.go":           "package lib\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	daemon := newScannedDaemon(t, tmpDir)
+	if err := daemon.addWatchDirs(); err != nil {
+		t.Fatalf("addWatchDirs failed: %v", err)
+	}
+
+	tracked := map[string]bool{
+		"main.go":               true,
+		"App.vue":               true,
+		"Program.cs":            true,
+		"index.php":             true,
+		"lib/util.go":           true,
+		"api.gen.go":            false,
+		"notes.txt":             false,
+		"build/out.go":          false,
+		"generated/types.go":    false,
+		"target/debug/build.rs": false,
+	}
+	for name, want := range tracked {
+		if got := daemon.isSourceFile(filepath.Join(tmpDir, filepath.FromSlash(name))); got != want {
+			t.Errorf("isSourceFile(%s) = %v, want %v", name, got, want)
+		}
+	}
+
+	watched := make(map[string]bool)
+	for _, path := range daemon.watcher.WatchList() {
+		if rel, err := filepath.Rel(tmpDir, path); err == nil {
+			watched[filepath.ToSlash(rel)] = true
+		}
+	}
+	for _, dir := range []string{".", "lib"} {
+		if !watched[dir] {
+			t.Errorf("%s should be watched", dir)
+		}
+	}
+	for _, dir := range []string{".codemap", "build", "generated", "target"} {
+		if watched[dir] {
+			t.Errorf("%s should not be watched", dir)
+		}
+	}
+}
+
+func TestPollFallback(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.go":     "package main\n",
+		"lib/util.go": "package lib\n",
+		"notes.txt":   "notes\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	daemon := newScannedDaemon(t, tmpDir)
+	if got := daemon.poller.mode(tmpDir); got != ModeNotify {
+		t.Errorf("mode = %q, want %q", got, ModeNotify)
+	}
+
+	// As if watching lib/ had hit the inotify limit
+	lib := filepath.Join(tmpDir, "lib")
+	daemon.poller.roots[lib] = watchLimitReason(fmt.Errorf("add: %w", syscall.ENOSPC))
+	daemon.snapshotPolled(lib)
+	if got := daemon.poller.mode(tmpDir); got != ModeMixed {
+		t.Errorf("mode = %q, want %q", got, ModeMixed)
+	}
+	if dirs := daemon.poller.dirs(tmpDir); len(dirs) != 1 || dirs[0].Path != "lib" || !strings.Contains(dirs[0].Reason, "inotify") {
+		t.Errorf("unexpected polled dirs: %+v", dirs)
+	}
+	if polled, err := daemon.addWatch(filepath.Join(lib, "sub")); !polled || err != nil {
+		t.Errorf("addWatch below a polled dir = %v, %v; want polled", polled, err)
+	}
+	if events := daemon.poll(); len(events) != 0 {
+		t.Errorf("first poll should find no changes, got %v", events)
+	}
+
+	// Edit, create, move and remove files in the polled subtree
+	write := func(name, content string) {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	write("lib/util.go", "package lib\n\nfunc Util() {}\n")
+	write("lib/sub/new.go", "package sub\n")
+	write("lib/readme.txt", "not tracked\n")
+	for _, event := range daemon.poll() {
+		daemon.handleEvent(event)
+	}
+	if err := os.Rename(filepath.Join(lib, "sub", "new.go"), filepath.Join(lib, "moved.go")); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	for _, event := range daemon.poll() {
+		daemon.handleEvent(event)
+	}
+	if err := os.Remove(filepath.Join(lib, "util.go")); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	for _, event := range daemon.poll() {
+		daemon.handleEvent(event)
+	}
+
+	var got []string
+	for _, e := range daemon.GetEvents(0) {
+		got = append(got, e.Op+" "+e.DisplayPath())
+	}
+	want := []string{"CREATE lib/sub/new.go", "WRITE lib/util.go", "MOVE lib/sub/new.go -> lib/moved.go", "REMOVE lib/util.go"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+// TestPollRenameMatching tests that a polled delete is only paired with a
+// create of the same file, by inode or content, not of any file of its size
+func TestPollRenameMatching(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	write("a.go", "package a\n")
+	write("b.go", "package b\n\nfunc B() {}\n")
+
+	daemon := newScannedDaemon(t, tmpDir)
+	daemon.poller.roots[tmpDir] = "test"
+	daemon.snapshotPolled(tmpDir)
+
+	ops := func() map[string]fsnotify.Op {
+		got := make(map[string]fsnotify.Op)
+		for _, e := range daemon.poll() {
+			got[filepath.Base(e.Name)] = e.Op
+		}
+		return got
+	}
+
+	// An unrelated file of the same size (created first, so it can't reuse
+	// the inode) doesn't turn the delete into a rename
+	write("c.go", "package c\n")
+	if err := os.Remove(filepath.Join(tmpDir, "a.go")); err != nil {
+		t.Fatal(err)
+	}
+	if got := ops(); got["a.go"] != fsnotify.Remove || got["c.go"] != fsnotify.Create {
+		t.Errorf("Expected REMOVE a.go and CREATE c.go, got %v", got)
+	}
+
+	// A copy and delete is a new inode with the same content
+	data, err := os.ReadFile(filepath.Join(tmpDir, "b.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("copied.go", string(data))
+	if err := os.Remove(filepath.Join(tmpDir, "b.go")); err != nil {
+		t.Fatal(err)
+	}
+	if got := ops(); got["b.go"] != fsnotify.Rename || got["copied.go"] != fsnotify.Create {
+		t.Errorf("Expected RENAME b.go and CREATE copied.go, got %v", got)
+	}
+}
+
+func TestTriggerMatching(t *testing.T) {
+	t.Setenv("CODEMAP_HOME", t.TempDir())
+	root := t.TempDir()
+	cfg := writeTriggerConfig(t, root, []config.Trigger{
+		{Path: "go.mod", Command: "true"},
+		{Hub: true, Ops: []string{"write"}, Command: "true"},
+		{Path: "api/**", MinImporters: 2, Notify: "out.jsonl"},
+	})
+	if _, err := TrustTriggers(root); err != nil {
+		t.Fatal(err)
+	}
+	trs := newTriggers(root, cfg, false)
+
+	tests := []struct {
+		event Event
+		want  []bool
+	}{
+		{Event{Op: "WRITE", Path: "go.mod"}, []bool{true, false, false}},
+		{Event{Op: "WRITE", Path: "scanner/types.go", IsHub: true, Importers: 5}, []bool{false, true, false}},
+		{Event{Op: "CREATE", Path: "scanner/types.go", IsHub: true, Importers: 5}, []bool{false, false, false}},
+		{Event{Op: "WRITE", Path: "api/v1/user.go", Importers: 2}, []bool{false, false, true}},
+		{Event{Op: "WRITE", Path: "api/v1/user.go", Importers: 1}, []bool{false, false, false}},
+		{Event{Op: "MOVE", Path: "internal/user.go", OldPath: "api/user.go", Importers: 2}, []bool{false, false, true}},
+	}
+	for _, tt := range tests {
+		for i, tr := range trs.list {
+			if got := tr.matches(tt.event); got != tt.want[i] {
+				t.Errorf("trigger %d matches(%s %s) = %v, want %v", i, tt.event.Op, tt.event.DisplayPath(), got, tt.want[i])
+			}
+		}
+	}
+
+	if !trs.tracks("go.mod") || trs.tracks("go.sum") {
+		t.Error("trigger paths should be tracked, and only those")
+	}
+}
+
+func TestTriggerActions(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	t.Setenv("CODEMAP_HOME", t.TempDir())
+	root := t.TempDir()
+	cfg := writeTriggerConfig(t, root, []config.Trigger{
+		{Name: "deps", Path: "go.mod", Command: `cat > stdin.jsonl; echo "$CODEMAP_TRIGGER $CODEMAP_EVENTS $CODEMAP_PATH"`, Debounce: config.Duration(50 * time.Millisecond)},
+		{Name: "notes", Notify: "notes/events.jsonl", Debounce: config.Duration(50 * time.Millisecond)},
+		{Name: "slow", Path: "slow.go", Command: "sleep 10", Debounce: config.Duration(time.Millisecond)},
+	})
+	if _, err := TrustTriggers(root); err != nil {
+		t.Fatal(err)
+	}
+	trs := newTriggers(root, cfg, false)
+
+	// Three quick writes fire each trigger once
+	for _, path := range []string{"go.mod", "go.mod", "main.go"} {
+		trs.handle(Event{Time: time.Now(), Op: "WRITE", Path: path})
+	}
+	trs.handle(Event{Time: time.Now(), Op: "WRITE", Path: "slow.go"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	var logged string
+	for time.Now().Before(deadline) {
+		data, _ := os.ReadFile(TriggersLogPath(root))
+		if logged = string(data); strings.Contains(logged, "deps 2 go.mod") {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !strings.Contains(logged, "deps: 2 event(s), last WRITE go.mod; ok") || !strings.Contains(logged, "deps 2 go.mod") {
+		t.Errorf("unexpected triggers.log:\n%s", logged)
+	}
+	stdin, _ := os.ReadFile(filepath.Join(root, "stdin.jsonl"))
+	if lines := strings.Count(string(stdin), "\n"); lines != 2 || !strings.Contains(string(stdin), `"path":"go.mod"`) {
+		t.Errorf("command should get both events as JSON lines, got:\n%s", stdin)
+	}
+	notes, _ := os.ReadFile(filepath.Join(root, "notes", "events.jsonl"))
+	if lines := strings.Count(string(notes), "\n"); lines != 4 {
+		t.Errorf("notify file should have all 4 events, got:\n%s", notes)
+	}
+
+	// Stopping kills the slow command instead of waiting for it
+	start := time.Now()
+	trs.stop()
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("stop took %v", elapsed)
+	}
+	data, _ := os.ReadFile(TriggersLogPath(root))
+	if !strings.Contains(string(data), "slow: 1 event(s), last WRITE slow.go; killed") {
+		t.Errorf("slow command should be logged as killed:\n%s", data)
+	}
+}
+
+// writeTriggerConfig saves triggers as root's .codemap/config.json
+func writeTriggerConfig(t *testing.T, root string, triggers []config.Trigger) config.Watch {
+	t.Helper()
+	cfg := config.Config{Watch: config.Watch{Triggers: triggers}}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, ".codemap"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.Path(root), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Watch
+}
+
+func TestUntrustedTriggers(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	t.Setenv("CODEMAP_HOME", t.TempDir())
+	root := t.TempDir()
+	external := filepath.Join(t.TempDir(), "events.jsonl")
+	cfg := writeTriggerConfig(t, root, []config.Trigger{
+		{Name: "build", Command: "touch ran", Notify: "notes.jsonl", Debounce: config.Duration(time.Millisecond)},
+		{Name: "elsewhere", Notify: external, Debounce: config.Duration(time.Millisecond)},
+	})
+
+	// A cloned config's commands and notify files don't run, not even a
+	// notify file inside the project
+	trs := newTriggers(root, cfg, false)
+	if trs.count() != 0 || trs.untrustedCount() != 3 {
+		t.Fatalf("untrusted config: got %d triggers, %d untrusted; want 0, 3", trs.count(), trs.untrustedCount())
+	}
+	trs.handle(Event{Time: time.Now(), Op: "WRITE", Path: "main.go"})
+	time.Sleep(100 * time.Millisecond)
+	trs.stop()
+	for _, path := range []string{filepath.Join(root, "ran"), filepath.Join(root, "notes.jsonl"), external} {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("untrusted trigger wrote %s", path)
+		}
+	}
+	if actions, err := UntrustedTriggers(root); err != nil || len(actions) != 3 {
+		t.Errorf("UntrustedTriggers = %v, %v; want 3 actions", actions, err)
+	}
+
+	// Trusting lets them run, until the command changes
+	if actions, err := TrustTriggers(root); err != nil || len(actions) != 3 {
+		t.Fatalf("TrustTriggers = %v, %v", actions, err)
+	}
+	if trs := newTriggers(root, cfg, false); trs.count() != 2 || trs.untrustedCount() != 0 {
+		t.Errorf("trusted config: got %d triggers, %d untrusted; want 2, 0", trs.count(), trs.untrustedCount())
+	}
+	if actions, err := UntrustedTriggers(root); err != nil || actions != nil {
+		t.Errorf("UntrustedTriggers after trust = %v, %v", actions, err)
+	}
+	cfg.Triggers[0].Command = "touch ran; curl example.com"
+	cfg = writeTriggerConfig(t, root, cfg.Triggers)
+	if trs := newTriggers(root, cfg, false); trs.untrustedCount() != 3 {
+		t.Errorf("changed command should be untrusted again, got %d untrusted", trs.untrustedCount())
+	}
+
+	// Untrusting forgets the record
+	if _, err := TrustTriggers(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := UntrustTriggers(root); err != nil {
+		t.Fatal(err)
+	}
+	if trs := newTriggers(root, cfg, false); trs.untrustedCount() != 3 {
+		t.Errorf("untrusted config should not run, got %d untrusted", trs.untrustedCount())
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	t.Setenv("CODEMAP_HOME", t.TempDir())
+	project := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(project, "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "pkg", "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sup := NewSupervisor(false)
+	if err := sup.Serve(); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	defer sup.Stop()
+	if SupervisorPID() != os.Getpid() {
+		t.Fatalf("SupervisorPID = %d, want %d", SupervisorPID(), os.Getpid())
+	}
+
+	// Projects added through the API are watched in this process
+	client := NewSupervisorClient()
+	if err := client.Add(project); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if !WaitRunning(ctx, project) {
+		t.Fatal("supervised project never started")
+	}
+	h, err := NewClient(project).Health()
+	if err != nil || !h.Supervised || h.PID != os.Getpid() {
+		t.Fatalf("project health = %+v, %v; want supervised by this process", h, err)
+	}
+	projects, err := client.Projects()
+	if err != nil || len(projects) != 1 || projects[0].Status != ProjectRunning || projects[0].Health.Files != 1 {
+		t.Fatalf("Projects = %+v, %v", projects, err)
+	}
+	if registered, _ := Projects(); len(registered) != 1 || registered[0] != project {
+		t.Errorf("registered projects = %v", registered)
+	}
+
+	// A path inside the project finds it
+	if root, ok := WatchedRoot(filepath.Join(project, "pkg", "main.go")); !ok || root != project {
+		t.Errorf("WatchedRoot = %q, %v; want %q", root, ok, project)
+	}
+
+	// Stop goes through the supervisor instead of signaling this process
+	if err := Stop(project); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if IsRunning(project) {
+		t.Error("project should no longer be watched")
+	}
+	if registered, _ := Projects(); len(registered) != 0 {
+		t.Errorf("stopped project should be unregistered, got %v", registered)
+	}
+	if err := client.Add(filepath.Join(project, "missing")); err == nil {
+		t.Error("adding a missing directory should fail")
+	}
+}
+
+func TestDaemonLock(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := NewDaemon(tmpDir, false)
+	if err != nil {
+		t.Fatalf("NewDaemon failed: %v", err)
+	}
+	if err := first.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := WritePID(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if !IsRunning(tmpDir) {
+		t.Fatal("daemon holding the lock should be running")
+	}
+
+	// A second daemon for the same project can't start
+	second, err := NewDaemon(tmpDir, false)
+	if err != nil {
+		t.Fatalf("NewDaemon failed: %v", err)
+	}
+	if err := second.Start(); !errors.Is(err, ErrAlreadyRunning) {
+		t.Fatalf("second Start = %v, want ErrAlreadyRunning", err)
+	}
+	second.watcher.Close()
+
+	// Stop removes the PID file and releases the lock
+	first.Stop()
+	if _, err := ReadPID(tmpDir); err == nil {
+		t.Error("Stop should remove the PID file")
+	}
+	if held, known := lockHeld(LockPath(tmpDir)); held || !known {
+		t.Errorf("lockHeld after Stop = %v, %v", held, known)
+	}
+
+	// A PID file whose daemon is gone doesn't count, even if its PID is
+	// alive: the lock is free
+	if err := WritePID(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if IsRunning(tmpDir) {
+		t.Error("PID file without a lock holder should not be running")
+	}
+
+	// Without a lock file, a PID reused by another process is caught by
+	// its start time
+	os.Remove(LockPath(tmpDir))
+	pidFile := filepath.Join(tmpDir, ".codemap", "watch.pid")
+	os.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n%s\n", os.Getpid(), "1")), 0644)
+	if processStartTime(os.Getpid()) != "" && IsRunning(tmpDir) {
+		t.Error("PID with a different start time should not be running")
+	}
+	if err := WritePID(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if !IsRunning(tmpDir) {
+		t.Error("without a lock file, a live PID with its start time should be running")
+	}
+}
+
+func TestStopProcess(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	lockPath := filepath.Join(t.TempDir(), "watch.lock")
+
+	// Exits on SIGTERM
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go cmd.Wait()
+	killed, err := stopProcess(cmd.Process.Pid, lockPath, 5*time.Second)
+	if err != nil || killed {
+		t.Errorf("stopProcess = %v, %v; want a graceful stop", killed, err)
+	}
+
+	// Ignores SIGTERM, so it is killed after the timeout
+	cmd = exec.Command("sh", "-c", "trap '' TERM; while :; do sleep 0.1; done")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go cmd.Wait()
+	time.Sleep(100 * time.Millisecond) // let the trap be set
+	start := time.Now()
+	killed, err = stopProcess(cmd.Process.Pid, lockPath, 300*time.Millisecond)
+	if err != nil || !killed {
+		t.Errorf("stopProcess = %v, %v; want it killed", killed, err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("killed after %v, before the timeout", elapsed)
+	}
+	if processAlive(cmd.Process.Pid) {
+		t.Error("process should be gone")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "main.go")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := newHistory(root, config.History{}, false)
+	if err := h.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	write("package main\n")
+	h.handle(Event{Op: "CREATE", Path: "main.go"})
+	write("package main\n\nfunc main() {}\n")
+	h.handle(Event{Op: "WRITE", Path: "main.go"})
+	h.handle(Event{Op: "WRITE", Path: "main.go"}) // unchanged: no new version
+	h.handle(Event{Op: "REMOVE", Path: "main.go"})
+
+	versions, err := ReadHistory(root, "main.go")
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("ReadHistory = %+v, %v; want 2 versions", versions, err)
+	}
+	if v := versions[0]; v.Version != 2 || v.Op != "WRITE" || v.Lines != 3 || v.Delta != 2 {
+		t.Errorf("unexpected newest version: %+v", v)
+	}
+	data, err := HistoryContent(root, versions[1])
+	if err != nil || string(data) != "package main\n" {
+		t.Errorf("v1 content = %q, %v", data, err)
+	}
+
+	// Restoring saves the content it replaces first
+	write("lost work\n")
+	restored, saved, err := Restore(root, "main.go", 1)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if got, _ := os.ReadFile(file); string(got) != "package main\n" || restored.Version != 1 {
+		t.Errorf("restored %q from v%d", got, restored.Version)
+	}
+	if data, _ := HistoryContent(root, saved); string(data) != "lost work\n" || saved.Version != 3 {
+		t.Errorf("saved v%d = %q, want v3 with the replaced content", saved.Version, data)
+	}
+	if _, _, err := Restore(root, "main.go", 9); !errors.Is(err, ErrNoVersion) {
+		t.Errorf("restoring a missing version = %v, want ErrNoVersion", err)
+	}
+	if got, ok := HistoryRoot(filepath.Join(root, "pkg")); !ok || got != root {
+		t.Errorf("HistoryRoot = %q, %v", got, ok)
+	}
+
+	// Pruning drops old versions and the objects only they used
+	versions, _ = readVersions(root)
+	versions[0].Time = time.Now().Add(-30 * 24 * time.Hour)
+	if err := writeVersions(root, versions); err != nil {
+		t.Fatal(err)
+	}
+	h = newHistory(root, config.History{}, false)
+	if err := h.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, err := FindVersion(root, "main.go", 1); !errors.Is(err, ErrNoVersion) {
+		t.Errorf("v1 should be pruned, got %v", err)
+	}
+	if h.latest["main.go"].Version != 4 {
+		t.Errorf("latest = %+v, want v4 (the restore)", h.latest["main.go"])
+	}
+	// v1's content survives: the restore (v4) uses it too
+	if _, err := os.Stat(objectPath(root, versions[0].Hash)); err != nil {
+		t.Errorf("object still in use was removed: %v", err)
+	}
+
+	h.maxSize = 0
+	if err := h.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if versions, _ := readVersions(root); len(versions) != 0 {
+		t.Errorf("size limit left %d versions", len(versions))
+	}
+	if _, err := os.Stat(objectPath(root, HashContent([]byte("lost work\n")))); !os.IsNotExist(err) {
+		t.Errorf("unused object should be removed, got %v", err)
+	}
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "main.go")
+	if err := os.WriteFile(file, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := newHistory(root, config.History{}, false)
+	if err := h.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	h.handle(Event{Op: "CREATE", Path: "main.go"})
+	if err := os.WriteFile(file, []byte("current\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.Path(root), []byte(`{"watch": {"history": {"disabled": true}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Refused the same way with and without a daemon, leaving the file and
+	// its history alone
+	check := func(how string) {
+		t.Helper()
+		if _, err := Snapshot(root, "main.go", "WRITE"); !errors.Is(err, ErrHistoryDisabled) {
+			t.Errorf("%s: Snapshot = %v, want ErrHistoryDisabled", how, err)
+		}
+		if _, _, err := Restore(root, "main.go", 1); !errors.Is(err, ErrHistoryDisabled) {
+			t.Errorf("%s: Restore = %v, want ErrHistoryDisabled", how, err)
+		}
+		if got, _ := os.ReadFile(file); string(got) != "current\n" {
+			t.Errorf("%s: file changed to %q", how, got)
+		}
+		if versions, _ := ReadHistory(root, "main.go"); len(versions) != 1 {
+			t.Errorf("%s: history has %d versions, want 1", how, len(versions))
+		}
+	}
+	check("no daemon")
+
+	daemon, err := NewDaemon(root, false)
+	if err != nil {
+		t.Fatalf("NewDaemon failed: %v", err)
+	}
+	if err := daemon.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer daemon.Stop()
+	if err := daemon.Serve(); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	check("daemon running")
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []byte("one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n")
+	b := []byte("one\n2\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n")
+	want := `--- a
++++ b
+@@ -1,5 +1,5 @@
+ one
+-two
++2
+ three
+ four
+ five
+@@ -8,3 +8,4 @@
+ eight
+ nine
+ ten
++eleven
+`
+	if got := UnifiedDiff(a, b, "a", "b"); got != want {
+		t.Errorf("UnifiedDiff =\n%s\nwant\n%s", got, want)
+	}
+	if got := UnifiedDiff(a, a, "a", "b"); got != "" {
+		t.Errorf("identical texts should have no diff, got\n%s", got)
+	}
+	if got := UnifiedDiff(nil, []byte("new\n"), "a", "b"); got != "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+new\n" {
+		t.Errorf("diff from empty =\n%s", got)
+	}
+}